@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/inelson/finguard/internal/config"
+	"github.com/inelson/finguard/internal/retention"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/migrations"
+)
+
+// runCheckConfig checks the settings as the server would read them, then
+// that the database opens and its schema is clean, without migrating it. It
+// fails if there is any problem.
+func runCheckConfig(args []string) error {
+	cfg := config.Load()
+	if err := newFlagSet("check-config", "[flags]", cfg).Parse(args); err != nil {
+		return err
+	}
+
+	var problems []error
+	for _, ignored := range config.IgnoredEnv() {
+		fmt.Println("warning: ignored", ignored)
+	}
+	if err := cfg.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := retention.ParseRules(cfg.CostRetention); err != nil {
+		problems = append(problems, fmt.Errorf("FINGUARD_COST_RETENTION: %w", err))
+	}
+	if cfg.CostPartitionRetention != "" {
+		if _, err := retention.ParseAge(cfg.CostPartitionRetention); err != nil {
+			problems = append(problems, fmt.Errorf("FINGUARD_COST_PARTITION_RETENTION: %w", err))
+		}
+	}
+	if err := checkDatabase(cfg.DatabaseDSN); err != nil {
+		problems = append(problems, err)
+	}
+
+	if len(problems) > 0 {
+		for _, err := range problems {
+			fmt.Println("error:", err)
+		}
+		return errors.New("configuration has problems")
+	}
+	fmt.Println("configuration OK")
+	return nil
+}
+
+// checkDatabase opens the database and reports a schema that is dirty or
+// behind the migrations.
+func checkDatabase(dsn string) error {
+	if dsn == "" {
+		return nil
+	}
+	db, err := store.New(dsn)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	status, err := db.MigrationStatus(migrations.FS)
+	if err != nil {
+		return fmt.Errorf("read migration status: %w", err)
+	}
+	switch {
+	case status.Dirty:
+		return fmt.Errorf("database is dirty at version %d: repair it, then run finguard migrate force", status.Version)
+	case status.Version < status.Latest:
+		fmt.Printf("database is at version %d of %d; finguard serve or finguard migrate up applies the rest\n", status.Version, status.Latest)
+	default:
+		fmt.Printf("database is at version %d\n", status.Version)
+	}
+	return nil
+}
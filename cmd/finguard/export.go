@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/config"
+	"github.com/inelson/finguard/internal/export"
+	"github.com/inelson/finguard/internal/store"
+)
+
+// runExport writes the cost records of a project, oldest first, in the
+// format the export endpoint would, to --out or stdout.
+func runExport(args []string) error {
+	cfg := config.Load()
+	fs := newFlagSet("export", "[flags] --project <id> [--format csv|ndjson|parquet] [--out <file>]", cfg)
+	var q store.CostQuery
+	fs.StringVar(&q.ProjectID, "project", "", "ID of the project to export")
+	formatName := fs.String("format", string(export.FormatCSV), "csv, ndjson or parquet")
+	out := fs.String("out", "", "file to write; defaults to stdout")
+	fs.StringVar(&q.Provider, "provider", "", "only records of this provider")
+	fs.StringVar(&q.Service, "service", "", "only records of this service")
+	fs.StringVar(&q.Category, "category", "", "only records of this category")
+	fs.StringVar(&q.Region, "region", "", "only records of this region")
+	fs.Func("label", "only records carrying the label key=value; repeat to require several", func(s string) error {
+		k, v, ok := strings.Cut(s, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("invalid label %q: must be key=value", s)
+		}
+		if q.Labels == nil {
+			q.Labels = make(map[string]string)
+		}
+		q.Labels[k] = v
+		return nil
+	})
+	fs.Func("from", "range start, a date (2006-01-02) or an RFC 3339 time", func(s string) (err error) {
+		q.StartTime, err = parseTime(s)
+		return err
+	})
+	fs.Func("to", "range end (exclusive), a date (2006-01-02) or an RFC 3339 time", func(s string) (err error) {
+		q.EndTime, err = parseTime(s)
+		return err
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if q.ProjectID == "" {
+		return errors.New("--project is required")
+	}
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	logger := newLogger(cfg, os.Stderr)
+
+	db, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	project, err := db.GetProject(ctx, q.ProjectID)
+	if err != nil {
+		return fmt.Errorf("get project: %w", err)
+	}
+	if project == nil {
+		return fmt.Errorf("project %s not found", q.ProjectID)
+	}
+
+	var labelKeys []string
+	if format != export.FormatNDJSON {
+		if labelKeys, err = db.CostLabelKeys(ctx, q); err != nil {
+			return fmt.Errorf("list label keys: %w", err)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if *out != "" {
+		if file, err = os.Create(*out); err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	audit.NewRecorder(db, logger).Record(ctx, cliActor, audit.Event{
+		Action:     "costs.export",
+		TargetType: audit.TargetProject,
+		TargetID:   q.ProjectID,
+		ProjectID:  q.ProjectID,
+		After:      map[string]string{"format": string(format), "query": strings.Join(args, " ")},
+	})
+
+	ew, err := export.NewWriter(w, format, labelKeys)
+	if err != nil {
+		return err
+	}
+	if err := db.ExportCostRecords(ctx, q, ew.Write); err != nil {
+		return fmt.Errorf("export cost records: %w", err)
+	}
+	if err := ew.Close(); err != nil {
+		return err
+	}
+	if file != nil {
+		return file.Close()
+	}
+	return nil
+}
@@ -1,18 +1,16 @@
 package main
 
 import (
-	"context"
 	"errors"
-	"io/fs"
+	"flag"
+	"fmt"
+	"io"
 	"log/slog"
-	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 	"time"
 
-	"github.com/inelson/finguard/internal/auth"
-	"github.com/inelson/finguard/internal/clustercache"
+	"github.com/inelson/finguard/internal/audit"
 	"github.com/inelson/finguard/internal/collector"
 	collectoraws "github.com/inelson/finguard/internal/collector/aws"
 	collectorazure "github.com/inelson/finguard/internal/collector/azure"
@@ -20,15 +18,8 @@ import (
 	collectork8s "github.com/inelson/finguard/internal/collector/kubernetes"
 	"github.com/inelson/finguard/internal/config"
 	"github.com/inelson/finguard/internal/models"
-	"github.com/inelson/finguard/internal/opencostproxy"
-	pluginmgr "github.com/inelson/finguard/internal/plugin"
-	"github.com/inelson/finguard/internal/server"
 	"github.com/inelson/finguard/internal/store"
-	"github.com/inelson/finguard/internal/stream"
 	"github.com/inelson/finguard/migrations"
-	"github.com/inelson/finguard/plugins/budgets"
-	"github.com/inelson/finguard/plugins/costbreakdown"
-	"github.com/inelson/finguard/web"
 
 	_ "github.com/inelson/finguard/docs/swagger"
 )
@@ -39,6 +30,25 @@ var (
 	buildTime = "unknown"
 )
 
+// command is a finguard subcommand. run is given the arguments after the
+// command's name.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "run the server (the default)", runServe},
+	{"migrate", "manage the database schema", runMigrate},
+	{"collect", "collect a cost source once, without the server", runCollect},
+	{"export", "export a project's cost records", runExport},
+	{"users", "grant a user platform admin", runUsers},
+	{"projects", "export or import projects with their cost sources and budgets", runProjects},
+	{"rebuild-rollups", "recompute the daily cost rollups from the raw records", runRebuildRollups},
+	{"check-config", "check the configuration and the database", runCheckConfig},
+}
+
 // @title           FinGuard API
 // @version         1.0
 // @description     FinGuard cloud cost management platform API.
@@ -48,125 +58,111 @@ var (
 // @in                          cookie
 // @name                        finguard_session
 func main() {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
-	slog.SetDefault(logger)
-
-	logger.Info("starting finguard", "version", version, "commit", commit, "build_time", buildTime)
-
-	cfg := config.Load()
-	hub := stream.NewHub(logger)
-
-	db, err := store.New(cfg.DatabaseDSN)
-	if err != nil {
-		logger.Error("failed to open database", "error", err)
-		os.Exit(1)
+	// Without a command, or with flags only, finguard serves.
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
-	defer db.Close()
-
-	if err := db.Migrate(migrations.FS); err != nil {
-		logger.Error("failed to run database migrations", "error", err)
-		os.Exit(1)
+	if name == "help" {
+		usage(os.Stdout)
+		return
 	}
-	logger.Info("database ready", "dsn", cfg.DatabaseDSN)
 
-	var proxy *opencostproxy.Proxy
-	if cfg.DevMode {
-		logger.Info("dev mode enabled, using mock OpenCost data")
-		proxy = opencostproxy.NewMock(logger)
-	} else {
-		proxy = opencostproxy.New(cfg.OpenCostURL, logger)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(args)
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "finguard %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
 	}
+	fmt.Fprintf(os.Stderr, "finguard: unknown command %q\n\n", name)
+	usage(os.Stderr)
+	os.Exit(2)
+}
 
-	var cc *clustercache.Cache
-	cc, err = clustercache.New(logger)
-	if err != nil {
-		logger.Warn("cluster cache unavailable, running without k8s integration", "error", err)
-		cc = nil
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: finguard <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-16s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Every command reads the FINGUARD_* environment variables and takes a flag")
+	fmt.Fprintln(w, "for each but the secrets, which overrides it. Run finguard <command> -h for")
+	fmt.Fprintln(w, "its flags.")
+}
 
-	pm := pluginmgr.NewManager(hub, logger)
-
-	cbPlugin := costbreakdown.New(logger)
-	if err := pm.Register(cbPlugin); err != nil {
-		logger.Error("failed to register costbreakdown plugin", "error", err)
+// newFlagSet returns the flag set of the named command, with a flag for
+// every setting of cfg. Flags go before the command's arguments.
+func newFlagSet(name, args string, cfg *config.Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("finguard "+name, flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: finguard %s %s\n\nflags:\n", name, args)
+		fs.PrintDefaults()
 	}
+	return fs
+}
 
-	budgetPlugin := budgets.New(logger, nil)
-	if err := pm.Register(budgetPlugin); err != nil {
-		logger.Error("failed to register budgets plugin", "error", err)
+// newLogger returns a JSON logger writing to w at the configured level. The
+// server logs to stdout; other commands log to stderr and keep stdout for
+// their output.
+func newLogger(cfg *config.Config, w io.Writer) *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		level = slog.LevelInfo
 	}
+	logger := slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(logger)
+	return logger
+}
 
-	frontendFS, err := fs.Sub(web.DistFS, "dist")
-	if err != nil {
-		logger.Error("failed to load embedded frontend", "error", err)
-		frontendFS = nil
+// openStore checks cfg as check-config does, then opens the configured
+// database and migrates it to the latest schema.
+func openStore(cfg *config.Config) (*store.SQLStore, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
-
-	authMgr, err := auth.NewManager(cfg, db, logger)
+	db, err := store.New(cfg.DatabaseDSN)
 	if err != nil {
-		logger.Error("failed to initialize auth manager", "error", err)
-		os.Exit(1)
-	}
-
-	// Cost collector registry and scheduler
-	collectorRegistry := collector.NewRegistry()
-	collectorRegistry.Register(models.CostSourceAWS, collectoraws.New(logger))
-	collectorRegistry.Register(models.CostSourceAzure, collectorazure.New(logger))
-	collectorRegistry.Register(models.CostSourceGCP, collectorgcp.New(logger))
-	collectorRegistry.Register(models.CostSourceKubernetes, collectork8s.New(logger))
-
-	collectorScheduler := collector.NewScheduler(collectorRegistry, db, hub, collector.DefaultSchedulerConfig(), logger)
-
-	srv := server.New(cfg, hub, proxy, cc, pm, db, authMgr, frontendFS, logger)
-
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
-
-	if cfg.DevMode {
-		go proxy.StartHealthCheckMock(ctx, 30*time.Second)
-	} else {
-		go proxy.StartHealthCheck(ctx, 30*time.Second)
+		return nil, fmt.Errorf("open database: %w", err)
 	}
-
-	if cc != nil {
-		go func() {
-			if err := cc.Start(ctx); err != nil {
-				logger.Error("cluster cache failed to start", "error", err)
-			}
-		}()
-	}
-
-	go collectorScheduler.Start(ctx)
-
-	if err := pm.InitializeAll(ctx, cfg.OpenCostURL); err != nil {
-		logger.Error("failed to initialize plugins", "error", err)
+	if err := db.Migrate(migrations.FS); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("run database migrations: %w", err)
 	}
+	return db, nil
+}
 
-	go func() {
-		if err := srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Error("server failed", "error", err)
-			os.Exit(1)
-		}
-	}()
-
-	logger.Info("finguard started", "addr", cfg.HTTPAddr)
-	<-ctx.Done()
-	logger.Info("received shutdown signal")
-
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func newCollectorRegistry(logger *slog.Logger) *collector.Registry {
+	registry := collector.NewRegistry()
+	registry.Register(models.CostSourceAWS, collectoraws.New(logger))
+	registry.Register(models.CostSourceAzure, collectorazure.New(logger))
+	registry.Register(models.CostSourceGCP, collectorgcp.New(logger))
+	registry.Register(models.CostSourceKubernetes, collectork8s.New(logger))
+	return registry
+}
 
-	pm.ShutdownAll(shutdownCtx)
+// cliActor is who the audit log records for changes made from the command
+// line.
+var cliActor = audit.Actor{Email: "cli"}
 
-	if cc != nil {
-		cc.Stop()
+// parseTime reads a date (2006-01-02, midnight UTC) or an RFC 3339 time.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
 	}
-
-	if err := srv.Shutdown(shutdownCtx); err != nil {
-		logger.Error("server shutdown failed", "error", err)
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: must be a date (2006-01-02) or an RFC 3339 time", s)
 	}
-
-	logger.Info("finguard stopped")
+	return t.UTC(), nil
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/inelson/finguard/internal/config"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/migrations"
+)
+
+const migrateUsage = `usage: finguard migrate <command>
+
+  status         show the schema version and every migration
+  up [version]   apply migrations up to version, or all of them
+  down version   revert migrations down to version (0 reverts them all)
+  force version  mark the schema clean at version after repairing a failed migration`
+
+// runMigrate opens the database without migrating it and runs the migrate
+// command of args.
+func runMigrate(args []string) error {
+	cfg := config.Load()
+	fs := newFlagSet("migrate", "[flags] status|up|down|force [version]", cfg)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	newLogger(cfg, os.Stderr)
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	db, err := store.New(cfg.DatabaseDSN)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+	return migrate(db, fs.Args(), os.Stdout)
+}
+
+// migrate runs finguard migrate with args, the words after "migrate".
+func migrate(db *store.SQLStore, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", migrateUsage)
+	}
+	var target int
+	if len(args) > 1 {
+		v, err := strconv.Atoi(args[1])
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid version %q\n%s", args[1], migrateUsage)
+		}
+		target = v
+	}
+	needsVersion := func() error {
+		if len(args) != 2 {
+			return fmt.Errorf("migrate %s needs a version\n%s", args[0], migrateUsage)
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "status":
+		status, err := db.MigrationStatus(migrations.FS)
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(out, status)
+		return nil
+	case "up":
+		if target == 0 {
+			// All the way up also runs the steps Migrate follows the files
+			// with, as starting the server would.
+			return db.Migrate(migrations.FS)
+		}
+		return db.MigrateUp(migrations.FS, target)
+	case "down":
+		if err := needsVersion(); err != nil {
+			return err
+		}
+		return db.MigrateDown(migrations.FS, target)
+	case "force":
+		if err := needsVersion(); err != nil {
+			return err
+		}
+		return db.ForceMigrationVersion(target)
+	}
+	return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+}
+
+func printMigrationStatus(out io.Writer, status *store.MigrationStatus) {
+	state := "clean"
+	if status.Dirty {
+		state = "DIRTY"
+	}
+	fmt.Fprintf(out, "version %d of %d, %s\n\n", status.Version, status.Latest, state)
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED\tREVERSIBLE")
+	for _, m := range status.Migrations {
+		fmt.Fprintf(tw, "%06d\t%s\t%s\t%s\n", m.Version, m.Name, yesNo(m.Applied), yesNo(m.Reversible))
+	}
+	tw.Flush()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
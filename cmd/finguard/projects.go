@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/config"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+)
+
+// projectBundleVersion is the version of the projects export format.
+const projectBundleVersion = 1
+
+// projectBundle is the file finguard projects export writes and import
+// reads: projects with their cost sources and budgets, without IDs, so that
+// they can be recreated in another installation. Budgets name their cost
+// source. Members, cost records and alert state are not included.
+type projectBundle struct {
+	Version  int             `json:"version"`
+	Projects []bundleProject `json:"projects"`
+}
+
+type bundleProject struct {
+	Name          string               `json:"name"`
+	Description   string               `json:"description,omitempty"`
+	AdmissionMode models.AdmissionMode `json:"admissionMode,omitempty"`
+	CostSources   []bundleCostSource   `json:"costSources,omitempty"`
+	Budgets       []bundleBudget       `json:"budgets,omitempty"`
+}
+
+type bundleCostSource struct {
+	Name    string                `json:"name"`
+	Type    models.CostSourceType `json:"type"`
+	Config  json.RawMessage       `json:"config,omitempty"`
+	Enabled bool                  `json:"enabled"`
+}
+
+type bundleBudget struct {
+	CostSource  string                     `json:"costSource,omitempty"`
+	Filter      models.CostFilter          `json:"filter"`
+	Period      models.BudgetPeriod        `json:"period"`
+	Amount      float64                    `json:"amount"`
+	Plan        []float64                  `json:"plan,omitempty"`
+	Rollover    bool                       `json:"rollover,omitempty"`
+	Thresholds  []float64                  `json:"thresholds,omitempty"`
+	Enforcement []models.EnforcementAction `json:"enforcement,omitempty"`
+}
+
+// runProjects runs finguard projects export [--out <file>] and finguard
+// projects import [file]. Import reads stdin without a file or with "-".
+func runProjects(args []string) error {
+	cfg := config.Load()
+	fs := newFlagSet("projects", "[flags] export|import [file]", cfg)
+	out := fs.String("out", "", "file export writes; defaults to stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || fs.NArg() > 2 {
+		fs.Usage()
+		return fmt.Errorf("expected export or import")
+	}
+	logger := newLogger(cfg, os.Stderr)
+
+	db, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	switch fs.Arg(0) {
+	case "export":
+		w := io.Writer(os.Stdout)
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		bundle, err := exportProjects(ctx, db)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(bundle)
+	case "import":
+		r := io.Reader(os.Stdin)
+		if name := fs.Arg(1); name != "" && name != "-" {
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		var bundle projectBundle
+		if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+			return fmt.Errorf("read projects: %w", err)
+		}
+		created, skipped, err := importProjects(ctx, db, audit.NewRecorder(db, logger), &bundle)
+		for _, name := range skipped {
+			fmt.Printf("skipped %s: a project of that name exists\n", name)
+		}
+		fmt.Printf("imported %d projects\n", created)
+		return err
+	}
+	return fmt.Errorf("unknown projects command %q", fs.Arg(0))
+}
+
+// exportProjects returns every project but the global one as a bundle.
+func exportProjects(ctx context.Context, st store.Store) (*projectBundle, error) {
+	projects, err := st.ListProjects(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list projects: %w", err)
+	}
+	bundle := &projectBundle{Version: projectBundleVersion, Projects: []bundleProject{}}
+	for _, p := range projects {
+		if p.ID == models.GlobalProjectID {
+			continue
+		}
+		bp := bundleProject{Name: p.Name, Description: p.Description, AdmissionMode: p.AdmissionMode}
+
+		sources, err := st.ListCostSources(ctx, p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("list cost sources of %s: %w", p.Name, err)
+		}
+		sourceNames := make(map[string]string, len(sources))
+		for _, cs := range sources {
+			sourceNames[cs.ID] = cs.Name
+			bp.CostSources = append(bp.CostSources, bundleCostSource{
+				Name: cs.Name, Type: cs.Type, Config: cs.Config, Enabled: cs.Enabled,
+			})
+		}
+
+		budgets, err := st.ListBudgets(ctx, p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("list budgets of %s: %w", p.Name, err)
+		}
+		for _, b := range budgets {
+			bb := bundleBudget{
+				Filter: b.Filter, Period: b.Period, Amount: b.Amount, Plan: b.Plan,
+				Rollover: b.Rollover, Thresholds: b.Thresholds, Enforcement: b.Enforcement,
+			}
+			if b.CostSourceID != nil {
+				bb.CostSource = sourceNames[*b.CostSourceID]
+			}
+			bp.Budgets = append(bp.Budgets, bb)
+		}
+		bundle.Projects = append(bundle.Projects, bp)
+	}
+	return bundle, nil
+}
+
+// importProjects creates the projects of bundle with their cost sources and
+// budgets. Projects are matched by name: one whose name is taken is skipped
+// whole, so importing the same bundle twice changes nothing. It returns how
+// many projects it created and the names it skipped.
+func importProjects(ctx context.Context, st store.Store, auditor *audit.Recorder, bundle *projectBundle) (int, []string, error) {
+	if bundle.Version != projectBundleVersion {
+		return 0, nil, fmt.Errorf("unsupported projects file version %d", bundle.Version)
+	}
+	existing, err := st.ListProjects(ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("list projects: %w", err)
+	}
+	taken := make(map[string]bool, len(existing))
+	for _, p := range existing {
+		taken[p.Name] = true
+	}
+
+	var created int
+	var skipped []string
+	for _, bp := range bundle.Projects {
+		if bp.Name == "" {
+			return created, skipped, fmt.Errorf("project %d has no name", created+len(skipped)+1)
+		}
+		if taken[bp.Name] {
+			skipped = append(skipped, bp.Name)
+			continue
+		}
+		if err := importProject(ctx, st, auditor, &bp); err != nil {
+			return created, skipped, fmt.Errorf("import %s: %w", bp.Name, err)
+		}
+		taken[bp.Name] = true
+		created++
+	}
+	return created, skipped, nil
+}
+
+func importProject(ctx context.Context, st store.Store, auditor *audit.Recorder, bp *bundleProject) error {
+	p := &models.Project{Name: bp.Name, Description: bp.Description, AdmissionMode: bp.AdmissionMode}
+	if err := st.CreateProject(ctx, p); err != nil {
+		return fmt.Errorf("create project: %w", err)
+	}
+	auditor.Record(ctx, cliActor, audit.Event{
+		Action: "project.create", TargetType: audit.TargetProject, TargetID: p.ID, ProjectID: p.ID, After: p,
+	})
+
+	sourceIDs := make(map[string]string, len(bp.CostSources))
+	for _, bs := range bp.CostSources {
+		cs := &models.CostSource{ProjectID: p.ID, Name: bs.Name, Type: bs.Type, Config: bs.Config, Enabled: bs.Enabled}
+		if err := st.CreateCostSource(ctx, cs); err != nil {
+			return fmt.Errorf("create cost source %s: %w", bs.Name, err)
+		}
+		sourceIDs[bs.Name] = cs.ID
+		auditor.Record(ctx, cliActor, audit.Event{
+			Action: "source.create", TargetType: audit.TargetCostSource, TargetID: cs.ID, ProjectID: p.ID, After: cs,
+		})
+	}
+
+	for _, bb := range bp.Budgets {
+		b := &models.Budget{
+			ProjectID: p.ID, Filter: bb.Filter, Period: bb.Period, Amount: bb.Amount, Plan: bb.Plan,
+			Rollover: bb.Rollover, Thresholds: bb.Thresholds, Enforcement: bb.Enforcement,
+		}
+		if bb.CostSource != "" {
+			id, ok := sourceIDs[bb.CostSource]
+			if !ok {
+				return fmt.Errorf("budget refers to unknown cost source %q", bb.CostSource)
+			}
+			b.CostSourceID = &id
+		}
+		if err := st.CreateBudget(ctx, b); err != nil {
+			return fmt.Errorf("create budget: %w", err)
+		}
+		auditor.Record(ctx, cliActor, audit.Event{
+			Action: "budget.create", TargetType: audit.TargetBudget, TargetID: b.ID, ProjectID: p.ID, After: b,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store/storetest"
+)
+
+func TestProjects_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := storetest.New(t)
+
+	p := &models.Project{Name: "payments", Description: "Payments team", AdmissionMode: models.AdmissionDeny}
+	if err := src.CreateProject(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	cs := &models.CostSource{ProjectID: p.ID, Name: "prod", Type: models.CostSourceAWS, Config: json.RawMessage(`{"accountId":"123"}`), Enabled: true}
+	if err := src.CreateCostSource(ctx, cs); err != nil {
+		t.Fatal(err)
+	}
+	b := &models.Budget{ProjectID: p.ID, CostSourceID: &cs.ID, Period: models.BudgetMonthly, Amount: 1000, Thresholds: []float64{0.8, 1}}
+	if err := src.CreateBudget(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := grantPlatformAdmin(ctx, src, nil, "admin@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := exportProjects(ctx, src)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(bundle.Projects) != 1 {
+		t.Fatalf("expected the global project to be left out, got %d projects", len(bundle.Projects))
+	}
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := storetest.New(t)
+	var read projectBundle
+	if err := json.Unmarshal(data, &read); err != nil {
+		t.Fatal(err)
+	}
+	created, skipped, err := importProjects(ctx, dst, nil, &read)
+	if err != nil || created != 1 || len(skipped) != 0 {
+		t.Fatalf("expected 1 project created, got %d created, %v skipped, err %v", created, skipped, err)
+	}
+
+	projects, _ := dst.ListProjects(ctx)
+	if len(projects) != 1 || projects[0].Name != "payments" || projects[0].AdmissionMode != models.AdmissionDeny {
+		t.Fatalf("unexpected imported projects %+v", projects)
+	}
+	sources, _ := dst.ListCostSources(ctx, projects[0].ID)
+	if len(sources) != 1 || sources[0].Name != "prod" || string(sources[0].Config) != `{"accountId":"123"}` {
+		t.Fatalf("unexpected imported cost sources %+v", sources)
+	}
+	budgets, _ := dst.ListBudgets(ctx, projects[0].ID)
+	if len(budgets) != 1 || budgets[0].Amount != 1000 || budgets[0].CostSourceID == nil || *budgets[0].CostSourceID != sources[0].ID {
+		t.Fatalf("unexpected imported budgets %+v", budgets)
+	}
+
+	created, skipped, err = importProjects(ctx, dst, nil, &read)
+	if err != nil || created != 0 || len(skipped) != 1 {
+		t.Errorf("expected a second import to skip the project, got %d created, %v skipped, err %v", created, skipped, err)
+	}
+}
+
+func TestUsers_GrantAdmin(t *testing.T) {
+	ctx := context.Background()
+	st := storetest.New(t)
+
+	if _, err := grantPlatformAdmin(ctx, st, nil, "new@example.com"); err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+	invs, _ := st.ListProjectInvitations(ctx, models.GlobalProjectID)
+	if len(invs) != 1 || invs[0].Role != models.RolePlatformAdmin {
+		t.Fatalf("expected a platform-admin invitation, got %+v", invs)
+	}
+
+	u := &models.User{Email: "existing@example.com", Active: true}
+	if err := st.CreateUser(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := grantPlatformAdmin(ctx, st, nil, "Existing@Example.com"); err != nil {
+		t.Fatalf("grant: %v", err)
+	}
+	role, _ := st.GetUserProjectRole(ctx, models.GlobalProjectID, u.ID)
+	if role == nil || role.Role != models.RolePlatformAdmin {
+		t.Errorf("expected platform-admin role, got %+v", role)
+	}
+
+	if _, err := grantPlatformAdmin(ctx, st, nil, "not-an-email"); err == nil {
+		t.Error("expected error for an invalid email")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/inelson/finguard/internal/config"
+)
+
+// runRebuildRollups recomputes the daily cost rollups of a project, or of
+// every project without one, from the raw records.
+func runRebuildRollups(args []string) error {
+	cfg := config.Load()
+	fs := newFlagSet("rebuild-rollups", "[flags] [projectID]", cfg)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	logger := newLogger(cfg, os.Stderr)
+
+	db, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	projectID := fs.Arg(0)
+	if err := db.RebuildCostRollups(context.Background(), projectID); err != nil {
+		return fmt.Errorf("rebuild cost rollups: %w", err)
+	}
+	logger.Info("cost rollups rebuilt", "project", projectID)
+	return nil
+}
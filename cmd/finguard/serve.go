@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/auth"
+	"github.com/inelson/finguard/internal/budget"
+	"github.com/inelson/finguard/internal/clustercache"
+	"github.com/inelson/finguard/internal/collector"
+	collectork8s "github.com/inelson/finguard/internal/collector/kubernetes"
+	"github.com/inelson/finguard/internal/config"
+	"github.com/inelson/finguard/internal/enforcement"
+	"github.com/inelson/finguard/internal/notify"
+	"github.com/inelson/finguard/internal/opencostproxy"
+	pluginmgr "github.com/inelson/finguard/internal/plugin"
+	"github.com/inelson/finguard/internal/report"
+	"github.com/inelson/finguard/internal/retention"
+	"github.com/inelson/finguard/internal/server"
+	"github.com/inelson/finguard/internal/stream"
+	"github.com/inelson/finguard/plugins/costbreakdown"
+	"github.com/inelson/finguard/web"
+)
+
+// runServe runs the server until it receives SIGINT or SIGTERM.
+func runServe(args []string) error {
+	cfg := config.Load()
+	if err := newFlagSet("serve", "[flags]", cfg).Parse(args); err != nil {
+		return err
+	}
+	logger := newLogger(cfg, os.Stdout)
+
+	logger.Info("starting finguard", "version", version, "commit", commit, "build_time", buildTime)
+
+	hub := stream.NewHub(logger)
+
+	// Migrate refuses a dirty database, so a failed migration stops the
+	// server from starting until it is repaired and forced clean.
+	db, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	logger.Info("database ready", "dsn", cfg.DatabaseDSN)
+
+	var proxy *opencostproxy.Proxy
+	if cfg.DevMode {
+		logger.Info("dev mode enabled, using mock OpenCost data")
+		proxy = opencostproxy.NewMock(logger)
+	} else {
+		proxy = opencostproxy.New(cfg.OpenCostURL, logger)
+	}
+
+	var cc *clustercache.Cache
+	cc, err = clustercache.New(logger)
+	if err != nil {
+		logger.Warn("cluster cache unavailable, running without k8s integration", "error", err)
+		cc = nil
+	}
+
+	pm := pluginmgr.NewManager(hub, logger)
+
+	// Idle recommendations are attributed to the projects whose Kubernetes
+	// sources list their namespace
+	cbPlugin := costbreakdown.New(logger, func(ctx context.Context) (map[string][]string, error) {
+		return collectork8s.NamespaceOwners(ctx, db)
+	})
+	if err := pm.Register(cbPlugin); err != nil {
+		logger.Error("failed to register costbreakdown plugin", "error", err)
+	}
+
+	frontendFS, err := fs.Sub(web.DistFS, "dist")
+	if err != nil {
+		logger.Error("failed to load embedded frontend", "error", err)
+		frontendFS = nil
+	}
+
+	auditor := audit.NewRecorder(db, logger)
+
+	authMgr, err := auth.NewManager(cfg, db, auditor, logger)
+	if err != nil {
+		return fmt.Errorf("initialize auth manager: %w", err)
+	}
+
+	// Cost collector registry and scheduler
+	collectorScheduler := collector.NewScheduler(newCollectorRegistry(logger), db, hub, collector.DefaultSchedulerConfig(), logger)
+	budgetEvaluator := budget.NewEvaluator(db, hub, budget.Config{
+		FiscalYearStart:  cfg.FiscalYearStartMonth,
+		ReminderInterval: cfg.BudgetReminderInterval,
+	}, logger)
+	collectorScheduler.AddHook(budgetEvaluator.Run)
+
+	// Budget enforcement needs a cluster to act on
+	var enforcer *enforcement.Enforcer
+	if cc != nil {
+		enforcer = enforcement.New(db, cc.Clientset(), auditor, enforcement.Config{DryRun: cfg.EnforcementDryRun}, logger)
+		budgetEvaluator.AddHook(enforcer.Enforce)
+	}
+
+	// Notification channels receive every event published on the hub,
+	// through an outbox that survives restarts
+	smtpRelay := notify.SMTPConfig{
+		Addr:     cfg.SMTPAddr,
+		From:     cfg.SMTPFrom,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+	}
+	notifier := notify.New(db, notify.Config{
+		SMTP:         smtpRelay,
+		MaxAttempts:  cfg.NotifyMaxAttempts,
+		RetryBackoff: cfg.NotifyRetryBackoff,
+	}, logger)
+	hub.AddSink(notifier.Enqueue)
+	// Budget alerts are written to the outbox with the alert state that
+	// raised them, so the hub sink skips them
+	budgetEvaluator.SetOutbox(notifier)
+	notifier.Skip(budget.Topics...)
+
+	// Scheduled cost reports are emailed through the same relay
+	reporter := report.New(db, report.Config{SMTP: smtpRelay, FiscalYearStart: cfg.FiscalYearStartMonth}, logger)
+
+	// Cost record retention merges old records into coarser ones and
+	// eventually drops them, archiving them first if configured
+	retentionRules, err := retention.ParseRules(cfg.CostRetention)
+	if err != nil {
+		return fmt.Errorf("invalid FINGUARD_COST_RETENTION: %w", err)
+	}
+	var compactor *retention.Compactor
+	if len(retentionRules) > 0 {
+		compactor = retention.New(db, retention.Config{
+			Rules:      retentionRules,
+			ArchiveDir: cfg.CostArchiveDir,
+			Interval:   cfg.CostCompactionInterval,
+		}, auditor, logger)
+	}
+
+	// On Postgres cost records are partitioned by month; keep partitions
+	// ready for the coming months and expire the oldest
+	partitionConfig := retention.PartitionConfig{Ahead: cfg.CostPartitionsAhead, Detach: cfg.CostPartitionDetach}
+	if cfg.CostPartitionRetention != "" {
+		if partitionConfig.Retention, err = retention.ParseAge(cfg.CostPartitionRetention); err != nil {
+			return fmt.Errorf("invalid FINGUARD_COST_PARTITION_RETENTION: %w", err)
+		}
+	}
+	partitioner := retention.NewPartitioner(db, partitionConfig, auditor, logger)
+
+	srv := server.New(cfg, hub, proxy, cc, pm, db, authMgr, auditor, enforcer, notifier, reporter, frontendFS, logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.DevMode {
+		go proxy.StartHealthCheckMock(ctx, 30*time.Second)
+	} else {
+		go proxy.StartHealthCheck(ctx, 30*time.Second)
+	}
+
+	if cc != nil {
+		go func() {
+			if err := cc.Start(ctx); err != nil {
+				logger.Error("cluster cache failed to start", "error", err)
+			}
+		}()
+	}
+
+	go collectorScheduler.Start(ctx)
+	go notifier.Start(ctx)
+	go reporter.Start(ctx)
+	if compactor != nil {
+		go compactor.Start(ctx)
+	}
+	go partitioner.Start(ctx)
+	go authMgr.StartSessionSweeper(ctx, 15*time.Minute)
+	go auth.NewRoleSweeper(db, hub, auditor, logger).Start(ctx, time.Minute)
+
+	if err := pm.InitializeAll(ctx, cfg.OpenCostURL); err != nil {
+		logger.Error("failed to initialize plugins", "error", err)
+	}
+
+	go func() {
+		if err := srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	go func() {
+		if err := srv.StartAdmission(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("admission webhook failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	logger.Info("finguard started", "addr", cfg.HTTPAddr)
+	<-ctx.Done()
+	logger.Info("received shutdown signal")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pm.ShutdownAll(shutdownCtx)
+
+	if cc != nil {
+		cc.Stop()
+	}
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("server shutdown failed", "error", err)
+	}
+
+	logger.Info("finguard stopped")
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/config"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+)
+
+// runUsers runs finguard users grant-admin <email>.
+func runUsers(args []string) error {
+	cfg := config.Load()
+	fs := newFlagSet("users", "[flags] grant-admin <email>", cfg)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 || fs.Arg(0) != "grant-admin" {
+		fs.Usage()
+		return fmt.Errorf("expected grant-admin <email>")
+	}
+	logger := newLogger(cfg, os.Stderr)
+
+	db, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	msg, err := grantPlatformAdmin(context.Background(), db, audit.NewRecorder(db, logger), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	fmt.Println(msg)
+	return nil
+}
+
+// grantPlatformAdmin makes the user with email a platform admin, creating the
+// global project that holds platform roles if it is missing. A user who has
+// not signed in yet is invited instead, and becomes admin at first login. It
+// returns what was done.
+func grantPlatformAdmin(ctx context.Context, st store.Store, auditor *audit.Recorder, email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !strings.Contains(email, "@") {
+		return "", fmt.Errorf("invalid email %q", email)
+	}
+
+	global, err := st.GetProject(ctx, models.GlobalProjectID)
+	if err != nil {
+		return "", fmt.Errorf("get global project: %w", err)
+	}
+	if global == nil {
+		global = &models.Project{
+			ID:          models.GlobalProjectID,
+			Name:        models.GlobalProjectID,
+			Description: "Platform-wide role assignments",
+		}
+		if err := st.CreateProject(ctx, global); err != nil {
+			return "", fmt.Errorf("create global project: %w", err)
+		}
+	}
+
+	user, err := st.GetUserByEmail(ctx, email)
+	if err != nil {
+		return "", fmt.Errorf("get user: %w", err)
+	}
+	if user == nil {
+		inv := &models.ProjectInvitation{
+			ProjectID: models.GlobalProjectID,
+			Email:     email,
+			Role:      models.RolePlatformAdmin,
+			InvitedBy: cliActor.Email,
+		}
+		if err := st.CreateProjectInvitation(ctx, inv); err != nil {
+			return "", fmt.Errorf("invite %s: %w", email, err)
+		}
+		auditor.Record(ctx, cliActor, audit.Event{
+			Action:     "invitation.create",
+			TargetType: audit.TargetInvitation,
+			TargetID:   inv.ID,
+			ProjectID:  models.GlobalProjectID,
+			After:      inv,
+		})
+		return fmt.Sprintf("%s has not signed in yet; invited as %s", email, models.RolePlatformAdmin), nil
+	}
+
+	pr := &models.ProjectRole{
+		ProjectID:   models.GlobalProjectID,
+		SubjectType: models.SubjectUser,
+		SubjectID:   user.ID,
+		Role:        models.RolePlatformAdmin,
+	}
+	if err := st.SetProjectRole(ctx, pr); err != nil {
+		return "", fmt.Errorf("grant %s: %w", models.RolePlatformAdmin, err)
+	}
+	auditor.Record(ctx, cliActor, audit.Event{
+		Action:     "member.add",
+		TargetType: audit.TargetMember,
+		TargetID:   user.ID,
+		ProjectID:  models.GlobalProjectID,
+		After:      pr,
+	})
+	return fmt.Sprintf("granted %s to %s", models.RolePlatformAdmin, email), nil
+}
@@ -0,0 +1,108 @@
+package admission
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// HourlyPriceAnnotation is the node annotation holding the node's on-demand
+// price per hour. Nodes without it are priced at the default rates.
+const HourlyPriceAnnotation = "finguard.io/hourly-price"
+
+// hoursPerMonth is the average number of hours in a month, as used by cloud
+// provider price lists.
+const hoursPerMonth = 730
+
+const bytesPerGiB = 1 << 30
+
+// Pricing is the hourly cost of one CPU core and one GiB of memory.
+type Pricing struct {
+	CPUCoreHour   float64
+	MemoryGiBHour float64
+}
+
+// Resources is an amount of CPU in cores and memory in GiB.
+type Resources struct {
+	CPU       float64
+	MemoryGiB float64
+}
+
+// Hourly is the cost of running r for an hour.
+func (p Pricing) Hourly(r Resources) float64 {
+	return r.CPU*p.CPUCoreHour + r.MemoryGiB*p.MemoryGiBHour
+}
+
+// nodePricing derives rates from the hourly price annotation of the given
+// nodes. Each annotated node's price is split between CPU and memory in the
+// same ratio as the default rates, and the resulting rates are averaged over
+// the annotated nodes. Without any usable annotation it returns defaults.
+func nodePricing(nodes []*corev1.Node, defaults Pricing) Pricing {
+	var scale float64
+	var n int
+	for _, node := range nodes {
+		price, err := strconv.ParseFloat(node.Annotations[HourlyPriceAnnotation], 64)
+		if err != nil || price <= 0 {
+			continue
+		}
+		base := defaults.Hourly(resources(node.Status.Allocatable))
+		if base <= 0 {
+			continue
+		}
+		scale += price / base
+		n++
+	}
+	if n == 0 {
+		return defaults
+	}
+	scale /= float64(n)
+	return Pricing{CPUCoreHour: defaults.CPUCoreHour * scale, MemoryGiBHour: defaults.MemoryGiBHour * scale}
+}
+
+// podResources is what the scheduler reserves for a pod: the larger of the
+// sum of its containers and its largest init container, plus pod overhead.
+// A container without a request falls back to its limit.
+func podResources(spec *corev1.PodSpec) Resources {
+	var total Resources
+	for i := range spec.Containers {
+		r := containerResources(&spec.Containers[i])
+		total.CPU += r.CPU
+		total.MemoryGiB += r.MemoryGiB
+	}
+	for i := range spec.InitContainers {
+		r := containerResources(&spec.InitContainers[i])
+		total.CPU = max(total.CPU, r.CPU)
+		total.MemoryGiB = max(total.MemoryGiB, r.MemoryGiB)
+	}
+	overhead := resources(spec.Overhead)
+	total.CPU += overhead.CPU
+	total.MemoryGiB += overhead.MemoryGiB
+	return total
+}
+
+func containerResources(c *corev1.Container) Resources {
+	r := resources(c.Resources.Requests)
+	limits := resources(c.Resources.Limits)
+	if _, ok := c.Resources.Requests[corev1.ResourceCPU]; !ok {
+		r.CPU = limits.CPU
+	}
+	if _, ok := c.Resources.Requests[corev1.ResourceMemory]; !ok {
+		r.MemoryGiB = limits.MemoryGiB
+	}
+	return r
+}
+
+func resources(list corev1.ResourceList) Resources {
+	return Resources{
+		CPU:       quantity(list, corev1.ResourceCPU),
+		MemoryGiB: quantity(list, corev1.ResourceMemory) / bytesPerGiB,
+	}
+}
+
+func quantity(list corev1.ResourceList, name corev1.ResourceName) float64 {
+	q, ok := list[name]
+	if !ok {
+		return 0
+	}
+	return q.AsApproximateFloat64()
+}
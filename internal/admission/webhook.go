@@ -0,0 +1,319 @@
+// Package admission implements a validating admission webhook that estimates
+// what a new or scaled Pod or Deployment will cost and warns about, or denies,
+// workloads that would push a namespace over its budget.
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/inelson/finguard/internal/budget"
+	collectork8s "github.com/inelson/finguard/internal/collector/kubernetes"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+)
+
+// NodeLister lists the cluster's nodes, whose annotations price workloads.
+type NodeLister interface {
+	GetNodes() []*corev1.Node
+}
+
+// Config sets the default rates, the budget period alignment and how long
+// budget evaluations are reused.
+type Config struct {
+	// Pricing is used for nodes without an hourly price annotation.
+	Pricing Pricing
+	// FiscalYearStart aligns quarterly and annual budget periods.
+	FiscalYearStart time.Month
+	// CacheTTL is how long the budgets of each namespace and their spend are
+	// reused between requests; zero means DefaultCacheTTL.
+	CacheTTL time.Duration
+}
+
+// DefaultCacheTTL is the CacheTTL used when none is configured. Spend only
+// changes when costs are collected, so a minute-old evaluation is current
+// enough to decide a request.
+const DefaultCacheTTL = time.Minute
+
+// Webhook serves AdmissionReview v1 requests. Budgets apply to a namespace
+// when their filter selects its "namespace" label and their project owns it,
+// and each budget's project decides whether a breach warns or denies.
+type Webhook struct {
+	store     store.Store
+	nodes     NodeLister
+	clientset kubernetes.Interface
+	config    Config
+	logger    *slog.Logger
+
+	// mu guards index, the evaluated budgets of each namespace, which is
+	// rebuilt once expires passes.
+	mu      sync.Mutex
+	index   map[string][]scopedBudget
+	expires time.Time
+}
+
+// scopedBudget is a budget of a project with admission checks enabled, as of
+// its last evaluation.
+type scopedBudget struct {
+	project *models.Project
+	status  *budget.Status
+}
+
+// New returns a webhook. nodes and cs may be nil, in which case workloads are
+// priced at the default rates and scale requests cannot be costed.
+func New(st store.Store, nodes NodeLister, cs kubernetes.Interface, cfg Config, logger *slog.Logger) *Webhook {
+	return &Webhook{store: st, nodes: nodes, clientset: cs, config: cfg, logger: logger}
+}
+
+var (
+	podsResource        = metav1.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
+	deploymentsResource = metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+)
+
+// errNotCosted is returned for requests the webhook does not price.
+var errNotCosted = errors.New("request does not change workload cost")
+
+func (h *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var review admissionv1.AdmissionReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Request == nil {
+		http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	resp := h.review(r.Context(), review.Request)
+	resp.UID = review.Request.UID
+	out := admissionv1.AdmissionReview{TypeMeta: review.TypeMeta, Response: resp}
+	out.APIVersion = admissionv1.SchemeGroupVersion.String()
+	out.Kind = "AdmissionReview"
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		h.logger.Error("admission: failed to encode response", "error", err)
+	}
+}
+
+// review decides a request. Failures to estimate or evaluate are reported as
+// warnings and the request is allowed, so FinGuard never blocks a deploy
+// because of its own problems.
+func (h *Webhook) review(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	allow := &admissionv1.AdmissionResponse{Allowed: true}
+
+	usage, err := h.estimate(ctx, req)
+	if errors.Is(err, errNotCosted) {
+		return allow
+	}
+	if err != nil {
+		h.logger.Warn("admission: failed to estimate cost", "namespace", req.Namespace, "name", req.Name, "error", err)
+		allow.Warnings = []string{"finguard: could not estimate cost: " + err.Error()}
+		return allow
+	}
+	var nodes []*corev1.Node
+	if h.nodes != nil {
+		nodes = h.nodes.GetNodes()
+	}
+	hourly := nodePricing(nodes, h.config.Pricing).Hourly(usage)
+	if hourly <= 0 {
+		return allow
+	}
+
+	breaches, err := h.breaches(ctx, req.Namespace, hourly, time.Now().UTC())
+	if err != nil {
+		h.logger.Error("admission: failed to evaluate budgets", "namespace", req.Namespace, "error", err)
+		allow.Warnings = []string{"finguard: could not evaluate budgets"}
+		return allow
+	}
+
+	var messages []string
+	deny := false
+	for _, b := range breaches {
+		messages = append(messages, b.message(hourly))
+		deny = deny || b.project.AdmissionMode == models.AdmissionDeny
+	}
+	if deny {
+		return &admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Code:    http.StatusForbidden,
+				Reason:  metav1.StatusReasonForbidden,
+				Message: "finguard: " + messages[0],
+			},
+			Warnings: messages[1:],
+		}
+	}
+	allow.Warnings = messages
+	return allow
+}
+
+// estimate returns the resources a request adds to the namespace. Scaling down
+// and shrinking a workload return negative amounts.
+func (h *Webhook) estimate(ctx context.Context, req *admissionv1.AdmissionRequest) (Resources, error) {
+	switch {
+	case req.Resource == podsResource && req.SubResource == "" && req.Operation == admissionv1.Create:
+		var pod corev1.Pod
+		if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
+			return Resources{}, fmt.Errorf("decode pod: %w", err)
+		}
+		// Pods created by a controller are costed through their Deployment.
+		if metav1.GetControllerOf(&pod) != nil {
+			return Resources{}, errNotCosted
+		}
+		return podResources(&pod.Spec), nil
+
+	case req.Resource == deploymentsResource && req.SubResource == "":
+		var d appsv1.Deployment
+		if err := json.Unmarshal(req.Object.Raw, &d); err != nil {
+			return Resources{}, fmt.Errorf("decode deployment: %w", err)
+		}
+		usage := deploymentResources(&d)
+		switch req.Operation {
+		case admissionv1.Create:
+			return usage, nil
+		case admissionv1.Update:
+			var old appsv1.Deployment
+			if err := json.Unmarshal(req.OldObject.Raw, &old); err != nil {
+				return Resources{}, fmt.Errorf("decode old deployment: %w", err)
+			}
+			prev := deploymentResources(&old)
+			return Resources{CPU: usage.CPU - prev.CPU, MemoryGiB: usage.MemoryGiB - prev.MemoryGiB}, nil
+		}
+
+	case req.Resource == deploymentsResource && req.SubResource == "scale" && req.Operation == admissionv1.Update:
+		var scale, old autoscalingv1.Scale
+		if err := json.Unmarshal(req.Object.Raw, &scale); err != nil {
+			return Resources{}, fmt.Errorf("decode scale: %w", err)
+		}
+		if err := json.Unmarshal(req.OldObject.Raw, &old); err != nil {
+			return Resources{}, fmt.Errorf("decode old scale: %w", err)
+		}
+		delta := float64(scale.Spec.Replicas - old.Spec.Replicas)
+		if delta == 0 {
+			return Resources{}, errNotCosted
+		}
+		if h.clientset == nil {
+			return Resources{}, errors.New("no cluster connection to look up the deployment")
+		}
+		d, err := h.clientset.AppsV1().Deployments(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+		if err != nil {
+			return Resources{}, err
+		}
+		pod := podResources(&d.Spec.Template.Spec)
+		return Resources{CPU: pod.CPU * delta, MemoryGiB: pod.MemoryGiB * delta}, nil
+	}
+	return Resources{}, errNotCosted
+}
+
+func deploymentResources(d *appsv1.Deployment) Resources {
+	replicas := 1.0
+	if d.Spec.Replicas != nil {
+		replicas = float64(*d.Spec.Replicas)
+	}
+	pod := podResources(&d.Spec.Template.Spec)
+	return Resources{CPU: pod.CPU * replicas, MemoryGiB: pod.MemoryGiB * replicas}
+}
+
+// breach is a budget the workload would push over its effective amount.
+type breach struct {
+	project *models.Project
+	status  *budget.Status
+	added   float64
+}
+
+// message tells the requester the workload's own cost only: whoever can
+// create workloads in a namespace cannot necessarily read its budgets.
+func (b breach) message(hourly float64) string {
+	return fmt.Sprintf("workload adds about %.2f/month and would exceed a budget for this namespace", hourly*hoursPerMonth)
+}
+
+// breaches returns the budgets scoped to namespace that the workload would
+// exceed when it runs at hourly cost for the rest of the budget's period.
+func (h *Webhook) breaches(ctx context.Context, namespace string, hourly float64, now time.Time) ([]breach, error) {
+	budgets, err := h.namespaceBudgets(ctx, namespace, now)
+	if err != nil {
+		return nil, err
+	}
+	var out []breach
+	for _, sb := range budgets {
+		added := hourly * sb.status.PeriodEnd.Sub(now).Hours()
+		if sb.status.EffectiveAmount > 0 && sb.status.ProjectedSpend+added > sb.status.EffectiveAmount {
+			out = append(out, breach{project: sb.project, status: sb.status, added: added})
+		}
+	}
+	return out, nil
+}
+
+// namespaceBudgets returns the evaluated budgets scoped to namespace. The
+// budgets of every namespace are evaluated together and reused until the
+// cache TTL passes or one of their periods ends, so requests do not query
+// spend themselves.
+func (h *Webhook) namespaceBudgets(ctx context.Context, namespace string, now time.Time) ([]scopedBudget, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.index == nil || !now.Before(h.expires) {
+		if err := h.rebuild(ctx, now); err != nil {
+			return nil, err
+		}
+	}
+	return h.index[namespace], nil
+}
+
+// rebuild evaluates every namespace-scoped budget of the projects that have
+// admission checks enabled. A budget is only indexed under a namespace listed
+// by one of its project's Kubernetes sources, so a project cannot gate
+// another's workloads by filtering on their namespace. h.mu must be held.
+func (h *Webhook) rebuild(ctx context.Context, now time.Time) error {
+	ttl := h.config.CacheTTL
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	expires := now.Add(ttl)
+
+	projects, err := h.store.ListProjects(ctx)
+	if err != nil {
+		return err
+	}
+	owners, err := collectork8s.NamespaceOwners(ctx, h.store)
+	if err != nil {
+		return err
+	}
+	index := make(map[string][]scopedBudget)
+	for _, p := range projects {
+		if p.AdmissionMode == models.AdmissionOff {
+			continue
+		}
+		budgets, err := h.store.ListBudgets(ctx, p.ID)
+		if err != nil {
+			return err
+		}
+		for _, b := range budgets {
+			namespace := b.Filter.Labels["namespace"]
+			if namespace == "" || !slices.Contains(owners[namespace], p.ID) {
+				continue
+			}
+			status, err := budget.Evaluate(ctx, h.store, b, h.config.FiscalYearStart, now)
+			if err != nil {
+				return err
+			}
+			index[namespace] = append(index[namespace], scopedBudget{project: p, status: status})
+			if status.PeriodEnd.Before(expires) {
+				expires = status.PeriodEnd
+			}
+		}
+	}
+	h.index, h.expires = index, expires
+	return nil
+}
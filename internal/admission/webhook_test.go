@@ -0,0 +1,345 @@
+package admission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func requests(cpu, memory string) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{Requests: corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+		corev1.ResourceMemory: resource.MustParse(memory),
+	}}
+}
+
+func podSpec(cpu, memory string) corev1.PodSpec {
+	return corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Resources: requests(cpu, memory)}}}
+}
+
+func raw(t *testing.T, obj any) runtime.RawExtension {
+	t.Helper()
+	b, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runtime.RawExtension{Raw: b}
+}
+
+// setup creates a project in mode with a monthly budget of 100 for the team-a
+// namespace that has already spent 99, so any sizeable workload breaches it.
+func setup(t *testing.T, mode models.AdmissionMode) (store.Store, *models.Project) {
+	t.Helper()
+	st := storetest.New(t)
+	ctx := context.Background()
+	project := &models.Project{Name: "payments", AdmissionMode: mode}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	source := &models.CostSource{
+		ProjectID: project.ID, Type: models.CostSourceKubernetes, Name: "k8s", Enabled: true,
+		Config: json.RawMessage(`{"clusterName":"dev","opencostUrl":"http://opencost","namespaces":["team-a"]}`),
+	}
+	if err := st.CreateCostSource(ctx, source); err != nil {
+		t.Fatal(err)
+	}
+	b := &models.Budget{ProjectID: project.ID, Amount: 100, Filter: models.CostFilter{Labels: map[string]string{"namespace": "team-a"}}}
+	if err := st.CreateBudget(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	record := &models.CostRecord{
+		ProjectID: project.ID, CostSourceID: source.ID, Provider: "kubernetes", Service: "compute",
+		Labels:    map[string]string{"namespace": "team-a"},
+		StartTime: monthStart, EndTime: monthStart.Add(time.Hour), NetCost: 99,
+	}
+	if err := st.InsertCostRecords(ctx, []*models.CostRecord{record}); err != nil {
+		t.Fatal(err)
+	}
+	return st, project
+}
+
+func newWebhook(st store.Store, objects ...runtime.Object) *Webhook {
+	cfg := Config{Pricing: Pricing{CPUCoreHour: 1000, MemoryGiBHour: 100}, FiscalYearStart: time.January}
+	return New(st, nil, fake.NewSimpleClientset(objects...), cfg, testLogger())
+}
+
+func review(t *testing.T, h http.Handler, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	t.Helper()
+	body, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request:  req,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admission/validate", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var out admissionv1.AdmissionReview
+	if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Response == nil || out.Response.UID != req.UID {
+		t.Fatalf("response does not echo request UID: %+v", out.Response)
+	}
+	return out.Response
+}
+
+func podRequest(t *testing.T, pod *corev1.Pod) *admissionv1.AdmissionRequest {
+	return &admissionv1.AdmissionRequest{
+		UID:       types.UID("req-1"),
+		Resource:  podsResource,
+		Operation: admissionv1.Create,
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		Object:    raw(t, pod),
+	}
+}
+
+func TestPodResources(t *testing.T) {
+	spec := corev1.PodSpec{
+		Containers: []corev1.Container{
+			{Name: "app", Resources: requests("500m", "1Gi")},
+			// No requests: the limits are what the scheduler reserves.
+			{Name: "sidecar", Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("250m"),
+				corev1.ResourceMemory: resource.MustParse("512Mi"),
+			}}},
+		},
+		InitContainers: []corev1.Container{{Name: "migrate", Resources: requests("2", "256Mi")}},
+		Overhead:       corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+	}
+	got := podResources(&spec)
+	if math.Abs(got.CPU-2.1) > 1e-9 || math.Abs(got.MemoryGiB-1.5) > 1e-9 {
+		t.Errorf("expected 2.1 cores and 1.5 GiB, got %+v", got)
+	}
+}
+
+func TestNodePricing(t *testing.T) {
+	defaults := Pricing{CPUCoreHour: 0.03, MemoryGiBHour: 0.004}
+	node := func(price string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{HourlyPriceAnnotation: price}},
+			Status: corev1.NodeStatus{Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("2"),
+				corev1.ResourceMemory: resource.MustParse("8Gi"),
+			}},
+		}
+	}
+	if got := nodePricing([]*corev1.Node{node("bogus")}, defaults); got != defaults {
+		t.Errorf("unannotated nodes: expected defaults, got %+v", got)
+	}
+
+	// Default rates price each node at 0.092/h; annotations of 0.184 and
+	// 0.368 average to a 3x scale.
+	got := nodePricing([]*corev1.Node{node("0.184"), node("0.368"), node("")}, defaults)
+	if math.Abs(got.CPUCoreHour-0.09) > 1e-9 || math.Abs(got.MemoryGiBHour-0.012) > 1e-9 {
+		t.Errorf("expected rates scaled 3x, got %+v", got)
+	}
+}
+
+func TestWebhook_Modes(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-a"}, Spec: podSpec("1", "1Gi")}
+
+	t.Run("warn", func(t *testing.T) {
+		st, _ := setup(t, models.AdmissionWarn)
+		resp := review(t, newWebhook(st), podRequest(t, pod))
+		if !resp.Allowed || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "would exceed a budget") {
+			t.Fatalf("expected an allowed response with a budget warning, got %+v", resp)
+		}
+		// The requester learns nothing about the budget itself.
+		if strings.Contains(resp.Warnings[0], "payments") || strings.Contains(resp.Warnings[0], " of ") {
+			t.Errorf("expected no budget details in the warning, got %q", resp.Warnings[0])
+		}
+	})
+
+	t.Run("deny", func(t *testing.T) {
+		st, _ := setup(t, models.AdmissionDeny)
+		resp := review(t, newWebhook(st), podRequest(t, pod))
+		if resp.Allowed || resp.Result == nil || resp.Result.Code != http.StatusForbidden {
+			t.Errorf("expected a 403 denial, got %+v", resp)
+		}
+	})
+
+	t.Run("off", func(t *testing.T) {
+		st, _ := setup(t, models.AdmissionOff)
+		resp := review(t, newWebhook(st), podRequest(t, pod))
+		if !resp.Allowed || len(resp.Warnings) != 0 {
+			t.Errorf("expected a plain allow, got %+v", resp)
+		}
+	})
+
+	t.Run("other namespace", func(t *testing.T) {
+		st, _ := setup(t, models.AdmissionDeny)
+		other := pod.DeepCopy()
+		other.Namespace = "team-b"
+		resp := review(t, newWebhook(st), podRequest(t, other))
+		if !resp.Allowed || len(resp.Warnings) != 0 {
+			t.Errorf("expected a plain allow, got %+v", resp)
+		}
+	})
+}
+
+func TestWebhook_IgnoresForeignBudgets(t *testing.T) {
+	st, _ := setup(t, models.AdmissionOff)
+	ctx := context.Background()
+
+	// A project in deny mode budgets a namespace only another project's
+	// source lists.
+	other := &models.Project{Name: "search", AdmissionMode: models.AdmissionDeny}
+	if err := st.CreateProject(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	b := &models.Budget{ProjectID: other.ID, Amount: 1, Filter: models.CostFilter{Labels: map[string]string{"namespace": "team-a"}}}
+	if err := st.CreateBudget(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-a"}, Spec: podSpec("1", "1Gi")}
+	resp := review(t, newWebhook(st), podRequest(t, pod))
+	if !resp.Allowed || len(resp.Warnings) != 0 {
+		t.Errorf("expected the foreign budget to be ignored, got %+v", resp)
+	}
+}
+
+func TestWebhook_ReusesEvaluations(t *testing.T) {
+	st, project := setup(t, models.AdmissionDeny)
+	h := newWebhook(st)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	if got, err := h.breaches(ctx, "team-a", 1000, now); err != nil || len(got) != 1 {
+		t.Fatalf("expected one breach, got %v %v", got, err)
+	}
+	budgets, err := st.ListBudgets(ctx, project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	budgets[0].Amount = 1e9
+	if err := st.UpdateBudget(ctx, budgets[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The raised budget is only seen once the cached evaluation expires.
+	if got, _ := h.breaches(ctx, "team-a", 1000, now.Add(time.Second)); len(got) != 1 {
+		t.Errorf("expected the cached evaluation to be reused, got %v", got)
+	}
+	if got, _ := h.breaches(ctx, "team-a", 1000, now.Add(DefaultCacheTTL)); len(got) != 0 {
+		t.Errorf("expected a fresh evaluation after the TTL, got %v", got)
+	}
+}
+
+func TestWebhook_Deployments(t *testing.T) {
+	st, _ := setup(t, models.AdmissionDeny)
+	three, five := int32(3), int32(5)
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-a"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &three,
+			Template: corev1.PodTemplateSpec{Spec: podSpec("1", "1Gi")},
+		},
+	}
+	h := newWebhook(st, d)
+
+	create := &admissionv1.AdmissionRequest{
+		UID: "create", Resource: deploymentsResource, Operation: admissionv1.Create,
+		Namespace: "team-a", Name: "web", Object: raw(t, d),
+	}
+	if resp := review(t, h, create); resp.Allowed {
+		t.Error("create: expected the deployment to be denied")
+	}
+
+	// Shrinking a deployment frees budget and is always allowed.
+	smaller := d.DeepCopy()
+	smaller.Spec.Template.Spec = podSpec("500m", "1Gi")
+	shrink := &admissionv1.AdmissionRequest{
+		UID: "shrink", Resource: deploymentsResource, Operation: admissionv1.Update,
+		Namespace: "team-a", Name: "web", Object: raw(t, smaller), OldObject: raw(t, d),
+	}
+	if resp := review(t, h, shrink); !resp.Allowed {
+		t.Errorf("shrink: expected allow, got %+v", resp)
+	}
+
+	scale := func(uid types.UID, from, to int32) *admissionv1.AdmissionRequest {
+		return &admissionv1.AdmissionRequest{
+			UID: uid, Resource: deploymentsResource, SubResource: "scale", Operation: admissionv1.Update,
+			Namespace: "team-a", Name: "web",
+			Object:    raw(t, &autoscalingv1.Scale{Spec: autoscalingv1.ScaleSpec{Replicas: to}}),
+			OldObject: raw(t, &autoscalingv1.Scale{Spec: autoscalingv1.ScaleSpec{Replicas: from}}),
+		}
+	}
+	if resp := review(t, h, scale("up", three, five)); resp.Allowed {
+		t.Error("scale up: expected the deployment to be denied")
+	}
+	if resp := review(t, h, scale("down", five, three)); !resp.Allowed {
+		t.Errorf("scale down: expected allow, got %+v", resp)
+	}
+}
+
+func TestWebhook_FailsOpen(t *testing.T) {
+	st, _ := setup(t, models.AdmissionDeny)
+	h := newWebhook(st)
+
+	bad := &admissionv1.AdmissionRequest{
+		UID: "bad", Resource: podsResource, Operation: admissionv1.Create,
+		Namespace: "team-a", Object: runtime.RawExtension{Raw: []byte(`{"spec":"nope"}`)},
+	}
+	if resp := review(t, h, bad); !resp.Allowed || len(resp.Warnings) != 1 {
+		t.Errorf("undecodable object: expected allow with a warning, got %+v", resp)
+	}
+
+	// Scaling a deployment the cluster does not know cannot be costed.
+	missing := &admissionv1.AdmissionRequest{
+		UID: "missing", Resource: deploymentsResource, SubResource: "scale", Operation: admissionv1.Update,
+		Namespace: "team-a", Name: "gone",
+		Object:    raw(t, &autoscalingv1.Scale{Spec: autoscalingv1.ScaleSpec{Replicas: 2}}),
+		OldObject: raw(t, &autoscalingv1.Scale{Spec: autoscalingv1.ScaleSpec{Replicas: 1}}),
+	}
+	if resp := review(t, h, missing); !resp.Allowed || len(resp.Warnings) != 1 {
+		t.Errorf("missing deployment: expected allow with a warning, got %+v", resp)
+	}
+
+	// Pods owned by a ReplicaSet are costed through their Deployment.
+	owned := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-abc", Namespace: "team-a"}, Spec: podSpec("1", "1Gi")}
+	controller := true
+	owned.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web", UID: "rs-1", Controller: &controller}}
+	if resp := review(t, h, podRequest(t, owned)); !resp.Allowed || len(resp.Warnings) != 0 {
+		t.Errorf("controller-owned pod: expected a plain allow, got %+v", resp)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admission/validate", strings.NewReader(`{}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("review without request: expected 400, got %d", w.Code)
+	}
+}
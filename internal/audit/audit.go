@@ -0,0 +1,154 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+)
+
+// Target types recorded in the audit log.
+const (
+	TargetProject     = "project"
+	TargetCostSource  = "cost_source"
+	TargetMember      = "project_member"
+	TargetInvitation  = "project_invitation"
+	TargetBudget      = "budget"
+	TargetEnforcement = "budget_enforcement"
+	TargetChannel     = "notification_channel"
+	TargetDelivery    = "notification_delivery"
+	TargetReport      = "report"
+	TargetRollups     = "cost_rollups"
+	TargetPartition   = "cost_partition"
+	TargetSession     = "session"
+	TargetUser        = "user"
+	TargetGroup       = "group"
+	TargetRole        = "role"
+)
+
+// redactedValue replaces the value of any field whose name looks like a credential.
+const redactedValue = "[REDACTED]"
+
+// sensitiveKeys are lower-cased substrings that mark a JSON field as secret.
+var sensitiveKeys = []string{
+	"secret",
+	"password",
+	"passwd",
+	"token",
+	"credential",
+	"privatekey",
+	"accesskey",
+	"apikey",
+	"serviceaccountkey",
+	"webhookurl",
+}
+
+// Actor identifies who performed an audited action and from where.
+type Actor struct {
+	ID        string
+	Email     string
+	IPAddress string
+	RequestID string
+}
+
+// Event describes one audited action. Before and After are snapshots of the
+// target and are redacted before they are stored.
+type Event struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	ProjectID  string
+	Before     any
+	After      any
+}
+
+// Recorder writes audit entries to the store. A nil Recorder discards entries.
+type Recorder struct {
+	store  store.Store
+	logger *slog.Logger
+}
+
+func NewRecorder(st store.Store, logger *slog.Logger) *Recorder {
+	return &Recorder{store: st, logger: logger}
+}
+
+// Record persists an audit entry. Failures are logged rather than returned so
+// that auditing never turns a successful mutation into an error response.
+func (r *Recorder) Record(ctx context.Context, actor Actor, ev Event) {
+	if r == nil || r.store == nil {
+		return
+	}
+	entry := &models.AuditEntry{
+		ActorID:    actor.ID,
+		ActorEmail: actor.Email,
+		Action:     ev.Action,
+		TargetType: ev.TargetType,
+		TargetID:   ev.TargetID,
+		ProjectID:  ev.ProjectID,
+		Before:     Redact(ev.Before),
+		After:      Redact(ev.After),
+		RequestID:  actor.RequestID,
+		IPAddress:  actor.IPAddress,
+	}
+	if err := r.store.InsertAuditEntry(ctx, entry); err != nil {
+		r.logger.Error("failed to write audit entry", "action", ev.Action, "target", ev.TargetID, "error", err)
+	}
+}
+
+// Redact marshals v to JSON with the values of credential-like fields replaced,
+// at any depth. Nested json.RawMessage values such as cost source configs are covered too.
+func Redact(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil
+	}
+	redacted, err := json.Marshal(redactValue(generic))
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+func redactValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if isSensitive(k) {
+				if s, ok := val.(string); ok && s == "" {
+					continue
+				}
+				t[k] = redactedValue
+				continue
+			}
+			t[k] = redactValue(val)
+		}
+		return t
+	case []any:
+		for i, val := range t {
+			t[i] = redactValue(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+func isSensitive(key string) bool {
+	k := strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
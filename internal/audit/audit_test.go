@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func TestRedact(t *testing.T) {
+	azure, _ := json.Marshal(models.AzureConfig{
+		SubscriptionID:   "sub-1",
+		ClientSecret:     "hunter2",
+		StorageAccessKey: "key",
+	})
+	source := &models.CostSource{ID: "cs-1", Name: "prod", Config: azure}
+
+	var got struct {
+		Name   string         `json:"name"`
+		Config map[string]any `json:"config"`
+	}
+	if err := json.Unmarshal(Redact(source), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Name != "prod" {
+		t.Errorf("expected name to be kept, got %q", got.Name)
+	}
+	if got.Config["subscriptionId"] != "sub-1" {
+		t.Errorf("expected subscriptionId to be kept, got %v", got.Config["subscriptionId"])
+	}
+	for _, key := range []string{"clientSecret", "storageAccessKey"} {
+		if got.Config[key] != redactedValue {
+			t.Errorf("expected %s to be redacted, got %v", key, got.Config[key])
+		}
+	}
+}
+
+func TestRedact_Nested(t *testing.T) {
+	tests := []struct {
+		name string
+		in   any
+		want string
+	}{
+		{"nil", nil, ""},
+		{"plain", map[string]string{"name": "a"}, `{"name":"a"}`},
+		{"empty secret kept", map[string]string{"password": ""}, `{"password":""}`},
+		{"case insensitive", map[string]string{"APIKey": "x"}, `{"APIKey":"[REDACTED]"}`},
+		{"in array", []map[string]any{{"token": 1}}, `[{"token":"[REDACTED]"}]`},
+		{"nested object", map[string]any{"gcp": map[string]string{"serviceAccountKey": "{}"}}, `{"gcp":{"serviceAccountKey":"[REDACTED]"}}`},
+		{"slack webhook", map[string]any{"config": map[string]string{"webhookUrl": "https://hooks.slack.com/services/x"}}, `{"config":{"webhookUrl":"[REDACTED]"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Redact(tt.in)); got != tt.want {
+				t.Errorf("Redact() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecorder_Record(t *testing.T) {
+	st := storetest.New(t)
+	rec := NewRecorder(st, testLogger())
+	ctx := context.Background()
+	actor := Actor{ID: "user-1", Email: "alice@example.com", IPAddress: "10.0.0.1", RequestID: "req-1"}
+
+	rec.Record(ctx, actor, Event{
+		Action:     "project.update",
+		TargetType: TargetProject,
+		TargetID:   "p-1",
+		ProjectID:  "p-1",
+		Before:     map[string]string{"name": "old"},
+		After:      map[string]string{"name": "new"},
+	})
+	rec.Record(ctx, actor, Event{Action: "project.create", TargetType: TargetProject, TargetID: "p-2", ProjectID: "p-2"})
+
+	entries, err := st.ListAuditEntries(ctx, store.AuditQuery{ProjectID: "p-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry for p-1, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Action != "project.update" || e.ActorEmail != "alice@example.com" || e.RequestID != "req-1" || e.IPAddress != "10.0.0.1" {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+	if string(e.Before) != `{"name":"old"}` || string(e.After) != `{"name":"new"}` {
+		t.Errorf("unexpected diff: before=%s after=%s", e.Before, e.After)
+	}
+
+	entries, err = st.ListAuditEntries(ctx, store.AuditQuery{Since: time.Now().UTC().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no entries in the future, got %d", len(entries))
+	}
+
+	entries, err = st.ListAuditEntries(ctx, store.AuditQuery{Since: time.Now().UTC().Add(-time.Hour), Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || string(entries[0].Before) != "null" {
+		t.Errorf("expected the latest create entry with a null before, got %+v", entries)
+	}
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var rec *Recorder
+	rec.Record(context.Background(), Actor{}, Event{Action: "project.create"})
+}
@@ -7,13 +7,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/gorilla/securecookie"
 	"golang.org/x/oauth2"
 
+	"github.com/inelson/finguard/internal/audit"
 	"github.com/inelson/finguard/internal/config"
 	"github.com/inelson/finguard/internal/models"
 	"github.com/inelson/finguard/internal/store"
@@ -26,7 +29,9 @@ const userContextKey contextKey = "finguard_user"
 const (
 	sessionCookieName = "finguard_session"
 	stateCookieName   = "finguard_oauth_state"
-	sessionMaxAge     = 24 * time.Hour
+
+	// sessionTouchInterval limits how often a session's last-seen time is written back.
+	sessionTouchInterval = time.Minute
 )
 
 type Manager struct {
@@ -35,11 +40,16 @@ type Manager struct {
 	oauth2Config oauth2.Config
 	cookie       *securecookie.SecureCookie
 	store        store.Store
+	auditor      *audit.Recorder
 	logger       *slog.Logger
 	disabled     bool
+	maxAge       time.Duration
+	idleTimeout  time.Duration
 }
 
+// SessionData is the authenticated identity attached to the request context.
 type SessionData struct {
+	SessionID   string    `json:"sessionId,omitempty"`
 	UserID      string    `json:"userId"`
 	Email       string    `json:"email"`
 	DisplayName string    `json:"displayName"`
@@ -47,10 +57,10 @@ type SessionData struct {
 	ExpiresAt   time.Time `json:"expiresAt"`
 }
 
-func NewManager(cfg *config.Config, st store.Store, logger *slog.Logger) (*Manager, error) {
+func NewManager(cfg *config.Config, st store.Store, auditor *audit.Recorder, logger *slog.Logger) (*Manager, error) {
 	if cfg.AuthDisabled || cfg.OIDCIssuer == "" {
 		logger.Info("authentication disabled")
-		return &Manager{disabled: true, store: st, logger: logger}, nil
+		return &Manager{disabled: true, store: st, auditor: auditor, logger: logger, maxAge: cfg.SessionMaxAge, idleTimeout: cfg.SessionIdleTimeout}, nil
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -84,7 +94,10 @@ func NewManager(cfg *config.Config, st store.Store, logger *slog.Logger) (*Manag
 		oauth2Config: oauth2Config,
 		cookie:       sc,
 		store:        st,
+		auditor:      auditor,
 		logger:       logger,
+		maxAge:       cfg.SessionMaxAge,
+		idleTimeout:  cfg.SessionIdleTimeout,
 	}, nil
 }
 
@@ -128,6 +141,7 @@ func (m *Manager) HandleCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if r.URL.Query().Get("state") != stateCookie.Value {
+		m.recordLoginFailure(r, "state mismatch")
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "state mismatch"})
 		return
 	}
@@ -147,12 +161,14 @@ func (m *Manager) HandleCallback(w http.ResponseWriter, r *http.Request) {
 	token, err := m.oauth2Config.Exchange(r.Context(), code)
 	if err != nil {
 		m.logger.Error("token exchange failed", "error", err)
+		m.recordLoginFailure(r, "token exchange failed")
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "token exchange failed"})
 		return
 	}
 
 	rawIDToken, ok := token.Extra("id_token").(string)
 	if !ok {
+		m.recordLoginFailure(r, "no id_token in response")
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "no id_token in response"})
 		return
 	}
@@ -160,6 +176,7 @@ func (m *Manager) HandleCallback(w http.ResponseWriter, r *http.Request) {
 	idToken, err := m.verifier.Verify(r.Context(), rawIDToken)
 	if err != nil {
 		m.logger.Error("id token verification failed", "error", err)
+		m.recordLoginFailure(r, "invalid id token")
 		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid id token"})
 		return
 	}
@@ -182,40 +199,120 @@ func (m *Manager) HandleCallback(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to provision user"})
 		return
 	}
+	if !user.Active {
+		m.recordLoginFailure(r, "user deactivated")
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "user is deactivated"})
+		return
+	}
 
-	session := SessionData{
-		UserID:      user.ID,
-		Email:       user.Email,
-		DisplayName: user.DisplayName,
-		Groups:      claims.Groups,
-		ExpiresAt:   time.Now().Add(sessionMaxAge),
+	sess := &models.Session{
+		UserID:       user.ID,
+		UserAgent:    r.UserAgent(),
+		IPAddress:    ClientIP(r),
+		Groups:       claims.Groups,
+		RefreshToken: token.RefreshToken,
+		ExpiresAt:    time.Now().UTC().Add(m.maxAge),
+	}
+	if !token.Expiry.IsZero() {
+		expiry := token.Expiry.UTC()
+		sess.TokenExpiresAt = &expiry
+	}
+	if err := m.store.CreateSession(r.Context(), sess); err != nil {
+		m.logger.Error("failed to persist session", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create session"})
+		return
 	}
 
-	encoded, err := m.encodeSession(session)
-	if err != nil {
+	if err := m.setSessionCookie(w, sess.ID); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create session"})
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     sessionCookieName,
-		Value:    encoded,
-		Path:     "/",
-		MaxAge:   int(sessionMaxAge.Seconds()),
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
+	m.auditor.Record(r.Context(), requestActor(r, user.ID, user.Email), audit.Event{
+		Action:     "auth.login",
+		TargetType: audit.TargetSession,
+		TargetID:   sess.ID,
+		After:      sess,
 	})
 
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
 func (m *Manager) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if !m.disabled {
+		if cookie, err := r.Cookie(sessionCookieName); err == nil {
+			if id, err := m.decodeSession(cookie.Value); err == nil {
+				m.logout(r, id)
+			}
+		}
+	}
+	ClearSessionCookie(w)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (m *Manager) logout(r *http.Request, sessionID string) {
+	ctx := r.Context()
+	sess, err := m.store.GetSession(ctx, sessionID)
+	if err != nil {
+		m.logger.Error("failed to load session on logout", "error", err)
+		return
+	}
+	if sess == nil || sess.RevokedAt != nil {
+		return
+	}
+	if err := m.store.RevokeSession(ctx, sessionID); err != nil {
+		m.logger.Error("failed to revoke session on logout", "error", err)
+		return
+	}
+
+	actor := requestActor(r, sess.UserID, "")
+	if user, err := m.store.GetUser(ctx, sess.UserID); err == nil && user != nil {
+		actor.Email = user.Email
+	}
+	m.auditor.Record(ctx, actor, audit.Event{
+		Action:     "auth.logout",
+		TargetType: audit.TargetSession,
+		TargetID:   sessionID,
+	})
+}
+
+// recordLoginFailure audits a rejected OIDC callback. The user is not known
+// yet, so only the request origin and the reason are recorded.
+func (m *Manager) recordLoginFailure(r *http.Request, reason string) {
+	m.auditor.Record(r.Context(), requestActor(r, "", ""), audit.Event{
+		Action:     "auth.login_failed",
+		TargetType: audit.TargetSession,
+		After:      map[string]string{"reason": reason},
+	})
+}
+
+// AuditActor describes the authenticated caller of r for the audit log.
+func AuditActor(r *http.Request) audit.Actor {
+	actor := requestActor(r, "", "")
+	if user := UserFromContext(r.Context()); user != nil {
+		actor.ID = user.UserID
+		actor.Email = user.Email
+	}
+	return actor
+}
+
+// requestActor describes the caller of r for the audit log.
+func requestActor(r *http.Request, userID, email string) audit.Actor {
+	return audit.Actor{
+		ID:        userID,
+		Email:     email,
+		IPAddress: ClientIP(r),
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+}
+
+// ClearSessionCookie instructs the browser to drop its session cookie.
+func ClearSessionCookie(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:   sessionCookieName,
 		Path:   "/",
 		MaxAge: -1,
 	})
-	http.Redirect(w, r, "/", http.StatusFound)
 }
 
 func (m *Manager) HandleUserInfo(w http.ResponseWriter, r *http.Request) {
@@ -241,22 +338,152 @@ func (m *Manager) Middleware(next http.Handler) http.Handler {
 			return
 		}
 
-		session, err := m.decodeSession(cookie.Value)
+		id, err := m.decodeSession(cookie.Value)
 		if err != nil {
 			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
 			return
 		}
 
-		if time.Now().After(session.ExpiresAt) {
-			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "session expired"})
+		session, status, msg := m.validateSession(w, r, id)
+		if session == nil {
+			writeJSON(w, status, map[string]string{"error": msg})
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), userContextKey, session)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), session)))
 	})
 }
 
+// validateSession loads the server-side session, enforces revocation, idle timeout
+// and expiry, and silently renews it with the IdP refresh token when one was issued.
+// On failure it returns a nil session with the status and message to send.
+func (m *Manager) validateSession(w http.ResponseWriter, r *http.Request, id string) (*SessionData, int, string) {
+	ctx := r.Context()
+	sess, err := m.store.GetSession(ctx, id)
+	if err != nil {
+		m.logger.Error("failed to load session", "error", err)
+		return nil, http.StatusInternalServerError, "failed to load session"
+	}
+	if sess == nil {
+		return nil, http.StatusUnauthorized, "invalid session"
+	}
+	if sess.RevokedAt != nil {
+		return nil, http.StatusUnauthorized, "session revoked"
+	}
+
+	now := time.Now().UTC()
+	if m.idleTimeout > 0 && now.Sub(sess.LastSeenAt) > m.idleTimeout {
+		m.revoke(ctx, sess.ID)
+		return nil, http.StatusUnauthorized, "session expired"
+	}
+
+	tokenExpired := sess.TokenExpiresAt != nil && now.After(*sess.TokenExpiresAt)
+	switch {
+	case sess.RefreshToken != "" && (tokenExpired || now.After(sess.ExpiresAt)):
+		if err := m.renewSession(ctx, sess); err != nil {
+			m.logger.Warn("session renewal failed", "sessionId", sess.ID, "userId", sess.UserID, "error", err)
+			m.revoke(ctx, sess.ID)
+			return nil, http.StatusUnauthorized, "session expired"
+		}
+		if err := m.setSessionCookie(w, sess.ID); err != nil {
+			m.logger.Error("failed to refresh session cookie", "error", err)
+		}
+	case now.After(sess.ExpiresAt):
+		return nil, http.StatusUnauthorized, "session expired"
+	}
+
+	user, err := m.store.GetUser(ctx, sess.UserID)
+	if err != nil {
+		m.logger.Error("failed to load session user", "error", err)
+		return nil, http.StatusInternalServerError, "failed to load session"
+	}
+	if user == nil {
+		return nil, http.StatusUnauthorized, "invalid session"
+	}
+	if !user.Active {
+		m.revoke(ctx, sess.ID)
+		return nil, http.StatusUnauthorized, "user is deactivated"
+	}
+
+	if now.Sub(sess.LastSeenAt) > sessionTouchInterval {
+		if err := m.store.TouchSession(ctx, sess.ID, now); err != nil {
+			m.logger.Error("failed to update session last-seen time", "error", err)
+		}
+	}
+
+	return &SessionData{
+		SessionID:   sess.ID,
+		UserID:      user.ID,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Groups:      sess.Groups,
+		ExpiresAt:   sess.ExpiresAt,
+	}, 0, ""
+}
+
+// renewSession exchanges the stored refresh token for a new one. A rejected
+// refresh means the IdP no longer vouches for the user, so the caller ends the session.
+func (m *Manager) renewSession(ctx context.Context, sess *models.Session) error {
+	expired := &oauth2.Token{RefreshToken: sess.RefreshToken, Expiry: time.Unix(1, 0)}
+	token, err := m.oauth2Config.TokenSource(ctx, expired).Token()
+	if err != nil {
+		return err
+	}
+
+	if token.RefreshToken != "" {
+		sess.RefreshToken = token.RefreshToken
+	}
+	sess.TokenExpiresAt = nil
+	if !token.Expiry.IsZero() {
+		expiry := token.Expiry.UTC()
+		sess.TokenExpiresAt = &expiry
+	}
+	sess.ExpiresAt = time.Now().UTC().Add(m.maxAge)
+	return m.store.UpdateSessionToken(ctx, sess)
+}
+
+func (m *Manager) revoke(ctx context.Context, id string) {
+	if err := m.store.RevokeSession(ctx, id); err != nil {
+		m.logger.Error("failed to revoke session", "sessionId", id, "error", err)
+	}
+}
+
+// StartSessionSweeper periodically purges revoked, idle and expired sessions until ctx is done.
+func (m *Manager) StartSessionSweeper(ctx context.Context, interval time.Duration) {
+	if m.disabled {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.store.DeleteStaleSessions(ctx, IdleBefore(time.Now(), m.idleTimeout)); err != nil {
+				m.logger.Error("failed to purge stale sessions", "error", err)
+			}
+		}
+	}
+}
+
+// IdleBefore returns the last-seen time before which a session has gone idle
+// at now, or the zero time if idleTimeout is not positive and sessions never
+// go idle.
+func IdleBefore(now time.Time, idleTimeout time.Duration) time.Time {
+	if idleTimeout <= 0 {
+		return time.Time{}
+	}
+	return now.UTC().Add(-idleTimeout)
+}
+
+// WithUser returns ctx carrying session as the signed-in user, as the auth
+// middleware does for authenticated requests.
+func WithUser(ctx context.Context, session *SessionData) context.Context {
+	return context.WithValue(ctx, userContextKey, session)
+}
+
 func UserFromContext(ctx context.Context) *SessionData {
 	session, _ := ctx.Value(userContextKey).(*SessionData)
 	return session
@@ -276,6 +503,14 @@ func (m *Manager) provisionUser(ctx context.Context, subject, email, name string
 		return nil, err
 	}
 	if user != nil {
+		// Users created ahead of their first login, e.g. by SCIM, are bound to
+		// their OIDC subject the first time they sign in.
+		if user.OIDCSubject == "" && subject != "" {
+			user.OIDCSubject = subject
+			if err := m.store.UpdateUser(ctx, user); err != nil {
+				return nil, fmt.Errorf("link oidc subject: %w", err)
+			}
+		}
 		return user, nil
 	}
 
@@ -287,6 +522,7 @@ func (m *Manager) provisionUser(ctx context.Context, subject, email, name string
 		Email:       email,
 		DisplayName: displayName,
 		OIDCSubject: subject,
+		Active:      true,
 	}
 	if err := m.store.CreateUser(ctx, user); err != nil {
 		return nil, fmt.Errorf("create user: %w", err)
@@ -294,6 +530,11 @@ func (m *Manager) provisionUser(ctx context.Context, subject, email, name string
 
 	m.logger.Info("provisioned new user from OIDC", "email", email, "subject", subject)
 
+	actor := audit.Actor{ID: user.ID, Email: user.Email}
+	if err := AcceptInvitations(ctx, m.store, m.auditor, actor, user); err != nil {
+		m.logger.Error("failed to accept project invitations", "email", email, "error", err)
+	}
+
 	for _, groupClaim := range groups {
 		m.syncGroup(ctx, groupClaim, user.ID)
 	}
@@ -322,24 +563,42 @@ func (m *Manager) syncGroup(ctx context.Context, claim, userID string) {
 	}
 }
 
-func (m *Manager) encodeSession(session SessionData) (string, error) {
-	data, err := json.Marshal(session)
+func (m *Manager) setSessionCookie(w http.ResponseWriter, sessionID string) error {
+	encoded, err := m.encodeSession(sessionID)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return m.cookie.Encode(sessionCookieName, string(data))
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    encoded,
+		Path:     "/",
+		MaxAge:   int(m.maxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
 }
 
-func (m *Manager) decodeSession(encoded string) (*SessionData, error) {
-	var raw string
-	if err := m.cookie.Decode(sessionCookieName, encoded, &raw); err != nil {
-		return nil, err
+// encodeSession signs the opaque session ID; all session state lives in the store.
+func (m *Manager) encodeSession(sessionID string) (string, error) {
+	return m.cookie.Encode(sessionCookieName, sessionID)
+}
+
+func (m *Manager) decodeSession(encoded string) (string, error) {
+	var sessionID string
+	if err := m.cookie.Decode(sessionCookieName, encoded, &sessionID); err != nil {
+		return "", err
 	}
-	var session SessionData
-	if err := json.Unmarshal([]byte(raw), &session); err != nil {
-		return nil, err
+	return sessionID, nil
+}
+
+// ClientIP returns the request's client address without the port. It relies on
+// the RealIP middleware having already rewritten RemoteAddr from proxy headers.
+func ClientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
 	}
-	return &session, nil
+	return r.RemoteAddr
 }
 
 func generateState() (string, error) {
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/stream"
+	"github.com/inelson/finguard/pkg/event"
+)
+
+// EventRoleExpired is published on event.TopicMembership when the sweeper
+// removes a time-bound role assignment.
+const EventRoleExpired = "role.expired"
+
+// RoleSweeper removes project role assignments whose expiry has passed.
+// Expired roles stop granting access immediately; the sweeper only cleans
+// them up and reports the removal.
+type RoleSweeper struct {
+	store   store.Store
+	hub     *stream.Hub
+	auditor *audit.Recorder
+	logger  *slog.Logger
+}
+
+func NewRoleSweeper(st store.Store, hub *stream.Hub, auditor *audit.Recorder, logger *slog.Logger) *RoleSweeper {
+	return &RoleSweeper{store: st, hub: hub, auditor: auditor, logger: logger}
+}
+
+// Start sweeps expired roles every interval until ctx is done.
+func (rs *RoleSweeper) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := rs.Sweep(ctx); err != nil {
+				rs.logger.Error("failed to sweep expired project roles", "error", err)
+			}
+		}
+	}
+}
+
+// Sweep removes every role that has expired by now, auditing and publishing
+// an event for each one.
+func (rs *RoleSweeper) Sweep(ctx context.Context) error {
+	expired, err := rs.store.DeleteExpiredProjectRoles(ctx, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	for _, pr := range expired {
+		rs.logger.Info("project role expired", "project", pr.ProjectID, "subjectType", pr.SubjectType, "subject", pr.SubjectID, "role", pr.Role)
+		rs.auditor.Record(ctx, audit.Actor{Email: "system"}, audit.Event{
+			Action:     "member.expire",
+			TargetType: audit.TargetMember,
+			TargetID:   pr.SubjectID,
+			ProjectID:  pr.ProjectID,
+			Before:     pr,
+		})
+		rs.publish(pr)
+	}
+	return nil
+}
+
+func (rs *RoleSweeper) publish(pr *models.ProjectRole) {
+	if rs.hub == nil {
+		return
+	}
+	e, err := event.New(EventRoleExpired, event.TopicMembership, "rbac", pr)
+	if err != nil {
+		rs.logger.Error("failed to create role expiry event", "error", err)
+		return
+	}
+	rs.hub.Publish(e)
+}
+
+// AcceptInvitations converts the pending project invitations for user's email
+// into role assignments. It is called whenever a user account is created.
+func AcceptInvitations(ctx context.Context, st store.Store, auditor *audit.Recorder, actor audit.Actor, user *models.User) error {
+	granted, err := st.AcceptProjectInvitations(ctx, user.Email, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, pr := range granted {
+		auditor.Record(ctx, actor, audit.Event{
+			Action:     "invitation.accept",
+			TargetType: audit.TargetMember,
+			TargetID:   pr.SubjectID,
+			ProjectID:  pr.ProjectID,
+			After:      pr,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+	"github.com/inelson/finguard/internal/stream"
+	"github.com/inelson/finguard/pkg/event"
+)
+
+func TestRoleSweeper_RemovesExpiredRoles(t *testing.T) {
+	rb, st, project := setupRBAC(t)
+	ctx := context.Background()
+
+	past := time.Now().UTC().Add(-time.Minute)
+	future := time.Now().UTC().Add(time.Hour)
+	assignments := []*models.ProjectRole{
+		{ProjectID: project.ID, SubjectType: models.SubjectUser, SubjectID: "contractor", Role: models.RoleEditor, ExpiresAt: &past},
+		{ProjectID: project.ID, SubjectType: models.SubjectUser, SubjectID: "temp", Role: models.RoleEditor, ExpiresAt: &future},
+		{ProjectID: project.ID, SubjectType: models.SubjectUser, SubjectID: "staff", Role: models.RoleEditor},
+	}
+	for _, a := range assignments {
+		if err := st.SetProjectRole(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if rb.hasPermission(ctx, &SessionData{UserID: "contractor"}, project.ID, models.PermCostsRead, grants) {
+		t.Error("expected an expired role to grant nothing before it is swept")
+	}
+	if !rb.hasPermission(ctx, &SessionData{UserID: "temp"}, project.ID, models.PermCostsRead, grants) {
+		t.Error("expected an unexpired role to grant access")
+	}
+
+	hub := stream.NewHub(testLogger())
+	client := hub.Register(ctx, nil)
+	defer hub.Unregister(client)
+	client.Subscribe(event.TopicMembership)
+
+	sweeper := NewRoleSweeper(st, hub, audit.NewRecorder(st, testLogger()), testLogger())
+	if err := sweeper.Sweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	roles, _ := st.ListProjectRoles(ctx, project.ID)
+	if len(roles) != 2 {
+		t.Fatalf("expected 2 remaining roles, got %d", len(roles))
+	}
+	for _, pr := range roles {
+		if pr.SubjectID == "contractor" {
+			t.Error("expected the expired role to be removed")
+		}
+	}
+
+	select {
+	case msg := <-client.Send():
+		var e event.Event
+		if err := json.Unmarshal(msg, &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Type != EventRoleExpired {
+			t.Errorf("expected %s event, got %s", EventRoleExpired, e.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for role expiry event")
+	}
+
+	entries, _ := st.ListAuditEntries(ctx, store.AuditQuery{Action: "member.expire"})
+	if len(entries) != 1 || entries[0].TargetID != "contractor" {
+		t.Errorf("expected one member.expire audit entry, got %+v", entries)
+	}
+}
+
+func TestProvisionUser_AcceptsInvitations(t *testing.T) {
+	st := storetest.New(t)
+	ctx := context.Background()
+	m := newTestManager(t, st, "")
+
+	project := &models.Project{Name: "payments"}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	expiry := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Second)
+	inv := &models.ProjectInvitation{ProjectID: project.ID, Email: "Contractor@Example.com", Role: models.RoleEditor, RoleExpiresAt: &expiry}
+	if err := st.CreateProjectInvitation(ctx, inv); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := m.provisionUser(ctx, "sub-1", "contractor@example.com", "Contractor", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := st.GetUserProjectRole(ctx, project.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr == nil || pr.Role != models.RoleEditor || pr.ExpiresAt == nil || !pr.ExpiresAt.Equal(expiry) {
+		t.Fatalf("expected editor role expiring at %s, got %+v", expiry, pr)
+	}
+	invitations, _ := st.ListProjectInvitations(ctx, project.ID)
+	if len(invitations) != 0 {
+		t.Errorf("expected the invitation to be consumed, got %d", len(invitations))
+	}
+}
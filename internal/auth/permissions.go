@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+var viewerPermissions = []models.Permission{
+	models.PermProjectsRead,
+	models.PermSourcesRead,
+	models.PermBudgetsRead,
+	models.PermMembersRead,
+	models.PermCostsRead,
+	models.PermNotificationsRead,
+	models.PermReportsRead,
+}
+
+var editorPermissions = append(append([]models.Permission{}, viewerPermissions...),
+	models.PermProjectsWrite,
+	models.PermSourcesWrite,
+	models.PermBudgetsWrite,
+	models.PermCostsExport,
+	models.PermNotificationsWrite,
+	models.PermReportsWrite,
+)
+
+var adminPermissions = append(append([]models.Permission{}, editorPermissions...),
+	models.PermProjectsDelete,
+	models.PermMembersManage,
+	models.PermAuditRead,
+	models.PermBudgetsEnforce,
+)
+
+// BuiltinRoles returns the roles that are defined in code and cannot be edited.
+// Platform admins bypass permission checks entirely and so are not listed.
+func BuiltinRoles() []*models.RoleDefinition {
+	return []*models.RoleDefinition{
+		{Name: string(models.RoleAdmin), Description: "Full control of the project, including members", Permissions: adminPermissions, BuiltIn: true},
+		{Name: string(models.RoleEditor), Description: "Manage sources and budgets", Permissions: editorPermissions, BuiltIn: true},
+		{Name: string(models.RoleViewer), Description: "Read-only access", Permissions: viewerPermissions, BuiltIn: true},
+	}
+}
+
+func builtinPermissions(role models.Role) ([]models.Permission, bool) {
+	switch role {
+	case models.RoleAdmin:
+		return adminPermissions, true
+	case models.RoleEditor:
+		return editorPermissions, true
+	case models.RoleViewer:
+		return viewerPermissions, true
+	default:
+		return nil, false
+	}
+}
+
+// IsBuiltinRole reports whether name is reserved for a role defined in code.
+func IsBuiltinRole(name string) bool {
+	_, ok := builtinPermissions(models.Role(name))
+	return ok || name == string(models.RolePlatformAdmin)
+}
+
+// ValidatePermission rejects unknown permission names. Source write permissions
+// may carry a cost source type suffix.
+func ValidatePermission(p models.Permission) error {
+	for _, known := range models.AllPermissions {
+		if p == known {
+			return nil
+		}
+	}
+	if t, ok := strings.CutPrefix(string(p), string(models.PermSourcesWrite)+":"); ok {
+		switch models.CostSourceType(t) {
+		case models.CostSourceAWS, models.CostSourceAzure, models.CostSourceGCP, models.CostSourceKubernetes, models.CostSourcePlugin:
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown permission %q", p)
+}
+
+// grants reports whether holding permission held satisfies want exactly: an
+// unscoped permission also covers every type-scoped variant of itself.
+func grants(held, want models.Permission) bool {
+	return held == want || strings.HasPrefix(string(want), string(held)+":")
+}
+
+// grantsAny is the looser check used at the route level, where the target type
+// is not known yet: a scoped permission admits the caller so the handler can
+// narrow the check once it has decoded the request.
+func grantsAny(held, want models.Permission) bool {
+	return grants(held, want) || strings.HasPrefix(string(held), string(want)+":")
+}
@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -19,10 +20,11 @@ func NewRBAC(st store.Store, disabled bool) *RBAC {
 	return &RBAC{store: st, disabled: disabled}
 }
 
-// RequireProjectRole returns middleware that checks the user has at least the given role on the project.
-// The project ID is extracted from the URL param "projectID".
-// Role hierarchy: platform-admin > admin > editor > viewer
-func (rb *RBAC) RequireProjectRole(minRole models.Role) func(http.Handler) http.Handler {
+// RequirePermission returns middleware that checks the user holds perm on the project
+// named by the URL param "projectID". Routes without a project ID are passed through.
+// A type-scoped grant such as "sources:write:kubernetes" satisfies "sources:write" here;
+// handlers narrow the check with Authorize once they know the target type.
+func (rb *RBAC) RequirePermission(perm models.Permission) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if rb.disabled {
@@ -42,7 +44,7 @@ func (rb *RBAC) RequireProjectRole(minRole models.Role) func(http.Handler) http.
 				return
 			}
 
-			if rb.hasSufficientRole(r.Context(), session, projectID, minRole) {
+			if rb.hasPermission(r.Context(), session, projectID, perm, grantsAny) {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -52,6 +54,18 @@ func (rb *RBAC) RequireProjectRole(minRole models.Role) func(http.Handler) http.
 	}
 }
 
+// Authorize reports whether the caller of r holds exactly perm on the project.
+func (rb *RBAC) Authorize(r *http.Request, projectID string, perm models.Permission) bool {
+	if rb.disabled {
+		return true
+	}
+	session := UserFromContext(r.Context())
+	if session == nil {
+		return false
+	}
+	return rb.hasPermission(r.Context(), session, projectID, perm, grants)
+}
+
 // RequirePlatformAdmin returns middleware that only allows platform-admin users.
 func (rb *RBAC) RequirePlatformAdmin() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -77,38 +91,80 @@ func (rb *RBAC) RequirePlatformAdmin() func(http.Handler) http.Handler {
 	}
 }
 
-func (rb *RBAC) hasSufficientRole(ctx context.Context, session *SessionData, projectID string, minRole models.Role) bool {
+func (rb *RBAC) hasPermission(ctx context.Context, session *SessionData, projectID string, perm models.Permission, match func(held, want models.Permission) bool) bool {
 	if rb.isPlatformAdmin(ctx, session) {
 		return true
 	}
 
-	pr, err := rb.store.GetUserProjectRole(ctx, projectID, session.UserID)
-	if err != nil || pr == nil {
-		for _, groupClaim := range session.Groups {
-			group, err := rb.store.GetGroupByOIDCClaim(ctx, groupClaim)
-			if err != nil || group == nil {
-				continue
-			}
-			roles, err := rb.store.ListProjectRoles(ctx, projectID)
-			if err != nil {
-				continue
-			}
-			for _, role := range roles {
-				if role.SubjectType == models.SubjectGroup && role.SubjectID == group.ID {
-					if roleLevel(role.Role) >= roleLevel(minRole) {
-						return true
-					}
-				}
+	roles, err := rb.subjectRoles(ctx, session, projectID)
+	if err != nil {
+		return false
+	}
+	for _, role := range roles {
+		for _, held := range rb.rolePermissions(ctx, role) {
+			if match(held, perm) {
+				return true
 			}
 		}
-		return false
 	}
+	return false
+}
 
-	return roleLevel(pr.Role) >= roleLevel(minRole)
+// subjectRoles returns the roles the user holds on the project, directly or
+// through any of their groups: those in the session's OIDC groups claim and
+// those the user was added to by directory sync.
+func (rb *RBAC) subjectRoles(ctx context.Context, session *SessionData, projectID string) ([]models.Role, error) {
+	assignments, err := rb.store.ListProjectRoles(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	groupIDs := map[string]bool{}
+	for _, groupClaim := range session.Groups {
+		group, err := rb.store.GetGroupByOIDCClaim(ctx, groupClaim)
+		if err != nil || group == nil {
+			continue
+		}
+		groupIDs[group.ID] = true
+	}
+	synced, err := rb.store.ListUserGroups(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range synced {
+		groupIDs[group.ID] = true
+	}
+
+	now := time.Now()
+	var roles []models.Role
+	for _, a := range assignments {
+		switch {
+		case a.Expired(now):
+			// Expired roles grant nothing even before the sweeper removes them.
+		case a.SubjectType == models.SubjectUser && a.SubjectID == session.UserID:
+			roles = append(roles, a.Role)
+		case a.SubjectType == models.SubjectGroup && groupIDs[a.SubjectID]:
+			roles = append(roles, a.Role)
+		}
+	}
+	return roles, nil
+}
+
+// rolePermissions resolves a built-in or custom role to its permissions.
+// Unknown roles, e.g. a custom role that has since been deleted, grant nothing.
+func (rb *RBAC) rolePermissions(ctx context.Context, role models.Role) []models.Permission {
+	if perms, ok := builtinPermissions(role); ok {
+		return perms
+	}
+	def, err := rb.store.GetRole(ctx, string(role))
+	if err != nil || def == nil {
+		return nil
+	}
+	return def.Permissions
 }
 
 func (rb *RBAC) isPlatformAdmin(ctx context.Context, session *SessionData) bool {
-	roles, err := rb.store.ListProjectRoles(ctx, "_global")
+	roles, err := rb.store.ListProjectRoles(ctx, models.GlobalProjectID)
 	if err != nil {
 		return false
 	}
@@ -119,18 +175,3 @@ func (rb *RBAC) isPlatformAdmin(ctx context.Context, session *SessionData) bool
 	}
 	return false
 }
-
-func roleLevel(role models.Role) int {
-	switch role {
-	case models.RolePlatformAdmin:
-		return 100
-	case models.RoleAdmin:
-		return 30
-	case models.RoleEditor:
-		return 20
-	case models.RoleViewer:
-		return 10
-	default:
-		return 0
-	}
-}
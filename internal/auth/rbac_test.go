@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+)
+
+func TestGrants(t *testing.T) {
+	tests := []struct {
+		held, want models.Permission
+		exact, any bool
+	}{
+		{"sources:write", "sources:write", true, true},
+		{"sources:write", "sources:write:aws_account", true, true},
+		{"sources:write:kubernetes", "sources:write:kubernetes", true, true},
+		{"sources:write:kubernetes", "sources:write:aws_account", false, false},
+		{"sources:write:kubernetes", "sources:write", false, true},
+		{"sources:read", "sources:write", false, false},
+		{"budgets:write", "budgets:writer", false, false},
+	}
+	for _, tt := range tests {
+		if got := grants(tt.held, tt.want); got != tt.exact {
+			t.Errorf("grants(%s, %s) = %v, want %v", tt.held, tt.want, got, tt.exact)
+		}
+		if got := grantsAny(tt.held, tt.want); got != tt.any {
+			t.Errorf("grantsAny(%s, %s) = %v, want %v", tt.held, tt.want, got, tt.any)
+		}
+	}
+}
+
+func TestValidatePermission(t *testing.T) {
+	for _, p := range []models.Permission{"costs:read", "sources:write:kubernetes", "members:manage"} {
+		if err := ValidatePermission(p); err != nil {
+			t.Errorf("expected %s to be valid, got %v", p, err)
+		}
+	}
+	for _, p := range []models.Permission{"costs:write", "sources:write:openstack", "sources:read:aws_account", ""} {
+		if err := ValidatePermission(p); err == nil {
+			t.Errorf("expected %q to be rejected", p)
+		}
+	}
+}
+
+func setupRBAC(t *testing.T) (*RBAC, store.Store, *models.Project) {
+	t.Helper()
+	st := storetest.New(t)
+	ctx := context.Background()
+	project := &models.Project{Name: "payments"}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	return NewRBAC(st, false), st, project
+}
+
+func TestRBAC_BuiltinAndCustomRoles(t *testing.T) {
+	rb, st, project := setupRBAC(t)
+	ctx := context.Background()
+
+	finance := &models.RoleDefinition{Name: "finance", Permissions: []models.Permission{models.PermCostsRead, models.PermBudgetsWrite}}
+	if err := st.CreateRole(ctx, finance); err != nil {
+		t.Fatal(err)
+	}
+	group := &models.Group{Name: "app-team", OIDCClaim: "app-team"}
+	if err := st.CreateGroup(ctx, group); err != nil {
+		t.Fatal(err)
+	}
+	appTeam := &models.RoleDefinition{Name: "k8s-onboarder", Permissions: []models.Permission{models.SourceWritePermission(models.CostSourceKubernetes)}}
+	if err := st.CreateRole(ctx, appTeam); err != nil {
+		t.Fatal(err)
+	}
+
+	assignments := []*models.ProjectRole{
+		{ProjectID: project.ID, SubjectType: models.SubjectUser, SubjectID: "viewer-1", Role: models.RoleViewer},
+		{ProjectID: project.ID, SubjectType: models.SubjectUser, SubjectID: "finance-1", Role: "finance"},
+		{ProjectID: project.ID, SubjectType: models.SubjectGroup, SubjectID: group.ID, Role: "k8s-onboarder"},
+	}
+	for _, a := range assignments {
+		if err := st.SetProjectRole(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		session *SessionData
+		perm    models.Permission
+		want    bool
+	}{
+		{"viewer reads costs", &SessionData{UserID: "viewer-1"}, models.PermCostsRead, true},
+		{"viewer cannot write budgets", &SessionData{UserID: "viewer-1"}, models.PermBudgetsWrite, false},
+		{"finance writes budgets", &SessionData{UserID: "finance-1"}, models.PermBudgetsWrite, true},
+		{"finance cannot touch sources", &SessionData{UserID: "finance-1"}, models.SourceWritePermission(models.CostSourceAWS), false},
+		{"group adds kubernetes sources", &SessionData{UserID: "dev-1", Groups: []string{"app-team"}}, models.SourceWritePermission(models.CostSourceKubernetes), true},
+		{"group cannot add aws sources", &SessionData{UserID: "dev-1", Groups: []string{"app-team"}}, models.SourceWritePermission(models.CostSourceAWS), false},
+		{"no assignment", &SessionData{UserID: "stranger"}, models.PermProjectsRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rb.hasPermission(ctx, tt.session, project.ID, tt.perm, grants); got != tt.want {
+				t.Errorf("hasPermission(%s) = %v, want %v", tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	rb, st, project := setupRBAC(t)
+	ctx := context.Background()
+
+	role := &models.RoleDefinition{Name: "k8s-onboarder", Permissions: []models.Permission{models.SourceWritePermission(models.CostSourceKubernetes)}}
+	if err := st.CreateRole(ctx, role); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetProjectRole(ctx, &models.ProjectRole{ProjectID: project.ID, SubjectType: models.SubjectUser, SubjectID: "dev-1", Role: "k8s-onboarder"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.With(rb.RequirePermission(models.PermSourcesWrite)).Post("/projects/{projectID}/sources", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r.With(rb.RequirePermission(models.PermMembersManage)).Post("/projects/{projectID}/members", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/projects/" + project.ID + "/sources", http.StatusOK},
+		{"/projects/" + project.ID + "/members", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), userContextKey, &SessionData{UserID: "dev-1"}))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.want, w.Code)
+		}
+	}
+}
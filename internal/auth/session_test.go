@@ -0,0 +1,307 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"golang.org/x/oauth2"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func newTestManager(t *testing.T, st store.Store, tokenURL string) *Manager {
+	t.Helper()
+	return &Manager{
+		oauth2Config: oauth2.Config{ClientID: "finguard", Endpoint: oauth2.Endpoint{TokenURL: tokenURL}},
+		cookie:       securecookie.New(securecookie.GenerateRandomKey(32), nil),
+		store:        st,
+		logger:       testLogger(),
+		maxAge:       time.Hour,
+		idleTimeout:  30 * time.Minute,
+	}
+}
+
+func createTestSession(t *testing.T, st store.Store, sess *models.Session) *models.Session {
+	t.Helper()
+	ctx := context.Background()
+	user := &models.User{Email: "alice@example.com", DisplayName: "Alice", Active: true}
+	if err := st.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	sess.UserID = user.ID
+	if sess.ExpiresAt.IsZero() {
+		sess.ExpiresAt = time.Now().UTC().Add(time.Hour)
+	}
+	if err := st.CreateSession(ctx, sess); err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+// serveWithSession runs a request carrying the session cookie through the middleware
+// and returns the recorder and the session data seen by the handler, if any.
+func serveWithSession(t *testing.T, m *Manager, sessionID string) (*httptest.ResponseRecorder, *SessionData) {
+	t.Helper()
+	encoded, err := m.encodeSession(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen *SessionData
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = UserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: encoded})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w, seen
+}
+
+func TestMiddleware_ValidSession(t *testing.T) {
+	st := storetest.New(t)
+	m := newTestManager(t, st, "")
+	sess := createTestSession(t, st, &models.Session{Groups: []string{"finance"}})
+
+	w, seen := serveWithSession(t, m, sess.ID)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if seen == nil || seen.SessionID != sess.ID || seen.Email != "alice@example.com" {
+		t.Fatalf("unexpected session data: %+v", seen)
+	}
+	if len(seen.Groups) != 1 || seen.Groups[0] != "finance" {
+		t.Errorf("expected groups [finance], got %v", seen.Groups)
+	}
+}
+
+func TestMiddleware_RevokedSession(t *testing.T) {
+	st := storetest.New(t)
+	m := newTestManager(t, st, "")
+	sess := createTestSession(t, st, &models.Session{})
+
+	if err := st.RevokeUserSessions(context.Background(), sess.UserID); err != nil {
+		t.Fatal(err)
+	}
+
+	w, seen := serveWithSession(t, m, sess.ID)
+	if w.Code != http.StatusUnauthorized || seen != nil {
+		t.Errorf("expected 401 for revoked session, got %d", w.Code)
+	}
+}
+
+func TestMiddleware_IdleTimeout(t *testing.T) {
+	st := storetest.New(t)
+	m := newTestManager(t, st, "")
+	sess := createTestSession(t, st, &models.Session{})
+
+	if err := st.TouchSession(context.Background(), sess.ID, time.Now().UTC().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	w, _ := serveWithSession(t, m, sess.ID)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for idle session, got %d", w.Code)
+	}
+
+	stored, _ := st.GetSession(context.Background(), sess.ID)
+	if stored.RevokedAt == nil {
+		t.Error("expected idle session to be revoked")
+	}
+}
+
+func TestMiddleware_DeactivatedUser(t *testing.T) {
+	st := storetest.New(t)
+	m := newTestManager(t, st, "")
+	sess := createTestSession(t, st, &models.Session{})
+
+	user, _ := st.GetUser(context.Background(), sess.UserID)
+	user.Active = false
+	if err := st.UpdateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	w, _ := serveWithSession(t, m, sess.ID)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for deactivated user, got %d", w.Code)
+	}
+	stored, _ := st.GetSession(context.Background(), sess.ID)
+	if stored.RevokedAt == nil {
+		t.Error("expected deactivated user's session to be revoked")
+	}
+}
+
+func TestMiddleware_ExpiredWithoutRefreshToken(t *testing.T) {
+	st := storetest.New(t)
+	m := newTestManager(t, st, "")
+	sess := createTestSession(t, st, &models.Session{ExpiresAt: time.Now().UTC().Add(-time.Minute)})
+
+	w, _ := serveWithSession(t, m, sess.ID)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for expired session, got %d", w.Code)
+	}
+}
+
+func TestMiddleware_SilentRenewal(t *testing.T) {
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "refresh-1" {
+			t.Errorf("unexpected token request: %v", r.Form)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access-2",
+			"refresh_token": "refresh-2",
+			"token_type":    "Bearer",
+			"expires_in":    300,
+		})
+	}))
+	defer idp.Close()
+
+	st := storetest.New(t)
+	m := newTestManager(t, st, idp.URL)
+	sess := createTestSession(t, st, &models.Session{
+		RefreshToken: "refresh-1",
+		ExpiresAt:    time.Now().UTC().Add(-time.Minute),
+	})
+
+	w, seen := serveWithSession(t, m, sess.ID)
+	if w.Code != http.StatusOK || seen == nil {
+		t.Fatalf("expected renewed session to pass, got %d", w.Code)
+	}
+
+	stored, _ := st.GetSession(context.Background(), sess.ID)
+	if stored.RefreshToken != "refresh-2" {
+		t.Errorf("expected rotated refresh token, got %q", stored.RefreshToken)
+	}
+	if !stored.ExpiresAt.After(time.Now()) {
+		t.Errorf("expected session expiry to be extended, got %s", stored.ExpiresAt)
+	}
+	if len(w.Result().Cookies()) == 0 {
+		t.Error("expected session cookie to be re-issued")
+	}
+}
+
+func TestMiddleware_RenewalRejected(t *testing.T) {
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+	}))
+	defer idp.Close()
+
+	st := storetest.New(t)
+	m := newTestManager(t, st, idp.URL)
+	sess := createTestSession(t, st, &models.Session{
+		RefreshToken: "refresh-1",
+		ExpiresAt:    time.Now().UTC().Add(-time.Minute),
+	})
+
+	w, _ := serveWithSession(t, m, sess.ID)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 when the IdP rejects renewal, got %d", w.Code)
+	}
+
+	stored, _ := st.GetSession(context.Background(), sess.ID)
+	if stored.RevokedAt == nil {
+		t.Error("expected session to be revoked after failed renewal")
+	}
+}
+
+func TestLogout_RevokesSession(t *testing.T) {
+	st := storetest.New(t)
+	m := newTestManager(t, st, "")
+	sess := createTestSession(t, st, &models.Session{})
+
+	encoded, _ := m.encodeSession(sess.ID)
+	req := httptest.NewRequest(http.MethodGet, "/logout", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: encoded})
+	w := httptest.NewRecorder()
+
+	m.HandleLogout(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Errorf("expected redirect, got %d", w.Code)
+	}
+	stored, _ := st.GetSession(context.Background(), sess.ID)
+	if stored.RevokedAt == nil {
+		t.Error("expected logout to revoke the session")
+	}
+}
+
+func TestDeleteStaleSessions_NoIdleTimeout(t *testing.T) {
+	st := storetest.New(t)
+	ctx := context.Background()
+	sess := createTestSession(t, st, &models.Session{})
+	if err := st.TouchSession(ctx, sess.ID, time.Now().UTC().Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.DeleteStaleSessions(ctx, IdleBefore(time.Now(), 0)); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := st.GetSession(ctx, sess.ID); stored == nil {
+		t.Fatal("expected a live session to survive the sweep without an idle timeout")
+	}
+
+	if err := st.DeleteStaleSessions(ctx, IdleBefore(time.Now(), time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := st.GetSession(ctx, sess.ID); stored != nil {
+		t.Error("expected the idle session to be purged with an idle timeout")
+	}
+}
+
+func TestListUserSessions_OnlyUsable(t *testing.T) {
+	st := storetest.New(t)
+	ctx := context.Background()
+	active := createTestSession(t, st, &models.Session{})
+	now := time.Now().UTC()
+
+	idle := &models.Session{UserID: active.UserID, ExpiresAt: now.Add(time.Hour)}
+	expired := &models.Session{UserID: active.UserID, ExpiresAt: now.Add(-time.Minute)}
+	renewable := &models.Session{UserID: active.UserID, ExpiresAt: now.Add(-time.Minute), RefreshToken: "refresh"}
+	revoked := &models.Session{UserID: active.UserID, ExpiresAt: now.Add(time.Hour)}
+	for _, sess := range []*models.Session{idle, expired, renewable, revoked} {
+		if err := st.CreateSession(ctx, sess); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.TouchSession(ctx, idle.ID, now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.RevokeSession(ctx, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := st.ListUserSessions(ctx, active.UserID, IdleBefore(now, 30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, sess := range sessions {
+		got[sess.ID] = true
+	}
+	if len(got) != 2 || !got[active.ID] || !got[renewable.ID] {
+		t.Errorf("expected only the active and renewable sessions, got %d sessions", len(sessions))
+	}
+
+	sessions, _ = st.ListUserSessions(ctx, active.UserID, IdleBefore(now, 0))
+	if len(sessions) != 3 {
+		t.Errorf("expected the idle session to be listed without an idle timeout, got %d sessions", len(sessions))
+	}
+}
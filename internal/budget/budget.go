@@ -0,0 +1,316 @@
+// Package budget evaluates project budgets against collected cost records and
+// publishes an event each time spend crosses one of a budget's threshold tiers.
+package budget
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/stream"
+	"github.com/inelson/finguard/pkg/event"
+)
+
+// State summarises how a budget's period-to-date spend compares to its amount.
+type State string
+
+const (
+	StateOK       State = "ok"
+	StateWarning  State = "warning"
+	StateExceeded State = "exceeded"
+)
+
+// Status is a budget together with its spend for the current period. Spend is
+// the net cost of the project's cost records that match the budget's filter,
+// narrowed to the budget's cost source when it has one. Tier is the highest
+// threshold the spend has reached as a fraction of EffectiveAmount: tiers
+// below 1 are warnings, and 1 or above means the budget is exceeded.
+type Status struct {
+	*models.Budget
+	PeriodStart     time.Time                `json:"periodStart"`
+	PeriodEnd       time.Time                `json:"periodEnd"`
+	PlannedAmount   float64                  `json:"plannedAmount"`
+	RolloverAmount  float64                  `json:"rolloverAmount"`
+	EffectiveAmount float64                  `json:"effectiveAmount"`
+	CurrentSpend    float64                  `json:"currentSpend"`
+	Utilization     float64                  `json:"utilization"`
+	ProjectedSpend  float64                  `json:"projectedSpend"`
+	Tier            float64                  `json:"tier"`
+	State           State                    `json:"state"`
+	Alert           *models.BudgetAlertState `json:"alert,omitempty"`
+}
+
+// Alert is the payload of a budget event.
+type Alert struct {
+	*Status
+	PreviousState State   `json:"previousState"`
+	PreviousTier  float64 `json:"previousTier"`
+	Reminder      bool    `json:"reminder,omitempty"`
+}
+
+// Config tunes budget periods and how often alerts are repeated.
+type Config struct {
+	// FiscalYearStart is the month quarterly and annual periods, plans and
+	// rollover are aligned to. Zero means January.
+	FiscalYearStart time.Month
+	// ReminderInterval re-sends an unacknowledged alert while its tier holds.
+	// Zero disables reminders.
+	ReminderInterval time.Duration
+}
+
+// ErrNothingToAcknowledge is returned by Acknowledge when the budget has no
+// active alert.
+var ErrNothingToAcknowledge = errors.New("budget has no active alert")
+
+// Evaluate computes b's period-to-date spend as of now and projects it
+// linearly to the end of the period. Utilization and tiers are measured
+// against the effective amount: the period's planned amount plus, for
+// budgets with rollover, the balance left unspent by earlier periods of the
+// same fiscal year.
+func Evaluate(ctx context.Context, st store.Store, b *models.Budget, fiscalStart time.Month, now time.Time) (*Status, error) {
+	start, end, index := PeriodBounds(b.Period, fiscalStart, now)
+	spend, err := periodSpend(ctx, st, b, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Budget:         b,
+		PeriodStart:    start,
+		PeriodEnd:      end,
+		PlannedAmount:  plannedAmount(b, index),
+		CurrentSpend:   spend,
+		ProjectedSpend: spend,
+		State:          StateOK,
+	}
+	if b.Rollover {
+		if status.RolloverAmount, err = rollover(ctx, st, b, fiscalStart, start); err != nil {
+			return nil, err
+		}
+	}
+	status.EffectiveAmount = status.PlannedAmount + status.RolloverAmount
+
+	if elapsed := now.Sub(start); elapsed > 0 {
+		status.ProjectedSpend = spend * float64(end.Sub(start)) / float64(elapsed)
+	}
+	if status.EffectiveAmount > 0 {
+		status.Utilization = spend / status.EffectiveAmount
+		for _, threshold := range b.Thresholds {
+			if status.Utilization >= threshold && threshold > status.Tier {
+				status.Tier = threshold
+			}
+		}
+	}
+	status.State = tierState(status.Tier)
+	return status, nil
+}
+
+// rollover returns the unspent balance carried into the period starting at
+// periodStart. Each earlier period of the fiscal year passes on whatever is
+// left of its planned amount plus its own carry; overspend is not carried.
+func rollover(ctx context.Context, st store.Store, b *models.Budget, fiscalStart time.Month, periodStart time.Time) (float64, error) {
+	carry := 0.0
+	for start, index := FiscalYearStart(fiscalStart, periodStart), 0; start.Before(periodStart); index++ {
+		end := start.AddDate(0, periodMonths(b.Period), 0)
+		spend, err := periodSpend(ctx, st, b, start, end)
+		if err != nil {
+			return 0, err
+		}
+		carry = max(0, plannedAmount(b, index)+carry-spend)
+		start = end
+	}
+	return carry, nil
+}
+
+func periodSpend(ctx context.Context, st store.Store, b *models.Budget, start, end time.Time) (float64, error) {
+	q := store.CostQuery{CostFilter: b.Filter, ProjectID: b.ProjectID, StartTime: start, EndTime: end}
+	if b.CostSourceID != nil {
+		q.CostSourceID = *b.CostSourceID
+	}
+	summary, err := st.AggregateCosts(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	return summary.TotalNetCost, nil
+}
+
+func tierState(tier float64) State {
+	switch {
+	case tier >= 1:
+		return StateExceeded
+	case tier > 0:
+		return StateWarning
+	default:
+		return StateOK
+	}
+}
+
+// Evaluator checks every budget after each cost collection and publishes an
+// event when a budget moves to a different threshold tier. The last tier
+// alerted on is persisted, so a condition that holds is not re-announced on
+// every run.
+type Evaluator struct {
+	store  store.Store
+	hub    *stream.Hub
+	config Config
+	logger *slog.Logger
+	now    func() time.Time
+	hooks  []Hook
+	outbox Outbox
+}
+
+// Hook is called when an evaluation moves a budget into the exceeded state.
+type Hook func(ctx context.Context, status *Status)
+
+// Outbox returns the notification deliveries an event is owed.
+type Outbox interface {
+	Deliveries(ctx context.Context, e *event.Event) ([]*models.NotificationDelivery, error)
+}
+
+func NewEvaluator(st store.Store, hub *stream.Hub, cfg Config, logger *slog.Logger) *Evaluator {
+	return &Evaluator{store: st, hub: hub, config: cfg, logger: logger, now: time.Now}
+}
+
+// AddHook registers fn to run each time a budget becomes exceeded. Hooks must
+// be added before the evaluator first runs.
+func (e *Evaluator) AddHook(fn Hook) {
+	e.hooks = append(e.hooks, fn)
+}
+
+// SetOutbox makes the evaluator record the deliveries of each budget event in
+// the same transaction as the alert state that raised it, so an alert is never
+// saved without them. It must be set before the evaluator first runs.
+func (e *Evaluator) SetOutbox(o Outbox) {
+	e.outbox = o
+}
+
+// Run evaluates the budgets of all projects. Failures are logged per budget
+// so that one bad budget does not stop the others from being checked.
+func (e *Evaluator) Run(ctx context.Context) {
+	projects, err := e.store.ListProjects(ctx)
+	if err != nil {
+		e.logger.Error("budget evaluator: failed to list projects", "error", err)
+		return
+	}
+	now := e.now().UTC()
+	for _, project := range projects {
+		budgets, err := e.store.ListBudgets(ctx, project.ID)
+		if err != nil {
+			e.logger.Error("budget evaluator: failed to list budgets", "project", project.ID, "error", err)
+			continue
+		}
+		for _, b := range budgets {
+			status, err := Evaluate(ctx, e.store, b, e.config.FiscalYearStart, now)
+			if err != nil {
+				e.logger.Error("budget evaluator: failed to evaluate budget", "budget", b.ID, "error", err)
+				continue
+			}
+			if err := e.transition(ctx, status, now); err != nil {
+				e.logger.Error("budget evaluator: failed to update alert state", "budget", b.ID, "error", err)
+			}
+		}
+	}
+}
+
+// transition compares status with the stored alert state and publishes an
+// event when the tier rises past anything acknowledged, when it falls, or when
+// an unacknowledged alert is due a reminder.
+func (e *Evaluator) transition(ctx context.Context, status *Status, now time.Time) error {
+	prev, err := e.store.GetBudgetAlertState(ctx, status.ID)
+	if err != nil {
+		return err
+	}
+	if prev == nil || !prev.PeriodStart.Equal(status.PeriodStart) {
+		// A new period starts from a clean slate, including acknowledgements.
+		prev = &models.BudgetAlertState{BudgetID: status.ID, PeriodStart: status.PeriodStart, State: string(StateOK)}
+	}
+
+	next := *prev
+	next.Tier = status.Tier
+	next.State = string(status.State)
+	if status.State == StateOK {
+		next.AcknowledgedTier = 0
+		next.AcknowledgedBy = ""
+	}
+
+	alert := &Alert{Status: status, PreviousState: State(prev.State), PreviousTier: prev.Tier}
+	notify := false
+	switch {
+	case status.Tier > prev.Tier:
+		notify = status.Tier > prev.AcknowledgedTier
+	case status.Tier < prev.Tier:
+		notify = true
+	case status.Tier > 0 && prev.AcknowledgedTier < status.Tier && e.reminderDue(prev, now):
+		notify = true
+		alert.Reminder = true
+	}
+	var ev *event.Event
+	var deliveries []*models.NotificationDelivery
+	if notify {
+		next.LastNotifiedAt = &now
+		status.Alert = &next
+		if ev, err = alertEvent(alert); err != nil {
+			return err
+		}
+		if e.outbox != nil {
+			if deliveries, err = e.outbox.Deliveries(ctx, ev); err != nil {
+				return err
+			}
+		}
+	}
+	if err := e.store.SaveBudgetAlertState(ctx, &next, deliveries...); err != nil {
+		return err
+	}
+	if ev != nil && e.hub != nil {
+		e.hub.Publish(ev)
+	}
+	if status.State == StateExceeded && State(prev.State) != StateExceeded {
+		for _, fn := range e.hooks {
+			fn(ctx, status)
+		}
+	}
+	return nil
+}
+
+func (e *Evaluator) reminderDue(st *models.BudgetAlertState, now time.Time) bool {
+	if e.config.ReminderInterval <= 0 || st.LastNotifiedAt == nil {
+		return false
+	}
+	return !now.Before(st.LastNotifiedAt.Add(e.config.ReminderInterval))
+}
+
+// alertEvent returns the event announcing alert, on the topic of its state.
+func alertEvent(alert *Alert) (*event.Event, error) {
+	topic := event.TopicBudgetWarning
+	switch alert.State {
+	case StateExceeded:
+		topic = event.TopicBudgetExceeded
+	case StateOK:
+		topic = event.TopicBudgetResolved
+	}
+	return event.New(string(alert.State), topic, "budgets", alert)
+}
+
+// Topics are the topics budget events are published on.
+var Topics = []string{event.TopicBudgetWarning, event.TopicBudgetExceeded, event.TopicBudgetResolved}
+
+// Acknowledge silences the budget's current alert until spend reaches a higher
+// tier or a new period starts.
+func Acknowledge(ctx context.Context, st store.Store, budgetID, by string) (*models.BudgetAlertState, error) {
+	state, err := st.GetBudgetAlertState(ctx, budgetID)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil || state.Tier == 0 {
+		return nil, ErrNothingToAcknowledge
+	}
+	state.AcknowledgedTier = state.Tier
+	state.AcknowledgedBy = by
+	if err := st.SaveBudgetAlertState(ctx, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
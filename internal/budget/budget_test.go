@@ -0,0 +1,450 @@
+package budget
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+	"github.com/inelson/finguard/internal/stream"
+	"github.com/inelson/finguard/pkg/event"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestPeriodBounds(t *testing.T) {
+	tests := []struct {
+		period      models.BudgetPeriod
+		fiscalStart time.Month
+		t           time.Time
+		wantStart   time.Time
+		wantEnd     time.Time
+		wantIndex   int
+	}{
+		{models.BudgetMonthly, time.January, date(2026, time.February, 14), date(2026, time.February, 1), date(2026, time.March, 1), 1},
+		{models.BudgetMonthly, time.January, date(2026, time.December, 31), date(2026, time.December, 1), date(2027, time.January, 1), 11},
+		{models.BudgetQuarterly, time.January, date(2026, time.January, 1), date(2026, time.January, 1), date(2026, time.April, 1), 0},
+		{models.BudgetQuarterly, time.January, date(2026, time.May, 20), date(2026, time.April, 1), date(2026, time.July, 1), 1},
+		{models.BudgetQuarterly, time.January, date(2026, time.December, 31), date(2026, time.October, 1), date(2027, time.January, 1), 3},
+		{models.BudgetAnnual, time.January, date(2026, time.August, 8), date(2026, time.January, 1), date(2027, time.January, 1), 0},
+		{models.BudgetMonthly, time.April, date(2026, time.March, 5), date(2026, time.March, 1), date(2026, time.April, 1), 11},
+		{models.BudgetQuarterly, time.April, date(2026, time.February, 10), date(2026, time.January, 1), date(2026, time.April, 1), 3},
+		{models.BudgetQuarterly, time.November, date(2026, time.December, 1), date(2026, time.November, 1), date(2027, time.February, 1), 0},
+		{models.BudgetAnnual, time.April, date(2026, time.March, 31), date(2025, time.April, 1), date(2026, time.April, 1), 0},
+	}
+	for _, tt := range tests {
+		start, end, index := PeriodBounds(tt.period, tt.fiscalStart, tt.t)
+		if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) || index != tt.wantIndex {
+			t.Errorf("PeriodBounds(%s, %s, %s) = %s, %s, %d, want %s, %s, %d", tt.period, tt.fiscalStart, tt.t.Format(time.DateOnly), start, end, index, tt.wantStart, tt.wantEnd, tt.wantIndex)
+		}
+	}
+}
+
+// seed creates a project with one cost source and a record of net cost spend
+// at the given time.
+func seed(t *testing.T, st store.Store, at time.Time, spend float64) *models.Project {
+	t.Helper()
+	ctx := context.Background()
+	project := &models.Project{Name: "payments"}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	cs := &models.CostSource{ProjectID: project.ID, Type: models.CostSourceAWS, Name: "aws", Enabled: true}
+	if err := st.CreateCostSource(ctx, cs); err != nil {
+		t.Fatal(err)
+	}
+	records := []*models.CostRecord{{ProjectID: project.ID, CostSourceID: cs.ID, Provider: "aws", Service: "ec2", StartTime: at, EndTime: at.Add(time.Hour), NetCost: spend}}
+	if err := st.InsertCostRecords(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+	return project
+}
+
+func TestEvaluate(t *testing.T) {
+	st := storetest.New(t)
+	project := seed(t, st, date(2026, time.April, 3), 300)
+	now := date(2026, time.April, 16) // halfway through a 30 day month
+
+	tests := []struct {
+		name          string
+		budget        models.Budget
+		wantState     State
+		wantTier      float64
+		wantProjected float64
+	}{
+		{"monthly ok", models.Budget{Period: models.BudgetMonthly, Amount: 1000, Thresholds: []float64{0.8, 1}}, StateOK, 0, 600},
+		{"monthly warning", models.Budget{Period: models.BudgetMonthly, Amount: 350, Thresholds: []float64{0.5, 0.8, 1}}, StateWarning, 0.8, 600},
+		{"monthly exceeded", models.Budget{Period: models.BudgetMonthly, Amount: 250, Thresholds: []float64{0.8, 1, 1.2}}, StateExceeded, 1.2, 600},
+		{"quarterly", models.Budget{Period: models.BudgetQuarterly, Amount: 3000, Thresholds: []float64{0.8, 1}}, StateOK, 0, 300 * 91.0 / 15},
+		{"annual", models.Budget{Period: models.BudgetAnnual, Amount: 3000, Thresholds: []float64{0.8, 1}}, StateOK, 0, 300 * 365.0 / 105},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.budget
+			b.ProjectID = project.ID
+			status, err := Evaluate(context.Background(), st, &b, time.January, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.CurrentSpend != 300 || status.State != tt.wantState || status.Tier != tt.wantTier {
+				t.Errorf("expected spend 300 at tier %v (%s), got %v at tier %v (%s)", tt.wantTier, tt.wantState, status.CurrentSpend, status.Tier, status.State)
+			}
+			if math.Abs(status.ProjectedSpend-tt.wantProjected) > 1e-6 {
+				t.Errorf("projected = %v, want %v", status.ProjectedSpend, tt.wantProjected)
+			}
+		})
+	}
+}
+
+func TestEvaluate_PlanAndRollover(t *testing.T) {
+	st := storetest.New(t)
+	ctx := context.Background()
+	// Fiscal year starting in April: spend 100 in April, 250 in May, 50 in June.
+	project := seed(t, st, date(2026, time.April, 3), 100)
+	sources, _ := st.ListCostSources(ctx, project.ID)
+	for _, r := range []struct {
+		at    time.Time
+		spend float64
+	}{{date(2026, time.May, 3), 250}, {date(2026, time.June, 3), 50}, {date(2026, time.March, 3), 500}} {
+		records := []*models.CostRecord{{ProjectID: project.ID, CostSourceID: sources[0].ID, Provider: "aws", Service: "ec2", StartTime: r.at, EndTime: r.at.Add(time.Hour), NetCost: r.spend}}
+		if err := st.InsertCostRecords(ctx, records); err != nil {
+			t.Fatal(err)
+		}
+	}
+	plan := []float64{200, 200, 100, 100, 100, 100, 100, 100, 100, 100, 100, 100}
+	now := date(2026, time.June, 16)
+
+	tests := []struct {
+		name          string
+		rollover      bool
+		wantPlanned   float64
+		wantRollover  float64
+		wantEffective float64
+		wantState     State
+	}{
+		// April leaves 100 of 200 unspent, May spends 250 of 200+100, so 50
+		// carries into June.
+		{"without rollover", false, 100, 0, 100, StateWarning},
+		{"with rollover", true, 100, 50, 150, StateOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &models.Budget{ProjectID: project.ID, Period: models.BudgetMonthly, Plan: plan, Rollover: tt.rollover, Thresholds: []float64{0.5, 1}}
+			status, err := Evaluate(ctx, st, b, time.April, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.PlannedAmount != tt.wantPlanned || status.RolloverAmount != tt.wantRollover || status.EffectiveAmount != tt.wantEffective || status.State != tt.wantState {
+				t.Errorf("got planned %v, rollover %v, effective %v (%s), want %v, %v, %v (%s)",
+					status.PlannedAmount, status.RolloverAmount, status.EffectiveAmount, status.State,
+					tt.wantPlanned, tt.wantRollover, tt.wantEffective, tt.wantState)
+			}
+		})
+	}
+
+	// In May the unspent April balance is carried over: 200 planned plus 100.
+	b := &models.Budget{ProjectID: project.ID, Period: models.BudgetMonthly, Plan: plan, Rollover: true, Thresholds: []float64{0.8, 1}}
+	status, err := Evaluate(ctx, st, b, time.April, date(2026, time.May, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.RolloverAmount != 100 || status.EffectiveAmount != 300 || status.State != StateWarning {
+		t.Errorf("expected 100 rolled over into an effective 300 (warning), got %v, %v (%s)", status.RolloverAmount, status.EffectiveAmount, status.State)
+	}
+
+	// Rollover does not cross into a new fiscal year: March spend is ignored in April.
+	status, err = Evaluate(ctx, st, b, time.April, date(2026, time.April, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.RolloverAmount != 0 || status.EffectiveAmount != 200 {
+		t.Errorf("expected no rollover at the start of the fiscal year, got %v, %v", status.RolloverAmount, status.EffectiveAmount)
+	}
+}
+
+func TestEvaluate_Filter(t *testing.T) {
+	st := storetest.New(t)
+	ctx := context.Background()
+	project := seed(t, st, date(2026, time.April, 3), 100)
+	sources, _ := st.ListCostSources(ctx, project.ID)
+	at := date(2026, time.April, 4)
+	record := func(service, region string, spend float64, labels map[string]string) *models.CostRecord {
+		return &models.CostRecord{ProjectID: project.ID, CostSourceID: sources[0].ID, Provider: "aws", Service: service, Region: region, StartTime: at, EndTime: at.Add(time.Hour), NetCost: spend, Labels: labels}
+	}
+	records := []*models.CostRecord{
+		record("rds", "us-east-1", 40, map[string]string{"env": "prod", "app.kubernetes.io/name": "billing"}),
+		record("rds", "eu-west-1", 20, map[string]string{"env": "dev"}),
+		record("s3", "us-east-1", 5, map[string]string{"env": "prod", `team"x`: "core"}),
+	}
+	if err := st.InsertCostRecords(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter models.CostFilter
+		want   float64
+	}{
+		{"everything", models.CostFilter{}, 165},
+		{"service", models.CostFilter{Service: "rds"}, 60},
+		{"service and region", models.CostFilter{Service: "rds", Region: "us-east-1"}, 40},
+		{"label", models.CostFilter{Labels: map[string]string{"env": "prod"}}, 45},
+		{"dotted label key", models.CostFilter{Labels: map[string]string{"app.kubernetes.io/name": "billing"}}, 40},
+		{"quoted label key", models.CostFilter{Labels: map[string]string{`team"x`: "core"}}, 5},
+		{"all labels must match", models.CostFilter{Labels: map[string]string{"env": "prod", "app.kubernetes.io/name": "other"}}, 0},
+		{"provider mismatch", models.CostFilter{Provider: "gcp"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &models.Budget{ProjectID: project.ID, Filter: tt.filter, Amount: 1000}
+			status, err := Evaluate(ctx, st, b, time.January, date(2026, time.April, 20))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.CurrentSpend != tt.want {
+				t.Errorf("spend = %v, want %v", status.CurrentSpend, tt.want)
+			}
+		})
+	}
+}
+
+// recv returns the next event published to client, or nil if none arrives.
+func recv(t *testing.T, client *stream.Client) *event.Event {
+	t.Helper()
+	select {
+	case msg := <-client.Send():
+		var e event.Event
+		if err := json.Unmarshal(msg, &e); err != nil {
+			t.Fatal(err)
+		}
+		return &e
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+}
+
+func TestEvaluator_EmitsOnlyOnTransitions(t *testing.T) {
+	st := storetest.New(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	project := seed(t, st, monthStart, 60)
+	b := &models.Budget{ProjectID: project.ID, Amount: 100}
+	if err := st.CreateBudget(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	sources, _ := st.ListCostSources(ctx, project.ID)
+	addSpend := func(amount float64) {
+		t.Helper()
+		records := []*models.CostRecord{{ProjectID: project.ID, CostSourceID: sources[0].ID, Provider: "aws", Service: "ec2", StartTime: monthStart, EndTime: monthStart.Add(time.Hour), NetCost: amount}}
+		if err := st.InsertCostRecords(ctx, records); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hub := stream.NewHub(testLogger())
+	client := hub.Register(ctx, nil)
+	defer hub.Unregister(client)
+	ev := NewEvaluator(st, hub, Config{ReminderInterval: time.Hour}, testLogger())
+	clock := monthStart.AddDate(0, 0, 10)
+	ev.now = func() time.Time { return clock }
+
+	// 60% crosses the 50% tier.
+	ev.Run(ctx)
+	if e := recv(t, client); e == nil || e.Topic != event.TopicBudgetWarning {
+		t.Fatalf("expected a warning at the 50%% tier, got %+v", e)
+	}
+	// Nothing changed: no event.
+	ev.Run(ctx)
+	if e := recv(t, client); e != nil {
+		t.Fatalf("expected no repeat event, got %+v", e)
+	}
+	// After the reminder interval the unacknowledged alert is repeated.
+	clock = clock.Add(time.Hour)
+	ev.Run(ctx)
+	e := recv(t, client)
+	var alert Alert
+	if e != nil {
+		json.Unmarshal(e.Payload, &alert)
+	}
+	if e == nil || !alert.Reminder {
+		t.Fatalf("expected a reminder, got %+v", e)
+	}
+
+	// Acknowledging silences reminders for the tier...
+	if _, err := Acknowledge(ctx, st, b.ID, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	clock = clock.Add(2 * time.Hour)
+	ev.Run(ctx)
+	if e := recv(t, client); e != nil {
+		t.Fatalf("expected the acknowledged alert to stay silent, got %+v", e)
+	}
+
+	// ...but not the next one.
+	addSpend(45)
+	ev.Run(ctx)
+	e = recv(t, client)
+	if e == nil || e.Topic != event.TopicBudgetExceeded {
+		t.Fatalf("expected an exceeded event at the 100%% tier, got %+v", e)
+	}
+	json.Unmarshal(e.Payload, &alert)
+	if alert.Tier != 1 || alert.PreviousTier != 0.5 {
+		t.Errorf("expected a 0.5 -> 1 transition, got %v -> %v", alert.PreviousTier, alert.Tier)
+	}
+
+	// Raising the amount resolves the alert.
+	b.Amount = 1000
+	if err := st.UpdateBudget(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	ev.Run(ctx)
+	if e := recv(t, client); e == nil || e.Topic != event.TopicBudgetResolved {
+		t.Fatalf("expected a resolved event, got %+v", e)
+	}
+	state, _ := st.GetBudgetAlertState(ctx, b.ID)
+	if state.State != string(StateOK) || state.AcknowledgedTier != 0 {
+		t.Errorf("expected the alert state to reset, got %+v", state)
+	}
+}
+
+func TestEvaluator_PublishesBreaches(t *testing.T) {
+	st := storetest.New(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	project := seed(t, st, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), 90)
+	for _, amount := range []float64{1000, 100, 50} {
+		if err := st.CreateBudget(ctx, &models.Budget{ProjectID: project.ID, Amount: amount, Thresholds: []float64{0.8, 1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hub := stream.NewHub(testLogger())
+	client := hub.Register(ctx, nil)
+	defer hub.Unregister(client)
+
+	NewEvaluator(st, hub, Config{}, testLogger()).Run(ctx)
+
+	got := map[string]string{}
+	for range 2 {
+		select {
+		case msg := <-client.Send():
+			var e event.Event
+			if err := json.Unmarshal(msg, &e); err != nil {
+				t.Fatal(err)
+			}
+			var status Status
+			json.Unmarshal(e.Payload, &status)
+			if status.ProjectID != project.ID {
+				t.Errorf("expected event for project %s, got %s", project.ID, status.ProjectID)
+			}
+			got[e.Topic] = e.Type
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for budget events")
+		}
+	}
+	if got[event.TopicBudgetWarning] != "warning" || got[event.TopicBudgetExceeded] != "exceeded" {
+		t.Errorf("expected one warning and one exceeded event, got %v", got)
+	}
+	select {
+	case msg := <-client.Send():
+		t.Errorf("unexpected event for a budget within limits: %s", msg)
+	default:
+	}
+}
+
+func TestEvaluator_RunsHooksWhenExceeded(t *testing.T) {
+	st := storetest.New(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	project := seed(t, st, monthStart, 90)
+	b := &models.Budget{ProjectID: project.ID, Amount: 100, Thresholds: []float64{0.8, 1, 1.2}}
+	if err := st.CreateBudget(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+
+	var exceeded []string
+	ev := NewEvaluator(st, nil, Config{}, testLogger())
+	ev.AddHook(func(ctx context.Context, status *Status) {
+		exceeded = append(exceeded, status.ID)
+	})
+	clock := monthStart.AddDate(0, 0, 10)
+	ev.now = func() time.Time { return clock }
+
+	ev.Run(ctx) // warning
+	b.Amount = 80
+	st.UpdateBudget(ctx, b)
+	ev.Run(ctx) // exceeded
+	b.Amount = 70
+	st.UpdateBudget(ctx, b)
+	ev.Run(ctx) // still exceeded, at a higher tier
+
+	if len(exceeded) != 1 || exceeded[0] != b.ID {
+		t.Errorf("expected the hook to run once when the budget became exceeded, got %v", exceeded)
+	}
+}
+
+// outboxFunc adapts a function to Outbox.
+type outboxFunc func(ctx context.Context, e *event.Event) ([]*models.NotificationDelivery, error)
+
+func (f outboxFunc) Deliveries(ctx context.Context, e *event.Event) ([]*models.NotificationDelivery, error) {
+	return f(ctx, e)
+}
+
+func TestEvaluator_RecordsDeliveriesWithAlertState(t *testing.T) {
+	st := storetest.New(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	project := seed(t, st, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), 90)
+	b := &models.Budget{ProjectID: project.ID, Amount: 50}
+	if err := st.CreateBudget(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	channel := &models.NotificationChannel{
+		ProjectID: project.ID, Type: models.ChannelWebhook, Name: "hook", Enabled: true,
+		Config: json.RawMessage(`{"url":"https://example.com/hook"}`),
+	}
+	if err := st.CreateNotificationChannel(ctx, channel); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := NewEvaluator(st, nil, Config{}, testLogger())
+	var failed error
+	ev.SetOutbox(outboxFunc(func(ctx context.Context, e *event.Event) ([]*models.NotificationDelivery, error) {
+		if failed != nil {
+			return nil, failed
+		}
+		raw, _ := json.Marshal(e)
+		return []*models.NotificationDelivery{{ChannelID: channel.ID, ProjectID: project.ID, Topic: e.Topic, Event: raw}}, nil
+	}))
+
+	// Without its deliveries the alert is not saved, so the next run raises
+	// it again.
+	failed = errors.New("database is locked")
+	ev.Run(ctx)
+	if state, _ := st.GetBudgetAlertState(ctx, b.ID); state != nil {
+		t.Fatalf("expected no alert state without its deliveries, got %+v", state)
+	}
+
+	failed = nil
+	ev.Run(ctx)
+	state, _ := st.GetBudgetAlertState(ctx, b.ID)
+	deliveries, _ := st.ListNotificationDeliveries(ctx, channel.ID, 10)
+	if state == nil || state.State != string(StateExceeded) || len(deliveries) != 1 || deliveries[0].Topic != event.TopicBudgetExceeded {
+		t.Fatalf("expected the alert state and its delivery, got %+v and %d deliveries", state, len(deliveries))
+	}
+}
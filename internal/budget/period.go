@@ -0,0 +1,61 @@
+package budget
+
+import (
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+// periodMonths returns the length of a budget period in months.
+func periodMonths(period models.BudgetPeriod) int {
+	switch period {
+	case models.BudgetQuarterly:
+		return 3
+	case models.BudgetAnnual:
+		return 12
+	default:
+		return 1
+	}
+}
+
+// PeriodsPerYear returns how many periods of the given kind make up a fiscal
+// year, i.e. how many entries a budget plan for that period must have.
+func PeriodsPerYear(period models.BudgetPeriod) int {
+	return 12 / periodMonths(period)
+}
+
+// FiscalYearStart returns the start of the fiscal year containing t, for a
+// fiscal year that begins on the first of fiscalStart. Months outside 1-12
+// are treated as January.
+func FiscalYearStart(fiscalStart time.Month, t time.Time) time.Time {
+	if fiscalStart < time.January || fiscalStart > time.December {
+		fiscalStart = time.January
+	}
+	t = t.UTC()
+	year := t.Year()
+	if t.Month() < fiscalStart {
+		year--
+	}
+	return time.Date(year, fiscalStart, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// PeriodBounds returns the UTC period of the given kind containing t as a
+// half-open interval [start, end), along with its zero-based index within the
+// fiscal year. Quarters and years are aligned to the fiscal year start.
+func PeriodBounds(period models.BudgetPeriod, fiscalStart time.Month, t time.Time) (start, end time.Time, index int) {
+	fy := FiscalYearStart(fiscalStart, t)
+	n := periodMonths(period)
+	monthsIn := (int(t.UTC().Month()) - int(fy.Month()) + 12) % 12
+	index = monthsIn / n
+	start = fy.AddDate(0, index*n, 0)
+	return start, start.AddDate(0, n, 0), index
+}
+
+// plannedAmount returns the amount budgeted for the period at index: the
+// plan's entry when the budget has a plan, otherwise its flat amount.
+func plannedAmount(b *models.Budget, index int) float64 {
+	if index < len(b.Plan) {
+		return b.Plan[index]
+	}
+	return b.Amount
+}
@@ -110,6 +110,12 @@ func (c *Cache) Stop() {
 	close(c.stopCh)
 }
 
+// Clientset returns the Kubernetes client the cache watches through, for
+// callers that need to change cluster state.
+func (c *Cache) Clientset() kubernetes.Interface {
+	return c.clientset
+}
+
 func (c *Cache) IsReady() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
 	"log/slog"
 	"time"
 
@@ -39,44 +40,51 @@ func (c *AWSCollector) Validate(_ context.Context, config json.RawMessage) error
 	return nil
 }
 
-// Collect queries AWS CUR data via Athena, similar to OpenCost's AthenaIntegration.
+// Collect gathers the records Stream yields.
+func (c *AWSCollector) Collect(ctx context.Context, source *models.CostSource, window collector.TimeWindow) ([]*models.CostRecord, error) {
+	return collector.Gather(c.Stream(ctx, source, window))
+}
+
+// Stream queries AWS CUR data via Athena, similar to OpenCost's AthenaIntegration,
+// yielding a record per result row as the pages of results arrive: a month of
+// CUR data runs to millions of rows.
 // The query groups by date, resource_id, account, product_code, usage_type, region.
 // Supports CUR 1.0 and 2.0 column layouts and dynamic resource tag extraction.
-func (c *AWSCollector) Collect(ctx context.Context, source *models.CostSource, window collector.TimeWindow) ([]*models.CostRecord, error) {
-	var cfg models.AWSConfig
-	if err := json.Unmarshal(source.Config, &cfg); err != nil {
-		return nil, fmt.Errorf("parse AWS config: %w", err)
+func (c *AWSCollector) Stream(ctx context.Context, source *models.CostSource, window collector.TimeWindow) iter.Seq2[*models.CostRecord, error] {
+	return func(yield func(*models.CostRecord, error) bool) {
+		var cfg models.AWSConfig
+		if err := json.Unmarshal(source.Config, &cfg); err != nil {
+			yield(nil, fmt.Errorf("parse AWS config: %w", err))
+			return
+		}
+
+		c.logger.Info("collecting AWS costs via Athena",
+			"account", cfg.AccountID,
+			"database", cfg.AthenaDatabase,
+			"table", cfg.AthenaTable,
+			"window", window,
+		)
+
+		// TODO: Implement actual Athena query execution using aws-sdk-go-v2/service/athena,
+		// paging through GetQueryResults and yielding athenaRowToRecord for each row.
+		// Reference: opencost/pkg/cloud/aws/athenaintegration.go
+		//
+		// The query pattern is:
+		//   SELECT line_item_usage_start_date, line_item_resource_id, line_item_usage_account_id,
+		//          product_product_name, line_item_usage_type, product_region_code,
+		//          SUM(line_item_unblended_cost) as list_cost,
+		//          SUM(line_item_net_unblended_cost) as net_cost,
+		//          SUM(reservation_effective_cost + savings_plan_savings_plan_effective_cost) as amortized_cost
+		//   FROM {database}.{table}
+		//   WHERE line_item_usage_start_date >= '{start}' AND line_item_usage_start_date < '{end}'
+		//   GROUP BY 1,2,3,4,5,6
+		//
+		// Supports dynamic tag columns (resource_tags_user_*) for label extraction.
+		// Handles CUR 2.0 partition differences (billing_period vs month).
+
+		c.logger.Warn("AWS Athena collection not yet implemented - returning empty results",
+			"account", cfg.AccountID)
 	}
-
-	c.logger.Info("collecting AWS costs via Athena",
-		"account", cfg.AccountID,
-		"database", cfg.AthenaDatabase,
-		"table", cfg.AthenaTable,
-		"window", window,
-	)
-
-	// TODO: Implement actual Athena query execution using aws-sdk-go-v2/service/athena.
-	// Reference: opencost/pkg/cloud/aws/athenaintegration.go
-	//
-	// The query pattern is:
-	//   SELECT line_item_usage_start_date, line_item_resource_id, line_item_usage_account_id,
-	//          product_product_name, line_item_usage_type, product_region_code,
-	//          SUM(line_item_unblended_cost) as list_cost,
-	//          SUM(line_item_net_unblended_cost) as net_cost,
-	//          SUM(reservation_effective_cost + savings_plan_savings_plan_effective_cost) as amortized_cost
-	//   FROM {database}.{table}
-	//   WHERE line_item_usage_start_date >= '{start}' AND line_item_usage_start_date < '{end}'
-	//   GROUP BY 1,2,3,4,5,6
-	//
-	// Supports dynamic tag columns (resource_tags_user_*) for label extraction.
-	// Handles CUR 2.0 partition differences (billing_period vs month).
-
-	records := make([]*models.CostRecord, 0)
-
-	c.logger.Warn("AWS Athena collection not yet implemented - returning empty results",
-		"account", cfg.AccountID)
-
-	return records, nil
 }
 
 func buildAthenaQuery(cfg models.AWSConfig, window collector.TimeWindow) string {
@@ -108,6 +116,9 @@ func buildAthenaQuery(cfg models.AWSConfig, window collector.TimeWindow) string
 
 func athenaRowToRecord(source *models.CostSource, row map[string]string, usageDate time.Time) *models.CostRecord {
 	return &models.CostRecord{
+		ID: collector.RecordID(source, row["line_item_resource_id"], usageDate,
+			row["line_item_usage_account_id"], row["product_product_name"], row["line_item_usage_type"],
+			row["product_region_code"], row["product_availability_zone"]),
 		ProjectID:     source.ProjectID,
 		CostSourceID:  source.ID,
 		Provider:      "aws",
@@ -101,6 +101,7 @@ func categorizeAzureService(meterCategory string) string {
 
 func azureRowToRecord(source *models.CostSource, date time.Time, meterCategory, subscriptionID, region, instanceID string, cost float64) *models.CostRecord {
 	return &models.CostRecord{
+		ID:           collector.RecordID(source, instanceID, date, subscriptionID, meterCategory, region),
 		ProjectID:    source.ProjectID,
 		CostSourceID: source.ID,
 		Provider:     "azure",
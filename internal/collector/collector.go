@@ -3,8 +3,11 @@ package collector
 import (
 	"context"
 	"encoding/json"
+	"iter"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/inelson/finguard/internal/models"
 )
 
@@ -21,6 +24,59 @@ type Collector interface {
 	Validate(ctx context.Context, config json.RawMessage) error
 }
 
+// StreamCollector is implemented by collectors that can yield records as
+// they read them, so that a large collection is stored in chunks rather than
+// held in memory whole. The sequence stops at the first error it yields.
+type StreamCollector interface {
+	Collector
+	Stream(ctx context.Context, source *models.CostSource, window TimeWindow) iter.Seq2[*models.CostRecord, error]
+}
+
+// Stream returns the records c collects for source over window, streamed if
+// c is a StreamCollector and collected in one piece otherwise.
+func Stream(ctx context.Context, c Collector, source *models.CostSource, window TimeWindow) iter.Seq2[*models.CostRecord, error] {
+	if sc, ok := c.(StreamCollector); ok {
+		return sc.Stream(ctx, source, window)
+	}
+	return func(yield func(*models.CostRecord, error) bool) {
+		records, err := c.Collect(ctx, source, window)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, r := range records {
+			if !yield(r, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Gather collects the records of seq into a slice, for a StreamCollector's
+// Collect.
+func Gather(seq iter.Seq2[*models.CostRecord, error]) ([]*models.CostRecord, error) {
+	records := make([]*models.CostRecord, 0)
+	for r, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// recordNamespace scopes the IDs RecordID derives.
+var recordNamespace = uuid.MustParse("4f1d2c6e-8b3a-4e7f-9a51-2d0c7e6b9f13")
+
+// RecordID derives the ID of the record source collects for providerID and
+// lineItem over the usage period starting at start. Collecting the same
+// period again yields the same IDs, so the new records replace the stored
+// ones instead of being counted twice.
+func RecordID(source *models.CostSource, providerID string, start time.Time, lineItem ...string) string {
+	key := append([]string{source.ID, providerID, start.UTC().Format(time.RFC3339Nano)}, lineItem...)
+	return uuid.NewSHA1(recordNamespace, []byte(strings.Join(key, "\x00"))).String()
+}
+
 // Registry maps cost source types to their collector implementations.
 type Registry struct {
 	collectors map[models.CostSourceType]Collector
@@ -124,6 +124,8 @@ func categorizeGCPService(service string) string {
 
 func bigqueryRowToRecord(source *models.CostSource, date time.Time, row map[string]string, cost, listCost float64) *models.CostRecord {
 	return &models.CostRecord{
+		ID: collector.RecordID(source, row["resource_name"], date,
+			row["billing_account_id"], row["project_id"], row["region"], row["zone"], row["service"], row["sku"]),
 		ProjectID:        source.ProjectID,
 		CostSourceID:     source.ID,
 		Provider:         "gcp",
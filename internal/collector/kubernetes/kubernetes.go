@@ -7,10 +7,12 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/inelson/finguard/internal/collector"
 	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
 )
 
 // KubernetesCollector wraps OpenCost's allocation API and normalizes the response into CostRecords.
@@ -87,10 +89,21 @@ func (c *KubernetesCollector) Collect(ctx context.Context, source *models.CostSo
 		return nil, fmt.Errorf("decode allocation response: %w", err)
 	}
 
+	owned := make(map[string]bool, len(cfg.Namespaces))
+	for _, ns := range cfg.Namespaces {
+		owned[ns] = true
+	}
+
 	var records []*models.CostRecord
 	for _, dataSet := range apiResp.Data {
 		for namespace, alloc := range dataSet {
+			if len(owned) > 0 && !owned[namespace] {
+				continue
+			}
 			record := &models.CostRecord{
+				// Keyed on the window's start only: a retry of a failed
+				// window ends later but replaces what the failed run stored.
+				ID:           collector.RecordID(source, cfg.ClusterName+"/"+namespace, window.Start),
 				ProjectID:    source.ProjectID,
 				CostSourceID: source.ID,
 				Provider:     "kubernetes",
@@ -128,3 +141,34 @@ type allocationData struct {
 	GPUCost   float64 `json:"gpuCost"`
 	TotalCost float64 `json:"totalCost"`
 }
+
+// NamespaceOwners returns, for each namespace listed in the namespaces config
+// of a Kubernetes cost source, the IDs of the projects whose sources list it.
+func NamespaceOwners(ctx context.Context, st store.Store) (map[string][]string, error) {
+	projects, err := st.ListProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	owners := make(map[string][]string)
+	for _, p := range projects {
+		sources, err := st.ListCostSources(ctx, p.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, cs := range sources {
+			if cs.Type != models.CostSourceKubernetes || len(cs.Config) == 0 {
+				continue
+			}
+			var cfg models.KubernetesConfig
+			if err := json.Unmarshal(cs.Config, &cfg); err != nil {
+				continue
+			}
+			for _, ns := range cfg.Namespaces {
+				if !slices.Contains(owners[ns], p.ID) {
+					owners[ns] = append(owners[ns], p.ID)
+				}
+			}
+		}
+	}
+	return owners, nil
+}
@@ -2,6 +2,7 @@ package collector
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"strconv"
 	"sync"
@@ -33,8 +34,12 @@ type Scheduler struct {
 	logger   *slog.Logger
 	mu       sync.Mutex
 	running  bool
+	hooks    []Hook
 }
 
+// Hook is called after each collection pass, once the new cost records are stored.
+type Hook func(ctx context.Context)
+
 func NewScheduler(registry *Registry, st store.Store, hub *stream.Hub, cfg SchedulerConfig, logger *slog.Logger) *Scheduler {
 	return &Scheduler{
 		registry: registry,
@@ -45,6 +50,14 @@ func NewScheduler(registry *Registry, st store.Store, hub *stream.Hub, cfg Sched
 	}
 }
 
+// AddHook registers fn to run after every collection pass. Hooks must be added
+// before Start.
+func (s *Scheduler) AddHook(fn Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, fn)
+}
+
 func (s *Scheduler) Start(ctx context.Context) {
 	s.mu.Lock()
 	if s.running {
@@ -87,6 +100,7 @@ func (s *Scheduler) collectAll(ctx context.Context) {
 	for _, project := range projects {
 		s.collectForProject(ctx, project.ID)
 	}
+	s.runHooks(ctx)
 }
 
 func (s *Scheduler) collectByTypes(ctx context.Context, types ...models.CostSourceType) {
@@ -114,6 +128,16 @@ func (s *Scheduler) collectByTypes(ctx context.Context, types ...models.CostSour
 			s.collectSource(ctx, source)
 		}
 	}
+	s.runHooks(ctx)
+}
+
+func (s *Scheduler) runHooks(ctx context.Context) {
+	s.mu.Lock()
+	hooks := s.hooks
+	s.mu.Unlock()
+	for _, fn := range hooks {
+		fn(ctx)
+	}
 }
 
 func (s *Scheduler) collectForProject(ctx context.Context, projectID string) {
@@ -132,12 +156,6 @@ func (s *Scheduler) collectForProject(ctx context.Context, projectID string) {
 }
 
 func (s *Scheduler) collectSource(ctx context.Context, source *models.CostSource) {
-	collector, ok := s.registry.Get(source.Type)
-	if !ok {
-		s.logger.Warn("scheduler: no collector for source type", "type", source.Type, "source", source.Name)
-		return
-	}
-
 	window := TimeWindow{
 		Start: time.Now().UTC().Add(-24 * time.Hour),
 		End:   time.Now().UTC(),
@@ -146,41 +164,71 @@ func (s *Scheduler) collectSource(ctx context.Context, source *models.CostSource
 		window.Start = *source.LastCollectedAt
 	}
 
-	s.logger.Info("collecting costs", "source", source.Name, "type", source.Type, "window", window)
-
-	records, err := collector.Collect(ctx, source, window)
-	if err != nil {
-		s.logger.Error("collection failed", "source", source.Name, "type", source.Type, "error", err)
-		s.publishEvent("collection.failed", source.Name, map[string]string{
-			"sourceId": source.ID,
-			"error":    err.Error(),
-		})
+	if _, err := s.Collect(ctx, source, window); err != nil {
 		return
 	}
+	if err := s.store.UpdateCostSourceCollectedAt(ctx, source.ID, time.Now().UTC()); err != nil {
+		s.logger.Error("failed to update collected_at", "source", source.Name, "error", err)
+	}
+}
 
-	if len(records) > 0 {
-		if err := s.store.InsertCostRecords(ctx, records); err != nil {
-			s.logger.Error("failed to insert cost records", "source", source.Name, "count", len(records), "error", err)
-			return
-		}
+// Collect runs the collector of source over window, stores the records it
+// yields and publishes the outcome. It returns how many records were stored,
+// and leaves the source's last collection time alone. Errors are logged as
+// well as returned.
+func (s *Scheduler) Collect(ctx context.Context, source *models.CostSource, window TimeWindow) (int, error) {
+	collector, ok := s.registry.Get(source.Type)
+	if !ok {
+		s.logger.Warn("scheduler: no collector for source type", "type", source.Type, "source", source.Name)
+		return 0, fmt.Errorf("no collector for source type %q", source.Type)
 	}
 
-	if err := s.store.UpdateCostSourceCollectedAt(ctx, source.ID, time.Now().UTC()); err != nil {
-		s.logger.Error("failed to update collected_at", "source", source.Name, "error", err)
+	s.logger.Info("collecting costs", "source", source.Name, "type", source.Type, "window", window)
+
+	// Records are committed in chunks as the collector yields them. If the
+	// collection fails part way, the window is collected again next time and
+	// records with source-derived IDs replace the ones already stored.
+	var collectErr error
+	records := func(yield func(*models.CostRecord, error) bool) {
+		for r, err := range Stream(ctx, collector, source, window) {
+			if err != nil {
+				collectErr = err
+			}
+			if !yield(r, err) {
+				return
+			}
+		}
+	}
+	count, err := s.store.IngestCostRecords(ctx, records)
+	if collectErr != nil {
+		s.logger.Error("collection failed", "source", source.Name, "type", source.Type, "stored", count, "error", collectErr)
+		s.publishEvent(event.TopicCollectionFailed, source.Name, map[string]string{
+			"projectId": source.ProjectID,
+			"sourceId":  source.ID,
+			"error":     collectErr.Error(),
+		})
+		return count, collectErr
+	}
+	if err != nil {
+		s.logger.Error("failed to insert cost records", "source", source.Name, "stored", count, "error", err)
+		return count, err
 	}
 
-	s.logger.Info("collection complete", "source", source.Name, "records", len(records))
-	s.publishEvent("collection.complete", source.Name, map[string]string{
-		"sourceId": source.ID,
-		"records":  strconv.Itoa(len(records)),
+	s.logger.Info("collection complete", "source", source.Name, "records", count)
+	s.publishEvent(event.TopicCollectionComplete, source.Name, map[string]string{
+		"projectId": source.ProjectID,
+		"sourceId":  source.ID,
+		"records":   strconv.Itoa(count),
 	})
+	return count, nil
 }
 
-func (s *Scheduler) publishEvent(eventType, sourceName string, payload map[string]string) {
+// publishEvent publishes a collection event on topic, which is also its type.
+func (s *Scheduler) publishEvent(topic, sourceName string, payload map[string]string) {
 	if s.hub == nil {
 		return
 	}
-	e, err := event.New(eventType, "cost.collection", sourceName, payload)
+	e, err := event.New(topic, topic, sourceName, payload)
 	if err != nil {
 		return
 	}
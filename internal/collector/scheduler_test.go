@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"iter"
+	"log/slog"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+)
+
+// flakyCollector yields one record per line item, deriving their IDs the way
+// the real collectors do, and fails after failAfter records while that is
+// positive.
+type flakyCollector struct {
+	lineItems int
+	failAfter int
+}
+
+func (c *flakyCollector) Type() string { return "flaky" }
+
+func (c *flakyCollector) Validate(context.Context, json.RawMessage) error { return nil }
+
+func (c *flakyCollector) Collect(ctx context.Context, source *models.CostSource, window TimeWindow) ([]*models.CostRecord, error) {
+	return Gather(c.Stream(ctx, source, window))
+}
+
+func (c *flakyCollector) Stream(_ context.Context, source *models.CostSource, window TimeWindow) iter.Seq2[*models.CostRecord, error] {
+	return func(yield func(*models.CostRecord, error) bool) {
+		for i := range c.lineItems {
+			if c.failAfter > 0 && i == c.failAfter {
+				yield(nil, errors.New("source went away"))
+				return
+			}
+			item := strconv.Itoa(i)
+			r := &models.CostRecord{ID: RecordID(source, "i-"+item, window.Start, item), ProjectID: source.ProjectID, CostSourceID: source.ID,
+				Provider: "aws", Service: "ec2", StartTime: window.Start, EndTime: window.End, NetCost: 1}
+			if !yield(r, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestScheduler_RetriesFailedCollections(t *testing.T) {
+	st := storetest.New(t)
+	ctx := context.Background()
+	project := &models.Project{Name: "payments"}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	source := &models.CostSource{ProjectID: project.ID, Type: models.CostSourceAWS, Name: "aws", Enabled: true}
+	if err := st.CreateCostSource(ctx, source); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first attempt fails after committing a chunk; the retry collects
+	// the whole window again.
+	n := store.IngestChunkSize + 10
+	flaky := &flakyCollector{lineItems: n, failAfter: store.IngestChunkSize + 3}
+	registry := NewRegistry()
+	registry.Register(models.CostSourceAWS, flaky)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	s := NewScheduler(registry, st, nil, DefaultSchedulerConfig(), logger)
+	day := time.Date(2025, time.June, 2, 0, 0, 0, 0, time.UTC)
+	window := TimeWindow{Start: day, End: day.Add(24 * time.Hour)}
+
+	if count, err := s.Collect(ctx, source, window); err == nil || count != store.IngestChunkSize {
+		t.Fatalf("failed collection: got %d, %v; want the first chunk and an error", count, err)
+	}
+	flaky.failAfter = 0
+	if count, err := s.Collect(ctx, source, window); err != nil || count != n {
+		t.Fatalf("retry: got %d, %v; want %d records", count, err, n)
+	}
+
+	summary, err := st.AggregateCosts(ctx, store.CostQuery{ProjectID: project.ID, StartTime: day, EndTime: window.End})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.TotalNetCost != float64(n) {
+		t.Errorf("expected total %d after the retry, got %v", n, summary.TotalNetCost)
+	}
+}
+
+func TestRecordID(t *testing.T) {
+	day := time.Date(2025, time.June, 2, 0, 0, 0, 0, time.UTC)
+	a := &models.CostSource{ID: "a"}
+	id := RecordID(a, "i-1", day, "ec2", "us-east-1")
+	if got := RecordID(a, "i-1", day.In(time.FixedZone("CEST", 2*60*60)), "ec2", "us-east-1"); got != id {
+		t.Errorf("expected the same ID for the same instant, got %s and %s", id, got)
+	}
+	for name, other := range map[string]string{
+		"source":    RecordID(&models.CostSource{ID: "b"}, "i-1", day, "ec2", "us-east-1"),
+		"provider":  RecordID(a, "i-2", day, "ec2", "us-east-1"),
+		"start":     RecordID(a, "i-1", day.AddDate(0, 0, 1), "ec2", "us-east-1"),
+		"line item": RecordID(a, "i-1", day, "ec2", "us-west-2"),
+		"boundary":  RecordID(a, "i-1", day, "ec2us-east-1"),
+	} {
+		if other == id {
+			t.Errorf("%s: expected a different ID, got %s for both", name, id)
+		}
+	}
+}
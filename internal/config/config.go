@@ -1,9 +1,15 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -23,6 +29,67 @@ type Config struct {
 	OIDCRedirectURL  string
 	OIDCScopes       []string
 	SessionSecret    string
+
+	// Session lifetime: MaxAge bounds a session that cannot be renewed with a
+	// refresh token, IdleTimeout ends any session that goes unused for that long.
+	SessionMaxAge      time.Duration
+	SessionIdleTimeout time.Duration
+
+	// SCIMToken is the bearer token identity providers use for SCIM provisioning.
+	// The SCIM endpoint is disabled when it is empty.
+	SCIMToken string
+
+	// BudgetReminderInterval repeats an unacknowledged budget alert while its
+	// threshold tier holds. Zero sends each alert once.
+	BudgetReminderInterval time.Duration
+
+	// FiscalYearStartMonth aligns budget quarters, years, plans and rollover.
+	FiscalYearStartMonth time.Month
+	// EnforcementDryRun records budget enforcement actions without changing
+	// the cluster, whatever each action says.
+	EnforcementDryRun bool
+
+	// AdmissionWebhook serves the budget-aware validating admission webhook
+	// over TLS on AdmissionAddr, with the AdmissionTLSCert certificate and
+	// AdmissionTLSKey key. AdmissionClientCA, if set, requires the API server
+	// to present a client certificate it signed. AdmissionCPUHourly and
+	// AdmissionMemoryGiBHourly price workload requests when nodes carry no
+	// hourly price annotation.
+	AdmissionWebhook         bool
+	AdmissionAddr            string
+	AdmissionTLSCert         string
+	AdmissionTLSKey          string
+	AdmissionClientCA        string
+	AdmissionCPUHourly       float64
+	AdmissionMemoryGiBHourly float64
+
+	// SMTP relay used by email notification channels.
+	SMTPAddr     string
+	SMTPFrom     string
+	SMTPUsername string
+	SMTPPassword string
+	// NotifyMaxAttempts is how many times a notification is tried before it
+	// is dead-lettered; NotifyRetryBackoff is the wait after the first
+	// failure, doubling with each further one.
+	NotifyMaxAttempts  int
+	NotifyRetryBackoff time.Duration
+
+	// CostRetention holds the cost record retention rules, e.g.
+	// "kubernetes:hourly=30d,daily=13mo"; empty keeps every record as
+	// collected. CostArchiveDir, if set, receives the records compaction
+	// removes, and CostCompactionInterval is how often it runs.
+	CostRetention          string
+	CostArchiveDir         string
+	CostCompactionInterval time.Duration
+
+	// On Postgres, CostPartitionsAhead is how many future months of cost
+	// record partitions are created ahead of time, CostPartitionRetention
+	// how long a month's partition is kept (e.g. "7y"; empty keeps them all)
+	// and CostPartitionDetach detaches expired partitions instead of dropping
+	// them.
+	CostPartitionsAhead    int
+	CostPartitionRetention string
+	CostPartitionDetach    bool
 }
 
 func Load() *Config {
@@ -41,6 +108,39 @@ func Load() *Config {
 		OIDCRedirectURL:  envOr("FINGUARD_OIDC_REDIRECT_URL", ""),
 		OIDCScopes:       envSlice("FINGUARD_OIDC_SCOPES", []string{"openid", "profile", "email", "groups"}),
 		SessionSecret:    envOr("FINGUARD_SESSION_SECRET", ""),
+
+		SessionMaxAge:      envDurationOr("FINGUARD_SESSION_MAX_AGE", 24*time.Hour),
+		SessionIdleTimeout: envDurationOr("FINGUARD_SESSION_IDLE_TIMEOUT", 2*time.Hour),
+
+		SCIMToken: envOr("FINGUARD_SCIM_TOKEN", ""),
+
+		BudgetReminderInterval: envDurationOr("FINGUARD_BUDGET_REMINDER_INTERVAL", 0),
+		FiscalYearStartMonth:   envMonthOr("FINGUARD_FISCAL_YEAR_START_MONTH", time.January),
+		EnforcementDryRun:      envBool("FINGUARD_ENFORCEMENT_DRY_RUN"),
+
+		AdmissionWebhook:         envBool("FINGUARD_ADMISSION_WEBHOOK"),
+		AdmissionAddr:            envOr("FINGUARD_ADMISSION_ADDR", ":8443"),
+		AdmissionTLSCert:         envOr("FINGUARD_ADMISSION_TLS_CERT", ""),
+		AdmissionTLSKey:          envOr("FINGUARD_ADMISSION_TLS_KEY", ""),
+		AdmissionClientCA:        envOr("FINGUARD_ADMISSION_CLIENT_CA", ""),
+		AdmissionCPUHourly:       envFloatOr("FINGUARD_ADMISSION_CPU_HOURLY", 0.031611),
+		AdmissionMemoryGiBHourly: envFloatOr("FINGUARD_ADMISSION_MEMORY_GIB_HOURLY", 0.004237),
+
+		SMTPAddr:     envOr("FINGUARD_SMTP_ADDR", ""),
+		SMTPFrom:     envOr("FINGUARD_SMTP_FROM", ""),
+		SMTPUsername: envOr("FINGUARD_SMTP_USERNAME", ""),
+		SMTPPassword: envOr("FINGUARD_SMTP_PASSWORD", ""),
+
+		NotifyMaxAttempts:  envIntOr("FINGUARD_NOTIFY_MAX_ATTEMPTS", 8),
+		NotifyRetryBackoff: envDurationOr("FINGUARD_NOTIFY_RETRY_BACKOFF", 30*time.Second),
+
+		CostRetention:          envOr("FINGUARD_COST_RETENTION", ""),
+		CostArchiveDir:         envOr("FINGUARD_COST_ARCHIVE_DIR", ""),
+		CostCompactionInterval: envDurationOr("FINGUARD_COST_COMPACTION_INTERVAL", 6*time.Hour),
+
+		CostPartitionsAhead:    envIntOr("FINGUARD_COST_PARTITIONS_AHEAD", 3),
+		CostPartitionRetention: envOr("FINGUARD_COST_PARTITION_RETENTION", ""),
+		CostPartitionDetach:    envBool("FINGUARD_COST_PARTITION_DETACH"),
 	}
 }
 
@@ -71,3 +171,140 @@ func envIntOr(key string, fallback int) int {
 	}
 	return fallback
 }
+
+func envFloatOr(key string, fallback float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
+
+func envDurationOr(key string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+// envMonthOr reads a month number from 1 to 12.
+func envMonthOr(key string, fallback time.Month) time.Month {
+	if n := envIntOr(key, 0); n >= 1 && n <= 12 {
+		return time.Month(n)
+	}
+	return fallback
+}
+
+// Validate checks the settings for values the server would fail on or
+// misbehave with, and returns every problem found joined together.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	if c.HTTPAddr == "" {
+		fail("FINGUARD_ADDR is empty")
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		fail("FINGUARD_LOG_LEVEL %q: must be debug, info, warn or error", c.LogLevel)
+	}
+	if c.DatabaseDSN == "" {
+		fail("FINGUARD_DB_DSN is empty")
+	} else if strings.HasPrefix(c.DatabaseDSN, "postgres://") || strings.HasPrefix(c.DatabaseDSN, "postgresql://") {
+		if _, err := url.Parse(c.DatabaseDSN); err != nil {
+			fail("FINGUARD_DB_DSN: %v", err)
+		}
+	}
+	if c.OIDCIssuer != "" && !c.AuthDisabled {
+		if c.OIDCClientID == "" {
+			fail("FINGUARD_OIDC_CLIENT_ID is required with FINGUARD_OIDC_ISSUER")
+		}
+		if c.OIDCRedirectURL == "" {
+			fail("FINGUARD_OIDC_REDIRECT_URL is required with FINGUARD_OIDC_ISSUER")
+		}
+	}
+	if c.SessionMaxAge <= 0 {
+		fail("FINGUARD_SESSION_MAX_AGE must be positive")
+	}
+	if c.SessionIdleTimeout <= 0 {
+		fail("FINGUARD_SESSION_IDLE_TIMEOUT must be positive")
+	}
+	if c.BudgetReminderInterval < 0 {
+		fail("FINGUARD_BUDGET_REMINDER_INTERVAL must not be negative")
+	}
+	if c.AdmissionWebhook {
+		if c.AdmissionAddr == "" {
+			fail("FINGUARD_ADMISSION_ADDR is empty")
+		} else if c.AdmissionAddr == c.HTTPAddr {
+			fail("FINGUARD_ADMISSION_ADDR must differ from FINGUARD_ADDR")
+		}
+		if c.AdmissionTLSCert == "" || c.AdmissionTLSKey == "" {
+			fail("FINGUARD_ADMISSION_TLS_CERT and FINGUARD_ADMISSION_TLS_KEY are required with FINGUARD_ADMISSION_WEBHOOK")
+		}
+	}
+	if c.AdmissionCPUHourly <= 0 || c.AdmissionMemoryGiBHourly <= 0 {
+		fail("FINGUARD_ADMISSION_CPU_HOURLY and FINGUARD_ADMISSION_MEMORY_GIB_HOURLY must be positive")
+	}
+	if c.SMTPAddr != "" {
+		if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+			fail("FINGUARD_SMTP_ADDR %q: must be host:port", c.SMTPAddr)
+		}
+		if c.SMTPFrom == "" {
+			fail("FINGUARD_SMTP_FROM is required with FINGUARD_SMTP_ADDR")
+		}
+	}
+	if c.NotifyMaxAttempts < 1 {
+		fail("FINGUARD_NOTIFY_MAX_ATTEMPTS must be at least 1")
+	}
+	if c.NotifyRetryBackoff <= 0 {
+		fail("FINGUARD_NOTIFY_RETRY_BACKOFF must be positive")
+	}
+	if c.CostCompactionInterval <= 0 {
+		fail("FINGUARD_COST_COMPACTION_INTERVAL must be positive")
+	}
+	if c.CostPartitionsAhead < 0 {
+		fail("FINGUARD_COST_PARTITIONS_AHEAD must not be negative")
+	}
+	return errors.Join(errs...)
+}
+
+// IgnoredEnv describes the environment variables set to values Load cannot
+// parse and so replaces with their defaults.
+func IgnoredEnv() []string {
+	var ignored []string
+	check := func(key string, parse func(string) error) {
+		if v := os.Getenv(key); v != "" {
+			if err := parse(v); err != nil {
+				ignored = append(ignored, fmt.Sprintf("%s=%q: %v", key, v, err))
+			}
+		}
+	}
+	for _, key := range []string{"FINGUARD_DEV_MODE", "FINGUARD_AUTH_DISABLED", "FINGUARD_ENFORCEMENT_DRY_RUN", "FINGUARD_ADMISSION_WEBHOOK", "FINGUARD_COST_PARTITION_DETACH"} {
+		check(key, func(v string) error {
+			switch v {
+			case "true", "1", "yes", "false", "0", "no":
+				return nil
+			}
+			return errors.New("not true, 1, yes, false, 0 or no; read as false")
+		})
+	}
+	for _, key := range []string{"FINGUARD_SESSION_MAX_AGE", "FINGUARD_SESSION_IDLE_TIMEOUT", "FINGUARD_BUDGET_REMINDER_INTERVAL", "FINGUARD_NOTIFY_RETRY_BACKOFF", "FINGUARD_COST_COMPACTION_INTERVAL"} {
+		check(key, func(v string) error { _, err := time.ParseDuration(v); return err })
+	}
+	for _, key := range []string{"FINGUARD_NOTIFY_MAX_ATTEMPTS", "FINGUARD_COST_PARTITIONS_AHEAD"} {
+		check(key, func(v string) error { _, err := strconv.Atoi(v); return err })
+	}
+	for _, key := range []string{"FINGUARD_ADMISSION_CPU_HOURLY", "FINGUARD_ADMISSION_MEMORY_GIB_HOURLY"} {
+		check(key, func(v string) error { _, err := strconv.ParseFloat(v, 64); return err })
+	}
+	check("FINGUARD_FISCAL_YEAR_START_MONTH", func(v string) error {
+		if n, err := strconv.Atoi(v); err != nil || n < 1 || n > 12 {
+			return errors.New("not a month number from 1 to 12")
+		}
+		return nil
+	})
+	return ignored
+}
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"flag"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoad_Defaults(t *testing.T) {
@@ -52,3 +55,109 @@ func TestEnvIntOr(t *testing.T) {
 		t.Errorf("expected 42 for bad int, got %d", v)
 	}
 }
+
+func TestEnvDurationOr(t *testing.T) {
+	if v := envDurationOr("NONEXISTENT_VAR", time.Hour); v != time.Hour {
+		t.Errorf("expected 1h, got %s", v)
+	}
+
+	os.Setenv("TEST_DURATION", "30m")
+	defer os.Unsetenv("TEST_DURATION")
+	if v := envDurationOr("TEST_DURATION", time.Hour); v != 30*time.Minute {
+		t.Errorf("expected 30m, got %s", v)
+	}
+
+	os.Setenv("TEST_BAD_DURATION", "soon")
+	defer os.Unsetenv("TEST_BAD_DURATION")
+	if v := envDurationOr("TEST_BAD_DURATION", time.Hour); v != time.Hour {
+		t.Errorf("expected 1h for bad duration, got %s", v)
+	}
+}
+
+func TestEnvFloatOr(t *testing.T) {
+	if v := envFloatOr("NONEXISTENT_VAR", 0.5); v != 0.5 {
+		t.Errorf("expected 0.5, got %g", v)
+	}
+
+	os.Setenv("TEST_FLOAT", "0.0125")
+	defer os.Unsetenv("TEST_FLOAT")
+	if v := envFloatOr("TEST_FLOAT", 0.5); v != 0.0125 {
+		t.Errorf("expected 0.0125, got %g", v)
+	}
+
+	os.Setenv("TEST_BAD_FLOAT", "cheap")
+	defer os.Unsetenv("TEST_BAD_FLOAT")
+	if v := envFloatOr("TEST_BAD_FLOAT", 0.5); v != 0.5 {
+		t.Errorf("expected 0.5 for bad float, got %g", v)
+	}
+}
+
+func TestRegisterFlags_OverrideEnv(t *testing.T) {
+	os.Setenv("FINGUARD_ADDR", ":9090")
+	os.Setenv("FINGUARD_DB_DSN", "sqlite://env.db")
+	defer os.Unsetenv("FINGUARD_ADDR")
+	defer os.Unsetenv("FINGUARD_DB_DSN")
+
+	cfg := Load()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--db-dsn", "sqlite://flag.db", "--session-max-age=2h", "--fiscal-year-start-month", "4", "--opencost-url=http://oc:9003"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if cfg.HTTPAddr != ":9090" {
+		t.Errorf("expected addr from env ':9090', got %q", cfg.HTTPAddr)
+	}
+	if cfg.DatabaseDSN != "sqlite://flag.db" {
+		t.Errorf("expected DSN from flag, got %q", cfg.DatabaseDSN)
+	}
+	if cfg.SessionMaxAge != 2*time.Hour {
+		t.Errorf("expected session max age 2h, got %s", cfg.SessionMaxAge)
+	}
+	if cfg.FiscalYearStartMonth != time.April {
+		t.Errorf("expected fiscal year start April, got %s", cfg.FiscalYearStartMonth)
+	}
+	if cfg.OpenCostURL != "http://oc:9003" {
+		t.Errorf("expected OpenCost URL from flag, got %q", cfg.OpenCostURL)
+	}
+
+	if err := fs.Parse([]string{"--fiscal-year-start-month", "13"}); err == nil {
+		t.Error("expected error for month 13")
+	}
+	for _, secret := range []string{"oidc-client-secret", "session-secret", "scim-token", "smtp-password"} {
+		if fs.Lookup(secret) != nil {
+			t.Errorf("expected no flag for the secret %s", secret)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Load()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected defaults to be valid, got %v", err)
+	}
+
+	cfg.LogLevel = "loud"
+	cfg.SMTPAddr = "mail.example.com"
+	cfg.NotifyMaxAttempts = 0
+	cfg.AdmissionWebhook = true
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"FINGUARD_LOG_LEVEL", "FINGUARD_SMTP_ADDR", "FINGUARD_SMTP_FROM", "FINGUARD_NOTIFY_MAX_ATTEMPTS", "FINGUARD_ADMISSION_TLS_CERT"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected an error about %s, got %v", want, err)
+		}
+	}
+}
+
+func TestIgnoredEnv(t *testing.T) {
+	os.Setenv("FINGUARD_NOTIFY_MAX_ATTEMPTS", "many")
+	defer os.Unsetenv("FINGUARD_NOTIFY_MAX_ATTEMPTS")
+
+	ignored := IgnoredEnv()
+	if len(ignored) != 1 || !strings.HasPrefix(ignored[0], "FINGUARD_NOTIFY_MAX_ATTEMPTS=") {
+		t.Errorf("expected FINGUARD_NOTIFY_MAX_ATTEMPTS to be ignored, got %v", ignored)
+	}
+}
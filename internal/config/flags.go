@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RegisterFlags defines a flag on fs for every setting, named after its
+// environment variable without the FINGUARD_ prefix, lower-cased and
+// hyphenated: FINGUARD_DB_DSN is --db-dsn and OPENCOST_URL --opencost-url.
+// Each flag defaults to the value c holds, so parsing fs after Load lets
+// flags override the environment. Secrets have no flag, so that they stay
+// out of process listings and shell history.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	str := func(p *string, env, usage string) { fs.StringVar(p, flagName(env), *p, usage+" ("+env+")") }
+	boolean := func(p *bool, env, usage string) { fs.BoolVar(p, flagName(env), *p, usage+" ("+env+")") }
+	integer := func(p *int, env, usage string) { fs.IntVar(p, flagName(env), *p, usage+" ("+env+")") }
+	float := func(p *float64, env, usage string) { fs.Float64Var(p, flagName(env), *p, usage+" ("+env+")") }
+	duration := func(p *time.Duration, env, usage string) { fs.DurationVar(p, flagName(env), *p, usage+" ("+env+")") }
+
+	str(&c.HTTPAddr, "FINGUARD_ADDR", "HTTP listen address")
+	str(&c.OpenCostURL, "OPENCOST_URL", "OpenCost API base URL")
+	str(&c.PluginDir, "FINGUARD_PLUGIN_DIR", "directory of plugin binaries")
+	str(&c.PluginConfigDir, "FINGUARD_PLUGIN_CONFIG_DIR", "directory of plugin configuration")
+	str(&c.LogLevel, "FINGUARD_LOG_LEVEL", "log level: debug, info, warn or error")
+	boolean(&c.DevMode, "FINGUARD_DEV_MODE", "use mock OpenCost data and disable auth")
+	boolean(&c.AuthDisabled, "FINGUARD_AUTH_DISABLED", "disable authentication")
+	str(&c.DatabaseDSN, "FINGUARD_DB_DSN", "database DSN, sqlite://path or postgres://...")
+
+	str(&c.OIDCIssuer, "FINGUARD_OIDC_ISSUER", "OIDC issuer URL")
+	str(&c.OIDCClientID, "FINGUARD_OIDC_CLIENT_ID", "OIDC client ID")
+	str(&c.OIDCRedirectURL, "FINGUARD_OIDC_REDIRECT_URL", "OIDC redirect URL")
+	fs.Func(flagName("FINGUARD_OIDC_SCOPES"), "comma-separated OIDC scopes (FINGUARD_OIDC_SCOPES)", func(s string) error {
+		c.OIDCScopes = strings.Split(s, ",")
+		return nil
+	})
+	duration(&c.SessionMaxAge, "FINGUARD_SESSION_MAX_AGE", "lifetime of a session that cannot be renewed")
+	duration(&c.SessionIdleTimeout, "FINGUARD_SESSION_IDLE_TIMEOUT", "idle time after which a session ends")
+
+	duration(&c.BudgetReminderInterval, "FINGUARD_BUDGET_REMINDER_INTERVAL", "repeat interval of unacknowledged budget alerts")
+	fs.Func(flagName("FINGUARD_FISCAL_YEAR_START_MONTH"), "first month of the fiscal year, 1-12 (FINGUARD_FISCAL_YEAR_START_MONTH)", func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 12 {
+			return errors.New("must be a month number from 1 to 12")
+		}
+		c.FiscalYearStartMonth = time.Month(n)
+		return nil
+	})
+	boolean(&c.EnforcementDryRun, "FINGUARD_ENFORCEMENT_DRY_RUN", "record budget enforcement actions without changing the cluster")
+
+	boolean(&c.AdmissionWebhook, "FINGUARD_ADMISSION_WEBHOOK", "serve the budget-aware admission webhook")
+	str(&c.AdmissionAddr, "FINGUARD_ADMISSION_ADDR", "HTTPS listen address of the admission webhook")
+	str(&c.AdmissionTLSCert, "FINGUARD_ADMISSION_TLS_CERT", "TLS certificate file of the admission webhook")
+	str(&c.AdmissionTLSKey, "FINGUARD_ADMISSION_TLS_KEY", "TLS key file of the admission webhook")
+	str(&c.AdmissionClientCA, "FINGUARD_ADMISSION_CLIENT_CA", "CA file verifying the API server's client certificate")
+	float(&c.AdmissionCPUHourly, "FINGUARD_ADMISSION_CPU_HOURLY", "default price of a CPU core per hour")
+	float(&c.AdmissionMemoryGiBHourly, "FINGUARD_ADMISSION_MEMORY_GIB_HOURLY", "default price of a GiB of memory per hour")
+
+	str(&c.SMTPAddr, "FINGUARD_SMTP_ADDR", "SMTP relay host:port")
+	str(&c.SMTPFrom, "FINGUARD_SMTP_FROM", "sender address of notification emails")
+	str(&c.SMTPUsername, "FINGUARD_SMTP_USERNAME", "SMTP username")
+	integer(&c.NotifyMaxAttempts, "FINGUARD_NOTIFY_MAX_ATTEMPTS", "delivery attempts before a notification is dead-lettered")
+	duration(&c.NotifyRetryBackoff, "FINGUARD_NOTIFY_RETRY_BACKOFF", "wait before the first retry of a failed notification")
+
+	str(&c.CostRetention, "FINGUARD_COST_RETENTION", "cost record retention rules")
+	str(&c.CostArchiveDir, "FINGUARD_COST_ARCHIVE_DIR", "directory receiving archives of removed cost records")
+	duration(&c.CostCompactionInterval, "FINGUARD_COST_COMPACTION_INTERVAL", "how often the retention rules are applied")
+	integer(&c.CostPartitionsAhead, "FINGUARD_COST_PARTITIONS_AHEAD", "future months of cost record partitions to create")
+	str(&c.CostPartitionRetention, "FINGUARD_COST_PARTITION_RETENTION", "how long monthly cost record partitions are kept")
+	boolean(&c.CostPartitionDetach, "FINGUARD_COST_PARTITION_DETACH", "detach expired partitions instead of dropping them")
+}
+
+// flagName returns the flag of the environment variable env.
+func flagName(env string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(env, "FINGUARD_")), "_", "-")
+}
@@ -0,0 +1,273 @@
+package enforcement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+// undo is the state an action replaced. Only the fields for the action's type
+// are set.
+type undo struct {
+	// QuotaExisted and QuotaHard describe the budget's ResourceQuota before
+	// the action; a quota that did not exist is deleted on revert.
+	QuotaExisted bool              `json:"quotaExisted,omitempty"`
+	QuotaHard    map[string]string `json:"quotaHard,omitempty"`
+	// Replicas maps each Deployment scaled to zero to its previous replicas.
+	Replicas map[string]int32 `json:"replicas,omitempty"`
+	// Annotations maps each annotation set to its previous value, or nil if
+	// the namespace did not have it.
+	Annotations map[string]*string `json:"annotations,omitempty"`
+}
+
+// ErrProductionNamespace is returned when a scaleToZero action targets a
+// namespace that is not labelled as non-production. A namespace without an
+// environment label is treated as production.
+var ErrProductionNamespace = errors.New("refusing to scale Deployments in a namespace not labelled as non-production")
+
+// environmentLabels are the namespace labels checked before scaling to zero,
+// and nonProductionValues the values that allow it. Every environment label a
+// namespace has must carry one of them, and it must have at least one.
+var (
+	environmentLabels   = []string{"env", "environment"}
+	nonProductionValues = map[string]bool{
+		"dev": true, "development": true, "test": true, "testing": true,
+		"qa": true, "staging": true, "sandbox": true, "preview": true,
+	}
+)
+
+const managedByLabel = "app.kubernetes.io/managed-by"
+
+// quotaName is the name of the ResourceQuota owned by a budget.
+func quotaName(b *models.Budget) string {
+	return "finguard-budget-" + b.ID
+}
+
+// applyQuota creates the budget's ResourceQuota, or tightens an existing one
+// so that no limit is raised.
+func (e *Enforcer) applyQuota(ctx context.Context, b *models.Budget, action models.EnforcementAction, dryRun bool) (*undo, error) {
+	quotas := e.clientset.CoreV1().ResourceQuotas(action.Namespace)
+	hard, err := resourceList(action.Hard)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := quotas.Get(ctx, quotaName(b), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if dryRun {
+			return &undo{}, nil
+		}
+		_, err = quotas.Create(ctx, &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   quotaName(b),
+				Labels: map[string]string{managedByLabel: "finguard"},
+			},
+			Spec: corev1.ResourceQuotaSpec{Hard: hard},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &undo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u := &undo{QuotaExisted: true, QuotaHard: quantityStrings(existing.Spec.Hard)}
+	if existing.Spec.Hard == nil {
+		existing.Spec.Hard = corev1.ResourceList{}
+	}
+	for name, q := range hard {
+		if current, ok := existing.Spec.Hard[name]; ok && current.Cmp(q) <= 0 {
+			continue
+		}
+		existing.Spec.Hard[name] = q
+	}
+	if dryRun {
+		return u, nil
+	}
+	if _, err := quotas.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (e *Enforcer) revertQuota(ctx context.Context, b *models.Budget, action models.EnforcementAction, u *undo) error {
+	quotas := e.clientset.CoreV1().ResourceQuotas(action.Namespace)
+	if !u.QuotaExisted {
+		err := quotas.Delete(ctx, quotaName(b), metav1.DeleteOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	existing, err := quotas.Get(ctx, quotaName(b), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if existing.Spec.Hard, err = resourceList(u.QuotaHard); err != nil {
+		return err
+	}
+	_, err = quotas.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+// scaleToZero scales the Deployments matching the action's selector to zero,
+// if the namespace is labelled as non-production. If scaling one fails, the
+// Deployments already scaled are returned with the error.
+func (e *Enforcer) scaleToZero(ctx context.Context, action models.EnforcementAction, dryRun bool) (*undo, error) {
+	ns, err := e.clientset.CoreV1().Namespaces().Get(ctx, action.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if !nonProduction(ns) {
+		return nil, ErrProductionNamespace
+	}
+
+	deployments := e.clientset.AppsV1().Deployments(action.Namespace)
+	list, err := deployments.List(ctx, metav1.ListOptions{LabelSelector: action.Selector})
+	if err != nil {
+		return nil, err
+	}
+	u := &undo{Replicas: make(map[string]int32)}
+	for i := range list.Items {
+		d := &list.Items[i]
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		if replicas == 0 {
+			continue
+		}
+		if dryRun {
+			u.Replicas[d.Name] = replicas
+			continue
+		}
+		zero := int32(0)
+		d.Spec.Replicas = &zero
+		if _, err := deployments.Update(ctx, d, metav1.UpdateOptions{}); err != nil {
+			err = fmt.Errorf("scale deployment %s: %w", d.Name, err)
+			if len(u.Replicas) == 0 {
+				return nil, err
+			}
+			return u, err
+		}
+		u.Replicas[d.Name] = replicas
+	}
+	return u, nil
+}
+
+// nonProduction reports whether ns is explicitly labelled as a non-production
+// environment.
+func nonProduction(ns *corev1.Namespace) bool {
+	labelled := false
+	for _, key := range environmentLabels {
+		value, ok := ns.Labels[key]
+		if !ok {
+			continue
+		}
+		if !nonProductionValues[strings.ToLower(value)] {
+			return false
+		}
+		labelled = true
+	}
+	return labelled
+}
+
+// revertScale restores the replicas of each Deployment that is still scaled to
+// zero. Deployments that were deleted or scaled up since are left alone.
+func (e *Enforcer) revertScale(ctx context.Context, action models.EnforcementAction, u *undo) error {
+	deployments := e.clientset.AppsV1().Deployments(action.Namespace)
+	for name, replicas := range u.Replicas {
+		d, err := deployments.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if d.Spec.Replicas != nil && *d.Spec.Replicas != 0 {
+			continue
+		}
+		d.Spec.Replicas = &replicas
+		if _, err := deployments.Update(ctx, d, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("scale deployment %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (e *Enforcer) annotate(ctx context.Context, action models.EnforcementAction, dryRun bool) (*undo, error) {
+	namespaces := e.clientset.CoreV1().Namespaces()
+	ns, err := namespaces.Get(ctx, action.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	u := &undo{Annotations: make(map[string]*string)}
+	if ns.Annotations == nil {
+		ns.Annotations = make(map[string]string)
+	}
+	for key, value := range action.Annotations {
+		if prev, ok := ns.Annotations[key]; ok {
+			u.Annotations[key] = &prev
+		} else {
+			u.Annotations[key] = nil
+		}
+		ns.Annotations[key] = value
+	}
+	if dryRun {
+		return u, nil
+	}
+	if _, err := namespaces.Update(ctx, ns, metav1.UpdateOptions{}); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (e *Enforcer) revertAnnotations(ctx context.Context, action models.EnforcementAction, u *undo) error {
+	namespaces := e.clientset.CoreV1().Namespaces()
+	ns, err := namespaces.Get(ctx, action.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	for key, prev := range u.Annotations {
+		if prev == nil {
+			delete(ns.Annotations, key)
+		} else {
+			if ns.Annotations == nil {
+				ns.Annotations = make(map[string]string)
+			}
+			ns.Annotations[key] = *prev
+		}
+	}
+	_, err = namespaces.Update(ctx, ns, metav1.UpdateOptions{})
+	return err
+}
+
+func resourceList(hard map[string]string) (corev1.ResourceList, error) {
+	list := make(corev1.ResourceList, len(hard))
+	for name, value := range hard {
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity %q for %s", value, name)
+		}
+		list[corev1.ResourceName(name)] = q
+	}
+	return list, nil
+}
+
+func quantityStrings(list corev1.ResourceList) map[string]string {
+	hard := make(map[string]string, len(list))
+	for name, q := range list {
+		hard[string(name)] = q.String()
+	}
+	return hard
+}
@@ -0,0 +1,287 @@
+// Package enforcement carries out the Kubernetes actions configured on a
+// budget when it is exceeded, and reverts them on request. Every action run is
+// stored with the state it replaced, so a revert restores the namespace to how
+// it was before FinGuard touched it.
+package enforcement
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/budget"
+	collectork8s "github.com/inelson/finguard/internal/collector/kubernetes"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+)
+
+// Config controls how enforcement actions are carried out.
+type Config struct {
+	// DryRun records every action as a dry run, whatever the budget says.
+	DryRun bool
+}
+
+// Enforcer applies and reverts budget enforcement actions through client-go.
+type Enforcer struct {
+	store     store.Store
+	clientset kubernetes.Interface
+	auditor   *audit.Recorder
+	config    Config
+	logger    *slog.Logger
+}
+
+func New(st store.Store, cs kubernetes.Interface, auditor *audit.Recorder, cfg Config, logger *slog.Logger) *Enforcer {
+	return &Enforcer{store: st, clientset: cs, auditor: auditor, config: cfg, logger: logger}
+}
+
+// systemActor is recorded as the actor of enforcement actions, which are
+// triggered by budget evaluation rather than a user.
+var systemActor = audit.Actor{Email: "system"}
+
+// Validate checks that an action is complete before it is saved on a budget.
+func Validate(action models.EnforcementAction) error {
+	if action.Namespace == "" {
+		return errors.New("enforcement actions need a namespace")
+	}
+	switch action.Type {
+	case models.EnforceResourceQuota:
+		if len(action.Hard) == 0 {
+			return errors.New("resourceQuota actions need at least one hard limit")
+		}
+		for name, value := range action.Hard {
+			if _, err := resource.ParseQuantity(value); err != nil {
+				return fmt.Errorf("invalid quantity %q for %s", value, name)
+			}
+		}
+	case models.EnforceScaleToZero:
+		sel, err := labels.Parse(action.Selector)
+		if err != nil {
+			return fmt.Errorf("invalid selector: %w", err)
+		}
+		if sel.Empty() {
+			return errors.New("scaleToZero actions need a selector naming the Deployments to scale")
+		}
+	case models.EnforceAnnotate:
+		if len(action.Annotations) == 0 {
+			return errors.New("annotate actions need at least one annotation")
+		}
+	default:
+		return fmt.Errorf("unknown enforcement action type %q", action.Type)
+	}
+	return nil
+}
+
+// ErrNamespaceNotOwned is returned for an enforcement action on a namespace the
+// budget does not own.
+var ErrNamespaceNotOwned = errors.New("enforcement actions may only target namespaces the budget owns")
+
+// CheckNamespaces checks that every action targets a namespace the budget
+// owns: one listed by a Kubernetes cost source of its project. A budget filter
+// never grants ownership of a namespace.
+func CheckNamespaces(ctx context.Context, st store.Store, projectID string, actions []models.EnforcementAction) error {
+	if len(actions) == 0 {
+		return nil
+	}
+	owned, err := ownedNamespaces(ctx, st, projectID)
+	if err != nil {
+		return err
+	}
+	for _, action := range actions {
+		if !owned[action.Namespace] {
+			return fmt.Errorf("%w: %s", ErrNamespaceNotOwned, action.Namespace)
+		}
+	}
+	return nil
+}
+
+// ownedNamespaces returns the namespaces listed by the project's Kubernetes
+// cost sources.
+func ownedNamespaces(ctx context.Context, st store.Store, projectID string) (map[string]bool, error) {
+	owners, err := collectork8s.NamespaceOwners(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[string]bool)
+	for ns, projects := range owners {
+		if slices.Contains(projects, projectID) {
+			owned[ns] = true
+		}
+	}
+	return owned, nil
+}
+
+// Enforce runs the enforcement actions of an exceeded budget. It is registered
+// as a budget evaluator hook. Actions that are still in effect from an earlier
+// run are skipped, so their recorded undo state is never overwritten.
+func (e *Enforcer) Enforce(ctx context.Context, status *budget.Status) {
+	if len(status.Enforcement) == 0 {
+		return
+	}
+	history, err := e.store.ListBudgetEnforcements(ctx, status.ID)
+	if err != nil {
+		e.logger.Error("enforcement: failed to list enforcement history", "budget", status.ID, "error", err)
+		return
+	}
+	owned, err := ownedNamespaces(ctx, e.store, status.ProjectID)
+	if err != nil {
+		e.logger.Error("enforcement: failed to resolve owned namespaces", "budget", status.ID, "error", err)
+		return
+	}
+	for _, action := range status.Enforcement {
+		if active(history, action) {
+			continue
+		}
+		e.run(ctx, status.Budget, action, owned[action.Namespace])
+	}
+}
+
+func (e *Enforcer) run(ctx context.Context, b *models.Budget, action models.EnforcementAction, owned bool) {
+	dryRun := action.DryRun || e.config.DryRun
+	rec := &models.BudgetEnforcement{BudgetID: b.ID, ProjectID: b.ProjectID, Action: action, Status: models.EnforcementApplied}
+	if dryRun {
+		rec.Status = models.EnforcementDryRun
+	}
+
+	var u *undo
+	var err error
+	if owned {
+		u, err = e.apply(ctx, b, action, dryRun)
+	} else {
+		// Ownership is checked when the budget is saved, but a cost source
+		// may since have been reconfigured.
+		err = fmt.Errorf("%w: %s", ErrNamespaceNotOwned, action.Namespace)
+	}
+	switch {
+	case err != nil && u != nil:
+		// Part of the action took effect: it stays applied, so that it is not
+		// run again over its own changes and a revert undoes that part.
+		rec.Error = err.Error()
+		e.logger.Error("enforcement: action partly applied", "budget", b.ID, "type", action.Type, "namespace", action.Namespace, "error", err)
+	case err != nil:
+		rec.Status = models.EnforcementFailed
+		rec.Error = err.Error()
+		e.logger.Error("enforcement: action failed", "budget", b.ID, "type", action.Type, "namespace", action.Namespace, "error", err)
+	default:
+		e.logger.Info("enforcement: action applied", "budget", b.ID, "type", action.Type, "namespace", action.Namespace, "dryRun", dryRun)
+	}
+	if rec.Undo, err = json.Marshal(u); err != nil {
+		e.logger.Error("enforcement: failed to encode undo state", "budget", b.ID, "error", err)
+	}
+	if err := e.store.CreateBudgetEnforcement(ctx, rec); err != nil {
+		e.logger.Error("enforcement: failed to record action", "budget", b.ID, "error", err)
+		return
+	}
+	e.auditor.Record(ctx, systemActor, audit.Event{
+		Action:     "budget.enforce",
+		TargetType: audit.TargetEnforcement,
+		TargetID:   rec.ID,
+		ProjectID:  b.ProjectID,
+		After:      rec,
+	})
+}
+
+// apply carries out an action, returning the state it replaced. An action
+// that fails part way returns the state of the part that took effect along
+// with its error.
+func (e *Enforcer) apply(ctx context.Context, b *models.Budget, action models.EnforcementAction, dryRun bool) (*undo, error) {
+	switch action.Type {
+	case models.EnforceResourceQuota:
+		return e.applyQuota(ctx, b, action, dryRun)
+	case models.EnforceScaleToZero:
+		return e.scaleToZero(ctx, action, dryRun)
+	case models.EnforceAnnotate:
+		return e.annotate(ctx, action, dryRun)
+	default:
+		return nil, fmt.Errorf("unknown enforcement action type %q", action.Type)
+	}
+}
+
+// Revert undoes every enforcement action of the budget that is still in
+// effect, returning the records it reverted. Actions that fail to revert stay
+// applied with their error recorded, and are reported in the returned error.
+func (e *Enforcer) Revert(ctx context.Context, budgetID string, actor audit.Actor) ([]*models.BudgetEnforcement, error) {
+	b, err := e.store.GetBudget(ctx, budgetID)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, fmt.Errorf("budget %s not found", budgetID)
+	}
+	history, err := e.store.ListBudgetEnforcements(ctx, budgetID)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []*models.BudgetEnforcement
+	var errs []error
+	for _, rec := range history {
+		if rec.Status != models.EnforcementApplied {
+			continue
+		}
+		before := *rec
+		var u undo
+		if err := json.Unmarshal(rec.Undo, &u); err != nil {
+			errs = append(errs, fmt.Errorf("enforcement %s: decode undo state: %w", rec.ID, err))
+			continue
+		}
+		if err := e.revert(ctx, b, rec.Action, &u); err != nil {
+			rec.Error = err.Error()
+			errs = append(errs, fmt.Errorf("enforcement %s: %w", rec.ID, err))
+		} else {
+			at := time.Now().UTC()
+			rec.Status = models.EnforcementReverted
+			rec.Error = ""
+			rec.RevertedAt = &at
+			rec.RevertedBy = actor.Email
+			reverted = append(reverted, rec)
+		}
+		if err := e.store.UpdateBudgetEnforcement(ctx, rec); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if rec.Status == models.EnforcementReverted {
+			e.auditor.Record(ctx, actor, audit.Event{
+				Action:     "budget.enforcement.revert",
+				TargetType: audit.TargetEnforcement,
+				TargetID:   rec.ID,
+				ProjectID:  rec.ProjectID,
+				Before:     &before,
+				After:      rec,
+			})
+		}
+	}
+	return reverted, errors.Join(errs...)
+}
+
+func (e *Enforcer) revert(ctx context.Context, b *models.Budget, action models.EnforcementAction, u *undo) error {
+	switch action.Type {
+	case models.EnforceResourceQuota:
+		return e.revertQuota(ctx, b, action, u)
+	case models.EnforceScaleToZero:
+		return e.revertScale(ctx, action, u)
+	case models.EnforceAnnotate:
+		return e.revertAnnotations(ctx, action, u)
+	default:
+		return fmt.Errorf("unknown enforcement action type %q", action.Type)
+	}
+}
+
+// active reports whether action has an applied, unreverted run in history.
+func active(history []*models.BudgetEnforcement, action models.EnforcementAction) bool {
+	for _, rec := range history {
+		if rec.Status == models.EnforcementApplied && reflect.DeepEqual(rec.Action, action) {
+			return true
+		}
+	}
+	return false
+}
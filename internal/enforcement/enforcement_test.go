@@ -0,0 +1,436 @@
+package enforcement
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/budget"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func deployment(name string, replicas int32, labels map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a", Labels: labels},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+}
+
+func namespace(name string, labels, annotations map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels, Annotations: annotations}}
+}
+
+// setup creates a project owning the namespaces of actions through a
+// Kubernetes cost source, with a budget carrying actions, and an enforcer
+// backed by a fake clientset holding the given namespaces and deployments.
+func setup(t *testing.T, cfg Config, actions []models.EnforcementAction, objects ...any) (*Enforcer, *fake.Clientset, store.Store, *budget.Status) {
+	t.Helper()
+	st := storetest.New(t)
+	ctx := context.Background()
+	project := &models.Project{Name: "payments"}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	var namespaces []string
+	for _, action := range actions {
+		namespaces = append(namespaces, action.Namespace)
+	}
+	createKubernetesSource(t, st, project.ID, namespaces...)
+	b := &models.Budget{ProjectID: project.ID, Amount: 100, Enforcement: actions}
+	if err := st.CreateBudget(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	cs := fake.NewSimpleClientset()
+	for _, obj := range objects {
+		var err error
+		switch o := obj.(type) {
+		case *corev1.Namespace:
+			_, err = cs.CoreV1().Namespaces().Create(ctx, o, metav1.CreateOptions{})
+		case *appsv1.Deployment:
+			_, err = cs.AppsV1().Deployments(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := New(st, cs, audit.NewRecorder(st, testLogger()), cfg, testLogger())
+	return e, cs, st, &budget.Status{Budget: b, State: budget.StateExceeded}
+}
+
+func createKubernetesSource(t *testing.T, st store.Store, projectID string, namespaces ...string) {
+	t.Helper()
+	config, err := json.Marshal(models.KubernetesConfig{ClusterName: "dev", OpenCostURL: "http://opencost", Namespaces: namespaces})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := &models.CostSource{ProjectID: projectID, Type: models.CostSourceKubernetes, Name: "k8s", Config: config, Enabled: true}
+	if err := st.CreateCostSource(context.Background(), cs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func replicas(t *testing.T, cs *fake.Clientset, name string) int32 {
+	t.Helper()
+	d, err := cs.AppsV1().Deployments("team-a").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *d.Spec.Replicas
+}
+
+func TestEnforcer_EnforceAndRevert(t *testing.T) {
+	actions := []models.EnforcementAction{
+		{Type: models.EnforceResourceQuota, Namespace: "team-a", Hard: map[string]string{"requests.cpu": "4", "pods": "10"}},
+		{Type: models.EnforceScaleToZero, Namespace: "team-a", Selector: "finguard.io/scalable=true"},
+		{Type: models.EnforceAnnotate, Namespace: "team-a", Annotations: map[string]string{"finguard.io/budget": "exceeded", "owner": "finance"}},
+	}
+	e, cs, st, status := setup(t, Config{}, actions,
+		namespace("team-a", map[string]string{"env": "staging"}, map[string]string{"owner": "team-a"}),
+		deployment("api", 3, map[string]string{"finguard.io/scalable": "true"}),
+		deployment("worker", 2, map[string]string{"finguard.io/scalable": "true"}),
+		deployment("db", 1, nil),
+	)
+	ctx := context.Background()
+
+	e.Enforce(ctx, status)
+
+	quota, err := cs.CoreV1().ResourceQuotas("team-a").Get(ctx, quotaName(status.Budget), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the budget's quota to be created: %v", err)
+	}
+	if cpu := quota.Spec.Hard[corev1.ResourceRequestsCPU]; cpu.String() != "4" {
+		t.Errorf("expected a requests.cpu limit of 4, got %s", cpu.String())
+	}
+	if replicas(t, cs, "api") != 0 || replicas(t, cs, "worker") != 0 || replicas(t, cs, "db") != 1 {
+		t.Error("expected only the labelled deployments to be scaled to zero")
+	}
+	ns, _ := cs.CoreV1().Namespaces().Get(ctx, "team-a", metav1.GetOptions{})
+	if ns.Annotations["finguard.io/budget"] != "exceeded" || ns.Annotations["owner"] != "finance" {
+		t.Errorf("expected the namespace to be annotated, got %v", ns.Annotations)
+	}
+
+	history, _ := st.ListBudgetEnforcements(ctx, status.ID)
+	if len(history) != 3 {
+		t.Fatalf("expected 3 enforcement records, got %d", len(history))
+	}
+	for _, rec := range history {
+		if rec.Status != models.EnforcementApplied {
+			t.Errorf("%s: expected applied, got %s (%s)", rec.Action.Type, rec.Status, rec.Error)
+		}
+	}
+
+	// A second breach while the actions are still in effect changes nothing.
+	e.Enforce(ctx, status)
+	if history, _ := st.ListBudgetEnforcements(ctx, status.ID); len(history) != 3 {
+		t.Errorf("expected active actions not to be repeated, got %d records", len(history))
+	}
+
+	reverted, err := e.Revert(ctx, status.ID, audit.Actor{Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 3 || reverted[0].RevertedBy != "alice@example.com" {
+		t.Errorf("expected 3 actions reverted by alice, got %+v", reverted)
+	}
+	if _, err := cs.CoreV1().ResourceQuotas("team-a").Get(ctx, quotaName(status.Budget), metav1.GetOptions{}); err == nil {
+		t.Error("expected the budget's quota to be deleted")
+	}
+	if replicas(t, cs, "api") != 3 || replicas(t, cs, "worker") != 2 {
+		t.Error("expected the deployments to be scaled back up")
+	}
+	ns, _ = cs.CoreV1().Namespaces().Get(ctx, "team-a", metav1.GetOptions{})
+	if _, ok := ns.Annotations["finguard.io/budget"]; ok || ns.Annotations["owner"] != "team-a" {
+		t.Errorf("expected the namespace annotations to be restored, got %v", ns.Annotations)
+	}
+
+	entries, _ := st.ListAuditEntries(ctx, store.AuditQuery{TargetType: audit.TargetEnforcement})
+	if len(entries) != 6 {
+		t.Errorf("expected 3 enforce and 3 revert audit entries, got %d", len(entries))
+	}
+
+	// Once reverted, the next breach enforces again.
+	e.Enforce(ctx, status)
+	if history, _ := st.ListBudgetEnforcements(ctx, status.ID); len(history) != 6 {
+		t.Errorf("expected the actions to run again after a revert, got %d records", len(history))
+	}
+}
+
+func TestEnforcer_PartialScaleToZero(t *testing.T) {
+	actions := []models.EnforcementAction{{Type: models.EnforceScaleToZero, Namespace: "team-a", Selector: "finguard.io/scalable=true"}}
+	e, cs, st, status := setup(t, Config{}, actions,
+		namespace("team-a", map[string]string{"env": "dev"}, nil),
+		deployment("api", 3, map[string]string{"finguard.io/scalable": "true"}),
+		deployment("worker", 2, map[string]string{"finguard.io/scalable": "true"}),
+	)
+	ctx := context.Background()
+
+	// The second Deployment fails to scale.
+	updates := 0
+	cs.PrependReactor("update", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		updates++
+		if updates == 2 {
+			return true, nil, errors.New("conflict")
+		}
+		return false, nil, nil
+	})
+
+	e.Enforce(ctx, status)
+	if scaled := replicas(t, cs, "api") + replicas(t, cs, "worker"); scaled != 2 && scaled != 3 {
+		t.Fatalf("expected exactly one deployment to be scaled to zero, got %d replicas left", scaled)
+	}
+	history, _ := st.ListBudgetEnforcements(ctx, status.ID)
+	if len(history) != 1 || history[0].Status != models.EnforcementApplied || history[0].Error == "" {
+		t.Fatalf("expected the run to stay applied with its error, got %+v", history)
+	}
+
+	// It is not run again over the Deployment it scaled.
+	e.Enforce(ctx, status)
+	if history, _ := st.ListBudgetEnforcements(ctx, status.ID); len(history) != 1 {
+		t.Errorf("expected the partly applied action not to be repeated, got %d records", len(history))
+	}
+
+	if _, err := e.Revert(ctx, status.ID, audit.Actor{Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if replicas(t, cs, "api") != 3 || replicas(t, cs, "worker") != 2 {
+		t.Error("expected the scaled deployment to be restored")
+	}
+}
+
+func TestEnforcer_DryRun(t *testing.T) {
+	actions := []models.EnforcementAction{
+		{Type: models.EnforceResourceQuota, Namespace: "team-a", Hard: map[string]string{"pods": "10"}},
+		{Type: models.EnforceScaleToZero, Namespace: "team-a", Selector: "tier=web"},
+		{Type: models.EnforceAnnotate, Namespace: "team-a", Annotations: map[string]string{"finguard.io/budget": "exceeded"}},
+	}
+	for _, tt := range []struct {
+		name    string
+		cfg     Config
+		actions []models.EnforcementAction
+	}{
+		{"global", Config{DryRun: true}, actions},
+		{"per action", Config{}, []models.EnforcementAction{
+			{Type: models.EnforceResourceQuota, Namespace: "team-a", Hard: map[string]string{"pods": "10"}, DryRun: true},
+			{Type: models.EnforceScaleToZero, Namespace: "team-a", Selector: "tier=web", DryRun: true},
+			{Type: models.EnforceAnnotate, Namespace: "team-a", Annotations: map[string]string{"finguard.io/budget": "exceeded"}, DryRun: true},
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e, cs, st, status := setup(t, tt.cfg, tt.actions,
+				namespace("team-a", map[string]string{"env": "dev"}, nil),
+				deployment("web", 2, map[string]string{"tier": "web"}),
+			)
+			ctx := context.Background()
+			e.Enforce(ctx, status)
+
+			if _, err := cs.CoreV1().ResourceQuotas("team-a").Get(ctx, quotaName(status.Budget), metav1.GetOptions{}); err == nil {
+				t.Error("expected no quota to be created")
+			}
+			if replicas(t, cs, "web") != 2 {
+				t.Error("expected the deployment to keep its replicas")
+			}
+			ns, _ := cs.CoreV1().Namespaces().Get(ctx, "team-a", metav1.GetOptions{})
+			if len(ns.Annotations) != 0 {
+				t.Errorf("expected no annotations, got %v", ns.Annotations)
+			}
+			history, _ := st.ListBudgetEnforcements(ctx, status.ID)
+			if len(history) != 3 {
+				t.Fatalf("expected 3 dry-run records, got %d", len(history))
+			}
+			for _, rec := range history {
+				if rec.Status != models.EnforcementDryRun {
+					t.Errorf("%s: expected dry-run, got %s", rec.Action.Type, rec.Status)
+				}
+			}
+			if string(history[1].Undo) != `{"replicas":{"web":2}}` {
+				t.Errorf("expected the dry run to record the replicas it would change, got %s", history[1].Undo)
+			}
+			if reverted, err := e.Revert(ctx, status.ID, audit.Actor{}); err != nil || len(reverted) != 0 {
+				t.Errorf("expected nothing to revert after a dry run, got %v, %v", reverted, err)
+			}
+		})
+	}
+}
+
+func TestEnforcer_RefusesProductionNamespaces(t *testing.T) {
+	for name, labels := range map[string]map[string]string{
+		"labelled production": {"environment": "production"},
+		"unlabelled":          nil,
+		"unknown environment": {"env": "shared"},
+		"conflicting labels":  {"env": "dev", "environment": "prod"},
+	} {
+		actions := []models.EnforcementAction{{Type: models.EnforceScaleToZero, Namespace: "team-a", Selector: "tier=web"}}
+		e, cs, st, status := setup(t, Config{}, actions,
+			namespace("team-a", labels, nil),
+			deployment("web", 2, map[string]string{"tier": "web"}),
+		)
+		ctx := context.Background()
+		e.Enforce(ctx, status)
+
+		if replicas(t, cs, "web") != 2 {
+			t.Errorf("%s: expected the deployment to keep its replicas", name)
+		}
+		history, _ := st.ListBudgetEnforcements(ctx, status.ID)
+		if len(history) != 1 || history[0].Status != models.EnforcementFailed || history[0].Error != ErrProductionNamespace.Error() {
+			t.Errorf("%s: expected one failed record, got %+v", name, history)
+		}
+	}
+}
+
+func TestEnforcer_TightensExistingQuota(t *testing.T) {
+	actions := []models.EnforcementAction{{Type: models.EnforceResourceQuota, Namespace: "team-a", Hard: map[string]string{"requests.cpu": "4", "requests.memory": "8Gi"}}}
+	e, cs, _, status := setup(t, Config{}, actions, namespace("team-a", nil, nil))
+	ctx := context.Background()
+	existing := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: quotaName(status.Budget), Namespace: "team-a"},
+		Spec:       corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("2")}},
+	}
+	if _, err := cs.CoreV1().ResourceQuotas("team-a").Create(ctx, existing, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	e.Enforce(ctx, status)
+	quota, _ := cs.CoreV1().ResourceQuotas("team-a").Get(ctx, quotaName(status.Budget), metav1.GetOptions{})
+	cpu, memory := quota.Spec.Hard[corev1.ResourceRequestsCPU], quota.Spec.Hard[corev1.ResourceRequestsMemory]
+	if cpu.String() != "2" || memory.String() != "8Gi" {
+		t.Errorf("expected cpu to stay at 2 and memory to be limited to 8Gi, got %s and %s", cpu.String(), memory.String())
+	}
+
+	if _, err := e.Revert(ctx, status.ID, audit.Actor{}); err != nil {
+		t.Fatal(err)
+	}
+	quota, err := cs.CoreV1().ResourceQuotas("team-a").Get(ctx, quotaName(status.Budget), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the pre-existing quota to be kept: %v", err)
+	}
+	if _, ok := quota.Spec.Hard[corev1.ResourceRequestsMemory]; ok || len(quota.Spec.Hard) != 1 {
+		t.Errorf("expected the original limits to be restored, got %v", quota.Spec.Hard)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		action models.EnforcementAction
+		ok     bool
+	}{
+		{models.EnforcementAction{Type: models.EnforceResourceQuota, Namespace: "a", Hard: map[string]string{"pods": "10"}}, true},
+		{models.EnforcementAction{Type: models.EnforceResourceQuota, Namespace: "a"}, false},
+		{models.EnforcementAction{Type: models.EnforceResourceQuota, Namespace: "a", Hard: map[string]string{"pods": "lots"}}, false},
+		{models.EnforcementAction{Type: models.EnforceScaleToZero, Namespace: "a", Selector: "tier in (web,api)"}, true},
+		{models.EnforcementAction{Type: models.EnforceScaleToZero, Namespace: "a"}, false},
+		{models.EnforcementAction{Type: models.EnforceScaleToZero, Namespace: "a", Selector: "=="}, false},
+		{models.EnforcementAction{Type: models.EnforceAnnotate, Namespace: "a", Annotations: map[string]string{"k": "v"}}, true},
+		{models.EnforcementAction{Type: models.EnforceAnnotate, Annotations: map[string]string{"k": "v"}}, false},
+		{models.EnforcementAction{Type: "delete", Namespace: "a"}, false},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.action); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) = %v, want ok=%v", tt.action, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckNamespaces(t *testing.T) {
+	st := storetest.New(t)
+	ctx := context.Background()
+	payments := &models.Project{Name: "payments"}
+	search := &models.Project{Name: "search"}
+	for _, p := range []*models.Project{payments, search} {
+		if err := st.CreateProject(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createKubernetesSource(t, st, payments.ID, "team-a")
+	createKubernetesSource(t, st, search.ID, "team-b")
+
+	annotate := func(ns string) []models.EnforcementAction {
+		return []models.EnforcementAction{{Type: models.EnforceAnnotate, Namespace: ns, Annotations: map[string]string{"k": "v"}}}
+	}
+	tests := []struct {
+		name string
+		ns   string
+		ok   bool
+	}{
+		{"listed by the project's source", "team-a", true},
+		{"listed by another project's source", "team-b", false},
+		{"not listed by any source", "team-c", false},
+	}
+	for _, tt := range tests {
+		err := CheckNamespaces(ctx, st, payments.ID, annotate(tt.ns))
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrNamespaceNotOwned) {
+			t.Errorf("%s: expected ErrNamespaceNotOwned, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestEnforcer_RefusesNamespacesNoLongerOwned(t *testing.T) {
+	actions := []models.EnforcementAction{{Type: models.EnforceAnnotate, Namespace: "team-a", Annotations: map[string]string{"k": "v"}}}
+	e, cs, st, status := setup(t, Config{}, actions, namespace("team-a", nil, nil))
+	ctx := context.Background()
+
+	// The source stops listing team-a after the budget was saved.
+	sources, err := st.ListCostSources(ctx, status.ProjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources[0].Config = json.RawMessage(`{"clusterName":"dev","opencostUrl":"http://opencost","namespaces":["team-z"]}`)
+	if err := st.UpdateCostSource(ctx, sources[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	e.Enforce(ctx, status)
+	history, err := st.ListBudgetEnforcements(ctx, status.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Status != models.EnforcementFailed {
+		t.Fatalf("expected one failed run, got %+v", history)
+	}
+	ns, err := cs.CoreV1().Namespaces().Get(ctx, "team-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ns.Annotations["k"]; ok {
+		t.Error("expected the namespace to be left alone")
+	}
+}
+
+func TestEnforcer_RevertReportsFailures(t *testing.T) {
+	actions := []models.EnforcementAction{{Type: models.EnforceAnnotate, Namespace: "team-a", Annotations: map[string]string{"k": "v"}}}
+	e, cs, st, status := setup(t, Config{}, actions, namespace("team-a", nil, nil))
+	ctx := context.Background()
+	e.Enforce(ctx, status)
+	if err := cs.CoreV1().Namespaces().Delete(ctx, "team-a", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	reverted, err := e.Revert(ctx, status.ID, audit.Actor{})
+	if err == nil || len(reverted) != 0 {
+		t.Fatalf("expected the revert to fail, got %v, %v", reverted, err)
+	}
+	history, _ := st.ListBudgetEnforcements(ctx, status.ID)
+	if history[0].Status != models.EnforcementApplied || history[0].Error == "" {
+		t.Errorf("expected the action to stay applied with its error, got %+v", history[0])
+	}
+}
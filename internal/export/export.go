@@ -0,0 +1,191 @@
+// Package export writes cost records as CSV, NDJSON or Parquet. Writers take
+// one record at a time, so an export streams from the database cursor to the
+// client without holding the records in memory. CSV and Parquet flatten each
+// label into its own label:<key> column; NDJSON keeps the labels object.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+// Format is an export file format.
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatNDJSON  Format = "ndjson"
+	FormatParquet Format = "parquet"
+)
+
+// parquetRowGroupRows bounds how many rows the Parquet writer buffers before
+// flushing a row group.
+const parquetRowGroupRows = 10000
+
+// ParseFormat returns the format named s.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatCSV, FormatNDJSON, FormatParquet:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown export format %q: must be csv, ndjson or parquet", s)
+}
+
+// ContentType is the media type of files in the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/vnd.apache.parquet"
+	}
+}
+
+// Writer writes cost records to an export. Close must be called to finish
+// the file; it does not close the underlying writer.
+type Writer interface {
+	Write(r *models.CostRecord) error
+	Close() error
+}
+
+// columns are the record fields every CSV and Parquet export has, in CSV
+// order, followed by one column per label key.
+var columns = []string{
+	"id", "project_id", "cost_source_id", "provider", "provider_id", "account_id", "account_name", "invoice_entity_id",
+	"service", "category", "region", "availability_zone", "start_time", "end_time",
+	"list_cost", "net_cost", "amortized_cost", "amortized_net_cost", "currency", "kubernetes_percent",
+}
+
+// LabelColumn is the name of the column holding the label key.
+func LabelColumn(key string) string {
+	return "label:" + key
+}
+
+// NewWriter returns a writer of format f to w. labelKeys are the label keys
+// to give columns in CSV and Parquet; other labels are left out.
+func NewWriter(w io.Writer, f Format, labelKeys []string) (Writer, error) {
+	switch f {
+	case FormatCSV:
+		return newCSVWriter(w, labelKeys)
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	case FormatParquet:
+		return newParquetWriter(w, labelKeys), nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", f)
+}
+
+// values returns a record's fields in the order of columns.
+func values(r *models.CostRecord) []any {
+	return []any{
+		r.ID, r.ProjectID, r.CostSourceID, r.Provider, r.ProviderID, r.AccountID, r.AccountName, r.InvoiceEntityID,
+		r.Service, r.Category, r.Region, r.AvailabilityZone, r.StartTime.UTC(), r.EndTime.UTC(),
+		r.ListCost, r.NetCost, r.AmortizedCost, r.AmortizedNetCost, r.Currency, r.KubernetesPercent,
+	}
+}
+
+type csvWriter struct {
+	w         *csv.Writer
+	labelKeys []string
+	row       []string
+}
+
+func newCSVWriter(w io.Writer, labelKeys []string) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), labelKeys: labelKeys}
+	header := append([]string{}, columns...)
+	for _, key := range labelKeys {
+		header = append(header, LabelColumn(key))
+	}
+	return cw, cw.w.Write(header)
+}
+
+func (cw *csvWriter) Write(r *models.CostRecord) error {
+	cw.row = cw.row[:0]
+	for _, v := range values(r) {
+		switch v := v.(type) {
+		case string:
+			cw.row = append(cw.row, v)
+		case float64:
+			cw.row = append(cw.row, strconv.FormatFloat(v, 'f', -1, 64))
+		case time.Time:
+			cw.row = append(cw.row, v.Format(time.RFC3339))
+		}
+	}
+	for _, key := range cw.labelKeys {
+		cw.row = append(cw.row, r.Labels[key])
+	}
+	return cw.w.Write(cw.row)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (nw *ndjsonWriter) Write(r *models.CostRecord) error {
+	return nw.enc.Encode(r)
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
+
+type parquetWriter struct {
+	w         *parquet.Writer
+	labelKeys []string
+}
+
+// newParquetWriter builds the schema from columns and the label keys. Label
+// columns are optional, null where a record lacks the label.
+func newParquetWriter(w io.Writer, labelKeys []string) *parquetWriter {
+	group := parquet.Group{}
+	for i, v := range values(&models.CostRecord{}) {
+		switch v.(type) {
+		case string:
+			group[columns[i]] = parquet.String()
+		case float64:
+			group[columns[i]] = parquet.Leaf(parquet.DoubleType)
+		case time.Time:
+			group[columns[i]] = parquet.Timestamp(parquet.Millisecond)
+		}
+	}
+	for _, key := range labelKeys {
+		group[LabelColumn(key)] = parquet.Optional(parquet.String())
+	}
+	schema := parquet.NewSchema("cost_record", group)
+	return &parquetWriter{
+		w:         parquet.NewWriter(w, schema, parquet.MaxRowsPerRowGroup(parquetRowGroupRows), parquet.Compression(&parquet.Zstd)),
+		labelKeys: labelKeys,
+	}
+}
+
+func (pw *parquetWriter) Write(r *models.CostRecord) error {
+	row := make(map[string]any, len(columns)+len(pw.labelKeys))
+	for i, v := range values(r) {
+		row[columns[i]] = v
+	}
+	for _, key := range pw.labelKeys {
+		if v, ok := r.Labels[key]; ok {
+			row[LabelColumn(key)] = v
+		}
+	}
+	return pw.w.Write(row)
+}
+
+func (pw *parquetWriter) Close() error {
+	return pw.w.Close()
+}
@@ -0,0 +1,121 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+func testRecords() []*models.CostRecord {
+	start := time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)
+	return []*models.CostRecord{
+		{ID: "r1", ProjectID: "p", Provider: "aws", Service: "ec2", StartTime: start, EndTime: start.Add(time.Hour), NetCost: 1.25, Currency: "USD", Labels: map[string]string{"team": "payments"}},
+		{ID: "r2", ProjectID: "p", Provider: "aws", Service: "s3", StartTime: start, EndTime: start.Add(time.Hour), NetCost: 2, Currency: "USD", Labels: map[string]string{"env": "prod"}},
+	}
+}
+
+func write(t *testing.T, f Format, labelKeys []string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, f, labelKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range testRecords() {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestCSV_FlattensLabels(t *testing.T) {
+	rows, err := csv.NewReader(write(t, FormatCSV, []string{"env", "team"})).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %d", len(rows))
+	}
+	header := rows[0]
+	if header[0] != "id" || header[len(header)-2] != "label:env" || header[len(header)-1] != "label:team" {
+		t.Errorf("unexpected header %v", header)
+	}
+	col := func(name string) int {
+		for i, h := range header {
+			if h == name {
+				return i
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return -1
+	}
+	if rows[1][col("label:team")] != "payments" || rows[1][col("label:env")] != "" || rows[2][col("label:env")] != "prod" {
+		t.Errorf("labels not flattened: %v", rows[1:])
+	}
+	if rows[1][col("net_cost")] != "1.25" || rows[1][col("start_time")] != "2025-06-01T00:00:00Z" {
+		t.Errorf("unexpected values %v", rows[1])
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(write(t, FormatNDJSON, nil).String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	var r models.CostRecord
+	if err := json.Unmarshal([]byte(lines[0]), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != "r1" || r.Labels["team"] != "payments" {
+		t.Errorf("unexpected record %+v", r)
+	}
+}
+
+func TestParquet_FlattensLabels(t *testing.T) {
+	buf := write(t, FormatParquet, []string{"env", "team"})
+	file, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.NumRows() != 2 {
+		t.Fatalf("expected 2 rows, got %d", file.NumRows())
+	}
+
+	reader := parquet.NewReader(bytes.NewReader(buf.Bytes()))
+	var rows []map[string]any
+	for range 2 {
+		row := map[string]any{}
+		if err := reader.Read(&row); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	if rows[0]["id"] != "r1" || rows[0]["label:team"] != "payments" || rows[0]["label:env"] != nil || rows[0]["net_cost"] != 1.25 {
+		t.Errorf("unexpected first row %v", rows[0])
+	}
+	if rows[1]["label:env"] != "prod" || rows[1]["label:team"] != nil {
+		t.Errorf("unexpected second row %v", rows[1])
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, s := range []string{"csv", "ndjson", "parquet"} {
+		if _, err := ParseFormat(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+	if _, err := ParseFormat("xlsx"); err == nil {
+		t.Error("expected xlsx to be rejected")
+	}
+}
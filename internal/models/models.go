@@ -2,15 +2,36 @@ package models
 
 import (
 	"encoding/json"
+	"slices"
 	"time"
 )
 
 type Project struct {
-	ID          string    `json:"id" db:"id"`
-	Name        string    `json:"name" db:"name"`
-	Description string    `json:"description" db:"description"`
-	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt   time.Time `json:"updatedAt" db:"updated_at"`
+	ID            string        `json:"id" db:"id"`
+	Name          string        `json:"name" db:"name"`
+	Description   string        `json:"description" db:"description"`
+	AdmissionMode AdmissionMode `json:"admissionMode" db:"admission_mode"`
+	CreatedAt     time.Time     `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time     `json:"updatedAt" db:"updated_at"`
+}
+
+// AdmissionMode is how the admission webhook treats a workload that would
+// breach one of the project's budgets.
+type AdmissionMode string
+
+const (
+	AdmissionOff  AdmissionMode = "off"
+	AdmissionWarn AdmissionMode = "warn"
+	AdmissionDeny AdmissionMode = "deny"
+)
+
+// Valid reports whether m is a known admission mode.
+func (m AdmissionMode) Valid() bool {
+	switch m {
+	case AdmissionOff, AdmissionWarn, AdmissionDeny:
+		return true
+	}
+	return false
 }
 
 type CostSourceType string
@@ -67,10 +88,14 @@ type GCPConfig struct {
 	ServiceAccountKey string `json:"serviceAccountKey,omitempty"`
 }
 
+// KubernetesConfig describes a cluster's OpenCost endpoint. Namespaces, if
+// set, are the namespaces of the cluster the project owns: only their costs
+// are collected, and budget enforcement actions may target them.
 type KubernetesConfig struct {
 	ClusterName  string `json:"clusterName"`
 	OpenCostURL  string `json:"opencostUrl"`
 	KubeconfigRef string `json:"kubeconfigRef,omitempty"`
+	Namespaces   []string `json:"namespaces,omitempty"`
 }
 
 type PluginConfig struct {
@@ -83,14 +108,33 @@ type User struct {
 	Email       string    `json:"email" db:"email"`
 	DisplayName string    `json:"displayName" db:"display_name"`
 	OIDCSubject string    `json:"oidcSubject,omitempty" db:"oidc_subject"`
+	ExternalID  string    `json:"externalId,omitempty" db:"external_id"`
+	Active      bool      `json:"active" db:"active"`
 	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
 }
 
 type Group struct {
-	ID        string    `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	OIDCClaim string    `json:"oidcClaim,omitempty" db:"oidc_claim"`
-	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	ID         string    `json:"id" db:"id"`
+	Name       string    `json:"name" db:"name"`
+	OIDCClaim  string    `json:"oidcClaim,omitempty" db:"oidc_claim"`
+	ExternalID string    `json:"externalId,omitempty" db:"external_id"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+}
+
+// Session is a server-side login session. The session cookie only carries the
+// opaque ID, so a session can be revoked or expired without the client's cooperation.
+type Session struct {
+	ID             string     `json:"id" db:"id"`
+	UserID         string     `json:"userId" db:"user_id"`
+	UserAgent      string     `json:"userAgent" db:"user_agent"`
+	IPAddress      string     `json:"ipAddress,omitempty" db:"ip_address"`
+	Groups         []string   `json:"groups,omitempty" db:"groups_json"`
+	RefreshToken   string     `json:"-" db:"refresh_token"`
+	TokenExpiresAt *time.Time `json:"-" db:"token_expires_at"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	LastSeenAt     time.Time  `json:"lastSeenAt" db:"last_seen_at"`
+	ExpiresAt      time.Time  `json:"expiresAt" db:"expires_at"`
+	RevokedAt      *time.Time `json:"revokedAt,omitempty" db:"revoked_at"`
 }
 
 type Role string
@@ -102,6 +146,60 @@ const (
 	RoleViewer        Role = "viewer"
 )
 
+// GlobalProjectID is the project holding platform-wide role assignments,
+// such as platform-admin.
+const GlobalProjectID = "_global"
+
+// Permission names a single capability on a project. Source write permissions may
+// be narrowed to one cost source type, e.g. "sources:write:kubernetes".
+type Permission string
+
+const (
+	PermProjectsRead       Permission = "projects:read"
+	PermProjectsWrite      Permission = "projects:write"
+	PermProjectsDelete     Permission = "projects:delete"
+	PermSourcesRead        Permission = "sources:read"
+	PermSourcesWrite       Permission = "sources:write"
+	PermBudgetsRead        Permission = "budgets:read"
+	PermBudgetsWrite       Permission = "budgets:write"
+	PermBudgetsEnforce     Permission = "budgets:enforce"
+	PermMembersRead        Permission = "members:read"
+	PermMembersManage      Permission = "members:manage"
+	PermCostsRead          Permission = "costs:read"
+	PermCostsExport        Permission = "costs:export"
+	PermAuditRead          Permission = "audit:read"
+	PermNotificationsRead  Permission = "notifications:read"
+	PermNotificationsWrite Permission = "notifications:write"
+	PermReportsRead        Permission = "reports:read"
+	PermReportsWrite       Permission = "reports:write"
+)
+
+// AllPermissions lists every unscoped permission, in display order.
+var AllPermissions = []Permission{
+	PermProjectsRead, PermProjectsWrite, PermProjectsDelete,
+	PermSourcesRead, PermSourcesWrite,
+	PermBudgetsRead, PermBudgetsWrite, PermBudgetsEnforce,
+	PermMembersRead, PermMembersManage,
+	PermCostsRead, PermCostsExport, PermAuditRead,
+	PermNotificationsRead, PermNotificationsWrite,
+	PermReportsRead, PermReportsWrite,
+}
+
+// SourceWritePermission returns the permission needed to manage sources of type t.
+func SourceWritePermission(t CostSourceType) Permission {
+	return PermSourcesWrite + Permission(":"+string(t))
+}
+
+// RoleDefinition is a named set of permissions that can be assigned on a project.
+type RoleDefinition struct {
+	Name        string       `json:"name" db:"name"`
+	Description string       `json:"description" db:"description"`
+	Permissions []Permission `json:"permissions" db:"permissions_json"`
+	BuiltIn     bool         `json:"builtIn"`
+	CreatedAt   time.Time    `json:"createdAt,omitzero" db:"created_at"`
+	UpdatedAt   time.Time    `json:"updatedAt,omitzero" db:"updated_at"`
+}
+
 type SubjectType string
 
 const (
@@ -114,16 +212,254 @@ type ProjectRole struct {
 	SubjectType SubjectType `json:"subjectType" db:"subject_type"`
 	SubjectID   string      `json:"subjectId" db:"subject_id"`
 	Role        Role        `json:"role" db:"role"`
+	ExpiresAt   *time.Time  `json:"expiresAt,omitempty" db:"expires_at"`
 }
 
+// Expired reports whether a time-bound assignment no longer grants access at t.
+func (pr *ProjectRole) Expired(t time.Time) bool {
+	return pr.ExpiresAt != nil && !t.Before(*pr.ExpiresAt)
+}
+
+// ProjectInvitation grants a role to an email address before a user with that
+// address exists. It becomes a ProjectRole when the user is provisioned.
+type ProjectInvitation struct {
+	ID            string     `json:"id" db:"id"`
+	ProjectID     string     `json:"projectId" db:"project_id"`
+	Email         string     `json:"email" db:"email"`
+	Role          Role       `json:"role" db:"role"`
+	RoleExpiresAt *time.Time `json:"roleExpiresAt,omitempty" db:"role_expires_at"`
+	InvitedBy     string     `json:"invitedBy,omitempty" db:"invited_by"`
+	CreatedAt     time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// Budget limits a project's spend per period. Amount applies to every period
+// unless Plan gives an explicit amount for each period of the fiscal year, in
+// order. With Rollover, unspent balance carries into the next period until the
+// fiscal year ends. Filter narrows the spend counted against the budget to
+// matching cost records. Enforcement lists the actions taken in the cluster
+// when the budget is exceeded.
 type Budget struct {
-	ID            string   `json:"id" db:"id"`
-	ProjectID     string   `json:"projectId" db:"project_id"`
-	CostSourceID  *string  `json:"costSourceId,omitempty" db:"cost_source_id"`
-	MonthlyLimit  float64  `json:"monthlyLimit" db:"monthly_limit"`
-	WarnThreshold float64  `json:"warnThreshold" db:"warn_threshold"`
-	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt     time.Time `json:"updatedAt" db:"updated_at"`
+	ID           string              `json:"id" db:"id"`
+	ProjectID    string              `json:"projectId" db:"project_id"`
+	CostSourceID *string             `json:"costSourceId,omitempty" db:"cost_source_id"`
+	Filter       CostFilter          `json:"filter" db:"filter_json"`
+	Period       BudgetPeriod        `json:"period" db:"period"`
+	Amount       float64             `json:"amount" db:"amount"`
+	Plan         []float64           `json:"plan,omitempty" db:"plan_json"`
+	Rollover     bool                `json:"rollover" db:"rollover"`
+	Thresholds   []float64           `json:"thresholds" db:"thresholds_json"`
+	Enforcement  []EnforcementAction `json:"enforcement,omitempty" db:"enforcement_json"`
+	CreatedAt    time.Time           `json:"createdAt" db:"created_at"`
+	UpdatedAt    time.Time           `json:"updatedAt" db:"updated_at"`
+}
+
+// DefaultBudgetThresholds are the alert tiers, as fractions of the budget
+// amount, used when a budget does not set its own.
+var DefaultBudgetThresholds = []float64{0.5, 0.8, 1, 1.2}
+
+// BudgetAlertState records the highest threshold tier a budget has alerted on
+// in its current period. Tier and AcknowledgedTier are fractions of the
+// budget amount; zero means no tier has been crossed or acknowledged.
+type BudgetAlertState struct {
+	BudgetID         string     `json:"budgetId" db:"budget_id"`
+	PeriodStart      time.Time  `json:"periodStart" db:"period_start"`
+	State            string     `json:"state" db:"state"`
+	Tier             float64    `json:"tier" db:"tier"`
+	AcknowledgedTier float64    `json:"acknowledgedTier" db:"acknowledged_tier"`
+	AcknowledgedBy   string     `json:"acknowledgedBy,omitempty" db:"acknowledged_by"`
+	LastNotifiedAt   *time.Time `json:"lastNotifiedAt,omitempty" db:"last_notified_at"`
+	UpdatedAt        time.Time  `json:"updatedAt" db:"updated_at"`
+}
+
+// BudgetPeriod is the calendar period a budget's amount applies to.
+type BudgetPeriod string
+
+const (
+	BudgetMonthly   BudgetPeriod = "monthly"
+	BudgetQuarterly BudgetPeriod = "quarterly"
+	BudgetAnnual    BudgetPeriod = "annual"
+)
+
+// Valid reports whether p is a known budget period.
+func (p BudgetPeriod) Valid() bool {
+	switch p {
+	case BudgetMonthly, BudgetQuarterly, BudgetAnnual:
+		return true
+	}
+	return false
+}
+
+// EnforcementActionType is what an enforcement action does to a namespace.
+type EnforcementActionType string
+
+const (
+	// EnforceResourceQuota applies a ResourceQuota owned by the budget.
+	EnforceResourceQuota EnforcementActionType = "resourceQuota"
+	// EnforceScaleToZero scales the Deployments matching a selector to zero.
+	EnforceScaleToZero EnforcementActionType = "scaleToZero"
+	// EnforceAnnotate sets annotations on the namespace.
+	EnforceAnnotate EnforcementActionType = "annotate"
+)
+
+// EnforcementAction is an opt-in action taken on a Kubernetes namespace when a
+// budget is exceeded. Hard, Selector and Annotations apply to the
+// resourceQuota, scaleToZero and annotate types respectively. A dry-run action
+// records what it would change without touching the cluster.
+type EnforcementAction struct {
+	Type        EnforcementActionType `json:"type"`
+	Namespace   string                `json:"namespace"`
+	Hard        map[string]string     `json:"hard,omitempty"`
+	Selector    string                `json:"selector,omitempty"`
+	Annotations map[string]string     `json:"annotations,omitempty"`
+	DryRun      bool                  `json:"dryRun,omitempty"`
+}
+
+// EnforcementStatus is the outcome of an enforcement action.
+type EnforcementStatus string
+
+const (
+	EnforcementApplied  EnforcementStatus = "applied"
+	EnforcementDryRun   EnforcementStatus = "dry-run"
+	EnforcementFailed   EnforcementStatus = "failed"
+	EnforcementReverted EnforcementStatus = "reverted"
+)
+
+// BudgetEnforcement records one enforcement action taken for a budget. Undo
+// holds what the action replaced, so that reverting restores it.
+type BudgetEnforcement struct {
+	ID         string            `json:"id" db:"id"`
+	BudgetID   string            `json:"budgetId" db:"budget_id"`
+	ProjectID  string            `json:"projectId" db:"project_id"`
+	Action     EnforcementAction `json:"action" db:"action_json"`
+	Status     EnforcementStatus `json:"status" db:"status"`
+	Undo       json.RawMessage   `json:"undo,omitempty" db:"undo_json"`
+	Error      string            `json:"error,omitempty" db:"error"`
+	AppliedAt  time.Time         `json:"appliedAt" db:"applied_at"`
+	RevertedAt *time.Time        `json:"revertedAt,omitempty" db:"reverted_at"`
+	RevertedBy string            `json:"revertedBy,omitempty" db:"reverted_by"`
+}
+
+// NotificationChannelType is where a notification channel delivers messages.
+type NotificationChannelType string
+
+const (
+	ChannelSlack   NotificationChannelType = "slack"
+	ChannelTeams   NotificationChannelType = "teams"
+	ChannelEmail   NotificationChannelType = "email"
+	ChannelWebhook NotificationChannelType = "webhook"
+)
+
+// NotificationChannel delivers the project's events on the subscribed Topics.
+// Config holds the type's settings, one of SlackChannelConfig,
+// TeamsChannelConfig, EmailChannelConfig or WebhookChannelConfig. Template is
+// an optional text/template overriding the default message for each topic.
+type NotificationChannel struct {
+	ID        string                  `json:"id" db:"id"`
+	ProjectID string                  `json:"projectId" db:"project_id"`
+	Type      NotificationChannelType `json:"type" db:"type"`
+	Name      string                  `json:"name" db:"name"`
+	Config    json.RawMessage         `json:"config" db:"config_json" swaggertype:"object"`
+	Topics    []string                `json:"topics" db:"topics_json"`
+	Template  string                  `json:"template,omitempty" db:"template"`
+	Enabled   bool                    `json:"enabled" db:"enabled"`
+	CreatedAt time.Time               `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time               `json:"updatedAt" db:"updated_at"`
+}
+
+// Subscribed reports whether the channel delivers events on topic.
+func (c *NotificationChannel) Subscribed(topic string) bool {
+	return slices.Contains(c.Topics, topic)
+}
+
+type SlackChannelConfig struct {
+	WebhookURL string `json:"webhookUrl"`
+}
+
+type TeamsChannelConfig struct {
+	WebhookURL string `json:"webhookUrl"`
+}
+
+// EmailChannelConfig sends through the server's SMTP relay. Subject is a
+// text/template like the channel's message template.
+type EmailChannelConfig struct {
+	To      []string `json:"to"`
+	Subject string   `json:"subject,omitempty"`
+}
+
+// WebhookChannelConfig posts events as JSON, signed with HMAC-SHA256 over the
+// request timestamp and body using Secret.
+type WebhookChannelConfig struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// DeliveryStatus is where a notification delivery is in the outbox.
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryDead      DeliveryStatus = "dead"
+)
+
+// NotificationDelivery is one event queued for one channel in the outbox. It
+// stays pending, retried with backoff from NextAttemptAt, until it is
+// delivered or has failed too many times and is dead-lettered.
+type NotificationDelivery struct {
+	ID            string          `json:"id" db:"id"`
+	ChannelID     string          `json:"channelId" db:"channel_id"`
+	ProjectID     string          `json:"projectId" db:"project_id"`
+	Topic         string          `json:"topic" db:"topic"`
+	Event         json.RawMessage `json:"event" db:"event_json" swaggertype:"object"`
+	Status        DeliveryStatus  `json:"status" db:"status"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time       `json:"nextAttemptAt" db:"next_attempt_at"`
+	LastError     string          `json:"lastError,omitempty" db:"last_error"`
+	CreatedAt     time.Time       `json:"createdAt" db:"created_at"`
+	DeliveredAt   *time.Time      `json:"deliveredAt,omitempty" db:"delivered_at"`
+}
+
+// DeliveryAttempt records one try at sending a delivery. StatusCode is zero
+// when no HTTP response was received, and for email.
+type DeliveryAttempt struct {
+	ID          string    `json:"id" db:"id"`
+	DeliveryID  string    `json:"deliveryId" db:"delivery_id"`
+	Attempt     int       `json:"attempt" db:"attempt"`
+	StatusCode  int       `json:"statusCode,omitempty" db:"status_code"`
+	LatencyMs   int64     `json:"latencyMs" db:"latency_ms"`
+	Response    string    `json:"response,omitempty" db:"response"`
+	Error       string    `json:"error,omitempty" db:"error"`
+	AttemptedAt time.Time `json:"attemptedAt" db:"attempted_at"`
+}
+
+// ReportFormat is how a scheduled report is delivered: an HTML email, or a
+// short plain-text email with the report attached as CSV.
+type ReportFormat string
+
+const (
+	ReportHTML ReportFormat = "html"
+	ReportCSV  ReportFormat = "csv"
+)
+
+// Report is a cost digest emailed to Recipients on a cron Schedule, evaluated
+// in Timezone. It covers the project's spend, narrowed by Filter, over the
+// seven days before the run, with the week-over-week change, the top
+// services and the project's budget status.
+type Report struct {
+	ID         string       `json:"id" db:"id"`
+	ProjectID  string       `json:"projectId" db:"project_id"`
+	Name       string       `json:"name" db:"name"`
+	Schedule   string       `json:"schedule" db:"schedule"`
+	Timezone   string       `json:"timezone" db:"timezone"`
+	Recipients []string     `json:"recipients" db:"recipients_json"`
+	Format     ReportFormat `json:"format" db:"format"`
+	Filter     CostFilter   `json:"filter" db:"filter_json"`
+	Enabled    bool         `json:"enabled" db:"enabled"`
+	NextRunAt  *time.Time   `json:"nextRunAt,omitempty" db:"next_run_at"`
+	LastRunAt  *time.Time   `json:"lastRunAt,omitempty" db:"last_run_at"`
+	LastError  string       `json:"lastError,omitempty" db:"last_error"`
+	CreatedAt  time.Time    `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time    `json:"updatedAt" db:"updated_at"`
 }
 
 type CostRecord struct {
@@ -150,3 +486,31 @@ type CostRecord struct {
 	LabelsJSON        string            `json:"-" db:"labels_json"`
 	KubernetesPercent float64           `json:"kubernetesPercent,omitempty" db:"kubernetes_percent"`
 }
+
+// CostFilter narrows cost records by their attributes. Empty fields match
+// every record; each label must be present on a record with exactly the given
+// value. Kubernetes records carry their namespace as the "namespace" label.
+type CostFilter struct {
+	Provider string            `json:"provider,omitempty"`
+	Service  string            `json:"service,omitempty"`
+	Category string            `json:"category,omitempty"`
+	Region   string            `json:"region,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// AuditEntry records a single mutation or authentication event. Before and After
+// hold redacted JSON snapshots of the target; either is null for creates and deletes.
+type AuditEntry struct {
+	ID         string          `json:"id" db:"id"`
+	OccurredAt time.Time       `json:"occurredAt" db:"occurred_at"`
+	ActorID    string          `json:"actorId,omitempty" db:"actor_id"`
+	ActorEmail string          `json:"actorEmail,omitempty" db:"actor_email"`
+	Action     string          `json:"action" db:"action"`
+	TargetType string          `json:"targetType" db:"target_type"`
+	TargetID   string          `json:"targetId,omitempty" db:"target_id"`
+	ProjectID  string          `json:"projectId,omitempty" db:"project_id"`
+	Before     json.RawMessage `json:"before" db:"before_json" swaggertype:"object"`
+	After      json.RawMessage `json:"after" db:"after_json" swaggertype:"object"`
+	RequestID  string          `json:"requestId,omitempty" db:"request_id"`
+	IPAddress  string          `json:"ipAddress,omitempty" db:"ip_address"`
+}
@@ -0,0 +1,169 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/pkg/event"
+)
+
+// Webhook request headers. The signature is "sha256=" followed by the hex
+// HMAC-SHA256 of the timestamp, a dot and the body, keyed with the channel's
+// secret; receivers should recompute it and reject stale timestamps.
+const (
+	HeaderEvent     = "X-FinGuard-Event"
+	HeaderTimestamp = "X-FinGuard-Timestamp"
+	HeaderSignature = "X-FinGuard-Signature"
+)
+
+// maxResponseBody bounds how much of a response is kept in the delivery log
+// and quoted in errors.
+const maxResponseBody = 512
+
+// Sign returns the signature header value for a webhook body sent at the
+// given Unix timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookPayload is the JSON body of a webhook delivery.
+type WebhookPayload struct {
+	Topic     string          `json:"topic"`
+	Type      string          `json:"type"`
+	Source    string          `json:"source"`
+	Timestamp time.Time       `json:"timestamp"`
+	ProjectID string          `json:"projectId"`
+	Message   string          `json:"message"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+func (n *Notifier) sendSlack(ctx context.Context, cfg models.SlackChannelConfig, msg Message) (Result, error) {
+	body, err := json.Marshal(map[string]string{"text": msg.Text})
+	if err != nil {
+		return Result{}, err
+	}
+	return n.post(ctx, cfg.WebhookURL, body, nil)
+}
+
+// sendTeams posts an Adaptive Card, the format accepted by Teams workflow
+// webhooks.
+func (n *Notifier) sendTeams(ctx context.Context, cfg models.TeamsChannelConfig, msg Message) (Result, error) {
+	card := map[string]any{
+		"type": "message",
+		"attachments": []any{map[string]any{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body": []any{
+					map[string]any{"type": "TextBlock", "text": msg.Subject, "weight": "Bolder", "wrap": true},
+					map[string]any{"type": "TextBlock", "text": msg.Text, "wrap": true},
+				},
+			},
+		}},
+	}
+	body, err := json.Marshal(card)
+	if err != nil {
+		return Result{}, err
+	}
+	return n.post(ctx, cfg.WebhookURL, body, nil)
+}
+
+func (n *Notifier) sendWebhook(ctx context.Context, cfg models.WebhookChannelConfig, e *event.Event, msg Message) (Result, error) {
+	body, err := json.Marshal(WebhookPayload{
+		Topic:     e.Topic,
+		Type:      e.Type,
+		Source:    e.Source,
+		Timestamp: e.Timestamp,
+		ProjectID: ProjectID(e),
+		Message:   msg.Text,
+		Payload:   e.Payload,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	ts := time.Now().Unix()
+	return n.post(ctx, cfg.URL, body, http.Header{
+		HeaderEvent:     {e.Topic},
+		HeaderTimestamp: {strconv.FormatInt(ts, 10)},
+		HeaderSignature: {Sign(cfg.Secret, ts, body)},
+	})
+}
+
+// post sends body to url and returns the response status and the start of
+// its body. Non-2xx responses are errors.
+func (n *Notifier) post(ctx context.Context, url string, body []byte, header http.Header) (Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "FinGuard")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	res := Result{StatusCode: resp.StatusCode, Response: strings.TrimSpace(string(snippet))}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return res, fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, res.Response)
+	}
+	return res, nil
+}
+
+func (n *Notifier) sendEmail(cfg models.EmailChannelConfig, msg Message) error {
+	relay := n.config.SMTP
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", relay.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+
+	return relay.Send(cfg.To, buf.Bytes())
+}
+
+// Send delivers msg, a complete message with headers, to the recipients
+// through the relay, authenticating with PLAIN when a username is set.
+func (relay SMTPConfig) Send(to []string, msg []byte) error {
+	if relay.Addr == "" || relay.From == "" {
+		return errors.New("email needs FINGUARD_SMTP_ADDR and FINGUARD_SMTP_FROM")
+	}
+	var auth smtp.Auth
+	if relay.Username != "" {
+		host, _, err := net.SplitHostPort(relay.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", relay.Username, relay.Password, host)
+	}
+	return smtp.SendMail(relay.Addr, auth, relay.From, to, msg)
+}
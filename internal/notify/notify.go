@@ -0,0 +1,654 @@
+// Package notify delivers hub events to the notification channels of the
+// project they belong to: Slack and Microsoft Teams incoming webhooks, SMTP
+// email and HMAC-signed HTTPS webhooks. Deliveries go through an outbox in the
+// store, so they survive restarts and are retried until they succeed or are
+// dead-lettered.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/pkg/event"
+)
+
+// TopicTest is the topic of the event sent when a channel is tested.
+const TopicTest = "notification.test"
+
+// SMTPConfig is the relay email channels send through. Username and Password
+// are optional; without them mail is sent unauthenticated.
+type SMTPConfig struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// Config configures delivery.
+type Config struct {
+	SMTP SMTPConfig
+	// HTTPClient sends Slack, Teams and webhook requests. Nil uses a client
+	// with a ten second timeout.
+	HTTPClient *http.Client
+	// MaxAttempts is how many times a delivery is tried before it is
+	// dead-lettered. Zero means 8.
+	MaxAttempts int
+	// RetryBackoff is the wait after the first failed attempt. It doubles
+	// with every further failure, up to MaxBackoff. Zero means 30 seconds and
+	// one hour.
+	RetryBackoff time.Duration
+	MaxBackoff   time.Duration
+	// PollInterval is how often the outbox is checked for due deliveries.
+	// Zero means five seconds.
+	PollInterval time.Duration
+}
+
+const (
+	// queueSize bounds the published events waiting to be written to the
+	// outbox; publishers wait while it is full.
+	queueSize = 1024
+	// enqueueTimeout bounds each outbox write of a queued event.
+	enqueueTimeout = 5 * time.Second
+	// enqueueAttempts is how many times a queued event's outbox write is
+	// tried before the event is dropped. The wait between tries starts at
+	// one second and doubles.
+	enqueueAttempts = 6
+	// claimLease is how long a claimed delivery is hidden from other workers.
+	// It outlasts a send, so a delivery is only picked up again if the
+	// worker sending it died.
+	claimLease = 2 * time.Minute
+	claimBatch = 20
+)
+
+// Notifier routes events to notification channels through a persisted
+// outbox. Enqueue, which is registered as a hub sink, queues each event, and
+// Start records a delivery per subscribed channel and sends due deliveries,
+// retrying failures with exponential backoff. Producers that need an event's
+// deliveries recorded with their own state change get them from Deliveries
+// and have Enqueue skip the event's topic.
+type Notifier struct {
+	store  store.Store
+	config Config
+	client *http.Client
+	queue  chan *event.Event
+	wake   chan struct{}
+	logger *slog.Logger
+	skip   map[string]bool
+
+	// stopping is closed when Start is cancelled, releasing publishers
+	// waiting on a full queue. mu guards stopped, which is set once the
+	// queue is no longer drained; Enqueue then writes events itself.
+	stopping chan struct{}
+	mu       sync.RWMutex
+	stopped  bool
+
+	// enqueueBackoff is the wait after a failed outbox write.
+	enqueueBackoff time.Duration
+}
+
+func New(st store.Store, cfg Config, logger *slog.Logger) *Notifier {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 30 * time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Hour
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+	return &Notifier{
+		store:          st,
+		config:         cfg,
+		client:         client,
+		queue:          make(chan *event.Event, queueSize),
+		wake:           make(chan struct{}, 1),
+		logger:         logger,
+		skip:           make(map[string]bool),
+		stopping:       make(chan struct{}),
+		enqueueBackoff: time.Second,
+	}
+}
+
+// Skip stops Enqueue from queueing events on topics, whose producers record
+// their deliveries themselves. It must be called before events are published.
+func (n *Notifier) Skip(topics ...string) {
+	for _, topic := range topics {
+		n.skip[topic] = true
+	}
+}
+
+// Enqueue queues e for Start to write to the outbox. It runs as a hub sink,
+// with the hub locked, so it only waits when the queue is full: the publisher
+// is held back until Start catches up instead of the event being dropped.
+// Once Start has stopped, Enqueue writes e itself.
+func (n *Notifier) Enqueue(e *event.Event) {
+	if n.skip[e.Topic] {
+		return
+	}
+	n.mu.RLock()
+	if !n.stopped {
+		select {
+		case n.queue <- e:
+			n.mu.RUnlock()
+			return
+		case <-n.stopping:
+		}
+	}
+	n.mu.RUnlock()
+	n.write(context.Background(), e, 1)
+}
+
+// drain writes queued events to the outbox until ctx is cancelled, then makes
+// one attempt at each event still queued.
+func (n *Notifier) drain(ctx context.Context) {
+	for {
+		select {
+		case e := <-n.queue:
+			n.write(ctx, e, enqueueAttempts)
+		case <-ctx.Done():
+			close(n.stopping)
+			n.mu.Lock()
+			n.stopped = true
+			n.mu.Unlock()
+			ctx = context.WithoutCancel(ctx)
+			for {
+				select {
+				case e := <-n.queue:
+					n.write(ctx, e, 1)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write records e's deliveries, retrying with backoff up to attempts times.
+// An event that cannot be written is logged and dropped.
+func (n *Notifier) write(ctx context.Context, e *event.Event, attempts int) {
+	wait := n.enqueueBackoff
+	for attempt := 1; ; attempt++ {
+		wctx, cancel := context.WithTimeout(ctx, enqueueTimeout)
+		err := n.enqueue(wctx, e)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt >= attempts {
+			n.logger.Error("notify: failed to enqueue event", "topic", e.Topic, "attempts", attempt, "error", err)
+			return
+		}
+		n.logger.Warn("notify: failed to enqueue event, will retry", "topic", e.Topic, "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			n.logger.Error("notify: dropping event on shutdown", "topic", e.Topic, "error", err)
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// enqueue records e's deliveries in a single transaction and wakes the
+// sender.
+func (n *Notifier) enqueue(ctx context.Context, e *event.Event) error {
+	deliveries, err := n.Deliveries(ctx, e)
+	if err != nil || len(deliveries) == 0 {
+		return err
+	}
+	if err := n.store.CreateNotificationDeliveries(ctx, deliveries); err != nil {
+		return err
+	}
+	n.signal()
+	return nil
+}
+
+// Deliveries returns a pending delivery of e for every enabled channel of its
+// project that is subscribed to its topic. Events whose payload carries no
+// projectId are not delivered.
+func (n *Notifier) Deliveries(ctx context.Context, e *event.Event) ([]*models.NotificationDelivery, error) {
+	projectID := ProjectID(e)
+	if projectID == "" {
+		return nil, nil
+	}
+	channels, err := n.store.ListNotificationChannels(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []*models.NotificationDelivery
+	for _, c := range channels {
+		if !c.Enabled || !c.Subscribed(e.Topic) {
+			continue
+		}
+		deliveries = append(deliveries, &models.NotificationDelivery{
+			ChannelID: c.ID,
+			ProjectID: projectID,
+			Topic:     e.Topic,
+			Event:     raw,
+		})
+	}
+	return deliveries, nil
+}
+
+// signal wakes Start without blocking.
+func (n *Notifier) signal() {
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start writes queued events to the outbox and sends due deliveries until ctx
+// is cancelled. Deliveries left pending by a previous run are picked up on the
+// first pass.
+func (n *Notifier) Start(ctx context.Context) {
+	go n.drain(ctx)
+	ticker := time.NewTicker(n.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		n.process(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-n.wake:
+		}
+	}
+}
+
+// process sends every delivery that is due, a batch at a time.
+func (n *Notifier) process(ctx context.Context) {
+	for ctx.Err() == nil {
+		due, err := n.store.ClaimNotificationDeliveries(ctx, time.Now(), claimLease, claimBatch)
+		if err != nil {
+			n.logger.Error("notify: failed to claim deliveries", "error", err)
+			return
+		}
+		for _, d := range due {
+			n.deliver(ctx, d)
+		}
+		if len(due) < claimBatch {
+			return
+		}
+	}
+}
+
+// deliver makes one attempt at d, records it, and marks d delivered, schedules
+// its next attempt or dead-letters it.
+func (n *Notifier) deliver(ctx context.Context, d *models.NotificationDelivery) {
+	c, err := n.store.GetNotificationChannel(ctx, d.ChannelID)
+	if err != nil {
+		// The claim lease expires and the delivery is retried.
+		n.logger.Error("notify: failed to get channel", "channel", d.ChannelID, "error", err)
+		return
+	}
+	if c == nil {
+		// The channel was deleted, taking its deliveries with it.
+		return
+	}
+	if !c.Enabled {
+		d.Status = models.DeliveryDead
+		d.LastError = "channel is disabled"
+		if err := n.store.UpdateNotificationDelivery(ctx, d); err != nil {
+			n.logger.Error("notify: failed to update delivery", "delivery", d.ID, "error", err)
+		}
+		return
+	}
+
+	var res Result
+	var e event.Event
+	start := time.Now()
+	if err = json.Unmarshal(d.Event, &e); err == nil {
+		res, err = n.Send(ctx, c, &e)
+	}
+	attempt := &models.DeliveryAttempt{
+		DeliveryID: d.ID,
+		Attempt:    d.Attempts + 1,
+		StatusCode: res.StatusCode,
+		LatencyMs:  time.Since(start).Milliseconds(),
+		Response:   res.Response,
+	}
+
+	d.Attempts++
+	if err == nil {
+		delivered := time.Now().UTC()
+		d.Status = models.DeliveryDelivered
+		d.DeliveredAt = &delivered
+		d.LastError = ""
+	} else {
+		attempt.Error = err.Error()
+		d.LastError = err.Error()
+		if d.Attempts >= n.config.MaxAttempts {
+			d.Status = models.DeliveryDead
+			n.logger.Warn("notify: delivery dead-lettered", "delivery", d.ID, "channel", c.ID, "topic", d.Topic, "attempts", d.Attempts, "error", err)
+		} else {
+			d.NextAttemptAt = time.Now().Add(n.backoff(d.Attempts))
+			n.logger.Info("notify: delivery failed, will retry", "delivery", d.ID, "channel", c.ID, "topic", d.Topic, "attempt", d.Attempts, "next", d.NextAttemptAt, "error", err)
+		}
+	}
+
+	if err := n.store.CreateDeliveryAttempt(ctx, attempt); err != nil {
+		n.logger.Error("notify: failed to record attempt", "delivery", d.ID, "error", err)
+	}
+	if err := n.store.UpdateNotificationDelivery(ctx, d); err != nil {
+		n.logger.Error("notify: failed to update delivery", "delivery", d.ID, "error", err)
+	}
+}
+
+// backoff is the wait before the attempt following the given number of
+// failures: RetryBackoff doubled for each failure after the first, capped at
+// MaxBackoff.
+func (n *Notifier) backoff(failures int) time.Duration {
+	wait := n.config.RetryBackoff
+	for i := 1; i < failures && wait < n.config.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, n.config.MaxBackoff)
+}
+
+// Redeliver puts a delivery back in the outbox with a fresh set of attempts,
+// whatever its status, and wakes Start. It returns nil if there is no such
+// delivery.
+func (n *Notifier) Redeliver(ctx context.Context, id string) (*models.NotificationDelivery, error) {
+	d, err := n.store.GetNotificationDelivery(ctx, id)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	d.Status = models.DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = time.Now().UTC()
+	d.LastError = ""
+	d.DeliveredAt = nil
+	if err := n.store.UpdateNotificationDelivery(ctx, d); err != nil {
+		return nil, err
+	}
+	n.signal()
+	return d, nil
+}
+
+// Result is the receiver's answer to a send. It is empty for email and when
+// no response was received.
+type Result struct {
+	StatusCode int
+	Response   string
+}
+
+// Send renders e with c's templates and delivers it to c.
+func (n *Notifier) Send(ctx context.Context, c *models.NotificationChannel, e *event.Event) (Result, error) {
+	msg, err := n.render(ctx, c, e)
+	if err != nil {
+		return Result{}, err
+	}
+	switch c.Type {
+	case models.ChannelSlack:
+		var cfg models.SlackChannelConfig
+		if err := json.Unmarshal(c.Config, &cfg); err != nil {
+			return Result{}, fmt.Errorf("slack config: %w", err)
+		}
+		return n.sendSlack(ctx, cfg, msg)
+	case models.ChannelTeams:
+		var cfg models.TeamsChannelConfig
+		if err := json.Unmarshal(c.Config, &cfg); err != nil {
+			return Result{}, fmt.Errorf("teams config: %w", err)
+		}
+		return n.sendTeams(ctx, cfg, msg)
+	case models.ChannelEmail:
+		var cfg models.EmailChannelConfig
+		if err := json.Unmarshal(c.Config, &cfg); err != nil {
+			return Result{}, fmt.Errorf("email config: %w", err)
+		}
+		return Result{}, n.sendEmail(cfg, msg)
+	case models.ChannelWebhook:
+		var cfg models.WebhookChannelConfig
+		if err := json.Unmarshal(c.Config, &cfg); err != nil {
+			return Result{}, fmt.Errorf("webhook config: %w", err)
+		}
+		return n.sendWebhook(ctx, cfg, e, msg)
+	default:
+		return Result{}, fmt.Errorf("unknown channel type %q", c.Type)
+	}
+}
+
+// ProjectID returns the projectId field of e's payload, if it has one.
+func ProjectID(e *event.Event) string {
+	var p struct {
+		ProjectID string `json:"projectId"`
+	}
+	if json.Unmarshal(e.Payload, &p) != nil {
+		return ""
+	}
+	return p.ProjectID
+}
+
+// Message is an event rendered for a channel.
+type Message struct {
+	Subject string
+	Text    string
+}
+
+// TemplateData is what message and subject templates are executed with.
+// Payload is the event payload decoded from JSON, so a budget alert's spend
+// is {{.Payload.currentSpend}}.
+type TemplateData struct {
+	Topic     string
+	Type      string
+	Source    string
+	Timestamp time.Time
+	Project   *models.Project
+	Payload   any
+}
+
+const defaultSubject = `[FinGuard] {{.Project.Name}}: {{.Topic}}`
+
+// defaultTemplates are the messages for channels without their own template.
+var defaultTemplates = map[string]string{
+	event.TopicBudgetWarning:    budgetTemplate,
+	event.TopicBudgetExceeded:   budgetTemplate,
+	event.TopicBudgetResolved:   budgetTemplate,
+	event.TopicCostIdle:         `Idle resources detected in project {{.Project.Name}} by {{.Source}}.`,
+	event.TopicCollectionFailed: `Cost collection from {{.Source}} failed in project {{.Project.Name}}: {{.Payload.error}}`,
+	TopicTest:                   `Test notification from FinGuard for project {{.Project.Name}}.`,
+}
+
+const budgetTemplate = `Budget {{.Payload.id}} ({{.Payload.period}}) in project {{.Project.Name}} is {{.Payload.state}}: ` +
+	`{{printf "%.2f" .Payload.currentSpend}} spent of {{printf "%.2f" .Payload.effectiveAmount}}, ` +
+	`projected {{printf "%.2f" .Payload.projectedSpend}}.`
+
+const fallbackTemplate = `{{.Topic}} event from {{.Source}} in project {{.Project.Name}}.`
+
+func (n *Notifier) render(ctx context.Context, c *models.NotificationChannel, e *event.Event) (Message, error) {
+	project, err := n.store.GetProject(ctx, c.ProjectID)
+	if err != nil {
+		return Message{}, err
+	}
+	if project == nil {
+		project = &models.Project{ID: c.ProjectID}
+	}
+	data := TemplateData{Topic: e.Topic, Type: e.Type, Source: e.Source, Timestamp: e.Timestamp, Project: project}
+	if len(e.Payload) > 0 {
+		if err := json.Unmarshal(e.Payload, &data.Payload); err != nil {
+			return Message{}, fmt.Errorf("decode payload: %w", err)
+		}
+	}
+
+	text := c.Template
+	if text == "" {
+		text = defaultTemplates[e.Topic]
+	}
+	if text == "" {
+		text = fallbackTemplate
+	}
+	subject := defaultSubject
+	if c.Type == models.ChannelEmail {
+		var cfg models.EmailChannelConfig
+		if json.Unmarshal(c.Config, &cfg) == nil && cfg.Subject != "" {
+			subject = cfg.Subject
+		}
+	}
+
+	var msg Message
+	if msg.Text, err = execute(text, data); err != nil {
+		return Message{}, err
+	}
+	if msg.Subject, err = execute(subject, data); err != nil {
+		return Message{}, err
+	}
+	return msg, nil
+}
+
+func execute(text string, data TemplateData) (string, error) {
+	tmpl, err := template.New("message").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Validate checks a channel's type, topics, template and config before it is
+// saved.
+func Validate(c *models.NotificationChannel) error {
+	if len(c.Topics) == 0 {
+		return errors.New("subscribe to at least one topic")
+	}
+	for _, topic := range c.Topics {
+		if topic == "" {
+			return errors.New("topics must not be empty")
+		}
+	}
+	if _, err := template.New("message").Parse(c.Template); err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+
+	switch c.Type {
+	case models.ChannelSlack:
+		var cfg models.SlackChannelConfig
+		if err := json.Unmarshal(c.Config, &cfg); err != nil {
+			return errors.New("invalid slack config")
+		}
+		return validateHTTPS("webhookUrl", cfg.WebhookURL)
+	case models.ChannelTeams:
+		var cfg models.TeamsChannelConfig
+		if err := json.Unmarshal(c.Config, &cfg); err != nil {
+			return errors.New("invalid teams config")
+		}
+		return validateHTTPS("webhookUrl", cfg.WebhookURL)
+	case models.ChannelEmail:
+		var cfg models.EmailChannelConfig
+		if err := json.Unmarshal(c.Config, &cfg); err != nil {
+			return errors.New("invalid email config")
+		}
+		if len(cfg.To) == 0 {
+			return errors.New("email channels need at least one recipient")
+		}
+		for _, to := range cfg.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				return fmt.Errorf("invalid recipient %q", to)
+			}
+		}
+		if _, err := template.New("subject").Parse(cfg.Subject); err != nil {
+			return fmt.Errorf("invalid subject template: %w", err)
+		}
+	case models.ChannelWebhook:
+		var cfg models.WebhookChannelConfig
+		if err := json.Unmarshal(c.Config, &cfg); err != nil {
+			return errors.New("invalid webhook config")
+		}
+		if cfg.Secret == "" {
+			return errors.New("webhook channels need a signing secret")
+		}
+		return validateHTTPS("url", cfg.URL)
+	default:
+		return fmt.Errorf("unknown channel type %q", c.Type)
+	}
+	return nil
+}
+
+// Redacted replaces the secret config fields of channels returned by the API.
+const Redacted = "[REDACTED]"
+
+// secretFields are the config fields of each channel type that let whoever
+// knows them post to the channel or sign as FinGuard.
+var secretFields = map[models.NotificationChannelType][]string{
+	models.ChannelSlack:   {"webhookUrl"},
+	models.ChannelTeams:   {"webhookUrl"},
+	models.ChannelWebhook: {"url", "secret"},
+}
+
+// Redact returns a copy of c with the secret fields of its config replaced
+// by Redacted.
+func Redact(c *models.NotificationChannel) *models.NotificationChannel {
+	out := *c
+	fields := secretFields[c.Type]
+	if len(fields) == 0 {
+		return &out
+	}
+	var cfg map[string]any
+	if err := json.Unmarshal(c.Config, &cfg); err != nil {
+		out.Config = json.RawMessage(`{}`)
+		return &out
+	}
+	for _, field := range fields {
+		if v, ok := cfg[field].(string); ok && v != "" {
+			cfg[field] = Redacted
+		}
+	}
+	out.Config, _ = json.Marshal(cfg)
+	return &out
+}
+
+// KeepSecrets puts back into next's config the secret fields it leaves
+// Redacted, from prev, so that a channel read from the API can be saved
+// unchanged. It does nothing when the channel changes type.
+func KeepSecrets(next, prev *models.NotificationChannel) {
+	fields := secretFields[next.Type]
+	if len(fields) == 0 || next.Type != prev.Type {
+		return
+	}
+	var cfg, prevCfg map[string]any
+	if json.Unmarshal(next.Config, &cfg) != nil || json.Unmarshal(prev.Config, &prevCfg) != nil {
+		return
+	}
+	for _, field := range fields {
+		if cfg[field] == Redacted {
+			cfg[field] = prevCfg[field]
+		}
+	}
+	if data, err := json.Marshal(cfg); err == nil {
+		next.Config = data
+	}
+}
+
+func validateHTTPS(field, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%s must be an https URL", field)
+	}
+	return nil
+}
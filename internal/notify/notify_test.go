@@ -0,0 +1,606 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+	"github.com/inelson/finguard/pkg/event"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func setupProject(t *testing.T, st store.Store, name string) *models.Project {
+	t.Helper()
+	project := &models.Project{Name: name}
+	if err := st.CreateProject(context.Background(), project); err != nil {
+		t.Fatal(err)
+	}
+	return project
+}
+
+func addChannel(t *testing.T, st store.Store, c *models.NotificationChannel) *models.NotificationChannel {
+	t.Helper()
+	if err := st.CreateNotificationChannel(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func config(t *testing.T, v any) json.RawMessage {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func budgetEvent(t *testing.T, projectID string) *event.Event {
+	t.Helper()
+	e, err := event.New("exceeded", event.TopicBudgetExceeded, "budgets", map[string]any{
+		"id": "b-1", "projectId": projectID, "period": "monthly", "state": "exceeded",
+		"currentSpend": 120.0, "effectiveAmount": 100.0, "projectedSpend": 150.0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// recorder is a stand-in HTTPS endpoint that keeps the requests it receives.
+type recorder struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	status   int
+}
+
+func newRecorder(t *testing.T) (*recorder, *httptest.Server) {
+	rec := &recorder{status: http.StatusOK}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rec.mu.Lock()
+		rec.requests = append(rec.requests, r)
+		rec.bodies = append(rec.bodies, body)
+		status := rec.status
+		rec.mu.Unlock()
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			w.Write([]byte("invalid_token"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return rec, srv
+}
+
+func TestSend_Slack(t *testing.T) {
+	st := storetest.New(t)
+	project := setupProject(t, st, "payments")
+	rec, srv := newRecorder(t)
+	n := New(st, Config{HTTPClient: srv.Client()}, testLogger())
+
+	c := addChannel(t, st, &models.NotificationChannel{
+		ProjectID: project.ID, Type: models.ChannelSlack, Name: "alerts", Enabled: true,
+		Config: config(t, models.SlackChannelConfig{WebhookURL: srv.URL + "/services/T/B/x"}),
+		Topics: []string{event.TopicBudgetExceeded},
+	})
+	if _, err := n.Send(context.Background(), c, budgetEvent(t, project.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	var body struct{ Text string }
+	json.Unmarshal(rec.bodies[0], &body)
+	want := "Budget b-1 (monthly) in project payments is exceeded: 120.00 spent of 100.00, projected 150.00."
+	if rec.requests[0].URL.Path != "/services/T/B/x" || body.Text != want {
+		t.Errorf("unexpected slack message at %s: %q", rec.requests[0].URL.Path, body.Text)
+	}
+
+	rec.status = http.StatusForbidden
+	res, err := n.Send(context.Background(), c, budgetEvent(t, project.ID))
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "invalid_token") {
+		t.Errorf("expected the response status and body in the error, got %v", err)
+	}
+	if res.StatusCode != http.StatusForbidden || res.Response != "invalid_token" {
+		t.Errorf("expected the response in the result, got %+v", res)
+	}
+}
+
+func TestSend_TeamsWithTemplate(t *testing.T) {
+	st := storetest.New(t)
+	project := setupProject(t, st, "payments")
+	rec, srv := newRecorder(t)
+	n := New(st, Config{HTTPClient: srv.Client()}, testLogger())
+
+	c := addChannel(t, st, &models.NotificationChannel{
+		ProjectID: project.ID, Type: models.ChannelTeams, Name: "finance", Enabled: true,
+		Config:   config(t, models.TeamsChannelConfig{WebhookURL: srv.URL}),
+		Topics:   []string{event.TopicBudgetExceeded},
+		Template: `{{.Project.Name}} over by {{printf "%.0f" .Payload.currentSpend}}`,
+	})
+	if _, err := n.Send(context.Background(), c, budgetEvent(t, project.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	var card struct {
+		Type        string
+		Attachments []struct {
+			ContentType string
+			Content     struct {
+				Body []struct{ Text string }
+			}
+		}
+	}
+	json.Unmarshal(rec.bodies[0], &card)
+	if card.Type != "message" || len(card.Attachments) != 1 || card.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" {
+		t.Fatalf("expected an adaptive card message, got %s", rec.bodies[0])
+	}
+	body := card.Attachments[0].Content.Body
+	if len(body) != 2 || body[0].Text != "[FinGuard] payments: budget.exceeded" || body[1].Text != "payments over by 120" {
+		t.Errorf("unexpected card text: %+v", body)
+	}
+}
+
+func TestSend_WebhookSignature(t *testing.T) {
+	st := storetest.New(t)
+	project := setupProject(t, st, "payments")
+	rec, srv := newRecorder(t)
+	n := New(st, Config{HTTPClient: srv.Client()}, testLogger())
+
+	c := addChannel(t, st, &models.NotificationChannel{
+		ProjectID: project.ID, Type: models.ChannelWebhook, Name: "hook", Enabled: true,
+		Config: config(t, models.WebhookChannelConfig{URL: srv.URL + "/hook", Secret: "s3cret"}),
+		Topics: []string{event.TopicBudgetExceeded},
+	})
+	if _, err := n.Send(context.Background(), c, budgetEvent(t, project.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	req, body := rec.requests[0], rec.bodies[0]
+	ts, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("missing timestamp header: %v", err)
+	}
+	if got, want := req.Header.Get(HeaderSignature), Sign("s3cret", ts, body); got != want {
+		t.Errorf("signature %q does not verify, want %q", got, want)
+	}
+	if got := req.Header.Get(HeaderSignature); got == Sign("other", ts, body) {
+		t.Error("signature verifies with the wrong secret")
+	}
+	var payload WebhookPayload
+	json.Unmarshal(body, &payload)
+	if payload.Topic != event.TopicBudgetExceeded || payload.ProjectID != project.ID || req.Header.Get(HeaderEvent) != event.TopicBudgetExceeded {
+		t.Errorf("unexpected webhook payload: %+v", payload)
+	}
+}
+
+// smtpServer is a minimal SMTP stand-in that accepts one message per
+// connection and records the envelope and data.
+type smtpServer struct {
+	addr string
+	mu   sync.Mutex
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &smtpServer{addr: ln.Addr().String()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		s.mu.Lock()
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(cmd, "AUTH PLAIN"):
+			decoded, _ := base64.StdEncoding.DecodeString(strings.TrimSpace(line[len("AUTH PLAIN"):]))
+			s.auth = string(decoded)
+			reply("235 ok")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.to = append(s.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.data = data.String()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			s.mu.Unlock()
+			return
+		default:
+			reply("250 ok")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestSend_Email(t *testing.T) {
+	st := storetest.New(t)
+	project := setupProject(t, st, "payments")
+	relay := newSMTPServer(t)
+	n := New(st, Config{SMTP: SMTPConfig{Addr: relay.addr, From: "finguard@example.com", Username: "bot", Password: "pw"}}, testLogger())
+
+	c := addChannel(t, st, &models.NotificationChannel{
+		ProjectID: project.ID, Type: models.ChannelEmail, Name: "finance", Enabled: true,
+		Config: config(t, models.EmailChannelConfig{To: []string{"a@example.com", "b@example.com"}, Subject: "Budget alert for {{.Project.Name}}"}),
+		Topics: []string{event.TopicBudgetExceeded},
+	})
+	if _, err := n.Send(context.Background(), c, budgetEvent(t, project.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	relay.mu.Lock()
+	defer relay.mu.Unlock()
+	if relay.auth != "\x00bot\x00pw" {
+		t.Errorf("expected PLAIN auth for bot, got %q", relay.auth)
+	}
+	if relay.from != "finguard@example.com" || len(relay.to) != 2 || relay.to[1] != "b@example.com" {
+		t.Errorf("unexpected envelope from %q to %v", relay.from, relay.to)
+	}
+	if !strings.Contains(relay.data, "Subject: Budget alert for payments\r\n") || !strings.Contains(relay.data, "Budget b-1 (monthly) in project payments is exceeded") {
+		t.Errorf("unexpected message:\n%s", relay.data)
+	}
+
+	unconfigured := New(st, Config{}, testLogger())
+	if _, err := unconfigured.Send(context.Background(), c, budgetEvent(t, project.ID)); err == nil {
+		t.Error("expected an error without an SMTP relay")
+	}
+}
+
+// flush writes the events queued on n to the outbox, as Start does.
+func flush(t *testing.T, n *Notifier) {
+	t.Helper()
+	for {
+		select {
+		case e := <-n.queue:
+			if err := n.enqueue(context.Background(), e); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// flakyStore fails the first failures outbox writes.
+type flakyStore struct {
+	store.Store
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (s *flakyStore) CreateNotificationDeliveries(ctx context.Context, deliveries []*models.NotificationDelivery) error {
+	s.mu.Lock()
+	s.calls++
+	fail := s.calls <= s.failures
+	s.mu.Unlock()
+	if fail {
+		return errors.New("database is locked")
+	}
+	return s.Store.CreateNotificationDeliveries(ctx, deliveries)
+}
+
+func TestEnqueue_QueuesAndRetries(t *testing.T) {
+	st := &flakyStore{Store: storetest.New(t), failures: 2}
+	project := setupProject(t, st, "payments")
+	c := addChannel(t, st, &models.NotificationChannel{
+		ProjectID: project.ID, Type: models.ChannelWebhook, Name: "hook", Enabled: true,
+		Config: config(t, models.WebhookChannelConfig{URL: "https://example.com/hook"}),
+		Topics: []string{event.TopicBudgetExceeded},
+	})
+	n := New(st, Config{PollInterval: time.Hour}, testLogger())
+	n.enqueueBackoff = time.Millisecond
+
+	// Enqueue only queues the event, so a publisher never waits on the store.
+	n.Enqueue(budgetEvent(t, project.ID))
+	if deliveries, _ := st.ListNotificationDeliveries(context.Background(), c.ID, 10); len(deliveries) != 0 {
+		t.Fatalf("expected nothing written before Start, got %d deliveries", len(deliveries))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go n.drain(ctx)
+	var deliveries []*models.NotificationDelivery
+	for ctx.Err() == nil && len(deliveries) == 0 {
+		time.Sleep(5 * time.Millisecond)
+		deliveries, _ = st.ListNotificationDeliveries(ctx, c.ID, 10)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("expected the event written after retrying, got %d deliveries", len(deliveries))
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.calls != 3 {
+		t.Errorf("expected two failed writes and one success, got %d writes", st.calls)
+	}
+}
+
+func TestEnqueue_WaitsWhenFull(t *testing.T) {
+	st := storetest.New(t)
+	project := setupProject(t, st, "payments")
+	c := addChannel(t, st, &models.NotificationChannel{
+		ProjectID: project.ID, Type: models.ChannelWebhook, Name: "hook", Enabled: true,
+		Config: config(t, models.WebhookChannelConfig{URL: "https://example.com/hook"}),
+		Topics: []string{event.TopicBudgetExceeded, event.TopicBudgetWarning},
+	})
+	n := New(st, Config{PollInterval: time.Hour}, testLogger())
+	n.queue = make(chan *event.Event, 1)
+
+	published := make(chan struct{})
+	go func() {
+		for range 3 {
+			n.Enqueue(budgetEvent(t, project.ID))
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("expected the publisher to wait on the full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go n.drain(ctx)
+	<-published
+	var deliveries []*models.NotificationDelivery
+	for ctx.Err() == nil && len(deliveries) < 3 {
+		time.Sleep(5 * time.Millisecond)
+		deliveries, _ = st.ListNotificationDeliveries(ctx, c.ID, 10)
+	}
+	if len(deliveries) != 3 {
+		t.Fatalf("expected every event written, got %d deliveries", len(deliveries))
+	}
+
+	// Once stopped, events are written directly; skipped topics are left to
+	// their producers.
+	cancel()
+	for !func() bool { n.mu.RLock(); defer n.mu.RUnlock(); return n.stopped }() {
+		time.Sleep(time.Millisecond)
+	}
+	n.Skip(event.TopicBudgetWarning)
+	n.Enqueue(budgetEvent(t, project.ID))
+	warning, _ := event.New("warning", event.TopicBudgetWarning, "budgets", map[string]string{"projectId": project.ID})
+	n.Enqueue(warning)
+	if deliveries, _ := st.ListNotificationDeliveries(context.Background(), c.ID, 10); len(deliveries) != 4 {
+		t.Errorf("expected the event published after Start stopped to be written, got %d deliveries", len(deliveries))
+	}
+}
+
+func TestEnqueue_RoutesByProjectAndTopic(t *testing.T) {
+	st := storetest.New(t)
+	project := setupProject(t, st, "payments")
+	other := setupProject(t, st, "search")
+	rec, srv := newRecorder(t)
+	n := New(st, Config{HTTPClient: srv.Client()}, testLogger())
+
+	slack := func(name string, projectID string, enabled bool, topics ...string) {
+		addChannel(t, st, &models.NotificationChannel{
+			ProjectID: projectID, Type: models.ChannelSlack, Name: name, Enabled: enabled,
+			Config: config(t, models.SlackChannelConfig{WebhookURL: srv.URL + "/" + name}),
+			Topics: topics,
+		})
+	}
+	slack("budgets", project.ID, true, event.TopicBudgetExceeded, event.TopicBudgetWarning)
+	slack("collection", project.ID, true, event.TopicCollectionFailed)
+	slack("disabled", project.ID, false, event.TopicBudgetExceeded)
+	slack("other", other.ID, true, event.TopicBudgetExceeded)
+
+	n.Enqueue(budgetEvent(t, project.ID))
+	failed, _ := event.New(event.TopicCollectionFailed, event.TopicCollectionFailed, "aws", map[string]string{"projectId": project.ID, "error": "access denied"})
+	n.Enqueue(failed)
+	// Events without a project are not delivered anywhere.
+	idle, _ := event.New("idle", event.TopicCostIdle, "plugin", map[string]string{})
+	n.Enqueue(idle)
+	flush(t, n)
+	n.process(context.Background())
+
+	var paths []string
+	for _, r := range rec.requests {
+		paths = append(paths, r.URL.Path)
+	}
+	if strings.Join(paths, ",") != "/budgets,/collection" {
+		t.Errorf("expected deliveries to /budgets and /collection, got %v", paths)
+	}
+	var body struct{ Text string }
+	json.Unmarshal(rec.bodies[1], &body)
+	if body.Text != "Cost collection from aws failed in project payments: access denied" {
+		t.Errorf("unexpected collection message %q", body.Text)
+	}
+}
+
+// pendingDelivery enqueues a budget event for a single webhook channel and
+// returns the delivery it creates.
+func pendingDelivery(t *testing.T, st store.Store, n *Notifier, url string) *models.NotificationDelivery {
+	t.Helper()
+	project := setupProject(t, st, "payments")
+	c := addChannel(t, st, &models.NotificationChannel{
+		ProjectID: project.ID, Type: models.ChannelWebhook, Name: "hook", Enabled: true,
+		Config: config(t, models.WebhookChannelConfig{URL: url, Secret: "s3cret"}),
+		Topics: []string{event.TopicBudgetExceeded},
+	})
+	n.Enqueue(budgetEvent(t, project.ID))
+	flush(t, n)
+	deliveries, err := st.ListNotificationDeliveries(context.Background(), c.ID, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("expected one delivery, got %d (%v)", len(deliveries), err)
+	}
+	return deliveries[0]
+}
+
+func TestDeliver_SurvivesRestart(t *testing.T) {
+	st := storetest.New(t)
+	rec, srv := newRecorder(t)
+
+	// The first notifier stops before sending anything.
+	d := pendingDelivery(t, st, New(st, Config{HTTPClient: srv.Client()}, testLogger()), srv.URL)
+	if d.Status != models.DeliveryPending || len(rec.requests) != 0 {
+		t.Fatalf("expected a pending, unsent delivery, got %s with %d requests", d.Status, len(rec.requests))
+	}
+
+	New(st, Config{HTTPClient: srv.Client()}, testLogger()).process(context.Background())
+
+	got, _ := st.GetNotificationDelivery(context.Background(), d.ID)
+	if got.Status != models.DeliveryDelivered || got.Attempts != 1 || got.DeliveredAt == nil || len(rec.requests) != 1 {
+		t.Errorf("expected the restarted notifier to deliver once, got %+v with %d requests", got, len(rec.requests))
+	}
+	attempts, _ := st.ListDeliveryAttempts(context.Background(), d.ID)
+	if len(attempts) != 1 || attempts[0].StatusCode != http.StatusOK || attempts[0].Error != "" {
+		t.Errorf("expected one successful attempt, got %+v", attempts)
+	}
+}
+
+func TestDeliver_RetriesThenDeadLetters(t *testing.T) {
+	st := storetest.New(t)
+	rec, srv := newRecorder(t)
+	rec.status = http.StatusServiceUnavailable
+	n := New(st, Config{HTTPClient: srv.Client(), MaxAttempts: 3, RetryBackoff: time.Nanosecond}, testLogger())
+	d := pendingDelivery(t, st, n, srv.URL)
+
+	n.process(context.Background())
+	got, _ := st.GetNotificationDelivery(context.Background(), d.ID)
+	if got.Status != models.DeliveryPending || got.Attempts != 1 || !strings.Contains(got.LastError, "503") {
+		t.Fatalf("expected a pending delivery after one failure, got %+v", got)
+	}
+
+	n.process(context.Background())
+	n.process(context.Background())
+	n.process(context.Background())
+	got, _ = st.GetNotificationDelivery(context.Background(), d.ID)
+	if got.Status != models.DeliveryDead || got.Attempts != 3 || len(rec.requests) != 3 {
+		t.Errorf("expected dead-lettering after 3 attempts, got %+v with %d requests", got, len(rec.requests))
+	}
+	attempts, _ := st.ListDeliveryAttempts(context.Background(), d.ID)
+	if len(attempts) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(attempts))
+	}
+	for i, a := range attempts {
+		if a.Attempt != i+1 || a.StatusCode != http.StatusServiceUnavailable || a.Response != "invalid_token" || a.Error == "" {
+			t.Errorf("unexpected attempt %d: %+v", i+1, a)
+		}
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	st := storetest.New(t)
+	rec, srv := newRecorder(t)
+	rec.status = http.StatusInternalServerError
+	n := New(st, Config{HTTPClient: srv.Client(), MaxAttempts: 1}, testLogger())
+	d := pendingDelivery(t, st, n, srv.URL)
+
+	n.process(context.Background())
+	if got, _ := st.GetNotificationDelivery(context.Background(), d.ID); got.Status != models.DeliveryDead {
+		t.Fatalf("expected a dead delivery, got %s", got.Status)
+	}
+
+	rec.status = http.StatusOK
+	redelivered, err := n.Redeliver(context.Background(), d.ID)
+	if err != nil || redelivered.Status != models.DeliveryPending || redelivered.Attempts != 0 {
+		t.Fatalf("expected a pending delivery, got %+v (%v)", redelivered, err)
+	}
+	n.process(context.Background())
+	if got, _ := st.GetNotificationDelivery(context.Background(), d.ID); got.Status != models.DeliveryDelivered {
+		t.Errorf("expected the redelivery to succeed, got %+v", got)
+	}
+
+	if missing, err := n.Redeliver(context.Background(), "nope"); missing != nil || err != nil {
+		t.Errorf("expected nil for an unknown delivery, got %+v (%v)", missing, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	n := New(nil, Config{RetryBackoff: 30 * time.Second, MaxBackoff: 5 * time.Minute}, testLogger())
+	for failures, want := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		4:  4 * time.Minute,
+		5:  5 * time.Minute,
+		40: 5 * time.Minute,
+	} {
+		if got := n.backoff(failures); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		c    models.NotificationChannel
+		ok   bool
+	}{
+		{"slack", models.NotificationChannel{Type: models.ChannelSlack, Topics: []string{"budget.exceeded"}, Config: json.RawMessage(`{"webhookUrl":"https://hooks.slack.com/services/x"}`)}, true},
+		{"plain http", models.NotificationChannel{Type: models.ChannelSlack, Topics: []string{"budget.exceeded"}, Config: json.RawMessage(`{"webhookUrl":"http://hooks.slack.com/services/x"}`)}, false},
+		{"no topics", models.NotificationChannel{Type: models.ChannelTeams, Config: json.RawMessage(`{"webhookUrl":"https://example.com"}`)}, false},
+		{"bad template", models.NotificationChannel{Type: models.ChannelTeams, Topics: []string{"x"}, Template: "{{.Topic", Config: json.RawMessage(`{"webhookUrl":"https://example.com"}`)}, false},
+		{"email", models.NotificationChannel{Type: models.ChannelEmail, Topics: []string{"x"}, Config: json.RawMessage(`{"to":["a@example.com"]}`)}, true},
+		{"bad recipient", models.NotificationChannel{Type: models.ChannelEmail, Topics: []string{"x"}, Config: json.RawMessage(`{"to":["nobody"]}`)}, false},
+		{"webhook without secret", models.NotificationChannel{Type: models.ChannelWebhook, Topics: []string{"x"}, Config: json.RawMessage(`{"url":"https://example.com"}`)}, false},
+		{"unknown type", models.NotificationChannel{Type: "pager", Topics: []string{"x"}, Config: json.RawMessage(`{}`)}, false},
+	}
+	for _, tt := range tests {
+		if err := Validate(&tt.c); (err == nil) != tt.ok {
+			t.Errorf("%s: expected ok=%v, got %v", tt.name, tt.ok, err)
+		}
+	}
+}
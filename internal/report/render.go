@@ -0,0 +1,191 @@
+package report
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+// Rendered is a report ready to send. Body is HTML for html reports and a
+// plain-text summary for csv reports, which carry the report in Attachment.
+type Rendered struct {
+	Subject        string
+	ContentType    string
+	Body           string
+	Attachment     []byte
+	AttachmentName string
+}
+
+// LastDay is the final day the report covers.
+func (d *Data) LastDay() time.Time {
+	return d.End.AddDate(0, 0, -1)
+}
+
+var funcs = template.FuncMap{
+	"money":   func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) },
+	"percent": func(v float64) string { return fmt.Sprintf("%+.1f%%", v*100) },
+	"date":    func(t time.Time) string { return t.Format("Jan 2, 2006") },
+}
+
+var subjectTemplate = template.Must(template.New("subject").Funcs(funcs).Parse(
+	`[FinGuard] {{.Report.Name}}: {{.Project.Name}}, {{date .Start}} to {{date .LastDay}}`,
+))
+
+var textTemplate = template.Must(template.New("text").Funcs(funcs).Parse(`Cost report for project {{.Project.Name}}, {{date .Start}} to {{date .LastDay}}.
+
+Spend: {{money .Spend}}{{if .HasChange}} ({{percent .Change}} week over week, from {{money .PreviousSpend}}){{end}}
+{{- with .Services}}
+
+Top services:
+{{range .}}  {{index .Group "service"}}: {{money .TotalNetCost}}
+{{end}}{{end}}
+{{- with .Budgets}}
+Budgets:
+{{range .}}  {{.Period}} budget {{.ID}}: {{money .CurrentSpend}} of {{money .EffectiveAmount}}, {{.State}}
+{{end}}{{end}}
+The full report is attached as CSV.
+`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap(funcs)).Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #1f2937;">
+<h2>{{.Report.Name}}</h2>
+<p>Project <strong>{{.Project.Name}}</strong>, {{date .Start}} to {{date .LastDay}}</p>
+<table cellpadding="6" style="border-collapse: collapse;">
+<tr><td>Spend</td><td align="right"><strong>{{money .Spend}}</strong></td></tr>
+<tr><td>Previous week</td><td align="right">{{money .PreviousSpend}}</td></tr>
+{{- if .HasChange}}
+<tr><td>Week over week</td><td align="right">{{percent .Change}}</td></tr>
+{{- end}}
+</table>
+{{- with .Services}}
+<h3>Top services</h3>
+<table cellpadding="6" style="border-collapse: collapse;">
+<tr><th align="left">Service</th><th align="right">Spend</th></tr>
+{{- range .}}
+<tr><td>{{index .Group "service"}}</td><td align="right">{{money .TotalNetCost}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- with .Budgets}}
+<h3>Budgets</h3>
+<table cellpadding="6" style="border-collapse: collapse;">
+<tr><th align="left">Budget</th><th align="right">Spent</th><th align="right">Amount</th><th align="right">Projected</th><th align="left">State</th></tr>
+{{- range .}}
+<tr><td>{{.Period}} ({{.ID}})</td><td align="right">{{money .CurrentSpend}}</td><td align="right">{{money .EffectiveAmount}}</td><td align="right">{{money .ProjectedSpend}}</td><td>{{.State}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// Render turns report data into the email for the report's format.
+func Render(d *Data) (*Rendered, error) {
+	var subject bytes.Buffer
+	if err := subjectTemplate.Execute(&subject, d); err != nil {
+		return nil, err
+	}
+	out := &Rendered{Subject: subject.String()}
+
+	var body bytes.Buffer
+	switch d.Report.Format {
+	case models.ReportCSV:
+		if err := textTemplate.Execute(&body, d); err != nil {
+			return nil, err
+		}
+		attachment, err := renderCSV(d)
+		if err != nil {
+			return nil, err
+		}
+		out.ContentType = "text/plain; charset=utf-8"
+		out.Attachment = attachment
+		out.AttachmentName = fmt.Sprintf("finguard-%s-%s.csv", d.Project.Name, d.Start.Format("2006-01-02"))
+	default:
+		if err := htmlTemplate.Execute(&body, d); err != nil {
+			return nil, err
+		}
+		out.ContentType = "text/html; charset=utf-8"
+	}
+	out.Body = body.String()
+	return out, nil
+}
+
+// renderCSV writes one row per figure in the report: the week's totals, each
+// top service and each budget.
+func renderCSV(d *Data) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+	w.Write([]string{"section", "name", "spend", "previous_spend", "change_percent", "budget_amount", "state"})
+	change := ""
+	if d.HasChange {
+		change = strconv.FormatFloat(d.Change*100, 'f', 1, 64)
+	}
+	w.Write([]string{"total", d.Project.Name, money(d.Spend), money(d.PreviousSpend), change, "", ""})
+	for _, s := range d.Services {
+		w.Write([]string{"service", s.Group["service"], money(s.TotalNetCost), "", "", "", ""})
+	}
+	for _, b := range d.Budgets {
+		w.Write([]string{"budget", string(b.Period) + " " + b.ID, money(b.CurrentSpend), "", "", money(b.EffectiveAmount), string(b.State)})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// message encodes the rendered report as an email, multipart when it has an
+// attachment.
+func (r *Rendered) message(from string, to []string, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", r.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	body := strings.ReplaceAll(r.Body, "\n", "\r\n")
+	if r.Attachment == nil {
+		fmt.Fprintf(&buf, "Content-Type: %s\r\n\r\n", r.ContentType)
+		buf.WriteString(body)
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {r.ContentType}})
+	if err != nil {
+		return nil, err
+	}
+	part.Write([]byte(body))
+
+	part, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType("text/csv", map[string]string{"name": r.AttachmentName})},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": r.AttachmentName})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(r.Attachment)
+	for len(encoded) > 76 {
+		part.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	part.Write([]byte(encoded + "\r\n"))
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,240 @@
+// Package report builds scheduled cost digests for a project, last week's
+// spend with its week-over-week change, the top services and budget status,
+// and emails them as HTML or as a CSV attachment on each report's cron
+// schedule.
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"time"
+
+	"github.com/inelson/finguard/internal/budget"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/notify"
+	"github.com/inelson/finguard/internal/store"
+)
+
+// topServices is how many services a report lists.
+const topServices = 10
+
+// Config configures report delivery.
+type Config struct {
+	SMTP notify.SMTPConfig
+	// FiscalYearStart aligns the budget periods reported on.
+	FiscalYearStart time.Month
+	// CheckInterval is how often Start looks for due reports. Zero means a
+	// minute, the resolution of a cron schedule.
+	CheckInterval time.Duration
+}
+
+// Reporter renders reports and sends them when they are due.
+type Reporter struct {
+	store  store.Store
+	config Config
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+func New(st store.Store, cfg Config, logger *slog.Logger) *Reporter {
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = time.Minute
+	}
+	return &Reporter{store: st, config: cfg, logger: logger, now: time.Now}
+}
+
+// Data is what report templates are executed with. The week covered is
+// [Start, End), the seven days before midnight of the run day in the
+// report's timezone, and the previous week is the seven days before that.
+// Change is the week-over-week change as a fraction of PreviousSpend, and
+// is only meaningful when HasChange is set.
+type Data struct {
+	Report        *models.Report
+	Project       *models.Project
+	Start         time.Time
+	End           time.Time
+	Spend         float64
+	PreviousSpend float64
+	Change        float64
+	HasChange     bool
+	Services      []*store.CostGroup
+	Budgets       []*budget.Status
+}
+
+// Build queries the costs and budgets a run of r at now reports on.
+func (rp *Reporter) Build(ctx context.Context, r *models.Report, now time.Time) (*Data, error) {
+	project, err := rp.store.GetProject(ctx, r.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, fmt.Errorf("project %s not found", r.ProjectID)
+	}
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	local := now.In(loc)
+	end := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	start := end.AddDate(0, 0, -7)
+
+	data := &Data{Report: r, Project: project, Start: start, End: end}
+	q := store.CostQuery{CostFilter: r.Filter, ProjectID: r.ProjectID, StartTime: start, EndTime: end}
+	current, err := rp.store.AggregateCosts(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	q.StartTime, q.EndTime = start.AddDate(0, 0, -7), start
+	previous, err := rp.store.AggregateCosts(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	data.Spend, data.PreviousSpend = current.TotalNetCost, previous.TotalNetCost
+	if data.PreviousSpend != 0 {
+		data.Change = (data.Spend - data.PreviousSpend) / data.PreviousSpend
+		data.HasChange = true
+	}
+
+	q.StartTime, q.EndTime = start, end
+	q.GroupBy, q.Limit = []string{"service"}, topServices
+	if data.Services, err = rp.store.GroupCosts(ctx, q); err != nil {
+		return nil, err
+	}
+
+	budgets, err := rp.store.ListBudgets(ctx, r.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range budgets {
+		status, err := budget.Evaluate(ctx, rp.store, b, rp.config.FiscalYearStart, now)
+		if err != nil {
+			return nil, fmt.Errorf("budget %s: %w", b.ID, err)
+		}
+		data.Budgets = append(data.Budgets, status)
+	}
+	return data, nil
+}
+
+// Preview builds and renders r as a run at the current time would, without
+// sending it.
+func (rp *Reporter) Preview(ctx context.Context, r *models.Report) (*Rendered, error) {
+	data, err := rp.Build(ctx, r, rp.now())
+	if err != nil {
+		return nil, err
+	}
+	return Render(data)
+}
+
+// Send builds, renders and emails r to its recipients now.
+func (rp *Reporter) Send(ctx context.Context, r *models.Report) error {
+	out, err := rp.Preview(ctx, r)
+	if err != nil {
+		return err
+	}
+	msg, err := out.message(rp.config.SMTP.From, r.Recipients, rp.now())
+	if err != nil {
+		return err
+	}
+	return rp.config.SMTP.Send(r.Recipients, msg)
+}
+
+// Start sends reports as they fall due until ctx is cancelled. A report whose
+// runs were missed while FinGuard was down is sent once, then resumes its
+// schedule.
+func (rp *Reporter) Start(ctx context.Context) {
+	ticker := time.NewTicker(rp.config.CheckInterval)
+	defer ticker.Stop()
+	for {
+		rp.runDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (rp *Reporter) runDue(ctx context.Context) {
+	now := rp.now()
+	due, err := rp.store.ListDueReports(ctx, now)
+	if err != nil {
+		rp.logger.Error("report: failed to list due reports", "error", err)
+		return
+	}
+	for _, r := range due {
+		next, err := NextRun(r, now)
+		if err != nil {
+			rp.logger.Error("report: invalid schedule", "report", r.ID, "error", err)
+			continue
+		}
+		// Advancing the schedule first claims the run, so another replica
+		// does not send it too.
+		claimed, err := rp.store.AdvanceReport(ctx, r.ID, *r.NextRunAt, next)
+		if err != nil {
+			rp.logger.Error("report: failed to advance schedule", "report", r.ID, "error", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		var lastError string
+		if err := rp.Send(ctx, r); err != nil {
+			lastError = err.Error()
+			rp.logger.Error("report: failed to send", "report", r.ID, "project", r.ProjectID, "error", err)
+		} else {
+			rp.logger.Info("report sent", "report", r.ID, "project", r.ProjectID, "recipients", len(r.Recipients))
+		}
+		if err := rp.store.RecordReportRun(ctx, r.ID, now, lastError); err != nil {
+			rp.logger.Error("report: failed to record run", "report", r.ID, "error", err)
+		}
+	}
+}
+
+// NextRun returns when r next runs after t, in UTC.
+func NextRun(r *models.Report, t time.Time) (time.Time, error) {
+	sched, err := ParseSchedule(r.Schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := sched.Next(t.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("schedule %q never runs", r.Schedule)
+	}
+	return next.UTC(), nil
+}
+
+// Validate checks a report's name, schedule, timezone, recipients and format
+// before it is saved.
+func Validate(r *models.Report) error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", r.Timezone)
+	}
+	if _, err := NextRun(r, time.Now()); err != nil {
+		return err
+	}
+	if len(r.Recipients) == 0 {
+		return errors.New("reports need at least one recipient")
+	}
+	for _, to := range r.Recipients {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("invalid recipient %q", to)
+		}
+	}
+	switch r.Format {
+	case models.ReportHTML, models.ReportCSV:
+	default:
+		return errors.New("format must be html or csv")
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package report
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/notify"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func TestParseSchedule(t *testing.T) {
+	at := func(s string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", s)
+		return t
+	}
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"0 8 * * MON", "2026-10-18 12:00", "2026-10-19 08:00"},
+		{"0 8 * * 1", "2026-10-19 08:00", "2026-10-26 08:00"},
+		{"*/15 * * * *", "2026-10-18 12:07", "2026-10-18 12:15"},
+		{"30 9 1 * *", "2026-10-18 12:00", "2026-11-01 09:30"},
+		{"0 0 * * 7", "2026-10-18 12:00", "2026-10-25 00:00"},
+		{"0 6 1-7 * 0-1", "2026-10-18 12:00", "2026-10-19 06:00"},
+		{"0 12 * FEB-MAR *", "2026-10-18 12:00", "2027-02-01 12:00"},
+		{"@daily", "2026-10-18 12:00", "2026-10-19 00:00"},
+		{"0 0 29 2 *", "2026-10-18 12:00", "2028-02-29 00:00"},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(at(tt.from)); !got.Equal(at(tt.want)) {
+			t.Errorf("%s after %s = %s, want %s", tt.expr, tt.from, got.Format("2006-01-02 15:04"), tt.want)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * MOON", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+
+	never, _ := ParseSchedule("0 0 30 2 *")
+	if got := never.Next(at("2026-10-18 12:00")); !got.IsZero() {
+		t.Errorf("expected February 30th never to run, got %s", got)
+	}
+}
+
+func TestNextRun_Timezone(t *testing.T) {
+	r := &models.Report{Schedule: "0 8 * * MON", Timezone: "America/New_York"}
+	next, err := NextRun(r, time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("expected 8am New York time, %s, got %s", want, next)
+	}
+}
+
+// seedReport creates a project with two weeks of spend before Monday
+// 2026-10-19 and an exceeded budget, and returns a report on it.
+func seedReport(t *testing.T, st store.Store, format models.ReportFormat) *models.Report {
+	t.Helper()
+	ctx := context.Background()
+	project := &models.Project{Name: "payments"}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	cs := &models.CostSource{ProjectID: project.ID, Type: models.CostSourceAWS, Name: "aws", Enabled: true}
+	if err := st.CreateCostSource(ctx, cs); err != nil {
+		t.Fatal(err)
+	}
+	record := func(day int, service string, cost float64) *models.CostRecord {
+		start := time.Date(2026, time.October, day, 10, 0, 0, 0, time.UTC)
+		return &models.CostRecord{ProjectID: project.ID, CostSourceID: cs.ID, Provider: "aws", Service: service, StartTime: start, EndTime: start.Add(time.Hour), NetCost: cost}
+	}
+	records := []*models.CostRecord{
+		record(5, "ec2", 100), // the previous week
+		record(13, "ec2", 90),
+		record(14, "s3", 20),
+		record(18, "rds", 40),
+		record(19, "ec2", 999), // the run day is not reported
+	}
+	if err := st.InsertCostRecords(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.CreateBudget(ctx, &models.Budget{ProjectID: project.ID, Period: models.BudgetMonthly, Amount: 200, Thresholds: []float64{1}}); err != nil {
+		t.Fatal(err)
+	}
+	r := &models.Report{ProjectID: project.ID, Name: "Weekly spend", Schedule: "0 8 * * MON", Timezone: "UTC", Recipients: []string{"finance@example.com"}, Format: format, Enabled: true}
+	if err := st.CreateReport(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+var monday = time.Date(2026, time.October, 19, 8, 0, 0, 0, time.UTC)
+
+func TestBuild(t *testing.T) {
+	st := storetest.New(t)
+	r := seedReport(t, st, models.ReportHTML)
+	rp := New(st, Config{}, testLogger())
+
+	data, err := rp.Build(context.Background(), r, monday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !data.Start.Equal(time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC)) || !data.End.Equal(time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the week of October 12, got %s to %s", data.Start, data.End)
+	}
+	if data.Spend != 150 || data.PreviousSpend != 100 || !data.HasChange || data.Change != 0.5 {
+		t.Errorf("expected 150 spent, up 50%% from 100, got %v from %v (%v)", data.Spend, data.PreviousSpend, data.Change)
+	}
+	var services []string
+	for _, s := range data.Services {
+		services = append(services, s.Group["service"])
+	}
+	if strings.Join(services, ",") != "ec2,rds,s3" {
+		t.Errorf("expected services by spend, got %v", services)
+	}
+	if len(data.Budgets) != 1 || data.Budgets[0].State != "exceeded" {
+		t.Errorf("expected one exceeded budget, got %+v", data.Budgets)
+	}
+}
+
+func TestRender(t *testing.T) {
+	st := storetest.New(t)
+	r := seedReport(t, st, models.ReportHTML)
+	rp := New(st, Config{}, testLogger())
+	data, err := rp.Build(context.Background(), r, monday)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Subject != "[FinGuard] Weekly spend: payments, Oct 12, 2026 to Oct 18, 2026" {
+		t.Errorf("unexpected subject %q", out.Subject)
+	}
+	for _, want := range []string{"<strong>150.00</strong>", "50.0%", "<td>ec2</td><td align=\"right\">90.00</td>", "exceeded"} {
+		if !strings.Contains(out.Body, want) {
+			t.Errorf("expected %q in the HTML report:\n%s", want, out.Body)
+		}
+	}
+	if out.Attachment != nil {
+		t.Error("expected no attachment for an HTML report")
+	}
+
+	r.Format = models.ReportCSV
+	out, err = Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csv := string(out.Attachment)
+	for _, want := range []string{"section,name,spend", "total,payments,150.00,100.00,50.0,,", "service,rds,40.00", "budget,monthly "} {
+		if !strings.Contains(csv, want) {
+			t.Errorf("expected %q in the CSV:\n%s", want, csv)
+		}
+	}
+	if out.AttachmentName != "finguard-payments-2026-10-12.csv" || !strings.Contains(out.Body, "Spend: 150.00 (+50.0% week over week, from 100.00)") {
+		t.Errorf("unexpected CSV email %q:\n%s", out.AttachmentName, out.Body)
+	}
+}
+
+// smtpServer is a minimal SMTP stand-in that records the recipients and data
+// of each message it accepts.
+type smtpServer struct {
+	addr     string
+	mu       sync.Mutex
+	to       []string
+	messages []string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &smtpServer{addr: ln.Addr().String()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimRight(line, "\r\n"))
+		switch {
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.mu.Lock()
+			s.to = append(s.to, strings.Trim(strings.TrimRight(line, "\r\n")[len("RCPT TO:"):], "<> "))
+			s.mu.Unlock()
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestRunDue_SendsOnceAndReschedules(t *testing.T) {
+	st := storetest.New(t)
+	relay := newSMTPServer(t)
+	r := seedReport(t, st, models.ReportCSV)
+	due := monday.Add(-time.Minute)
+	r.NextRunAt = &due
+	if err := st.UpdateReport(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+
+	rp := New(st, Config{SMTP: notify.SMTPConfig{Addr: relay.addr, From: "finguard@example.com"}}, testLogger())
+	rp.now = func() time.Time { return monday }
+	rp.runDue(context.Background())
+	rp.runDue(context.Background())
+
+	relay.mu.Lock()
+	defer relay.mu.Unlock()
+	if len(relay.messages) != 1 || relay.to[0] != "finance@example.com" {
+		t.Fatalf("expected one message to finance@example.com, got %d to %v", len(relay.messages), relay.to)
+	}
+	msg := relay.messages[0]
+	if !strings.Contains(msg, "multipart/mixed") || !strings.Contains(msg, `filename=finguard-payments-2026-10-12.csv`) {
+		t.Errorf("expected a CSV attachment:\n%s", msg)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, _ := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	parts.NextPart()
+	part, err := parts.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	attachment, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+	if err != nil || !strings.HasPrefix(string(attachment), "section,name,spend") {
+		t.Errorf("unexpected attachment %q (%v)", attachment, err)
+	}
+
+	got, _ := st.GetReport(context.Background(), r.ID)
+	if got.LastRunAt == nil || !got.LastRunAt.Equal(monday) || got.LastError != "" {
+		t.Errorf("expected a successful run at %s, got %v (%q)", monday, got.LastRunAt, got.LastError)
+	}
+	if want := monday.AddDate(0, 0, 7); got.NextRunAt == nil || !got.NextRunAt.Equal(want) {
+		t.Errorf("expected the next run at %s, got %v", want, got.NextRunAt)
+	}
+}
+
+func TestRunDue_RecordsFailures(t *testing.T) {
+	st := storetest.New(t)
+	r := seedReport(t, st, models.ReportHTML)
+	due := monday
+	r.NextRunAt = &due
+	st.UpdateReport(context.Background(), r)
+
+	rp := New(st, Config{}, testLogger())
+	rp.now = func() time.Time { return monday }
+	rp.runDue(context.Background())
+
+	got, _ := st.GetReport(context.Background(), r.ID)
+	if !strings.Contains(got.LastError, "FINGUARD_SMTP_ADDR") || got.NextRunAt == nil || !got.NextRunAt.After(monday) {
+		t.Errorf("expected a recorded SMTP error and a later next run, got %+v", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := models.Report{Name: "weekly", Schedule: "0 8 * * MON", Timezone: "UTC", Recipients: []string{"a@example.com"}, Format: models.ReportHTML}
+	if err := Validate(&valid); err != nil {
+		t.Fatalf("expected a valid report, got %v", err)
+	}
+	for name, mutate := range map[string]func(*models.Report){
+		"no name":       func(r *models.Report) { r.Name = "" },
+		"bad schedule":  func(r *models.Report) { r.Schedule = "every monday" },
+		"never runs":    func(r *models.Report) { r.Schedule = "0 0 31 2 *" },
+		"bad timezone":  func(r *models.Report) { r.Timezone = "Mars/Olympus" },
+		"no recipients": func(r *models.Report) { r.Recipients = nil },
+		"bad recipient": func(r *models.Report) { r.Recipients = []string{"finance"} },
+		"bad format":    func(r *models.Report) { r.Format = "pdf" },
+	} {
+		r := valid
+		mutate(&r)
+		if err := Validate(&r); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package retention
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/inelson/finguard/internal/export"
+	"github.com/inelson/finguard/internal/models"
+)
+
+// archiver returns a store.CostCompaction Archive func writing each bucket's
+// records to dir/<project>/<provider>-<tier>-<bucket>-<digest>.ndjson.gz,
+// where digest identifies the records. A bucket whose compaction fails after
+// its file was written is archived again under the same name by the next
+// run, replacing the file instead of duplicating the records. Files are
+// written under a temporary name and renamed once complete, so a file with
+// the final name always holds a whole bucket.
+func archiver(dir, projectID, provider, tier string) func(time.Time, []*models.CostRecord) error {
+	if provider == AnyProvider {
+		provider = "all"
+	}
+	return func(bucket time.Time, records []*models.CostRecord) error {
+		projectDir := filepath.Join(dir, projectID)
+		if err := os.MkdirAll(projectDir, 0o750); err != nil {
+			return err
+		}
+		name := fmt.Sprintf("%s-%s-%s-%s.ndjson.gz", safeName(provider), tier, bucket.UTC().Format(time.DateOnly), digest(records))
+		return writeArchive(filepath.Join(projectDir, name), records)
+	}
+}
+
+// digest identifies a set of records by their IDs.
+func digest(records []*models.CostRecord) string {
+	ids := make([]string, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	slices.Sort(ids)
+	h := sha256.New()
+	for _, id := range ids {
+		io.WriteString(h, id)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func writeArchive(path string, records []*models.CostRecord) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), ".archive-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	gz := gzip.NewWriter(f)
+	w, err := export.NewWriter(gz, export.FormatNDJSON, nil)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// safeName makes a provider name usable in a file name.
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, s)
+}
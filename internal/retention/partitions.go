@@ -0,0 +1,91 @@
+package retention
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/store"
+)
+
+// PartitionConfig configures the partition job, which keeps the monthly
+// partitions of cost records on Postgres.
+type PartitionConfig struct {
+	// Ahead is how many months after the current one get a partition ahead
+	// of time. Zero means three.
+	Ahead int
+	// Retention, if set, expires the partitions of the months it reaches
+	// past; Detach keeps them as plain tables instead of dropping them.
+	Retention Age
+	Detach    bool
+	// Interval is how often Start runs. Zero means a day.
+	Interval time.Duration
+}
+
+// Partitioner creates future cost record partitions and expires old ones.
+// On SQLite, which keeps a flat table, it does nothing.
+type Partitioner struct {
+	store   store.Store
+	config  PartitionConfig
+	auditor *audit.Recorder
+	logger  *slog.Logger
+	now     func() time.Time
+}
+
+func NewPartitioner(st store.Store, cfg PartitionConfig, auditor *audit.Recorder, logger *slog.Logger) *Partitioner {
+	if cfg.Ahead <= 0 {
+		cfg.Ahead = 3
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 24 * time.Hour
+	}
+	return &Partitioner{store: st, config: cfg, auditor: auditor, logger: logger, now: time.Now}
+}
+
+// Start manages the partitions once, then every interval until ctx is done.
+func (p *Partitioner) Start(ctx context.Context) {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Run(ctx); err != nil {
+			p.logger.Error("retention: partition management failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run creates the missing partitions and expires old ones once.
+func (p *Partitioner) Run(ctx context.Context) error {
+	now := p.now().UTC()
+	policy := store.CostPartitionPolicy{Ahead: p.config.Ahead, Detach: p.config.Detach}
+	if !p.config.Retention.IsZero() {
+		policy.Before = store.GranularityMonth.Truncate(p.config.Retention.Before(now))
+	}
+
+	res, err := p.store.ManageCostPartitions(ctx, now, policy)
+	if len(res.Created) > 0 {
+		p.logger.Info("retention: created cost record partitions", "partitions", res.Created)
+	}
+	for _, expired := range []struct {
+		names    []string
+		detached bool
+	}{{res.Detached, true}, {res.Dropped, false}} {
+		for _, name := range expired.names {
+			p.logger.Info("retention: expired cost record partition", "partition", name, "detached", expired.detached)
+			if p.auditor != nil {
+				p.auditor.Record(ctx, audit.Actor{Email: "system"}, audit.Event{
+					Action:     "costs.partition.expire",
+					TargetType: audit.TargetPartition,
+					TargetID:   name,
+					After:      map[string]any{"before": policy.Before, "detached": expired.detached},
+				})
+			}
+		}
+	}
+	return err
+}
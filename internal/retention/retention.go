@@ -0,0 +1,284 @@
+// Package retention keeps cost records from growing without bound. Each rule
+// keeps a provider's sub-daily records for a while, then merges them into
+// daily records, later merges those into monthly records and finally, if
+// the rule says so, drops them. Merging preserves the totals of every day or
+// month merged, and records can be archived as gzipped NDJSON before they
+// are removed.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+)
+
+// AnyProvider is the provider of a rule applying to every provider no other
+// rule names.
+const AnyProvider = "*"
+
+// Age is how far back a retention tier reaches, in calendar days and months.
+type Age struct {
+	Days   int
+	Months int
+}
+
+var agePattern = regexp.MustCompile(`^(\d+)(d|w|mo|y)$`)
+
+// ParseAge reads an age such as 30d, 2w, 13mo or 7y.
+func ParseAge(s string) (Age, error) {
+	m := agePattern.FindStringSubmatch(s)
+	if m == nil {
+		return Age{}, fmt.Errorf("invalid age %q: must be a number of days (d), weeks (w), months (mo) or years (y)", s)
+	}
+	n, _ := strconv.Atoi(m[1])
+	switch m[2] {
+	case "w":
+		return Age{Days: 7 * n}, nil
+	case "mo":
+		return Age{Months: n}, nil
+	case "y":
+		return Age{Months: 12 * n}, nil
+	}
+	return Age{Days: n}, nil
+}
+
+// IsZero reports whether the age is unset, which leaves its tier off.
+func (a Age) IsZero() bool {
+	return a.Days == 0 && a.Months == 0
+}
+
+// Before returns the time the age reaches back to from t.
+func (a Age) Before(t time.Time) time.Time {
+	return t.AddDate(0, -a.Months, -a.Days)
+}
+
+func (a Age) String() string {
+	switch {
+	case a.Months == 0:
+		return strconv.Itoa(a.Days) + "d"
+	case a.Days == 0:
+		return strconv.Itoa(a.Months) + "mo"
+	}
+	return strconv.Itoa(a.Months) + "mo" + strconv.Itoa(a.Days) + "d"
+}
+
+// Rule is the retention of one provider's cost records. Hourly is how long
+// records shorter than a day are kept before they are merged into daily
+// records, Daily how long records shorter than a month are kept before they
+// are merged into monthly records, and Monthly how long records are kept at
+// all. A zero age leaves its tier off: records are not merged at that step,
+// or never dropped.
+type Rule struct {
+	Provider string
+	Hourly   Age
+	Daily    Age
+	Monthly  Age
+}
+
+// ParseRules reads rules written as provider:tier=age,... separated by
+// semicolons, e.g. "kubernetes:hourly=30d,daily=13mo;*:daily=25mo". The
+// provider * stands for every provider no other rule names.
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	seen := make(map[string]bool)
+	for _, spec := range strings.Split(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		provider, tiers, ok := strings.Cut(spec, ":")
+		provider = strings.TrimSpace(provider)
+		if !ok || provider == "" {
+			return nil, fmt.Errorf("invalid retention rule %q: must be provider:tier=age,...", spec)
+		}
+		if seen[provider] {
+			return nil, fmt.Errorf("duplicate retention rule for provider %q", provider)
+		}
+		seen[provider] = true
+
+		rule := Rule{Provider: provider}
+		for _, tier := range strings.Split(tiers, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(tier), "=")
+			age, err := ParseAge(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("retention rule for %s: %w", provider, err)
+			}
+			switch name {
+			case "hourly":
+				rule.Hourly = age
+			case "daily":
+				rule.Daily = age
+			case "monthly":
+				rule.Monthly = age
+			default:
+				return nil, fmt.Errorf("retention rule for %s: unknown tier %q: must be hourly, daily or monthly", provider, name)
+			}
+		}
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// validate checks that each tier reaches further back than the one before,
+// so records are merged in order before they are dropped.
+func (r Rule) validate() error {
+	// Compare the ages from a fixed time, so that months count the same
+	// number of days on every run.
+	ref := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	prev, prevName := Age{}, ""
+	for _, tier := range []struct {
+		name string
+		age  Age
+	}{{"hourly", r.Hourly}, {"daily", r.Daily}, {"monthly", r.Monthly}} {
+		if tier.age.IsZero() {
+			continue
+		}
+		if !prev.IsZero() && !tier.age.Before(ref).Before(prev.Before(ref)) {
+			return fmt.Errorf("retention rule for %s: %s age %s must be longer than %s age %s", r.Provider, tier.name, tier.age, prevName, prev)
+		}
+		prev, prevName = tier.age, tier.name
+	}
+	return nil
+}
+
+// Config configures the compaction job.
+type Config struct {
+	Rules []Rule
+	// ArchiveDir, if set, receives the records each run removes.
+	ArchiveDir string
+	// Interval is how often Start compacts. Zero means six hours.
+	Interval time.Duration
+}
+
+// Compactor applies the retention rules to every project's cost records.
+type Compactor struct {
+	store   store.Store
+	config  Config
+	auditor *audit.Recorder
+	logger  *slog.Logger
+	now     func() time.Time
+}
+
+func New(st store.Store, cfg Config, auditor *audit.Recorder, logger *slog.Logger) *Compactor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 6 * time.Hour
+	}
+	return &Compactor{store: st, config: cfg, auditor: auditor, logger: logger, now: time.Now}
+}
+
+// Start compacts once, then every interval until ctx is done.
+func (c *Compactor) Start(ctx context.Context) {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Run(ctx); err != nil {
+			c.logger.Error("retention: compaction failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run applies every rule to every project once.
+func (c *Compactor) Run(ctx context.Context) error {
+	projects, err := c.store.ListProjects(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range projects {
+		for _, rule := range c.config.Rules {
+			if err := c.apply(ctx, p, rule); err != nil {
+				return fmt.Errorf("project %s, provider %s: %w", p.ID, rule.Provider, err)
+			}
+		}
+	}
+	return nil
+}
+
+// tier is one step of a rule: the records older than age are merged into
+// into, or dropped when into is empty.
+type tier struct {
+	name string
+	age  Age
+	into store.Granularity
+}
+
+func (c *Compactor) apply(ctx context.Context, p *models.Project, rule Rule) error {
+	now := c.now().UTC()
+	for _, t := range []tier{
+		{"hourly", rule.Hourly, store.GranularityDay},
+		{"daily", rule.Daily, store.GranularityMonth},
+		{"monthly", rule.Monthly, ""},
+	} {
+		if t.age.IsZero() {
+			continue
+		}
+		// Cut at a boundary of the coarser tier so no bucket is split;
+		// dropping goes by whole months like the monthly tier before it.
+		unit := t.into
+		if unit == "" {
+			unit = store.GranularityMonth
+		}
+		compaction := store.CostCompaction{
+			ProjectID: p.ID,
+			Into:      t.into,
+			Before:    unit.Truncate(t.age.Before(now)),
+		}
+		if rule.Provider == AnyProvider {
+			compaction.ExcludeProviders = c.namedProviders()
+		} else {
+			compaction.Providers = []string{rule.Provider}
+		}
+		if c.config.ArchiveDir != "" {
+			compaction.Archive = archiver(c.config.ArchiveDir, p.ID, rule.Provider, t.name)
+		}
+
+		res, err := c.store.CompactCostRecords(ctx, compaction)
+		if res.Removed > 0 {
+			c.logger.Info("retention: compacted cost records", "project", p.ID, "provider", rule.Provider, "tier", t.name,
+				"before", compaction.Before, "removed", res.Removed, "written", res.Written)
+			if c.auditor != nil {
+				c.auditor.Record(ctx, audit.Actor{Email: "system"}, audit.Event{
+					Action:     "costs.compact",
+					TargetType: audit.TargetProject,
+					TargetID:   p.ID,
+					ProjectID:  p.ID,
+					After: map[string]any{
+						"provider": rule.Provider, "tier": t.name, "before": compaction.Before,
+						"removed": res.Removed, "written": res.Written, "archived": c.config.ArchiveDir != "",
+					},
+				})
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s tier: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// namedProviders are the providers rules name, which the * rule leaves to
+// them.
+func (c *Compactor) namedProviders() []string {
+	var providers []string
+	for _, r := range c.config.Rules {
+		if r.Provider != AnyProvider {
+			providers = append(providers, r.Provider)
+		}
+	}
+	return providers
+}
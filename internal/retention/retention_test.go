@@ -0,0 +1,238 @@
+package retention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("kubernetes:hourly=30d,daily=13mo; *:daily=2w,monthly=7y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{
+		{Provider: "kubernetes", Hourly: Age{Days: 30}, Daily: Age{Months: 13}},
+		{Provider: "*", Daily: Age{Days: 14}, Monthly: Age{Months: 84}},
+	}
+	if len(rules) != len(want) || rules[0] != want[0] || rules[1] != want[1] {
+		t.Errorf("expected %+v, got %+v", want, rules)
+	}
+	if rules, err := ParseRules(""); err != nil || len(rules) != 0 {
+		t.Errorf("empty: expected no rules, got %v, %v", rules, err)
+	}
+
+	for _, s := range []string{
+		"kubernetes",
+		"kubernetes:hourly=30",
+		"kubernetes:weekly=30d",
+		"kubernetes:hourly=13mo,daily=30d",
+		"kubernetes:daily=1y,monthly=12mo",
+		"aws:daily=30d;aws:monthly=1y",
+	} {
+		if _, err := ParseRules(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestCompactor_Run(t *testing.T) {
+	ctx := context.Background()
+	st := storetest.New(t)
+	project := &models.Project{Name: "payments"}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	aws := &models.CostSource{ProjectID: project.ID, Type: models.CostSourceAWS, Name: "aws"}
+	k8s := &models.CostSource{ProjectID: project.ID, Type: models.CostSourceKubernetes, Name: "k8s"}
+	for _, cs := range []*models.CostSource{aws, k8s} {
+		if err := st.CreateCostSource(ctx, cs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	old := time.Date(2026, time.August, 3, 0, 0, 0, 0, time.UTC)
+	recent := now.AddDate(0, 0, -2).Truncate(24 * time.Hour)
+	var records []*models.CostRecord
+	hourly := func(start time.Time, hours int, namespace string) {
+		for h := range hours {
+			t := start.Add(time.Duration(h) * time.Hour)
+			records = append(records, &models.CostRecord{
+				ProjectID: project.ID, CostSourceID: k8s.ID, Provider: "kubernetes", Service: "compute",
+				StartTime: t, EndTime: t.Add(time.Hour), ListCost: 0.1, NetCost: 0.1 * float64(h%3+1),
+				Labels: map[string]string{"namespace": namespace},
+			})
+		}
+	}
+	hourly(old, 48, "api")
+	hourly(old, 24, "web")
+	hourly(recent, 24, "api")
+	// Two years back, past the monthly tier of every other provider.
+	ancient := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	for d := range 3 {
+		t := ancient.AddDate(0, 0, d)
+		records = append(records, &models.CostRecord{
+			ProjectID: project.ID, CostSourceID: aws.ID, Provider: "aws", Service: "ec2",
+			StartTime: t, EndTime: t.AddDate(0, 0, 1), NetCost: 7,
+		})
+	}
+	if err := st.InsertCostRecords(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+
+	oldMonth := store.CostQuery{ProjectID: project.ID, StartTime: time.Date(2026, time.August, 1, 0, 0, 0, 0, time.UTC), EndTime: time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC)}
+	before, err := st.AggregateCosts(ctx, oldMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := ParseRules("kubernetes:hourly=30d;*:monthly=18mo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := t.TempDir()
+	c := New(st, Config{Rules: rules, ArchiveDir: archive}, audit.NewRecorder(st, testLogger()), testLogger())
+	c.now = func() time.Time { return now }
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The old hourly records became one daily record per namespace and day,
+	// with the same totals.
+	after, err := st.AggregateCosts(ctx, oldMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.RecordCount != 3 || math.Abs(after.TotalNetCost-before.TotalNetCost) > 1e-9 || math.Abs(after.TotalListCost-before.TotalListCost) > 1e-9 {
+		t.Errorf("expected 3 daily records totalling %+v, got %+v", before, after)
+	}
+	raw, _, err := st.QueryCostRecords(ctx, oldMonth, store.PageQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range raw {
+		if !r.StartTime.Equal(store.GranularityDay.Truncate(r.StartTime)) || !r.EndTime.Equal(r.StartTime.AddDate(0, 0, 1)) || r.Labels["namespace"] == "" {
+			t.Errorf("expected a labelled daily record, got %+v", r)
+		}
+	}
+	// Labels stay queryable through the index after merging.
+	web, err := st.AggregateCosts(ctx, store.CostQuery{ProjectID: project.ID, CostFilter: models.CostFilter{Labels: map[string]string{"namespace": "web"}}, StartTime: oldMonth.StartTime, EndTime: oldMonth.EndTime})
+	if err != nil || web.RecordCount != 1 {
+		t.Errorf("expected one merged web record, got %+v, %v", web, err)
+	}
+
+	// Recent hourly records are kept; the aws records are gone and archived.
+	all, err := st.AggregateCosts(ctx, store.CostQuery{ProjectID: project.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all.RecordCount != 3+24 {
+		t.Errorf("expected the merged and recent records only, got %d", all.RecordCount)
+	}
+	files, _ := filepath.Glob(filepath.Join(archive, project.ID, "*.ndjson.gz"))
+	var lines int
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for sc := bufio.NewScanner(gz); sc.Scan(); {
+			lines++
+		}
+		f.Close()
+	}
+	if want := 48 + 24 + 3; lines != want {
+		t.Errorf("expected %d archived records in %v, got %d", want, files, lines)
+	}
+
+	// A second run has nothing left to do.
+	entries, _ := st.ListAuditEntries(ctx, store.AuditQuery{Action: "costs.compact"})
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := st.ListAuditEntries(ctx, store.AuditQuery{Action: "costs.compact"})
+	if len(entries) != 2 || len(again) != len(entries) {
+		t.Errorf("expected two audited compactions, then none, got %d and %d", len(entries), len(again))
+	}
+
+	// Collecting the merged days again does not count them twice, whether
+	// the records come back with their IDs or new ones.
+	var recollected []*models.CostRecord
+	for _, r := range records[:72] {
+		again := *r
+		recollected = append(recollected, &again)
+	}
+	for _, r := range records[:24] {
+		again := *r
+		again.ID = ""
+		recollected = append(recollected, &again)
+	}
+	if err := st.InsertCostRecords(ctx, recollected); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got, err := st.AggregateCosts(ctx, oldMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RecordCount != 3 || math.Abs(got.TotalNetCost-before.TotalNetCost) > 1e-9 {
+		t.Errorf("expected re-collected records to be dropped, got %+v, want the totals of %+v", got, before)
+	}
+}
+
+func TestArchiver_NamesFilesByRecords(t *testing.T) {
+	dir := t.TempDir()
+	bucket := time.Date(2026, time.August, 3, 0, 0, 0, 0, time.UTC)
+	records := []*models.CostRecord{{ID: "a", StartTime: bucket, EndTime: bucket.Add(time.Hour)}, {ID: "b", StartTime: bucket, EndTime: bucket.Add(time.Hour)}}
+	archive := archiver(dir, "p1", AnyProvider, "hourly")
+
+	// Archiving a bucket again, as after a compaction that failed to commit,
+	// replaces its file; other records get a file of their own.
+	for _, batch := range [][]*models.CostRecord{records, records, records[:1]} {
+		if err := archive(bucket, batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "p1", "all-hourly-2026-08-03-*.ndjson.gz"))
+	if len(files) != 2 {
+		t.Errorf("expected one file per set of records, got %v", files)
+	}
+}
+
+func TestPartitioner_RunSQLite(t *testing.T) {
+	st := storetest.New(t)
+	p := NewPartitioner(st, PartitionConfig{Retention: Age{Months: 1}}, nil, testLogger())
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// SQLite keeps a flat table: there are no partitions to create or expire.
+	res, err := st.ManageCostPartitions(context.Background(), time.Now(), store.CostPartitionPolicy{Ahead: 3, Before: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Created)+len(res.Detached)+len(res.Dropped) != 0 {
+		t.Errorf("result = %+v, want nothing done", res)
+	}
+}
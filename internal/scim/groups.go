@@ -0,0 +1,435 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/models"
+)
+
+type groupResource struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []memberRef `json:"members,omitempty"`
+	Meta        *meta       `json:"meta,omitempty"`
+}
+
+// groupSnapshot is the audited state of a group, including its members.
+type groupSnapshot struct {
+	*models.Group
+	Members []string `json:"members"`
+}
+
+var memberFilterPath = regexp.MustCompile(`^members\[\s*value\s+(?i:eq)\s+"([^"]+)"\s*\]$`)
+
+func (h *Handler) toGroupResource(r *http.Request, g *models.Group, withMembers bool) (*groupResource, error) {
+	res := &groupResource{
+		Schemas:     []string{schemaGroup},
+		ID:          g.ID,
+		ExternalID:  g.ExternalID,
+		DisplayName: g.Name,
+		Meta: &meta{
+			ResourceType: "Group",
+			Created:      g.CreatedAt,
+			LastModified: g.CreatedAt,
+			Location:     "/scim/v2/Groups/" + g.ID,
+		},
+	}
+	if !withMembers {
+		return res, nil
+	}
+	members, err := h.store.ListGroupMembers(r.Context(), g.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range members {
+		res.Members = append(res.Members, memberRef{Value: u.ID, Display: u.Email, Ref: "/scim/v2/Users/" + u.ID})
+	}
+	return res, nil
+}
+
+func (h *Handler) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	p, err := parsePage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	attr, value, err := parseFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	q := p.query()
+	switch attr {
+	case "":
+	case "displayname":
+		q.Name = value
+	case "externalid":
+		q.ExternalID = value
+	default:
+		writeError(w, http.StatusBadRequest, "invalidFilter", fmt.Sprintf("filtering on %q is not supported", attr))
+		return
+	}
+
+	groups, total, err := h.store.SearchGroups(r.Context(), q)
+	if err != nil {
+		h.logger.Error("scim: failed to list groups", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to list groups")
+		return
+	}
+
+	// Membership lists can be large; IdPs that only need IDs ask to leave them out.
+	withMembers := !strings.Contains(strings.ToLower(r.URL.Query().Get("excludedAttributes")), "members")
+	resources := make([]any, 0, len(groups))
+	for _, g := range groups {
+		res, err := h.toGroupResource(r, g, withMembers)
+		if err != nil {
+			h.logger.Error("scim: failed to list group members", "error", err)
+			writeError(w, http.StatusInternalServerError, "", "failed to list groups")
+			return
+		}
+		resources = append(resources, res)
+	}
+	writeList(w, p, total, resources)
+}
+
+func (h *Handler) handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	h.writeGroup(w, r, http.StatusOK, group)
+}
+
+// handleCreateGroup provisions a group. The display name doubles as the OIDC
+// group claim, so a group created from the IdP's groups claim at login is adopted
+// rather than duplicated, and project roles granted to it apply either way.
+func (h *Handler) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req groupResource
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	if req.DisplayName == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	memberIDs, ok := h.resolveMembers(w, r, req.Members)
+	if !ok {
+		return
+	}
+
+	existing, total, err := h.store.SearchGroups(r.Context(), pageOfOne(req.DisplayName))
+	if err != nil {
+		h.logger.Error("scim: failed to look up group", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to create group")
+		return
+	}
+
+	var group *models.Group
+	action := "group.create"
+	var before *groupSnapshot
+	switch {
+	case total > 0 && existing[0].ExternalID != "":
+		writeError(w, http.StatusConflict, "uniqueness", "a group with this displayName already exists")
+		return
+	case total > 0:
+		group = existing[0]
+		action = "group.update"
+		if before, err = h.snapshotGroup(r, group); err != nil {
+			h.logger.Error("scim: failed to list group members", "error", err)
+			writeError(w, http.StatusInternalServerError, "", "failed to create group")
+			return
+		}
+		group.ExternalID = req.ExternalID
+		err = h.store.UpdateGroup(r.Context(), group)
+	default:
+		group = &models.Group{Name: req.DisplayName, OIDCClaim: req.DisplayName, ExternalID: req.ExternalID}
+		err = h.store.CreateGroup(r.Context(), group)
+	}
+	if err != nil {
+		h.logger.Error("scim: failed to save group", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to create group")
+		return
+	}
+	if err := h.store.SetGroupMembers(r.Context(), group.ID, memberIDs); err != nil {
+		h.logger.Error("scim: failed to set group members", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to create group")
+		return
+	}
+
+	ev := audit.Event{Action: action, TargetType: audit.TargetGroup, TargetID: group.ID, After: groupSnapshot{group, memberIDs}}
+	if before != nil {
+		ev.Before = before
+	}
+	h.record(r, ev)
+	h.writeGroup(w, r, http.StatusCreated, group)
+}
+
+func (h *Handler) handleReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	var req groupResource
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	if req.DisplayName == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	memberIDs, ok := h.resolveMembers(w, r, req.Members)
+	if !ok {
+		return
+	}
+
+	before, err := h.snapshotGroup(r, group)
+	if err != nil {
+		h.logger.Error("scim: failed to list group members", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to update group")
+		return
+	}
+	group.Name = req.DisplayName
+	group.ExternalID = req.ExternalID
+	h.saveGroup(w, r, before, group, memberIDs)
+}
+
+func (h *Handler) handlePatchGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	var req patchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+
+	before, err := h.snapshotGroup(r, group)
+	if err != nil {
+		h.logger.Error("scim: failed to list group members", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to update group")
+		return
+	}
+	members := slices.Clone(before.Members)
+
+	for _, op := range req.Operations {
+		var ok bool
+		members, ok = h.applyGroupPatch(w, r, group, members, op)
+		if !ok {
+			return
+		}
+	}
+	h.saveGroup(w, r, before, group, members)
+}
+
+func (h *Handler) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	before, err := h.snapshotGroup(r, group)
+	if err != nil {
+		h.logger.Error("scim: failed to list group members", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to delete group")
+		return
+	}
+	if err := h.store.DeleteGroup(r.Context(), group.ID); err != nil {
+		h.logger.Error("scim: failed to delete group", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to delete group")
+		return
+	}
+	h.record(r, audit.Event{Action: "group.delete", TargetType: audit.TargetGroup, TargetID: group.ID, Before: before})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyGroupPatch applies one PATCH operation to the group and the working
+// member list. It writes the error response itself and reports false on failure.
+func (h *Handler) applyGroupPatch(w http.ResponseWriter, r *http.Request, group *models.Group, members []string, op patchOperation) ([]string, bool) {
+	path := strings.TrimSpace(op.Path)
+	opName := strings.ToLower(op.Op)
+
+	if m := memberFilterPath.FindStringSubmatch(path); m != nil && opName == "remove" {
+		return slices.DeleteFunc(members, func(id string) bool { return id == m[1] }), true
+	}
+
+	switch strings.ToLower(path) {
+	case "members":
+		var refs []memberRef
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &refs); err != nil {
+				writeError(w, http.StatusBadRequest, "invalidValue", "members must be a list of {value}")
+				return nil, false
+			}
+		}
+		switch opName {
+		case "add":
+			ids, ok := h.resolveMembers(w, r, refs)
+			if !ok {
+				return nil, false
+			}
+			for _, id := range ids {
+				if !slices.Contains(members, id) {
+					members = append(members, id)
+				}
+			}
+		case "replace":
+			ids, ok := h.resolveMembers(w, r, refs)
+			if !ok {
+				return nil, false
+			}
+			members = ids
+		case "remove":
+			if len(refs) == 0 {
+				return []string{}, true
+			}
+			for _, ref := range refs {
+				members = slices.DeleteFunc(members, func(id string) bool { return id == ref.Value })
+			}
+		default:
+			writeError(w, http.StatusBadRequest, "invalidValue", fmt.Sprintf("unsupported patch op %q", op.Op))
+			return nil, false
+		}
+		return members, true
+	case "displayname", "externalid", "":
+	default:
+		writeError(w, http.StatusBadRequest, "invalidPath", fmt.Sprintf("unsupported path %q", op.Path))
+		return nil, false
+	}
+
+	if opName != "add" && opName != "replace" {
+		writeError(w, http.StatusBadRequest, "invalidValue", fmt.Sprintf("unsupported patch op %q on %q", op.Op, op.Path))
+		return nil, false
+	}
+
+	values := map[string]json.RawMessage{}
+	if path == "" {
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			writeError(w, http.StatusBadRequest, "invalidValue", "patch value must be an object when no path is given")
+			return nil, false
+		}
+	} else {
+		values[path] = op.Value
+	}
+	for attr, value := range values {
+		var err error
+		switch strings.ToLower(attr) {
+		case "displayname":
+			err = json.Unmarshal(value, &group.Name)
+		case "externalid":
+			err = json.Unmarshal(value, &group.ExternalID)
+		case "id":
+		default:
+			writeError(w, http.StatusBadRequest, "invalidPath", fmt.Sprintf("unsupported attribute %q", attr))
+			return nil, false
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalidValue", fmt.Sprintf("invalid value for %s", attr))
+			return nil, false
+		}
+	}
+	return members, true
+}
+
+func (h *Handler) saveGroup(w http.ResponseWriter, r *http.Request, before *groupSnapshot, group *models.Group, memberIDs []string) {
+	if group.Name != before.Name {
+		others, total, err := h.store.SearchGroups(r.Context(), pageOfOne(group.Name))
+		if err != nil {
+			h.logger.Error("scim: failed to look up group", "error", err)
+			writeError(w, http.StatusInternalServerError, "", "failed to update group")
+			return
+		}
+		if total > 0 && others[0].ID != group.ID {
+			writeError(w, http.StatusConflict, "uniqueness", "a group with this displayName already exists")
+			return
+		}
+	}
+	if err := h.store.UpdateGroup(r.Context(), group); err != nil {
+		h.logger.Error("scim: failed to update group", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to update group")
+		return
+	}
+	if err := h.store.SetGroupMembers(r.Context(), group.ID, memberIDs); err != nil {
+		h.logger.Error("scim: failed to set group members", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to update group")
+		return
+	}
+	h.record(r, audit.Event{
+		Action:     "group.update",
+		TargetType: audit.TargetGroup,
+		TargetID:   group.ID,
+		Before:     before,
+		After:      groupSnapshot{group, memberIDs},
+	})
+	h.writeGroup(w, r, http.StatusOK, group)
+}
+
+// resolveMembers checks that every referenced user exists and returns their IDs.
+func (h *Handler) resolveMembers(w http.ResponseWriter, r *http.Request, refs []memberRef) ([]string, bool) {
+	ids := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		user, err := h.store.GetUser(r.Context(), ref.Value)
+		if err != nil {
+			h.logger.Error("scim: failed to look up member", "error", err)
+			writeError(w, http.StatusInternalServerError, "", "failed to resolve members")
+			return nil, false
+		}
+		if user == nil {
+			writeError(w, http.StatusBadRequest, "invalidValue", fmt.Sprintf("member %q does not exist", ref.Value))
+			return nil, false
+		}
+		if !slices.Contains(ids, user.ID) {
+			ids = append(ids, user.ID)
+		}
+	}
+	return ids, true
+}
+
+func (h *Handler) snapshotGroup(r *http.Request, g *models.Group) (*groupSnapshot, error) {
+	members, err := h.store.ListGroupMembers(r.Context(), g.ID)
+	if err != nil {
+		return nil, err
+	}
+	copied := *g
+	snap := &groupSnapshot{Group: &copied, Members: []string{}}
+	for _, u := range members {
+		snap.Members = append(snap.Members, u.ID)
+	}
+	return snap, nil
+}
+
+func (h *Handler) loadGroup(w http.ResponseWriter, r *http.Request) (*models.Group, bool) {
+	group, err := h.store.GetGroup(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Error("scim: failed to get group", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to get group")
+		return nil, false
+	}
+	if group == nil {
+		writeError(w, http.StatusNotFound, "", "group not found")
+		return nil, false
+	}
+	return group, true
+}
+
+func (h *Handler) writeGroup(w http.ResponseWriter, r *http.Request, code int, group *models.Group) {
+	res, err := h.toGroupResource(r, group, true)
+	if err != nil {
+		h.logger.Error("scim: failed to list group members", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to load group")
+		return
+	}
+	writeResource(w, code, res)
+}
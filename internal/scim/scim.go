@@ -0,0 +1,244 @@
+// Package scim implements a SCIM 2.0 (RFC 7643/7644) service provider for users
+// and groups, so an identity provider such as Okta or Entra ID can provision
+// accounts and memberships before anyone signs in.
+package scim
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/auth"
+	"github.com/inelson/finguard/internal/store"
+)
+
+const (
+	schemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	schemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	schemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	schemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	schemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	schemaSPConfig     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	schemaResourceType = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	contentType = "application/scim+json"
+
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Handler serves the SCIM API. It is mounted under /scim/v2 and authenticates
+// every request with a static bearer token, independently of user sessions.
+type Handler struct {
+	store   store.Store
+	token   string
+	auditor *audit.Recorder
+	logger  *slog.Logger
+}
+
+func New(st store.Store, token string, auditor *audit.Recorder, logger *slog.Logger) *Handler {
+	return &Handler{store: st, token: token, auditor: auditor, logger: logger}
+}
+
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(h.authenticate)
+
+	r.Get("/ServiceProviderConfig", h.handleServiceProviderConfig)
+	r.Get("/ResourceTypes", h.handleResourceTypes)
+
+	r.Get("/Users", h.handleListUsers)
+	r.Post("/Users", h.handleCreateUser)
+	r.Get("/Users/{id}", h.handleGetUser)
+	r.Put("/Users/{id}", h.handleReplaceUser)
+	r.Patch("/Users/{id}", h.handlePatchUser)
+	r.Delete("/Users/{id}", h.handleDeleteUser)
+
+	r.Get("/Groups", h.handleListGroups)
+	r.Post("/Groups", h.handleCreateGroup)
+	r.Get("/Groups/{id}", h.handleGetGroup)
+	r.Put("/Groups/{id}", h.handleReplaceGroup)
+	r.Patch("/Groups/{id}", h.handlePatchGroup)
+	r.Delete("/Groups/{id}", h.handleDeleteGroup)
+	return r
+}
+
+func (h *Handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "", "invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// record audits a directory change. The actor is the provisioning client, not a user.
+func (h *Handler) record(r *http.Request, ev audit.Event) {
+	h.auditor.Record(r.Context(), h.actor(r), ev)
+}
+
+func (h *Handler) actor(r *http.Request) audit.Actor {
+	return audit.Actor{
+		Email:     "scim",
+		IPAddress: auth.ClientIP(r),
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+}
+
+type meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+type listResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+type errorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+type patchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []patchOperation `json:"Operations"`
+}
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// page holds the 1-based startIndex and count of a list request.
+type page struct {
+	startIndex int
+	count      int
+}
+
+func parsePage(r *http.Request) (page, error) {
+	p := page{startIndex: 1, count: defaultPageSize}
+	if v := r.URL.Query().Get("startIndex"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid startIndex")
+		}
+		// RFC 7644 3.4.2.4: values below 1 are interpreted as 1.
+		p.startIndex = max(n, 1)
+	}
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid count")
+		}
+		p.count = min(max(n, 0), maxPageSize)
+	}
+	return p, nil
+}
+
+// query converts the page into a store query. A count of zero still needs one
+// row fetched to learn the total, so callers drop the results in that case.
+func (p page) query() store.DirectoryQuery {
+	return store.DirectoryQuery{Offset: p.startIndex - 1, Limit: max(p.count, 1)}
+}
+
+// pageOfOne looks up a single user or group by name.
+func pageOfOne(name string) store.DirectoryQuery {
+	return store.DirectoryQuery{Name: name, Limit: 1}
+}
+
+var filterPattern = regexp.MustCompile(`^\s*([A-Za-z][\w.]*)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// parseFilter supports the single `attribute eq "value"` form that identity
+// providers use to look up an existing resource before creating it.
+func parseFilter(filter string) (attr, value string, err error) {
+	if filter == "" {
+		return "", "", nil
+	}
+	m := filterPattern.FindStringSubmatch(filter)
+	if m == nil {
+		return "", "", fmt.Errorf("unsupported filter %q: only 'attribute eq \"value\"' is supported", filter)
+	}
+	value, err = strconv.Unquote(`"` + m[2] + `"`)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid filter value: %w", err)
+	}
+	return strings.ToLower(m[1]), value, nil
+}
+
+func writeResource(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeList(w http.ResponseWriter, p page, total int, resources []any) {
+	if p.count == 0 {
+		resources = nil
+	}
+	if resources == nil {
+		resources = []any{}
+	}
+	writeResource(w, http.StatusOK, listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: total,
+		StartIndex:   p.startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func writeError(w http.ResponseWriter, code int, scimType, detail string) {
+	writeResource(w, code, errorResponse{
+		Schemas:  []string{schemaError},
+		Status:   strconv.Itoa(code),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+func (h *Handler) handleServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	writeResource(w, http.StatusOK, map[string]any{
+		"schemas":        []string{schemaSPConfig},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": maxPageSize},
+		"changePassword": map[string]bool{"supported": false},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "Static bearer token configured with FINGUARD_SCIM_TOKEN",
+			"primary":     true,
+		}},
+	})
+}
+
+func (h *Handler) handleResourceTypes(w http.ResponseWriter, r *http.Request) {
+	types := []any{
+		map[string]any{"schemas": []string{schemaResourceType}, "id": "User", "name": "User", "endpoint": "/Users", "schema": schemaUser},
+		map[string]any{"schemas": []string{schemaResourceType}, "id": "Group", "name": "Group", "endpoint": "/Groups", "schema": schemaGroup},
+	}
+	writeList(w, page{startIndex: 1, count: len(types)}, len(types), types)
+}
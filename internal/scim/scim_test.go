@@ -0,0 +1,292 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+)
+
+const testToken = "scim-secret"
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func newTestHandler(t *testing.T) (http.Handler, store.Store) {
+	t.Helper()
+	st := storetest.New(t)
+	logger := testLogger()
+	return New(st, testToken, audit.NewRecorder(st, logger), logger).Routes(), st
+}
+
+func do(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func decode[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(w.Body).Decode(&v); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return v
+}
+
+func createUser(t *testing.T, h http.Handler, userName string) userResource {
+	t.Helper()
+	w := do(t, h, http.MethodPost, "/Users", `{"schemas":["`+schemaUser+`"],"userName":"`+userName+`","externalId":"ext-`+userName+`","name":{"givenName":"Test","familyName":"User"}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create user %s: expected 201, got %d: %s", userName, w.Code, w.Body)
+	}
+	return decode[userResource](t, w)
+}
+
+func TestAuthentication(t *testing.T) {
+	h, _ := newTestHandler(t)
+	for _, header := range []string{"", "Bearer wrong", "Basic " + testToken} {
+		req := httptest.NewRequest(http.MethodGet, "/Users", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401, got %d", header, w.Code)
+		}
+	}
+}
+
+func TestUsers_CreateFilterAndPaginate(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	alice := createUser(t, h, "alice@example.com")
+	if alice.ID == "" || alice.DisplayName != "Test User" || alice.Active == nil || !*alice.Active {
+		t.Fatalf("unexpected created user: %+v", alice)
+	}
+	createUser(t, h, "bob@example.com")
+	createUser(t, h, "carol@example.com")
+
+	if w := do(t, h, http.MethodPost, "/Users", `{"userName":"alice@example.com"}`); w.Code != http.StatusConflict {
+		t.Errorf("duplicate user: expected 409, got %d", w.Code)
+	}
+
+	list := decode[listResponse](t, do(t, h, http.MethodGet, `/Users?filter=userName+eq+"Alice@Example.com"`, ""))
+	if list.TotalResults != 1 || len(list.Resources) != 1 {
+		t.Fatalf("filter by userName: expected 1 result, got %+v", list)
+	}
+
+	list = decode[listResponse](t, do(t, h, http.MethodGet, `/Users?filter=externalId+eq+"ext-bob@example.com"`, ""))
+	if list.TotalResults != 1 {
+		t.Errorf("filter by externalId: expected 1 result, got %d", list.TotalResults)
+	}
+
+	list = decode[listResponse](t, do(t, h, http.MethodGet, "/Users?startIndex=2&count=1", ""))
+	if list.TotalResults != 3 || list.ItemsPerPage != 1 || list.StartIndex != 2 {
+		t.Fatalf("pagination: unexpected page %+v", list)
+	}
+	if got := list.Resources[0].(map[string]any)["userName"]; got != "bob@example.com" {
+		t.Errorf("expected bob on page 2, got %v", got)
+	}
+
+	list = decode[listResponse](t, do(t, h, http.MethodGet, "/Users?count=0", ""))
+	if list.TotalResults != 3 || len(list.Resources) != 0 {
+		t.Errorf("count=0: expected only the total, got %+v", list)
+	}
+
+	if w := do(t, h, http.MethodGet, `/Users?filter=title+sw+"x"`, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unsupported filter: expected 400, got %d", w.Code)
+	}
+}
+
+func TestUsers_AdoptsExistingLogin(t *testing.T) {
+	h, st := newTestHandler(t)
+	ctx := context.Background()
+	existing := &models.User{Email: "dave@example.com", DisplayName: "dave", OIDCSubject: "sub-dave", Active: true}
+	if err := st.CreateUser(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	created := createUser(t, h, "dave@example.com")
+	if created.ID != existing.ID {
+		t.Errorf("expected existing user %s to be adopted, got %s", existing.ID, created.ID)
+	}
+	stored, _ := st.GetUser(ctx, existing.ID)
+	if stored.ExternalID != "ext-dave@example.com" || stored.OIDCSubject != "sub-dave" {
+		t.Errorf("expected external ID linked and OIDC subject kept, got %+v", stored)
+	}
+}
+
+func TestUsers_CreateAcceptsInvitations(t *testing.T) {
+	h, st := newTestHandler(t)
+	ctx := context.Background()
+	project := &models.Project{Name: "payments"}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.CreateProjectInvitation(ctx, &models.ProjectInvitation{ProjectID: project.ID, Email: "gina@example.com", Role: models.RoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+
+	user := createUser(t, h, "gina@example.com")
+	pr, _ := st.GetUserProjectRole(ctx, project.ID, user.ID)
+	if pr == nil || pr.Role != models.RoleViewer {
+		t.Errorf("expected the invitation to grant viewer, got %+v", pr)
+	}
+}
+
+func TestUsers_PatchDeactivateRevokesSessions(t *testing.T) {
+	h, st := newTestHandler(t)
+	ctx := context.Background()
+	user := createUser(t, h, "erin@example.com")
+
+	sess := &models.Session{UserID: user.ID, ExpiresAt: time.Now().UTC().Add(time.Hour)}
+	if err := st.CreateSession(ctx, sess); err != nil {
+		t.Fatal(err)
+	}
+
+	// Entra ID sends the path-less form with string booleans.
+	w := do(t, h, http.MethodPatch, "/Users/"+user.ID, `{"schemas":["`+schemaPatchOp+`"],"Operations":[{"op":"Replace","value":{"active":"False","displayName":"Erin E."}}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	patched := decode[userResource](t, w)
+	if *patched.Active || patched.DisplayName != "Erin E." {
+		t.Errorf("unexpected patched user: %+v", patched)
+	}
+
+	stored, _ := st.GetSession(ctx, sess.ID)
+	if stored.RevokedAt == nil {
+		t.Error("expected deactivation to revoke the user's sessions")
+	}
+
+	w = do(t, h, http.MethodPatch, "/Users/"+user.ID, `{"Operations":[{"op":"replace","path":"active","value":true}]}`)
+	if w.Code != http.StatusOK || !*decode[userResource](t, w).Active {
+		t.Errorf("expected user to be reactivated")
+	}
+}
+
+func TestUsers_DeleteRemovesRoles(t *testing.T) {
+	h, st := newTestHandler(t)
+	ctx := context.Background()
+	user := createUser(t, h, "frank@example.com")
+
+	project := &models.Project{Name: "payments"}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetProjectRole(ctx, &models.ProjectRole{ProjectID: project.ID, SubjectType: models.SubjectUser, SubjectID: user.ID, Role: models.RoleEditor}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := do(t, h, http.MethodDelete, "/Users/"+user.ID, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d", w.Code)
+	}
+	if w := do(t, h, http.MethodGet, "/Users/"+user.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("get deleted user: expected 404, got %d", w.Code)
+	}
+	roles, _ := st.ListProjectRoles(ctx, project.ID)
+	if len(roles) != 0 {
+		t.Errorf("expected project roles to be removed, got %d", len(roles))
+	}
+
+	entries, _ := st.ListAuditEntries(ctx, store.AuditQuery{Action: "user.delete"})
+	if len(entries) != 1 || entries[0].ActorEmail != "scim" {
+		t.Errorf("expected user.delete audit entry by scim, got %+v", entries)
+	}
+}
+
+func TestGroups_Membership(t *testing.T) {
+	h, st := newTestHandler(t)
+	ctx := context.Background()
+	alice := createUser(t, h, "alice@example.com")
+	bob := createUser(t, h, "bob@example.com")
+
+	w := do(t, h, http.MethodPost, "/Groups", `{"schemas":["`+schemaGroup+`"],"displayName":"finance","members":[{"value":"`+alice.ID+`"}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create group: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	group := decode[groupResource](t, w)
+	if len(group.Members) != 1 {
+		t.Fatalf("expected 1 member, got %+v", group.Members)
+	}
+
+	stored, _ := st.GetGroup(ctx, group.ID)
+	if stored.OIDCClaim != "finance" {
+		t.Errorf("expected group claim to default to the display name, got %q", stored.OIDCClaim)
+	}
+
+	w = do(t, h, http.MethodPatch, "/Groups/"+group.ID, `{"Operations":[
+		{"op":"add","path":"members","value":[{"value":"`+bob.ID+`"}]},
+		{"op":"remove","path":"members[value eq \"`+alice.ID+`\"]"},
+		{"op":"replace","path":"displayName","value":"finance-team"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch group: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	group = decode[groupResource](t, w)
+	if group.DisplayName != "finance-team" || len(group.Members) != 1 || group.Members[0].Value != bob.ID {
+		t.Errorf("unexpected patched group: %+v", group)
+	}
+
+	userRes := decode[userResource](t, do(t, h, http.MethodGet, "/Users/"+bob.ID, ""))
+	if len(userRes.Groups) != 1 || userRes.Groups[0].Value != group.ID {
+		t.Errorf("expected bob's groups to include %s, got %+v", group.ID, userRes.Groups)
+	}
+
+	if w := do(t, h, http.MethodPatch, "/Groups/"+group.ID, `{"Operations":[{"op":"add","path":"members","value":[{"value":"nobody"}]}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown member: expected 400, got %d", w.Code)
+	}
+
+	list := decode[listResponse](t, do(t, h, http.MethodGet, `/Groups?filter=displayName+eq+"finance-team"&excludedAttributes=members`, ""))
+	if list.TotalResults != 1 {
+		t.Fatalf("expected 1 group, got %d", list.TotalResults)
+	}
+	if _, ok := list.Resources[0].(map[string]any)["members"]; ok {
+		t.Error("expected members to be excluded")
+	}
+
+	if w := do(t, h, http.MethodDelete, "/Groups/"+group.ID, ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete group: expected 204, got %d", w.Code)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter    string
+		wantAttr  string
+		wantValue string
+		wantErr   bool
+	}{
+		{``, "", "", false},
+		{`userName eq "a@b.c"`, "username", "a@b.c", false},
+		{`displayName EQ "Team \"A\""`, "displayname", `Team "A"`, false},
+		{`userName co "a"`, "", "", true},
+		{`userName eq "a" and active eq true`, "", "", true},
+	}
+	for _, tt := range tests {
+		attr, value, err := parseFilter(tt.filter)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFilter(%q) error = %v, wantErr %v", tt.filter, err, tt.wantErr)
+			continue
+		}
+		if attr != tt.wantAttr || value != tt.wantValue {
+			t.Errorf("parseFilter(%q) = %q, %q, want %q, %q", tt.filter, attr, value, tt.wantAttr, tt.wantValue)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/auth"
+	"github.com/inelson/finguard/internal/models"
+)
+
+type userResource struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *userName   `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []multiAttr `json:"emails,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Groups      []memberRef `json:"groups,omitempty"`
+	Meta        *meta       `json:"meta,omitempty"`
+}
+
+type userName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type multiAttr struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type memberRef struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// email returns the address FinGuard keys the user by: userName when it looks
+// like an address, otherwise the primary (or first) email.
+func (u *userResource) email() string {
+	if strings.Contains(u.UserName, "@") || len(u.Emails) == 0 {
+		return u.UserName
+	}
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	return u.Emails[0].Value
+}
+
+func (u *userResource) displayName() string {
+	switch {
+	case u.DisplayName != "":
+		return u.DisplayName
+	case u.Name != nil && u.Name.Formatted != "":
+		return u.Name.Formatted
+	case u.Name != nil && (u.Name.GivenName != "" || u.Name.FamilyName != ""):
+		return strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+	default:
+		return u.email()
+	}
+}
+
+func (h *Handler) toUserResource(r *http.Request, u *models.User) (*userResource, error) {
+	groups, err := h.store.ListUserGroups(r.Context(), u.ID)
+	if err != nil {
+		return nil, err
+	}
+	active := u.Active
+	res := &userResource{
+		Schemas:     []string{schemaUser},
+		ID:          u.ID,
+		ExternalID:  u.ExternalID,
+		UserName:    u.Email,
+		Name:        &userName{Formatted: u.DisplayName},
+		DisplayName: u.DisplayName,
+		Emails:      []multiAttr{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &meta{
+			ResourceType: "User",
+			Created:      u.CreatedAt,
+			LastModified: u.CreatedAt,
+			Location:     "/scim/v2/Users/" + u.ID,
+		},
+	}
+	for _, g := range groups {
+		res.Groups = append(res.Groups, memberRef{Value: g.ID, Display: g.Name, Ref: "/scim/v2/Groups/" + g.ID})
+	}
+	return res, nil
+}
+
+func (h *Handler) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	p, err := parsePage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	attr, value, err := parseFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	q := p.query()
+	switch attr {
+	case "":
+	case "username", "emails", "emails.value":
+		q.Name = value
+	case "externalid":
+		q.ExternalID = value
+	default:
+		writeError(w, http.StatusBadRequest, "invalidFilter", fmt.Sprintf("filtering on %q is not supported", attr))
+		return
+	}
+
+	users, total, err := h.store.SearchUsers(r.Context(), q)
+	if err != nil {
+		h.logger.Error("scim: failed to list users", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to list users")
+		return
+	}
+
+	resources := make([]any, 0, len(users))
+	for _, u := range users {
+		res, err := h.toUserResource(r, u)
+		if err != nil {
+			h.logger.Error("scim: failed to load user groups", "error", err)
+			writeError(w, http.StatusInternalServerError, "", "failed to list users")
+			return
+		}
+		resources = append(resources, res)
+	}
+	writeList(w, p, total, resources)
+}
+
+func (h *Handler) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+	h.writeUser(w, r, http.StatusOK, user)
+}
+
+// handleCreateUser provisions a user. A user that already signed in via OIDC but
+// is not yet linked to the directory is adopted instead of rejected as a duplicate.
+func (h *Handler) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req userResource
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	email := req.email()
+	if email == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	existing, err := h.store.GetUserByEmail(r.Context(), email)
+	if err != nil {
+		h.logger.Error("scim: failed to look up user", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to create user")
+		return
+	}
+	if existing != nil && existing.ExternalID != "" {
+		writeError(w, http.StatusConflict, "uniqueness", "a user with this userName already exists")
+		return
+	}
+
+	active := req.Active == nil || *req.Active
+	if existing != nil {
+		before := *existing
+		existing.DisplayName = req.displayName()
+		existing.ExternalID = req.ExternalID
+		existing.Active = active
+		if err := h.store.UpdateUser(r.Context(), existing); err != nil {
+			h.logger.Error("scim: failed to link user", "error", err)
+			writeError(w, http.StatusInternalServerError, "", "failed to create user")
+			return
+		}
+		h.record(r, audit.Event{Action: "user.update", TargetType: audit.TargetUser, TargetID: existing.ID, Before: before, After: existing})
+		h.writeUser(w, r, http.StatusCreated, existing)
+		return
+	}
+
+	user := &models.User{
+		Email:       email,
+		DisplayName: req.displayName(),
+		ExternalID:  req.ExternalID,
+		Active:      active,
+	}
+	if err := h.store.CreateUser(r.Context(), user); err != nil {
+		h.logger.Error("scim: failed to create user", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to create user")
+		return
+	}
+	h.record(r, audit.Event{Action: "user.create", TargetType: audit.TargetUser, TargetID: user.ID, After: user})
+	if err := auth.AcceptInvitations(r.Context(), h.store, h.auditor, h.actor(r), user); err != nil {
+		h.logger.Error("scim: failed to accept project invitations", "email", email, "error", err)
+	}
+	h.writeUser(w, r, http.StatusCreated, user)
+}
+
+func (h *Handler) handleReplaceUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+	var req userResource
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	if req.email() == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	before := *user
+	user.Email = req.email()
+	user.DisplayName = req.displayName()
+	user.ExternalID = req.ExternalID
+	user.Active = req.Active == nil || *req.Active
+	h.saveUser(w, r, &before, user)
+}
+
+func (h *Handler) handlePatchUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+	var req patchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+
+	before := *user
+	for _, op := range req.Operations {
+		if err := applyUserPatch(user, op); err != nil {
+			writeError(w, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	h.saveUser(w, r, &before, user)
+}
+
+func (h *Handler) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+	if err := h.store.DeleteUser(r.Context(), user.ID); err != nil {
+		h.logger.Error("scim: failed to delete user", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to delete user")
+		return
+	}
+	h.record(r, audit.Event{Action: "user.delete", TargetType: audit.TargetUser, TargetID: user.ID, Before: user})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) loadUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user, err := h.store.GetUser(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Error("scim: failed to get user", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to get user")
+		return nil, false
+	}
+	if user == nil {
+		writeError(w, http.StatusNotFound, "", "user not found")
+		return nil, false
+	}
+	return user, true
+}
+
+// saveUser persists an update. Deactivating a user also ends their sessions so
+// that access stops immediately rather than at the next idle timeout.
+func (h *Handler) saveUser(w http.ResponseWriter, r *http.Request, before, user *models.User) {
+	if user.Email != before.Email {
+		other, err := h.store.GetUserByEmail(r.Context(), user.Email)
+		if err != nil {
+			h.logger.Error("scim: failed to look up user", "error", err)
+			writeError(w, http.StatusInternalServerError, "", "failed to update user")
+			return
+		}
+		if other != nil {
+			writeError(w, http.StatusConflict, "uniqueness", "a user with this userName already exists")
+			return
+		}
+	}
+	if err := h.store.UpdateUser(r.Context(), user); err != nil {
+		h.logger.Error("scim: failed to update user", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to update user")
+		return
+	}
+	if before.Active && !user.Active {
+		if err := h.store.RevokeUserSessions(r.Context(), user.ID); err != nil {
+			h.logger.Error("scim: failed to revoke sessions of deactivated user", "userId", user.ID, "error", err)
+		}
+	}
+	h.record(r, audit.Event{Action: "user.update", TargetType: audit.TargetUser, TargetID: user.ID, Before: before, After: user})
+	h.writeUser(w, r, http.StatusOK, user)
+}
+
+func (h *Handler) writeUser(w http.ResponseWriter, r *http.Request, code int, user *models.User) {
+	res, err := h.toUserResource(r, user)
+	if err != nil {
+		h.logger.Error("scim: failed to load user groups", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "failed to load user")
+		return
+	}
+	writeResource(w, code, res)
+}
+
+// applyUserPatch applies one PATCH operation. Both the path form
+// ({"op":"replace","path":"active","value":false}) and the path-less form
+// ({"op":"replace","value":{"active":false}}) are accepted, as IdPs use both.
+func applyUserPatch(user *models.User, op patchOperation) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	case "remove":
+		switch strings.ToLower(op.Path) {
+		case "externalid":
+			user.ExternalID = ""
+		case "displayname", "name.formatted":
+			user.DisplayName = user.Email
+		default:
+			return fmt.Errorf("cannot remove %q", op.Path)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported patch op %q", op.Op)
+	}
+
+	if op.Path == "" {
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return fmt.Errorf("patch value must be an object when no path is given")
+		}
+		for attr, value := range values {
+			if err := setUserAttr(user, attr, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return setUserAttr(user, op.Path, op.Value)
+}
+
+func setUserAttr(user *models.User, attr string, value json.RawMessage) error {
+	attr = strings.ToLower(attr)
+	switch {
+	case attr == "active":
+		active, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		user.Active = active
+	case attr == "username":
+		return json.Unmarshal(value, &user.Email)
+	case attr == "displayname" || attr == "name.formatted":
+		return json.Unmarshal(value, &user.DisplayName)
+	case attr == "externalid":
+		return json.Unmarshal(value, &user.ExternalID)
+	case attr == "name":
+		var name userName
+		if err := json.Unmarshal(value, &name); err != nil {
+			return err
+		}
+		res := userResource{Name: &name, UserName: user.Email}
+		user.DisplayName = res.displayName()
+	case attr == "emails":
+		var emails []multiAttr
+		if err := json.Unmarshal(value, &emails); err != nil {
+			return err
+		}
+		res := userResource{Emails: emails}
+		if email := res.email(); email != "" {
+			user.Email = email
+		}
+	case strings.HasPrefix(attr, "emails[") && strings.HasSuffix(attr, "].value"):
+		return json.Unmarshal(value, &user.Email)
+	case strings.HasPrefix(attr, "name."), strings.HasPrefix(attr, "urn:"):
+		// Name parts and extension attributes are accepted but not stored.
+	default:
+		return fmt.Errorf("unsupported attribute %q", attr)
+	}
+	return nil
+}
+
+// parseBool accepts JSON booleans and the "True"/"False" strings some IdPs send.
+func parseBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("active must be a boolean")
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/auth"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+)
+
+// recordAudit writes an audit entry attributed to the caller of r.
+func (s *Server) recordAudit(r *http.Request, ev audit.Event) {
+	s.auditor.Record(r.Context(), auth.AuditActor(r), ev)
+}
+
+// @Summary      List audit entries
+// @Description  Returns one page of audit log entries, newest first unless sorted otherwise. Requires platform admin.
+// @Tags         Audit
+// @Produce      json
+// @Param        projectId   query     string  false  "Filter by project ID"
+// @Param        actorId     query     string  false  "Filter by actor user ID"
+// @Param        action      query     string  false  "Filter by action, e.g. project.delete"
+// @Param        targetType  query     string  false  "Filter by target type"
+// @Param        targetId    query     string  false  "Filter by target ID"
+// @Param        since       query     string  false  "Only entries at or after this RFC 3339 time"
+// @Param        until       query     string  false  "Only entries before this RFC 3339 time"
+// @Param        sort        query     string  false  "Sort field: occurredAt or action, prefixed with - for descending (default -occurredAt)"
+// @Param        cursor      query     string  false  "Cursor from the previous page's next link"
+// @Param        limit       query     int     false  "Maximum entries to return (default 100, max 1000)"
+// @Success      200         {object}  object{entries=[]models.AuditEntry,next=string}
+// @Failure      400         {object}  object{error=string}
+// @Failure      403         {object}  object{error=string}
+// @Failure      500         {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /audit [get]
+func (s *Server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	s.writeAuditEntries(w, r, q)
+}
+
+// @Summary      Export audit entries
+// @Description  Streams matching audit log entries as newline-delimited JSON. Requires platform admin.
+// @Tags         Audit
+// @Produce      application/x-ndjson
+// @Param        projectId   query     string  false  "Filter by project ID"
+// @Param        actorId     query     string  false  "Filter by actor user ID"
+// @Param        action      query     string  false  "Filter by action"
+// @Param        targetType  query     string  false  "Filter by target type"
+// @Param        targetId    query     string  false  "Filter by target ID"
+// @Param        since       query     string  false  "Only entries at or after this RFC 3339 time"
+// @Param        until       query     string  false  "Only entries before this RFC 3339 time"
+// @Success      200         {string}  string  "One models.AuditEntry per line"
+// @Failure      400         {object}  object{error=string}
+// @Failure      403         {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /audit/export [get]
+func (s *Server) handleExportAudit(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	s.streamAuditEntries(w, r, q)
+}
+
+// @Summary      List project audit entries
+// @Description  Returns one page of a single project's audit log entries, newest first unless sorted otherwise. Requires project admin.
+// @Tags         Audit
+// @Produce      json
+// @Param        projectID   path      string  true   "Project ID"
+// @Param        actorId     query     string  false  "Filter by actor user ID"
+// @Param        action      query     string  false  "Filter by action"
+// @Param        targetType  query     string  false  "Filter by target type"
+// @Param        targetId    query     string  false  "Filter by target ID"
+// @Param        since       query     string  false  "Only entries at or after this RFC 3339 time"
+// @Param        until       query     string  false  "Only entries before this RFC 3339 time"
+// @Param        sort        query     string  false  "Sort field: occurredAt or action, prefixed with - for descending (default -occurredAt)"
+// @Param        cursor      query     string  false  "Cursor from the previous page's next link"
+// @Param        limit       query     int     false  "Maximum entries to return (default 100, max 1000)"
+// @Success      200         {object}  object{entries=[]models.AuditEntry,next=string}
+// @Failure      400         {object}  object{error=string}
+// @Failure      403         {object}  object{error=string}
+// @Failure      500         {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/audit [get]
+func (s *Server) handleListProjectAudit(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	q.ProjectID = chi.URLParam(r, "projectID")
+	s.writeAuditEntries(w, r, q)
+}
+
+// @Summary      Export project audit entries
+// @Description  Streams a project's audit log entries as newline-delimited JSON. Requires project admin.
+// @Tags         Audit
+// @Produce      application/x-ndjson
+// @Param        projectID   path      string  true   "Project ID"
+// @Param        actorId     query     string  false  "Filter by actor user ID"
+// @Param        action      query     string  false  "Filter by action"
+// @Param        targetType  query     string  false  "Filter by target type"
+// @Param        targetId    query     string  false  "Filter by target ID"
+// @Param        since       query     string  false  "Only entries at or after this RFC 3339 time"
+// @Param        until       query     string  false  "Only entries before this RFC 3339 time"
+// @Success      200         {string}  string  "One models.AuditEntry per line"
+// @Failure      400         {object}  object{error=string}
+// @Failure      403         {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/audit/export [get]
+func (s *Server) handleExportProjectAudit(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	q.ProjectID = chi.URLParam(r, "projectID")
+	s.streamAuditEntries(w, r, q)
+}
+
+func (s *Server) writeAuditEntries(w http.ResponseWriter, r *http.Request, q store.AuditQuery) {
+	p, err := parsePage(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	entries, next, err := s.store.ListAuditEntriesPage(r.Context(), q, p)
+	if err != nil {
+		s.writePageError(w, err, "audit entries")
+		return
+	}
+	if entries == nil {
+		entries = []*models.AuditEntry{}
+	}
+	writePage(w, r, "entries", entries, next)
+}
+
+// streamAuditEntries writes entries as NDJSON while they are read from the store.
+// Once the first line is sent the status is committed, so later errors are only logged.
+func (s *Server) streamAuditEntries(w http.ResponseWriter, r *http.Request, q store.AuditQuery) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.ndjson"`)
+	clearWriteDeadline(w)
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	err := s.store.ExportAuditEntries(r.Context(), q, func(e *models.AuditEntry) error {
+		return enc.Encode(e)
+	})
+	if err != nil {
+		s.logger.Error("audit export aborted", "error", err)
+	}
+}
+
+func parseAuditQuery(r *http.Request) (store.AuditQuery, error) {
+	params := r.URL.Query()
+	q := store.AuditQuery{
+		ProjectID:  params.Get("projectId"),
+		ActorID:    params.Get("actorId"),
+		Action:     params.Get("action"),
+		TargetType: params.Get("targetType"),
+		TargetID:   params.Get("targetId"),
+	}
+
+	for name, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if v := params.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s: must be an RFC 3339 timestamp", name)
+			}
+			*dst = t.UTC()
+		}
+	}
+	return q, nil
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/config"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/opencostproxy"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+	"github.com/inelson/finguard/internal/stream"
+)
+
+// newTestServerWithStore returns a server backed by a migrated SQLite store with
+// auth disabled, for tests that exercise handlers end to end.
+func newTestServerWithStore(t *testing.T) (*Server, store.Store) {
+	t.Helper()
+	st := storetest.New(t)
+
+	cfg := &config.Config{
+		HTTPAddr:    ":0",
+		OpenCostURL: "http://localhost:9003",
+	}
+	logger := testLogger()
+	hub := stream.NewHub(logger)
+	proxy := opencostproxy.New(cfg.OpenCostURL, logger)
+	return New(cfg, hub, proxy, nil, nil, st, nil, audit.NewRecorder(st, logger), nil, nil, nil, nil, logger), st
+}
+
+func doRequest(srv *Server, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAudit_ProjectLifecycle(t *testing.T) {
+	srv, _ := newTestServerWithStore(t)
+
+	w := doRequest(srv, http.MethodPost, "/api/v1/projects", `{"name":"payments"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create project: expected 201, got %d", w.Code)
+	}
+	var project models.Project
+	json.NewDecoder(w.Body).Decode(&project)
+
+	doRequest(srv, http.MethodPut, "/api/v1/projects/"+project.ID, `{"name":"billing"}`)
+	doRequest(srv, http.MethodPost, "/api/v1/projects/"+project.ID+"/sources",
+		`{"type":"azure_subscription","name":"prod","config":{"subscriptionId":"sub-1","clientSecret":"hunter2"}}`)
+	doRequest(srv, http.MethodDelete, "/api/v1/projects/"+project.ID, "")
+
+	w = doRequest(srv, http.MethodGet, "/api/v1/projects/"+project.ID+"/audit", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list audit: expected 200, got %d", w.Code)
+	}
+	var body struct {
+		Entries []models.AuditEntry `json:"entries"`
+	}
+	json.NewDecoder(w.Body).Decode(&body)
+
+	var actions []string
+	for _, e := range body.Entries {
+		actions = append(actions, e.Action)
+	}
+	want := "project.delete,source.create,project.update,project.create"
+	if got := strings.Join(actions, ","); got != want {
+		t.Fatalf("expected actions %s, got %s", want, got)
+	}
+
+	update := body.Entries[2]
+	if !strings.Contains(string(update.Before), `"payments"`) || !strings.Contains(string(update.After), `"billing"`) {
+		t.Errorf("expected update diff, got before=%s after=%s", update.Before, update.After)
+	}
+	if source := string(body.Entries[1].After); strings.Contains(source, "hunter2") {
+		t.Errorf("expected client secret to be redacted, got %s", source)
+	}
+}
+
+func TestAudit_ExportNDJSON(t *testing.T) {
+	srv, _ := newTestServerWithStore(t)
+	doRequest(srv, http.MethodPost, "/api/v1/projects", `{"name":"a"}`)
+	doRequest(srv, http.MethodPost, "/api/v1/projects", `{"name":"b"}`)
+
+	w := doRequest(srv, http.MethodGet, "/api/v1/audit/export?action=project.create", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("expected NDJSON content type, got %q", ct)
+	}
+
+	lines := 0
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var e models.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", scanner.Text(), err)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("expected 2 exported entries, got %d", lines)
+	}
+}
+
+func TestAudit_InvalidQuery(t *testing.T) {
+	srv, _ := newTestServerWithStore(t)
+	for _, q := range []string{"since=yesterday", "until=2026-13-01", "limit=0", "limit=abc"} {
+		w := doRequest(srv, http.MethodGet, "/api/v1/audit?"+q, "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/auth"
+	"github.com/inelson/finguard/internal/budget"
+	"github.com/inelson/finguard/internal/enforcement"
+	"github.com/inelson/finguard/internal/models"
+)
+
+// budgetRequest is the body accepted when creating or replacing a budget.
+type budgetRequest struct {
+	CostSourceID *string                    `json:"costSourceId"`
+	Filter       models.CostFilter          `json:"filter"`
+	Period       models.BudgetPeriod        `json:"period"`
+	Amount       float64                    `json:"amount"`
+	Plan         []float64                  `json:"plan"`
+	Rollover     bool                       `json:"rollover"`
+	Thresholds   []float64                  `json:"thresholds"`
+	Enforcement  []models.EnforcementAction `json:"enforcement"`
+}
+
+// maxBudgetThreshold bounds alert tiers at ten times the budget amount.
+const maxBudgetThreshold = 10
+
+// @Summary      Create a budget
+// @Description  Create a monthly, quarterly or annual budget for the whole project, or for one of its cost sources when costSourceId is set.
+// @Description  filter narrows the counted spend by provider, service, category, region and labels.
+// @Description  plan optionally sets an amount for each period of the fiscal year, and rollover carries unspent balance into the next period.
+// @Description  enforcement lists Kubernetes actions taken when the budget is exceeded; setting it requires budgets:enforce.
+// @Tags         Budgets
+// @Accept       json
+// @Produce      json
+// @Param        projectID  path      string                                                                                                                                                                      true  "Project ID"
+// @Param        body       body      object{costSourceId=string,filter=models.CostFilter,period=string,amount=number,plan=[]number,rollover=boolean,thresholds=[]number,enforcement=[]models.EnforcementAction}  true  "Budget fields"
+// @Success      201        {object}  budget.Status
+// @Failure      400        {object}  object{error=string}
+// @Failure      403        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/budgets [post]
+func (s *Server) handleCreateBudget(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+
+	var req budgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	b := &models.Budget{ProjectID: projectID}
+	if !s.applyBudgetRequest(w, r, b, req) {
+		return
+	}
+
+	if err := s.store.CreateBudget(r.Context(), b); err != nil {
+		s.logger.Error("failed to create budget", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create budget"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "budget.create",
+		TargetType: audit.TargetBudget,
+		TargetID:   b.ID,
+		ProjectID:  projectID,
+		After:      b,
+	})
+
+	s.writeBudget(w, r, http.StatusCreated, b)
+}
+
+// @Summary      List budgets
+// @Description  Returns all budgets for a project with their current period's spend, utilization and projection
+// @Tags         Budgets
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Success      200        {object}  object{budgets=[]budget.Status}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/budgets [get]
+func (s *Server) handleListBudgets(w http.ResponseWriter, r *http.Request) {
+	budgets, err := s.store.ListBudgets(r.Context(), chi.URLParam(r, "projectID"))
+	if err != nil {
+		s.logger.Error("failed to list budgets", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list budgets"})
+		return
+	}
+
+	now := time.Now()
+	statuses := make([]*budget.Status, 0, len(budgets))
+	for _, b := range budgets {
+		status, err := s.budgetStatus(r, b, now)
+		if err != nil {
+			s.logger.Error("failed to compute budget spend", "budget", b.ID, "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list budgets"})
+			return
+		}
+		statuses = append(statuses, status)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"budgets": statuses})
+}
+
+// @Summary      Get a budget
+// @Description  Returns a budget with its current period's spend, utilization and projection
+// @Tags         Budgets
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Param        budgetID   path      string  true  "Budget ID"
+// @Success      200        {object}  budget.Status
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/budgets/{budgetID} [get]
+func (s *Server) handleGetBudget(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.loadBudget(w, r)
+	if !ok {
+		return
+	}
+	s.writeBudget(w, r, http.StatusOK, b)
+}
+
+// @Summary      Update a budget
+// @Description  Replace a budget's scope, filter, period, amounts, rollover and alert thresholds
+// @Tags         Budgets
+// @Accept       json
+// @Produce      json
+// @Param        projectID  path      string                                                                                                                                                                      true  "Project ID"
+// @Param        budgetID   path      string                                                                                                                                                                      true  "Budget ID"
+// @Param        body       body      object{costSourceId=string,filter=models.CostFilter,period=string,amount=number,plan=[]number,rollover=boolean,thresholds=[]number,enforcement=[]models.EnforcementAction}  true  "Budget fields"
+// @Success      200        {object}  budget.Status
+// @Failure      400        {object}  object{error=string}
+// @Failure      403        {object}  object{error=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/budgets/{budgetID} [put]
+func (s *Server) handleUpdateBudget(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.loadBudget(w, r)
+	if !ok {
+		return
+	}
+
+	var req budgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	before := *b
+	if !s.applyBudgetRequest(w, r, b, req) {
+		return
+	}
+
+	if err := s.store.UpdateBudget(r.Context(), b); err != nil {
+		s.logger.Error("failed to update budget", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update budget"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "budget.update",
+		TargetType: audit.TargetBudget,
+		TargetID:   b.ID,
+		ProjectID:  b.ProjectID,
+		Before:     before,
+		After:      b,
+	})
+
+	s.writeBudget(w, r, http.StatusOK, b)
+}
+
+// @Summary      Delete a budget
+// @Description  Delete a budget from a project
+// @Tags         Budgets
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Param        budgetID   path      string  true  "Budget ID"
+// @Success      200        {object}  object{status=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/budgets/{budgetID} [delete]
+func (s *Server) handleDeleteBudget(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.loadBudget(w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteBudget(r.Context(), b.ID); err != nil {
+		s.logger.Error("failed to delete budget", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete budget"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "budget.delete",
+		TargetType: audit.TargetBudget,
+		TargetID:   b.ID,
+		ProjectID:  b.ProjectID,
+		Before:     b,
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// @Summary      Acknowledge a budget alert
+// @Description  Silence the budget's current alert tier. Reminders stop, and the next event is sent only when spend reaches a higher tier or the period ends.
+// @Tags         Budgets
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Param        budgetID   path      string  true  "Budget ID"
+// @Success      200        {object}  models.BudgetAlertState
+// @Failure      404        {object}  object{error=string}
+// @Failure      409        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/budgets/{budgetID}/acknowledge [post]
+func (s *Server) handleAcknowledgeBudget(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.loadBudget(w, r)
+	if !ok {
+		return
+	}
+	var by string
+	if session := auth.UserFromContext(r.Context()); session != nil {
+		by = session.Email
+	}
+	state, err := budget.Acknowledge(r.Context(), s.store, b.ID, by)
+	if errors.Is(err, budget.ErrNothingToAcknowledge) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to acknowledge budget alert", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to acknowledge alert"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "budget.acknowledge",
+		TargetType: audit.TargetBudget,
+		TargetID:   b.ID,
+		ProjectID:  b.ProjectID,
+		After:      state,
+	})
+
+	writeJSON(w, http.StatusOK, state)
+}
+
+// loadBudget fetches the budget named by the URL and writes a 404 unless it
+// belongs to the project in the URL.
+func (s *Server) loadBudget(w http.ResponseWriter, r *http.Request) (*models.Budget, bool) {
+	b, err := s.store.GetBudget(r.Context(), chi.URLParam(r, "budgetID"))
+	if err != nil {
+		s.logger.Error("failed to get budget", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get budget"})
+		return nil, false
+	}
+	if b == nil || b.ProjectID != chi.URLParam(r, "projectID") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "budget not found"})
+		return nil, false
+	}
+	return b, true
+}
+
+// applyBudgetRequest validates req and copies it onto b, writing a 400 and
+// returning false when the request is invalid.
+func (s *Server) applyBudgetRequest(w http.ResponseWriter, r *http.Request, b *models.Budget, req budgetRequest) bool {
+	if req.Period == "" {
+		req.Period = models.BudgetMonthly
+	}
+	if !req.Period.Valid() {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "period must be monthly, quarterly or annual"})
+		return false
+	}
+	if len(req.Plan) > 0 {
+		if n := budget.PeriodsPerYear(req.Period); len(req.Plan) != n {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("a %s plan needs exactly %d amounts, one per period of the fiscal year", req.Period, n)})
+			return false
+		}
+		if slices.Min(req.Plan) < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "plan amounts must not be negative"})
+			return false
+		}
+	} else if req.Amount <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "amount must be greater than zero"})
+		return false
+	}
+	if req.Amount < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "amount must not be negative"})
+		return false
+	}
+	if len(req.Thresholds) == 0 {
+		req.Thresholds = models.DefaultBudgetThresholds
+	}
+	thresholds := slices.Clone(req.Thresholds)
+	slices.Sort(thresholds)
+	thresholds = slices.Compact(thresholds)
+	if thresholds[0] <= 0 || thresholds[len(thresholds)-1] > maxBudgetThreshold {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "thresholds must be greater than 0 and at most 10"})
+		return false
+	}
+	for _, action := range req.Enforcement {
+		if err := enforcement.Validate(action); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return false
+		}
+	}
+	if !reflect.DeepEqual(req.Enforcement, b.Enforcement) && (len(req.Enforcement) > 0 || len(b.Enforcement) > 0) &&
+		!s.rbac.Authorize(r, b.ProjectID, models.PermBudgetsEnforce) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "changing enforcement actions requires " + string(models.PermBudgetsEnforce)})
+		return false
+	}
+	if err := validateCostFilter(req.Filter); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	if err := enforcement.CheckNamespaces(r.Context(), s.store, b.ProjectID, req.Enforcement); err != nil {
+		if !errors.Is(err, enforcement.ErrNamespaceNotOwned) {
+			s.logger.Error("failed to check enforcement namespaces", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save budget"})
+			return false
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	if req.CostSourceID != nil && *req.CostSourceID == "" {
+		req.CostSourceID = nil
+	}
+	if req.CostSourceID != nil {
+		cs, err := s.store.GetCostSource(r.Context(), *req.CostSourceID)
+		if err != nil {
+			s.logger.Error("failed to get cost source", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save budget"})
+			return false
+		}
+		if cs == nil || cs.ProjectID != b.ProjectID {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "costSourceId must name a cost source in this project"})
+			return false
+		}
+	}
+
+	b.CostSourceID = req.CostSourceID
+	b.Filter = req.Filter
+	b.Period = req.Period
+	b.Amount = req.Amount
+	b.Plan = req.Plan
+	b.Rollover = req.Rollover
+	b.Thresholds = thresholds
+	b.Enforcement = req.Enforcement
+	return true
+}
+
+func (s *Server) writeBudget(w http.ResponseWriter, r *http.Request, code int, b *models.Budget) {
+	status, err := s.budgetStatus(r, b, time.Now())
+	if err != nil {
+		s.logger.Error("failed to compute budget spend", "budget", b.ID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to compute budget spend"})
+		return
+	}
+	writeJSON(w, code, status)
+}
+
+// budgetStatus evaluates b and attaches its alert state when the alert
+// belongs to the current period.
+func (s *Server) budgetStatus(r *http.Request, b *models.Budget, now time.Time) (*budget.Status, error) {
+	status, err := budget.Evaluate(r.Context(), s.store, b, s.cfg.FiscalYearStartMonth, now)
+	if err != nil {
+		return nil, err
+	}
+	alert, err := s.store.GetBudgetAlertState(r.Context(), b.ID)
+	if err != nil {
+		return nil, err
+	}
+	if alert != nil && alert.PeriodStart.Equal(status.PeriodStart) {
+		status.Alert = alert
+	}
+	return status, nil
+}
+
+// @Summary      List budget enforcements
+// @Description  Returns the enforcement actions run for a budget, oldest first, including dry runs, failures and reverted actions.
+// @Tags         Budgets
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Param        budgetID   path      string  true  "Budget ID"
+// @Success      200        {object}  object{enforcements=[]models.BudgetEnforcement}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/budgets/{budgetID}/enforcements [get]
+func (s *Server) handleListBudgetEnforcements(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.loadBudget(w, r)
+	if !ok {
+		return
+	}
+	enforcements, err := s.store.ListBudgetEnforcements(r.Context(), b.ID)
+	if err != nil {
+		s.logger.Error("failed to list budget enforcements", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list enforcements"})
+		return
+	}
+	if enforcements == nil {
+		enforcements = []*models.BudgetEnforcement{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"enforcements": enforcements})
+}
+
+// @Summary      Revert budget enforcements
+// @Description  Undo every enforcement action of the budget that is still in effect, restoring the quotas, replicas and annotations it replaced.
+// @Tags         Budgets
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Param        budgetID   path      string  true  "Budget ID"
+// @Success      200        {object}  object{reverted=[]models.BudgetEnforcement}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Failure      503        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/budgets/{budgetID}/enforcements/revert [post]
+func (s *Server) handleRevertBudgetEnforcements(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.loadBudget(w, r)
+	if !ok {
+		return
+	}
+	if s.enforcer == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "budget enforcement is not available without a Kubernetes connection"})
+		return
+	}
+	reverted, err := s.enforcer.Revert(r.Context(), b.ID, auth.AuditActor(r))
+	if err != nil {
+		s.logger.Error("failed to revert budget enforcements", "budget", b.ID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to revert some enforcement actions", "reverted": reverted})
+		return
+	}
+	if reverted == nil {
+		reverted = []*models.BudgetEnforcement{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"reverted": reverted})
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/inelson/finguard/internal/budget"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+)
+
+func setupBudgetProject(t *testing.T, st store.Store) (*models.Project, *models.CostSource, *models.CostSource) {
+	t.Helper()
+	ctx := context.Background()
+	project := &models.Project{Name: "payments"}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	aws := &models.CostSource{ProjectID: project.ID, Type: models.CostSourceAWS, Name: "aws", Enabled: true}
+	k8s := &models.CostSource{ProjectID: project.ID, Type: models.CostSourceKubernetes, Name: "k8s", Enabled: true,
+		Config: json.RawMessage(`{"clusterName":"dev","opencostUrl":"http://opencost","namespaces":["team-a"]}`)}
+	for _, cs := range []*models.CostSource{aws, k8s} {
+		if err := st.CreateCostSource(ctx, cs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	records := []*models.CostRecord{
+		{ProjectID: project.ID, CostSourceID: aws.ID, Provider: "aws", Service: "ec2", StartTime: monthStart, EndTime: monthStart.Add(time.Hour), NetCost: 30},
+		{ProjectID: project.ID, CostSourceID: k8s.ID, Provider: "kubernetes", Service: "compute", StartTime: monthStart, EndTime: monthStart.Add(time.Hour), NetCost: 20},
+		// Last month's spend must not count towards the current period.
+		{ProjectID: project.ID, CostSourceID: aws.ID, Provider: "aws", Service: "ec2", StartTime: monthStart.AddDate(0, -1, 0), EndTime: monthStart.AddDate(0, -1, 0).Add(time.Hour), NetCost: 500},
+	}
+	if err := st.InsertCostRecords(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+	return project, aws, k8s
+}
+
+func TestBudgets_CRUDWithSpend(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, aws, _ := setupBudgetProject(t, st)
+	base := "/api/v1/projects/" + project.ID + "/budgets"
+
+	w := doRequest(srv, http.MethodPost, base, `{"amount":100}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create project budget: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var projectBudget budget.Status
+	json.NewDecoder(w.Body).Decode(&projectBudget)
+	if projectBudget.CurrentSpend != 50 || projectBudget.Utilization != 0.5 || len(projectBudget.Thresholds) != len(models.DefaultBudgetThresholds) {
+		t.Errorf("project budget: expected spend 50 at 50%% with default thresholds, got %+v", projectBudget)
+	}
+
+	w = doRequest(srv, http.MethodPost, base, `{"costSourceId":"`+aws.ID+`","amount":40,"thresholds":[1,0.9,0.9]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create source budget: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var sourceBudget budget.Status
+	json.NewDecoder(w.Body).Decode(&sourceBudget)
+	if sourceBudget.CurrentSpend != 30 || math.Abs(sourceBudget.Utilization-0.75) > 1e-9 || !slices.Equal(sourceBudget.Thresholds, []float64{0.9, 1}) {
+		t.Errorf("source budget: expected spend 30 at 75%% with sorted thresholds, got %+v", sourceBudget)
+	}
+
+	w = doRequest(srv, http.MethodGet, base, "")
+	var list struct {
+		Budgets []budget.Status `json:"budgets"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Budgets) != 2 {
+		t.Fatalf("expected 2 budgets, got %d", len(list.Budgets))
+	}
+
+	w = doRequest(srv, http.MethodPut, base+"/"+sourceBudget.ID, `{"amount":25}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update budget: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var updated budget.Status
+	json.NewDecoder(w.Body).Decode(&updated)
+	if updated.CostSourceID != nil || updated.CurrentSpend != 50 || updated.Utilization != 2 {
+		t.Errorf("expected the budget to widen to the project at 200%%, got %+v", updated)
+	}
+
+	if w = doRequest(srv, http.MethodGet, "/api/v1/projects/other/budgets/"+sourceBudget.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("get budget through another project: expected 404, got %d", w.Code)
+	}
+	if w = doRequest(srv, http.MethodDelete, base+"/"+sourceBudget.ID, ""); w.Code != http.StatusOK {
+		t.Errorf("delete budget: expected 200, got %d", w.Code)
+	}
+	if w = doRequest(srv, http.MethodGet, base+"/"+sourceBudget.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("get deleted budget: expected 404, got %d", w.Code)
+	}
+
+	entries, _ := st.ListAuditEntries(context.Background(), store.AuditQuery{TargetType: "budget"})
+	if len(entries) != 4 {
+		t.Errorf("expected 4 budget audit entries, got %d", len(entries))
+	}
+}
+
+func TestBudgets_Validation(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	other := &models.Project{Name: "other"}
+	st.CreateProject(context.Background(), other)
+	foreign := &models.CostSource{ProjectID: other.ID, Type: models.CostSourceAWS, Name: "foreign"}
+	st.CreateCostSource(context.Background(), foreign)
+	base := "/api/v1/projects/" + project.ID + "/budgets"
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{}`, http.StatusBadRequest},
+		{`{"amount":-5}`, http.StatusBadRequest},
+		{`{"amount":100,"thresholds":[0,1]}`, http.StatusBadRequest},
+		{`{"amount":100,"thresholds":[1,11]}`, http.StatusBadRequest},
+		{`{"amount":100,"costSourceId":"missing"}`, http.StatusBadRequest},
+		{`{"amount":100,"costSourceId":"` + foreign.ID + `"}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+		{`{"amount":100,"period":"weekly"}`, http.StatusBadRequest},
+		{`{"amount":100,"costSourceId":""}`, http.StatusCreated},
+		{`{"amount":100,"period":"quarterly"}`, http.StatusCreated},
+		{`{"plan":[100,100,100]}`, http.StatusBadRequest},
+		{`{"period":"quarterly","plan":[100,100,-1,100]}`, http.StatusBadRequest},
+		{`{"amount":-1,"period":"quarterly","plan":[100,100,100,100]}`, http.StatusBadRequest},
+		{`{"period":"quarterly","plan":[100,0,300,100],"rollover":true}`, http.StatusCreated},
+		{`{"period":"annual","plan":[1200]}`, http.StatusCreated},
+		{`{"amount":100,"filter":{"labels":{" ":"prod"}}}`, http.StatusBadRequest},
+		{`{"amount":100,"filter":{"service":"ec2","labels":{"env":"prod"}}}`, http.StatusCreated},
+		{`{"amount":100,"enforcement":[{"type":"scaleToZero","namespace":"team-a"}]}`, http.StatusBadRequest},
+		{`{"amount":100,"enforcement":[{"type":"evict","namespace":"team-a"}]}`, http.StatusBadRequest},
+		{`{"amount":100,"enforcement":[{"type":"annotate","namespace":"team-a","annotations":{"finguard.io/budget":"exceeded"},"dryRun":true}]}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		if w := doRequest(srv, http.MethodPost, base, tt.body); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.body, tt.want, w.Code)
+		}
+	}
+}
+
+func TestBudgets_Plan(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	base := "/api/v1/projects/" + project.ID + "/budgets"
+
+	w := doRequest(srv, http.MethodPost, base, `{"plan":[10,20,30,40,50,60,70,80,90,100,110,120],"rollover":true}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var status budget.Status
+	json.NewDecoder(w.Body).Decode(&status)
+	want := float64(10 * time.Now().UTC().Month())
+	if len(status.Plan) != 12 || !status.Rollover || status.PlannedAmount != want || status.EffectiveAmount < want {
+		t.Errorf("expected this month's planned amount of %v, got %+v", want, status)
+	}
+
+	w = doRequest(srv, http.MethodGet, base+"/"+status.ID, "")
+	var got budget.Status
+	json.NewDecoder(w.Body).Decode(&got)
+	if !slices.Equal(got.Plan, status.Plan) || !got.Rollover {
+		t.Errorf("expected the plan to round-trip, got %+v", got)
+	}
+}
+
+func TestBudgets_Filter(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	base := "/api/v1/projects/" + project.ID + "/budgets"
+
+	w := doRequest(srv, http.MethodPost, base, `{"amount":100,"filter":{"provider":"kubernetes"}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var status budget.Status
+	json.NewDecoder(w.Body).Decode(&status)
+	if status.Filter.Provider != "kubernetes" || status.CurrentSpend != 20 {
+		t.Errorf("expected only kubernetes spend of 20, got %+v", status)
+	}
+
+	w = doRequest(srv, http.MethodPut, base+"/"+status.ID, `{"amount":100,"filter":{"service":"ec2"}}`)
+	var updated budget.Status
+	json.NewDecoder(w.Body).Decode(&updated)
+	if updated.Filter.Provider != "" || updated.Filter.Service != "ec2" || updated.CurrentSpend != 30 {
+		t.Errorf("expected the filter to be replaced with ec2 spend of 30, got %+v", updated)
+	}
+}
+
+func TestBudgets_Enforcements(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	base := "/api/v1/projects/" + project.ID + "/budgets"
+
+	w := doRequest(srv, http.MethodPost, base, `{"amount":100,"enforcement":[{"type":"resourceQuota","namespace":"team-a","hard":{"pods":"5"}}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var status budget.Status
+	json.NewDecoder(w.Body).Decode(&status)
+	if len(status.Enforcement) != 1 || status.Enforcement[0].Hard["pods"] != "5" {
+		t.Errorf("expected the enforcement action to be saved, got %+v", status.Enforcement)
+	}
+
+	rec := &models.BudgetEnforcement{BudgetID: status.ID, ProjectID: project.ID, Action: status.Enforcement[0], Status: models.EnforcementApplied}
+	if err := st.CreateBudgetEnforcement(context.Background(), rec); err != nil {
+		t.Fatal(err)
+	}
+	w = doRequest(srv, http.MethodGet, base+"/"+status.ID+"/enforcements", "")
+	var list struct {
+		Enforcements []models.BudgetEnforcement `json:"enforcements"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	if w.Code != http.StatusOK || len(list.Enforcements) != 1 || list.Enforcements[0].ID != rec.ID {
+		t.Errorf("expected the enforcement record to be listed, got %d: %+v", w.Code, list)
+	}
+
+	// Another project cannot act on a namespace this project owns, even by
+	// filtering its budget on it.
+	other := &models.Project{Name: "search"}
+	if err := st.CreateProject(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+	otherBase := "/api/v1/projects/" + other.ID + "/budgets"
+	for _, body := range []string{
+		`{"amount":100,"enforcement":[{"type":"resourceQuota","namespace":"team-a","hard":{"pods":"5"}}]}`,
+		`{"amount":100,"filter":{"labels":{"namespace":"team-a"}},"enforcement":[{"type":"resourceQuota","namespace":"team-a","hard":{"pods":"5"}}]}`,
+	} {
+		if w := doRequest(srv, http.MethodPost, otherBase, body); w.Code != http.StatusBadRequest {
+			t.Errorf("enforcement on another project's namespace: expected 400, got %d: %s", w.Code, w.Body)
+		}
+	}
+
+	// The test server has no cluster connection.
+	if w := doRequest(srv, http.MethodPost, base+"/"+status.ID+"/enforcements/revert", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("revert without a cluster: expected 503, got %d", w.Code)
+	}
+	if w := doRequest(srv, http.MethodGet, base+"/missing/enforcements", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown budget: expected 404, got %d", w.Code)
+	}
+}
+
+func TestBudgets_Acknowledge(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	base := "/api/v1/projects/" + project.ID + "/budgets"
+
+	w := doRequest(srv, http.MethodPost, base, `{"amount":60}`)
+	var b budget.Status
+	json.NewDecoder(w.Body).Decode(&b)
+
+	if w = doRequest(srv, http.MethodPost, base+"/"+b.ID+"/acknowledge", ""); w.Code != http.StatusConflict {
+		t.Fatalf("acknowledge before any alert: expected 409, got %d", w.Code)
+	}
+
+	budget.NewEvaluator(st, nil, budget.Config{}, testLogger()).Run(context.Background())
+
+	w = doRequest(srv, http.MethodPost, base+"/"+b.ID+"/acknowledge", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("acknowledge: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var state models.BudgetAlertState
+	json.NewDecoder(w.Body).Decode(&state)
+	if state.Tier != 0.8 || state.AcknowledgedTier != 0.8 {
+		t.Errorf("expected the 80%% tier to be acknowledged, got %+v", state)
+	}
+
+	w = doRequest(srv, http.MethodGet, base+"/"+b.ID, "")
+	json.NewDecoder(w.Body).Decode(&b)
+	if b.Alert == nil || b.Alert.AcknowledgedTier != 0.8 {
+		t.Errorf("expected the alert state in the budget response, got %+v", b.Alert)
+	}
+}
@@ -0,0 +1,403 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/notify"
+	"github.com/inelson/finguard/pkg/event"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+// channelRequest is the body accepted when creating or replacing a
+// notification channel.
+type channelRequest struct {
+	Type     models.NotificationChannelType `json:"type"`
+	Name     string                         `json:"name"`
+	Config   json.RawMessage                `json:"config"`
+	Topics   []string                       `json:"topics"`
+	Template string                         `json:"template"`
+	Enabled  *bool                          `json:"enabled"`
+}
+
+// @Summary      Create a notification channel
+// @Description  Add a Slack, Teams, email or webhook channel that receives the project's events on the subscribed topics.
+// @Description  template is an optional Go text/template replacing the default message; it is executed with Topic, Type, Source, Timestamp, Project and the decoded event Payload.
+// @Tags         Notifications
+// @Accept       json
+// @Produce      json
+// @Param        projectID  path      string                                                                                      true  "Project ID"
+// @Param        body       body      object{type=string,name=string,config=object,topics=[]string,template=string,enabled=bool}  true  "Channel fields"
+// @Success      201        {object}  models.NotificationChannel
+// @Failure      400        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/notification-channels [post]
+func (s *Server) handleCreateChannel(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+
+	var req channelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	c := &models.NotificationChannel{ProjectID: projectID, Enabled: true}
+	if !applyChannelRequest(w, c, req) {
+		return
+	}
+
+	if err := s.store.CreateNotificationChannel(r.Context(), c); err != nil {
+		s.logger.Error("failed to create notification channel", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create notification channel"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "notification_channel.create",
+		TargetType: audit.TargetChannel,
+		TargetID:   c.ID,
+		ProjectID:  projectID,
+		After:      notify.Redact(c),
+	})
+
+	writeJSON(w, http.StatusCreated, notify.Redact(c))
+}
+
+// @Summary      List notification channels
+// @Description  Returns all notification channels of a project, with webhook URLs and signing secrets redacted
+// @Tags         Notifications
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Success      200        {object}  object{channels=[]models.NotificationChannel}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/notification-channels [get]
+func (s *Server) handleListChannels(w http.ResponseWriter, r *http.Request) {
+	channels, err := s.store.ListNotificationChannels(r.Context(), chi.URLParam(r, "projectID"))
+	if err != nil {
+		s.logger.Error("failed to list notification channels", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list notification channels"})
+		return
+	}
+	redacted := make([]*models.NotificationChannel, len(channels))
+	for i, c := range channels {
+		redacted[i] = notify.Redact(c)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"channels": redacted})
+}
+
+// @Summary      Get a notification channel
+// @Description  Returns a single notification channel by ID, with webhook URLs and signing secrets redacted
+// @Tags         Notifications
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Param        channelID  path      string  true  "Channel ID"
+// @Success      200        {object}  models.NotificationChannel
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/notification-channels/{channelID} [get]
+func (s *Server) handleGetChannel(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.loadChannel(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, notify.Redact(c))
+}
+
+// @Summary      Update a notification channel
+// @Description  Replace a notification channel's type, name, config, topics, template and enabled flag
+// @Tags         Notifications
+// @Accept       json
+// @Produce      json
+// @Param        projectID  path      string                                                                                      true  "Project ID"
+// @Param        channelID  path      string                                                                                      true  "Channel ID"
+// @Param        body       body      object{type=string,name=string,config=object,topics=[]string,template=string,enabled=bool}  true  "Channel fields"
+// @Success      200        {object}  models.NotificationChannel
+// @Failure      400        {object}  object{error=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/notification-channels/{channelID} [put]
+func (s *Server) handleUpdateChannel(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.loadChannel(w, r)
+	if !ok {
+		return
+	}
+
+	var req channelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	before := *c
+	if !applyChannelRequest(w, c, req) {
+		return
+	}
+
+	if err := s.store.UpdateNotificationChannel(r.Context(), c); err != nil {
+		s.logger.Error("failed to update notification channel", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update notification channel"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "notification_channel.update",
+		TargetType: audit.TargetChannel,
+		TargetID:   c.ID,
+		ProjectID:  c.ProjectID,
+		Before:     notify.Redact(&before),
+		After:      notify.Redact(c),
+	})
+
+	writeJSON(w, http.StatusOK, notify.Redact(c))
+}
+
+// @Summary      Delete a notification channel
+// @Description  Remove a notification channel from a project
+// @Tags         Notifications
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Param        channelID  path      string  true  "Channel ID"
+// @Success      200        {object}  object{status=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/notification-channels/{channelID} [delete]
+func (s *Server) handleDeleteChannel(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.loadChannel(w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteNotificationChannel(r.Context(), c.ID); err != nil {
+		s.logger.Error("failed to delete notification channel", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete notification channel"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "notification_channel.delete",
+		TargetType: audit.TargetChannel,
+		TargetID:   c.ID,
+		ProjectID:  c.ProjectID,
+		Before:     notify.Redact(c),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// @Summary      Test a notification channel
+// @Description  Send a test message through the channel, whatever its topics, and report whether delivery succeeded.
+// @Tags         Notifications
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Param        channelID  path      string  true  "Channel ID"
+// @Success      200        {object}  object{status=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      502        {object}  object{error=string}
+// @Failure      503        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/notification-channels/{channelID}/test [post]
+func (s *Server) handleTestChannel(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.loadChannel(w, r)
+	if !ok {
+		return
+	}
+	if s.notifier == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "notifications are not available"})
+		return
+	}
+	e, err := event.New("test", notify.TopicTest, "finguard", map[string]string{"projectId": c.ProjectID})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to build test event"})
+		return
+	}
+	if _, err := s.notifier.Send(r.Context(), c, e); err != nil {
+		s.logger.Warn("notification channel test failed", "channel", c.ID, "error", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "delivery failed: " + err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+}
+
+// @Summary      List notification deliveries
+// @Description  Returns a channel's most recent deliveries from the outbox, newest first, with their status, attempt count, next attempt and last error.
+// @Tags         Notifications
+// @Produce      json
+// @Param        projectID  path      string  true   "Project ID"
+// @Param        channelID  path      string  true   "Channel ID"
+// @Param        limit      query     int     false  "Maximum deliveries to return (default 50, max 500)"
+// @Success      200        {object}  object{deliveries=[]models.NotificationDelivery}
+// @Failure      400        {object}  object{error=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/notification-channels/{channelID}/deliveries [get]
+func (s *Server) handleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.loadChannel(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultDeliveryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid limit: must be a positive integer"})
+			return
+		}
+		limit = min(n, maxDeliveryLimit)
+	}
+
+	deliveries, err := s.store.ListNotificationDeliveries(r.Context(), c.ID, limit)
+	if err != nil {
+		s.logger.Error("failed to list notification deliveries", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list notification deliveries"})
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*models.NotificationDelivery{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"deliveries": deliveries})
+}
+
+// @Summary      Get a notification delivery
+// @Description  Returns a delivery with every attempt made at it: status code, latency, the start of the response and any error.
+// @Tags         Notifications
+// @Produce      json
+// @Param        projectID   path      string  true  "Project ID"
+// @Param        channelID   path      string  true  "Channel ID"
+// @Param        deliveryID  path      string  true  "Delivery ID"
+// @Success      200         {object}  object{delivery=models.NotificationDelivery,attempts=[]models.DeliveryAttempt}
+// @Failure      404         {object}  object{error=string}
+// @Failure      500         {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/notification-channels/{channelID}/deliveries/{deliveryID} [get]
+func (s *Server) handleGetDelivery(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.loadDelivery(w, r)
+	if !ok {
+		return
+	}
+	attempts, err := s.store.ListDeliveryAttempts(r.Context(), d.ID)
+	if err != nil {
+		s.logger.Error("failed to list delivery attempts", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list delivery attempts"})
+		return
+	}
+	if attempts == nil {
+		attempts = []*models.DeliveryAttempt{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"delivery": d, "attempts": attempts})
+}
+
+// @Summary      Redeliver a notification
+// @Description  Put a delivery back in the outbox with a fresh set of attempts, whether it was delivered, dead-lettered or is still pending.
+// @Tags         Notifications
+// @Produce      json
+// @Param        projectID   path      string  true  "Project ID"
+// @Param        channelID   path      string  true  "Channel ID"
+// @Param        deliveryID  path      string  true  "Delivery ID"
+// @Success      202         {object}  models.NotificationDelivery
+// @Failure      404         {object}  object{error=string}
+// @Failure      500         {object}  object{error=string}
+// @Failure      503         {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/notification-channels/{channelID}/deliveries/{deliveryID}/redeliver [post]
+func (s *Server) handleRedeliver(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.loadDelivery(w, r)
+	if !ok {
+		return
+	}
+	if s.notifier == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "notifications are not available"})
+		return
+	}
+	before := *d
+	d, err := s.notifier.Redeliver(r.Context(), d.ID)
+	if err != nil || d == nil {
+		s.logger.Error("failed to redeliver notification", "delivery", before.ID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to redeliver notification"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "notification_delivery.redeliver",
+		TargetType: audit.TargetDelivery,
+		TargetID:   d.ID,
+		ProjectID:  d.ProjectID,
+		Before:     map[string]any{"status": before.Status, "attempts": before.Attempts},
+		After:      map[string]any{"status": d.Status, "attempts": d.Attempts},
+	})
+
+	writeJSON(w, http.StatusAccepted, d)
+}
+
+// loadChannel fetches the channel named by the URL and writes a 404 unless it
+// belongs to the project in the URL.
+func (s *Server) loadChannel(w http.ResponseWriter, r *http.Request) (*models.NotificationChannel, bool) {
+	c, err := s.store.GetNotificationChannel(r.Context(), chi.URLParam(r, "channelID"))
+	if err != nil {
+		s.logger.Error("failed to get notification channel", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get notification channel"})
+		return nil, false
+	}
+	if c == nil || c.ProjectID != chi.URLParam(r, "projectID") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "notification channel not found"})
+		return nil, false
+	}
+	return c, true
+}
+
+// applyChannelRequest validates req and copies it onto c, writing a 400 and
+// returning false when the request is invalid. Secret config fields sent back
+// redacted keep their stored values.
+func applyChannelRequest(w http.ResponseWriter, c *models.NotificationChannel, req channelRequest) bool {
+	if req.Name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name is required"})
+		return false
+	}
+	next := *c
+	next.Type = req.Type
+	next.Name = req.Name
+	next.Config = req.Config
+	next.Topics = req.Topics
+	next.Template = req.Template
+	if req.Enabled != nil {
+		next.Enabled = *req.Enabled
+	}
+	notify.KeepSecrets(&next, c)
+	if err := notify.Validate(&next); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	*c = next
+	return true
+}
+
+// loadDelivery fetches the delivery named by the URL and writes a 404 unless
+// it belongs to the channel and project in the URL.
+func (s *Server) loadDelivery(w http.ResponseWriter, r *http.Request) (*models.NotificationDelivery, bool) {
+	c, ok := s.loadChannel(w, r)
+	if !ok {
+		return nil, false
+	}
+	d, err := s.store.GetNotificationDelivery(r.Context(), chi.URLParam(r, "deliveryID"))
+	if err != nil {
+		s.logger.Error("failed to get notification delivery", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get notification delivery"})
+		return nil, false
+	}
+	if d == nil || d.ChannelID != c.ID {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "notification delivery not found"})
+		return nil, false
+	}
+	return d, true
+}
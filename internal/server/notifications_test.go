@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/notify"
+)
+
+func TestNotificationChannels_CRUD(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	base := "/api/v1/projects/" + project.ID + "/notification-channels"
+
+	w := doRequest(srv, http.MethodPost, base, `{"type":"slack","name":"alerts","config":{"webhookUrl":"https://hooks.slack.com/services/x"},"topics":["budget.exceeded"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var created models.NotificationChannel
+	json.NewDecoder(w.Body).Decode(&created)
+	if !created.Enabled || created.ProjectID != project.ID {
+		t.Errorf("expected an enabled channel in the project, got %+v", created)
+	}
+
+	w = doRequest(srv, http.MethodPut, base+"/"+created.ID, `{"type":"slack","name":"alerts","config":{"webhookUrl":"https://hooks.slack.com/services/y"},"topics":["budget.exceeded","collection.failed"],"enabled":false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var updated models.NotificationChannel
+	json.NewDecoder(doRequest(srv, http.MethodGet, base+"/"+created.ID, "").Body).Decode(&updated)
+	if updated.Enabled || len(updated.Topics) != 2 {
+		t.Errorf("expected a disabled channel with two topics, got %+v", updated)
+	}
+
+	var list struct {
+		Channels []models.NotificationChannel `json:"channels"`
+	}
+	json.NewDecoder(doRequest(srv, http.MethodGet, base, "").Body).Decode(&list)
+	if len(list.Channels) != 1 {
+		t.Errorf("expected 1 channel, got %d", len(list.Channels))
+	}
+
+	if w := doRequest(srv, http.MethodDelete, base+"/"+created.ID, ""); w.Code != http.StatusOK {
+		t.Errorf("delete: expected 200, got %d", w.Code)
+	}
+	if w := doRequest(srv, http.MethodGet, base+"/"+created.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete: expected 404, got %d", w.Code)
+	}
+}
+
+func TestNotificationChannels_RedactsSecrets(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	base := "/api/v1/projects/" + project.ID + "/notification-channels"
+
+	w := doRequest(srv, http.MethodPost, base, `{"type":"webhook","name":"hook","config":{"url":"https://example.com/hook?token=abc","secret":"s3cret"},"topics":["budget.exceeded"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var created models.NotificationChannel
+	json.NewDecoder(w.Body).Decode(&created)
+
+	var list struct {
+		Channels []json.RawMessage `json:"channels"`
+	}
+	json.NewDecoder(doRequest(srv, http.MethodGet, base, "").Body).Decode(&list)
+	responses := map[string]string{
+		"create": w.Body.String(),
+		"get":    doRequest(srv, http.MethodGet, base+"/"+created.ID, "").Body.String(),
+	}
+	if len(list.Channels) == 1 {
+		responses["list"] = string(list.Channels[0])
+	}
+	// Saving the channel as read back keeps its secrets.
+	w = doRequest(srv, http.MethodPut, base+"/"+created.ID, `{"type":"webhook","name":"renamed","config":{"url":"[REDACTED]","secret":"[REDACTED]"},"topics":["budget.exceeded"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	responses["update"] = w.Body.String()
+	for name, body := range responses {
+		if strings.Contains(body, "s3cret") || strings.Contains(body, "token=abc") {
+			t.Errorf("%s: expected the secret and URL to be redacted, got %s", name, body)
+		}
+	}
+
+	stored, err := st.GetNotificationChannel(context.Background(), created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg models.WebhookChannelConfig
+	json.Unmarshal(stored.Config, &cfg)
+	if cfg.URL != "https://example.com/hook?token=abc" || cfg.Secret != "s3cret" || stored.Name != "renamed" {
+		t.Errorf("expected the stored secrets to be kept, got %+v %q", cfg, stored.Name)
+	}
+}
+
+func TestNotificationChannels_Validation(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	base := "/api/v1/projects/" + project.ID + "/notification-channels"
+
+	for _, body := range []string{
+		`{"type":"slack","config":{"webhookUrl":"https://hooks.slack.com/x"},"topics":["budget.exceeded"]}`,
+		`{"type":"slack","name":"a","config":{"webhookUrl":"http://hooks.slack.com/x"},"topics":["budget.exceeded"]}`,
+		`{"type":"webhook","name":"a","config":{"url":"https://example.com"},"topics":["budget.exceeded"]}`,
+		`{"type":"email","name":"a","config":{"to":[]},"topics":["budget.exceeded"]}`,
+		`{"type":"teams","name":"a","config":{"webhookUrl":"https://example.com"},"topics":[]}`,
+		`{"type":"sms","name":"a","config":{},"topics":["budget.exceeded"]}`,
+	} {
+		if w := doRequest(srv, http.MethodPost, base, body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestNotificationChannels_Test(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	base := "/api/v1/projects/" + project.ID + "/notification-channels"
+
+	var got string
+	hook := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&body)
+		got = body.Text
+		if strings.HasSuffix(r.URL.Path, "/revoked") {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer hook.Close()
+
+	create := func(path string) string {
+		w := doRequest(srv, http.MethodPost, base, `{"type":"slack","name":"`+path+`","config":{"webhookUrl":"`+hook.URL+"/"+path+`"},"topics":["budget.exceeded"]}`)
+		var c models.NotificationChannel
+		json.NewDecoder(w.Body).Decode(&c)
+		return c.ID
+	}
+	ok, revoked := create("ok"), create("revoked")
+
+	if w := doRequest(srv, http.MethodPost, base+"/"+ok+"/test", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("without a notifier: expected 503, got %d", w.Code)
+	}
+
+	srv.notifier = notify.New(st, notify.Config{HTTPClient: hook.Client()}, testLogger())
+	if w := doRequest(srv, http.MethodPost, base+"/"+ok+"/test", ""); w.Code != http.StatusOK {
+		t.Errorf("test: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if got != "Test notification from FinGuard for project payments." {
+		t.Errorf("unexpected test message %q", got)
+	}
+	if w := doRequest(srv, http.MethodPost, base+"/"+revoked+"/test", ""); w.Code != http.StatusBadGateway {
+		t.Errorf("failing channel: expected 502, got %d", w.Code)
+	}
+}
+
+func TestNotificationDeliveries(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	other := &models.Project{Name: "search"}
+	st.CreateProject(context.Background(), other)
+	base := "/api/v1/projects/" + project.ID + "/notification-channels"
+
+	w := doRequest(srv, http.MethodPost, base, `{"type":"webhook","name":"hook","config":{"url":"https://example.com/hook","secret":"s"},"topics":["budget.exceeded"]}`)
+	var c models.NotificationChannel
+	json.NewDecoder(w.Body).Decode(&c)
+
+	d := &models.NotificationDelivery{ChannelID: c.ID, ProjectID: project.ID, Topic: "budget.exceeded", Event: json.RawMessage(`{}`), Status: models.DeliveryDead, Attempts: 8, LastError: "example.com returned 500"}
+	if err := st.CreateNotificationDeliveries(context.Background(), []*models.NotificationDelivery{d}); err != nil {
+		t.Fatal(err)
+	}
+	st.CreateDeliveryAttempt(context.Background(), &models.DeliveryAttempt{DeliveryID: d.ID, Attempt: 8, StatusCode: 500, LatencyMs: 12, Response: "oops", Error: "example.com returned 500"})
+
+	var list struct {
+		Deliveries []models.NotificationDelivery `json:"deliveries"`
+	}
+	json.NewDecoder(doRequest(srv, http.MethodGet, base+"/"+c.ID+"/deliveries", "").Body).Decode(&list)
+	if len(list.Deliveries) != 1 || list.Deliveries[0].Status != models.DeliveryDead {
+		t.Fatalf("expected the dead delivery, got %+v", list.Deliveries)
+	}
+	if w := doRequest(srv, http.MethodGet, base+"/"+c.ID+"/deliveries?limit=0", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("limit=0: expected 400, got %d", w.Code)
+	}
+
+	var detail struct {
+		Delivery models.NotificationDelivery `json:"delivery"`
+		Attempts []models.DeliveryAttempt    `json:"attempts"`
+	}
+	json.NewDecoder(doRequest(srv, http.MethodGet, base+"/"+c.ID+"/deliveries/"+d.ID, "").Body).Decode(&detail)
+	if detail.Delivery.ID != d.ID || len(detail.Attempts) != 1 || detail.Attempts[0].Response != "oops" {
+		t.Errorf("unexpected delivery detail %+v", detail)
+	}
+	if w := doRequest(srv, http.MethodGet, "/api/v1/projects/"+other.ID+"/notification-channels/"+c.ID+"/deliveries/"+d.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("other project: expected 404, got %d", w.Code)
+	}
+
+	redeliver := base + "/" + c.ID + "/deliveries/" + d.ID + "/redeliver"
+	if w := doRequest(srv, http.MethodPost, redeliver, ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("without a notifier: expected 503, got %d", w.Code)
+	}
+	srv.notifier = notify.New(st, notify.Config{}, testLogger())
+	if w := doRequest(srv, http.MethodPost, redeliver, ""); w.Code != http.StatusAccepted {
+		t.Fatalf("redeliver: expected 202, got %d: %s", w.Code, w.Body)
+	}
+	got, _ := st.GetNotificationDelivery(context.Background(), d.ID)
+	if got.Status != models.DeliveryPending || got.Attempts != 0 || got.LastError != "" {
+		t.Errorf("expected a fresh pending delivery, got %+v", got)
+	}
+}
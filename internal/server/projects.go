@@ -2,20 +2,27 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/auth"
+	"github.com/inelson/finguard/internal/export"
 	"github.com/inelson/finguard/internal/models"
 	"github.com/inelson/finguard/internal/store"
 )
 
 // @Summary      Create a project
-// @Description  Create a new project for organizing cost sources
+// @Description  Create a new project for organizing cost sources. The signed-in user who creates it is made its admin.
 // @Tags         Projects
 // @Accept       json
 // @Produce      json
-// @Param        body  body      object{name=string,description=string}  true  "Project fields"
+// @Param        body  body      object{name=string,description=string,admissionMode=string}  true  "Project fields"
 // @Success      201   {object}  models.Project
 // @Failure      400   {object}  object{error=string}
 // @Failure      500   {object}  object{error=string}
@@ -23,8 +30,9 @@ import (
 // @Router       /projects [post]
 func (s *Server) handleCreateProject(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
+		Name          string               `json:"name"`
+		Description   string               `json:"description"`
+		AdmissionMode models.AdmissionMode `json:"admissionMode"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
@@ -34,17 +42,45 @@ func (s *Server) handleCreateProject(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name is required"})
 		return
 	}
+	if req.AdmissionMode != "" && !req.AdmissionMode.Valid() {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "admissionMode must be off, warn or deny"})
+		return
+	}
 
 	project := &models.Project{
-		Name:        req.Name,
-		Description: req.Description,
+		Name:          req.Name,
+		Description:   req.Description,
+		AdmissionMode: req.AdmissionMode,
 	}
-	if err := s.store.CreateProject(r.Context(), project); err != nil {
+	// Project routes check roles on the project, so without one its creator
+	// could not manage it.
+	var roles []*models.ProjectRole
+	if session := auth.UserFromContext(r.Context()); session != nil && session.UserID != "" {
+		roles = append(roles, &models.ProjectRole{SubjectType: models.SubjectUser, SubjectID: session.UserID, Role: models.RoleAdmin})
+	}
+	if err := s.store.CreateProject(r.Context(), project, roles...); err != nil {
 		s.logger.Error("failed to create project", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create project"})
 		return
 	}
 
+	s.recordAudit(r, audit.Event{
+		Action:     "project.create",
+		TargetType: audit.TargetProject,
+		TargetID:   project.ID,
+		ProjectID:  project.ID,
+		After:      project,
+	})
+	for _, pr := range roles {
+		s.recordAudit(r, audit.Event{
+			Action:     "member.add",
+			TargetType: audit.TargetMember,
+			TargetID:   pr.SubjectID,
+			ProjectID:  project.ID,
+			After:      pr,
+		})
+	}
+
 	writeJSON(w, http.StatusCreated, project)
 }
 
@@ -74,33 +110,41 @@ func (s *Server) handleGetProject(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary      List projects
-// @Description  Returns all projects
+// @Description  Returns one page of projects, by name unless sorted otherwise
 // @Tags         Projects
 // @Produce      json
-// @Success      200  {object}  object{projects=[]models.Project}
-// @Failure      500  {object}  object{error=string}
+// @Param        sort    query     string  false  "Sort field: name, createdAt or updatedAt, prefixed with - for descending"
+// @Param        cursor  query     string  false  "Cursor from the previous page's next link"
+// @Param        limit   query     int     false  "Maximum projects to return (default 100, max 1000)"
+// @Success      200     {object}  object{projects=[]models.Project,next=string}
+// @Failure      400     {object}  object{error=string}
+// @Failure      500     {object}  object{error=string}
 // @Security     SessionAuth
 // @Router       /projects [get]
 func (s *Server) handleListProjects(w http.ResponseWriter, r *http.Request) {
-	projects, err := s.store.ListProjects(r.Context())
+	p, err := parsePage(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	projects, next, err := s.store.ListProjectsPage(r.Context(), p)
 	if err != nil {
-		s.logger.Error("failed to list projects", "error", err)
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list projects"})
+		s.writePageError(w, err, "projects")
 		return
 	}
 	if projects == nil {
 		projects = []*models.Project{}
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"projects": projects})
+	writePage(w, r, "projects", projects, next)
 }
 
 // @Summary      Update a project
-// @Description  Update an existing project's name and/or description
+// @Description  Update an existing project's name, description and/or admission mode
 // @Tags         Projects
 // @Accept       json
 // @Produce      json
-// @Param        projectID  path      string                                   true  "Project ID"
-// @Param        body       body      object{name=string,description=string}   true  "Fields to update"
+// @Param        projectID  path      string                                                       true  "Project ID"
+// @Param        body       body      object{name=string,description=string,admissionMode=string}  true  "Fields to update"
 // @Success      200        {object}  models.Project
 // @Failure      400        {object}  object{error=string}
 // @Failure      404        {object}  object{error=string}
@@ -122,20 +166,29 @@ func (s *Server) handleUpdateProject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Name        *string `json:"name"`
-		Description *string `json:"description"`
+		Name          *string               `json:"name"`
+		Description   *string               `json:"description"`
+		AdmissionMode *models.AdmissionMode `json:"admissionMode"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
 		return
 	}
+	if req.AdmissionMode != nil && !req.AdmissionMode.Valid() {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "admissionMode must be off, warn or deny"})
+		return
+	}
 
+	before := *existing
 	if req.Name != nil {
 		existing.Name = *req.Name
 	}
 	if req.Description != nil {
 		existing.Description = *req.Description
 	}
+	if req.AdmissionMode != nil {
+		existing.AdmissionMode = *req.AdmissionMode
+	}
 
 	if err := s.store.UpdateProject(r.Context(), existing); err != nil {
 		s.logger.Error("failed to update project", "error", err)
@@ -143,6 +196,15 @@ func (s *Server) handleUpdateProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.recordAudit(r, audit.Event{
+		Action:     "project.update",
+		TargetType: audit.TargetProject,
+		TargetID:   existing.ID,
+		ProjectID:  existing.ID,
+		Before:     before,
+		After:      existing,
+	})
+
 	writeJSON(w, http.StatusOK, existing)
 }
 
@@ -157,11 +219,26 @@ func (s *Server) handleUpdateProject(w http.ResponseWriter, r *http.Request) {
 // @Router       /projects/{projectID} [delete]
 func (s *Server) handleDeleteProject(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "projectID")
+	existing, err := s.store.GetProject(r.Context(), id)
+	if err != nil {
+		s.logger.Error("failed to get project", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete project"})
+		return
+	}
 	if err := s.store.DeleteProject(r.Context(), id); err != nil {
 		s.logger.Error("failed to delete project", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete project"})
 		return
 	}
+	if existing != nil {
+		s.recordAudit(r, audit.Event{
+			Action:     "project.delete",
+			TargetType: audit.TargetProject,
+			TargetID:   id,
+			ProjectID:  id,
+			Before:     existing,
+		})
+	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
@@ -176,6 +253,7 @@ func (s *Server) handleDeleteProject(w http.ResponseWriter, r *http.Request) {
 // @Param        body       body      object{type=string,name=string,config=object,enabled=bool}  true  "Cost source fields"
 // @Success      201        {object}  models.CostSource
 // @Failure      400        {object}  object{error=string}
+// @Failure      403        {object}  object{error=string}
 // @Failure      500        {object}  object{error=string}
 // @Security     SessionAuth
 // @Router       /projects/{projectID}/sources [post]
@@ -196,6 +274,10 @@ func (s *Server) handleCreateCostSource(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name and type are required"})
 		return
 	}
+	if !s.rbac.Authorize(r, projectID, models.SourceWritePermission(req.Type)) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "insufficient permissions for this source type"})
+		return
+	}
 
 	enabled := true
 	if req.Enabled != nil {
@@ -216,30 +298,46 @@ func (s *Server) handleCreateCostSource(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	s.recordAudit(r, audit.Event{
+		Action:     "source.create",
+		TargetType: audit.TargetCostSource,
+		TargetID:   cs.ID,
+		ProjectID:  projectID,
+		After:      cs,
+	})
+
 	writeJSON(w, http.StatusCreated, cs)
 }
 
 // @Summary      List cost sources
-// @Description  Returns all cost sources for a project
+// @Description  Returns one page of a project's cost sources, by name unless sorted otherwise
 // @Tags         CostSources
 // @Produce      json
-// @Param        projectID  path      string  true  "Project ID"
-// @Success      200        {object}  object{sources=[]models.CostSource}
+// @Param        projectID  path      string  true   "Project ID"
+// @Param        sort       query     string  false  "Sort field: name, type or createdAt, prefixed with - for descending"
+// @Param        cursor     query     string  false  "Cursor from the previous page's next link"
+// @Param        limit      query     int     false  "Maximum sources to return (default 100, max 1000)"
+// @Success      200        {object}  object{sources=[]models.CostSource,next=string}
+// @Failure      400        {object}  object{error=string}
 // @Failure      500        {object}  object{error=string}
 // @Security     SessionAuth
 // @Router       /projects/{projectID}/sources [get]
 func (s *Server) handleListCostSources(w http.ResponseWriter, r *http.Request) {
 	projectID := chi.URLParam(r, "projectID")
-	sources, err := s.store.ListCostSources(r.Context(), projectID)
+	p, err := parsePage(r)
 	if err != nil {
-		s.logger.Error("failed to list cost sources", "error", err)
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list cost sources"})
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	sources, next, err := s.store.ListCostSourcesPage(r.Context(), projectID, p)
+	if err != nil {
+		s.writePageError(w, err, "cost sources")
 		return
 	}
 	if sources == nil {
 		sources = []*models.CostSource{}
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"sources": sources})
+	writePage(w, r, "sources", sources, next)
 }
 
 // @Summary      Get a cost source
@@ -254,15 +352,8 @@ func (s *Server) handleListCostSources(w http.ResponseWriter, r *http.Request) {
 // @Security     SessionAuth
 // @Router       /projects/{projectID}/sources/{sourceID} [get]
 func (s *Server) handleGetCostSource(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "sourceID")
-	cs, err := s.store.GetCostSource(r.Context(), id)
-	if err != nil {
-		s.logger.Error("failed to get cost source", "error", err)
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get cost source"})
-		return
-	}
-	if cs == nil {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": "cost source not found"})
+	cs, ok := s.loadCostSource(w, r)
+	if !ok {
 		return
 	}
 	writeJSON(w, http.StatusOK, cs)
@@ -275,52 +366,95 @@ func (s *Server) handleGetCostSource(w http.ResponseWriter, r *http.Request) {
 // @Param        projectID  path      string  true  "Project ID"
 // @Param        sourceID   path      string  true  "Cost source ID"
 // @Success      200        {object}  object{status=string}
+// @Failure      403        {object}  object{error=string}
+// @Failure      404        {object}  object{error=string}
 // @Failure      500        {object}  object{error=string}
 // @Security     SessionAuth
 // @Router       /projects/{projectID}/sources/{sourceID} [delete]
 func (s *Server) handleDeleteCostSource(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "sourceID")
-	if err := s.store.DeleteCostSource(r.Context(), id); err != nil {
+	existing, ok := s.loadCostSource(w, r)
+	if !ok {
+		return
+	}
+	if !s.rbac.Authorize(r, existing.ProjectID, models.SourceWritePermission(existing.Type)) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "insufficient permissions for this source type"})
+		return
+	}
+	if err := s.store.DeleteCostSource(r.Context(), existing.ID); err != nil {
 		s.logger.Error("failed to delete cost source", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete cost source"})
 		return
 	}
+	s.recordAudit(r, audit.Event{
+		Action:     "source.delete",
+		TargetType: audit.TargetCostSource,
+		TargetID:   existing.ID,
+		ProjectID:  existing.ProjectID,
+		Before:     existing,
+	})
 	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+// loadCostSource fetches the cost source named by the URL, writing a 404 when
+// it does not exist or belongs to another project than the URL's.
+func (s *Server) loadCostSource(w http.ResponseWriter, r *http.Request) (*models.CostSource, bool) {
+	cs, err := s.store.GetCostSource(r.Context(), chi.URLParam(r, "sourceID"))
+	if err != nil {
+		s.logger.Error("failed to get cost source", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get cost source"})
+		return nil, false
+	}
+	if cs == nil || cs.ProjectID != chi.URLParam(r, "projectID") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "cost source not found"})
+		return nil, false
+	}
+	return cs, true
+}
+
 // --- Project Members ---
 
 // @Summary      List project members
-// @Description  Returns all role assignments for a project
+// @Description  Returns one page of the unexpired role assignments for a project, by subject unless sorted otherwise
 // @Tags         Members
 // @Produce      json
-// @Param        projectID  path      string  true  "Project ID"
-// @Success      200        {object}  object{members=[]models.ProjectRole}
+// @Param        projectID  path      string  true   "Project ID"
+// @Param        sort       query     string  false  "Sort field: subject or role, prefixed with - for descending"
+// @Param        cursor     query     string  false  "Cursor from the previous page's next link"
+// @Param        limit      query     int     false  "Maximum members to return (default 100, max 1000)"
+// @Success      200        {object}  object{members=[]models.ProjectRole,next=string}
+// @Failure      400        {object}  object{error=string}
 // @Failure      500        {object}  object{error=string}
 // @Security     SessionAuth
 // @Router       /projects/{projectID}/members [get]
 func (s *Server) handleListProjectMembers(w http.ResponseWriter, r *http.Request) {
 	projectID := chi.URLParam(r, "projectID")
-	roles, err := s.store.ListProjectRoles(r.Context(), projectID)
+	p, err := parsePage(r)
 	if err != nil {
-		s.logger.Error("failed to list project members", "error", err)
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list members"})
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
-	if roles == nil {
-		roles = []*models.ProjectRole{}
+	members, next, err := s.store.ListProjectMembersPage(r.Context(), projectID, time.Now(), p)
+	if err != nil {
+		s.writePageError(w, err, "members")
+		return
+	}
+	if members == nil {
+		members = []*models.ProjectRole{}
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"members": roles})
+	writePage(w, r, "members", members, next)
 }
 
 // @Summary      Add a project member
-// @Description  Assign a role to a user or group for a project
+// @Description  Assign a role to a user or group for a project, optionally until expiresAt. A user may be
+// @Description  identified by email instead of subjectId; if no user has that email yet, a pending
+// @Description  invitation is created and converted into the role when the user is first provisioned.
 // @Tags         Members
 // @Accept       json
 // @Produce      json
-// @Param        projectID  path      string                                                  true  "Project ID"
-// @Param        body       body      object{subjectType=string,subjectId=string,role=string}  true  "Member role assignment"
+// @Param        projectID  path      string                                                                                 true  "Project ID"
+// @Param        body       body      object{subjectType=string,subjectId=string,email=string,role=string,expiresAt=string}  true  "Member role assignment"
 // @Success      201        {object}  models.ProjectRole
+// @Success      202        {object}  models.ProjectInvitation
 // @Failure      400        {object}  object{error=string}
 // @Failure      500        {object}  object{error=string}
 // @Security     SessionAuth
@@ -331,18 +465,72 @@ func (s *Server) handleAddProjectMember(w http.ResponseWriter, r *http.Request)
 	var req struct {
 		SubjectType models.SubjectType `json:"subjectType"`
 		SubjectID   string             `json:"subjectId"`
+		Email       string             `json:"email"`
 		Role        models.Role        `json:"role"`
+		ExpiresAt   *time.Time         `json:"expiresAt"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
 		return
 	}
 
+	if req.Email != "" && req.SubjectType == "" {
+		req.SubjectType = models.SubjectUser
+	}
+	if req.Email != "" && (req.SubjectID != "" || req.SubjectType != models.SubjectUser) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "email identifies a user and cannot be combined with subjectId"})
+		return
+	}
+	if (req.SubjectID == "" && req.Email == "") || (req.SubjectType != models.SubjectUser && req.SubjectType != models.SubjectGroup) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "subjectType must be user or group and subjectId or email is required"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expiresAt must be in the future"})
+		return
+	}
+	known, err := s.roleExists(r, req.Role)
+	if err != nil {
+		s.logger.Error("failed to look up role", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to add member"})
+		return
+	}
+	if !known {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown role"})
+		return
+	}
+
+	if req.Email != "" {
+		user, err := s.store.GetUserByEmail(r.Context(), req.Email)
+		if err != nil {
+			s.logger.Error("failed to look up user by email", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to add member"})
+			return
+		}
+		if user == nil {
+			s.inviteProjectMember(w, r, &models.ProjectInvitation{
+				ProjectID:     projectID,
+				Email:         req.Email,
+				Role:          req.Role,
+				RoleExpiresAt: req.ExpiresAt,
+			})
+			return
+		}
+		req.SubjectID = user.ID
+	}
+
 	pr := &models.ProjectRole{
 		ProjectID:   projectID,
 		SubjectType: req.SubjectType,
 		SubjectID:   req.SubjectID,
 		Role:        req.Role,
+		ExpiresAt:   req.ExpiresAt,
+	}
+	before, err := s.findProjectRole(r, projectID, pr.SubjectType, pr.SubjectID)
+	if err != nil {
+		s.logger.Error("failed to list project roles", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to add member"})
+		return
 	}
 	if err := s.store.SetProjectRole(r.Context(), pr); err != nil {
 		s.logger.Error("failed to set project role", "error", err)
@@ -350,6 +538,19 @@ func (s *Server) handleAddProjectMember(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	ev := audit.Event{
+		Action:     "member.add",
+		TargetType: audit.TargetMember,
+		TargetID:   pr.SubjectID,
+		ProjectID:  projectID,
+		After:      pr,
+	}
+	if before != nil {
+		ev.Action = "member.update"
+		ev.Before = before
+	}
+	s.recordAudit(r, ev)
+
 	writeJSON(w, http.StatusCreated, pr)
 }
 
@@ -372,37 +573,548 @@ func (s *Server) handleRemoveProjectMember(w http.ResponseWriter, r *http.Reques
 		subjectType = models.SubjectUser
 	}
 
+	before, err := s.findProjectRole(r, projectID, subjectType, subjectID)
+	if err != nil {
+		s.logger.Error("failed to list project roles", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to remove member"})
+		return
+	}
 	if err := s.store.RemoveProjectRole(r.Context(), projectID, subjectType, subjectID); err != nil {
 		s.logger.Error("failed to remove project member", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to remove member"})
 		return
 	}
+	if before != nil {
+		s.recordAudit(r, audit.Event{
+			Action:     "member.remove",
+			TargetType: audit.TargetMember,
+			TargetID:   subjectID,
+			ProjectID:  projectID,
+			Before:     before,
+		})
+	}
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "removed"})
 }
 
+// findProjectRole returns the current assignment of a subject on a project, or nil.
+func (s *Server) findProjectRole(r *http.Request, projectID string, subjectType models.SubjectType, subjectID string) (*models.ProjectRole, error) {
+	roles, err := s.store.ListProjectRoles(r.Context(), projectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		if role.SubjectType == subjectType && role.SubjectID == subjectID {
+			return role, nil
+		}
+	}
+	return nil, nil
+}
+
+// --- Project Invitations ---
+
+// inviteProjectMember records a pending role for an email address that has no
+// user yet and responds with 202 Accepted.
+func (s *Server) inviteProjectMember(w http.ResponseWriter, r *http.Request, inv *models.ProjectInvitation) {
+	if session := auth.UserFromContext(r.Context()); session != nil {
+		inv.InvitedBy = session.Email
+	}
+	if err := s.store.CreateProjectInvitation(r.Context(), inv); err != nil {
+		s.logger.Error("failed to create project invitation", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to add member"})
+		return
+	}
+	s.recordAudit(r, audit.Event{
+		Action:     "invitation.create",
+		TargetType: audit.TargetInvitation,
+		TargetID:   inv.ID,
+		ProjectID:  inv.ProjectID,
+		After:      inv,
+	})
+	writeJSON(w, http.StatusAccepted, inv)
+}
+
+// @Summary      List project invitations
+// @Description  Returns pending invitations for email addresses that have not signed in yet
+// @Tags         Members
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Success      200        {object}  object{invitations=[]models.ProjectInvitation}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/invitations [get]
+func (s *Server) handleListProjectInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := s.store.ListProjectInvitations(r.Context(), chi.URLParam(r, "projectID"))
+	if err != nil {
+		s.logger.Error("failed to list project invitations", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list invitations"})
+		return
+	}
+	if invitations == nil {
+		invitations = []*models.ProjectInvitation{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"invitations": invitations})
+}
+
+// @Summary      Revoke a project invitation
+// @Description  Delete a pending invitation before it is accepted
+// @Tags         Members
+// @Produce      json
+// @Param        projectID     path      string  true  "Project ID"
+// @Param        invitationID  path      string  true  "Invitation ID"
+// @Success      200           {object}  object{status=string}
+// @Failure      404           {object}  object{error=string}
+// @Failure      500           {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/invitations/{invitationID} [delete]
+func (s *Server) handleDeleteProjectInvitation(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	inv, err := s.store.GetProjectInvitation(r.Context(), chi.URLParam(r, "invitationID"))
+	if err != nil {
+		s.logger.Error("failed to get project invitation", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete invitation"})
+		return
+	}
+	if inv == nil || inv.ProjectID != projectID {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "invitation not found"})
+		return
+	}
+	if err := s.store.DeleteProjectInvitation(r.Context(), inv.ID); err != nil {
+		s.logger.Error("failed to delete project invitation", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete invitation"})
+		return
+	}
+	s.recordAudit(r, audit.Event{
+		Action:     "invitation.delete",
+		TargetType: audit.TargetInvitation,
+		TargetID:   inv.ID,
+		ProjectID:  projectID,
+		Before:     inv,
+	})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
 // --- Project Costs ---
 
+// maxCostBuckets caps how many time buckets a cost series may have, so a
+// wide range at hourly granularity cannot build an unbounded response.
+const maxCostBuckets = 1000
+
+// minBucketWidth is the shortest a bucket of each granularity can be, which
+// bounds the bucket count of a range before any are built.
+var minBucketWidth = map[store.Granularity]time.Duration{
+	store.GranularityHour:  time.Hour,
+	store.GranularityDay:   24 * time.Hour,
+	store.GranularityWeek:  7 * 24 * time.Hour,
+	store.GranularityMonth: 28 * 24 * time.Hour,
+}
+
+// defaultCostRange is how far back a cost series reaches without a start.
+const defaultCostRange = 30 * 24 * time.Hour
+
+// costsResponse is the body of the project costs endpoint: the totals over
+// the requested range and, when a granularity or group was asked for, one
+// time series per group.
+type costsResponse struct {
+	store.CostSummary
+	Start       *time.Time          `json:"start,omitempty"`
+	End         *time.Time          `json:"end,omitempty"`
+	Granularity store.Granularity   `json:"granularity,omitempty"`
+	GroupBy     []string            `json:"groupBy,omitempty"`
+	Series      []*store.CostSeries `json:"series,omitempty"`
+}
+
 // @Summary      Get project costs
-// @Description  Returns aggregated cost summary for a project
+// @Description  Returns the cost totals of a project, optionally narrowed by provider, service, category, region, label predicates and a [start, end) range.
+// @Description  With a granularity (hour, day, week or month) or groupBy dimensions (provider, service, category, region, account, source or label:<key>), it also returns a zero-filled time series per group, in UTC buckets.
+// @Description  Series default to daily buckets over the 30 days before end, and end defaults to now.
 // @Tags         Costs
 // @Produce      json
-// @Param        projectID  path      string  true  "Project ID"
-// @Success      200        {object}  store.CostSummary
-// @Failure      500        {object}  object{error=string}
+// @Param        projectID     path      string    true   "Project ID"
+// @Param        provider      query     string    false  "Provider"
+// @Param        service       query     string    false  "Service"
+// @Param        category      query     string    false  "Category"
+// @Param        region        query     string    false  "Region"
+// @Param        label         query     []string  false  "Label as key=value; repeat to require several"
+// @Param        labelIn       query     []string  false  "Label as key=value1,value2, matching any of the values"
+// @Param        labelExists   query     []string  false  "Label key the records must carry"
+// @Param        labelMissing  query     []string  false  "Label key the records must not carry"
+// @Param        start         query     string    false  "Range start, RFC 3339 or YYYY-MM-DD"
+// @Param        end           query     string    false  "Range end (exclusive), RFC 3339 or YYYY-MM-DD"
+// @Param        granularity   query     string    false  "Bucket width: hour, day, week or month"
+// @Param        groupBy       query     []string  false  "Dimension to group by; repeat to group by several"
+// @Success      200           {object}  costsResponse
+// @Failure      400           {object}  object{error=string}
+// @Failure      500           {object}  object{error=string}
 // @Security     SessionAuth
 // @Router       /projects/{projectID}/costs [get]
 func (s *Server) handleGetProjectCosts(w http.ResponseWriter, r *http.Request) {
 	projectID := chi.URLParam(r, "projectID")
 
-	summary, err := s.store.AggregateCosts(r.Context(), store.CostQuery{
-		ProjectID: projectID,
-	})
+	filter, err := costFilterFromQuery(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	q, err := costRangeFromQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if q.LabelSelectors, err = labelSelectorsFromQuery(r.URL.Query()); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	q.CostFilter = filter
+	q.ProjectID = projectID
+
+	summary, err := s.store.AggregateCosts(r.Context(), q)
 	if err != nil {
 		s.logger.Error("failed to aggregate costs", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get costs"})
 		return
 	}
+	resp := costsResponse{CostSummary: *summary, Granularity: q.Granularity, GroupBy: q.GroupBy}
+	if !q.StartTime.IsZero() {
+		resp.Start = &q.StartTime
+	}
+	if !q.EndTime.IsZero() {
+		resp.End = &q.EndTime
+	}
+
+	if q.Granularity != "" {
+		if resp.Series, err = s.store.CostTimeSeries(r.Context(), q); err != nil {
+			s.logger.Error("failed to build cost series", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get costs"})
+			return
+		}
+		if resp.Series == nil {
+			resp.Series = []*store.CostSeries{}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// @Summary      Export project cost records
+// @Description  Streams the raw cost records of a project, oldest first, as CSV, NDJSON or Parquet (format, default csv). It takes the same filters as the costs endpoint.
+// @Description  CSV and Parquet give each label key found on the exported records its own label:<key> column; NDJSON keeps a labels object per record.
+// @Tags         Costs
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Produce      application/vnd.apache.parquet
+// @Param        projectID     path      string    true   "Project ID"
+// @Param        format        query     string    false  "csv, ndjson or parquet"
+// @Param        provider      query     string    false  "Provider"
+// @Param        service       query     string    false  "Service"
+// @Param        category      query     string    false  "Category"
+// @Param        region        query     string    false  "Region"
+// @Param        label         query     []string  false  "Label as key=value; repeat to require several"
+// @Param        labelIn       query     []string  false  "Label as key=value1,value2, matching any of the values"
+// @Param        labelExists   query     []string  false  "Label key the records must carry"
+// @Param        labelMissing  query     []string  false  "Label key the records must not carry"
+// @Param        start         query     string    false  "Range start, RFC 3339 or YYYY-MM-DD"
+// @Param        end           query     string    false  "Range end (exclusive), RFC 3339 or YYYY-MM-DD"
+// @Success      200           {file}    file
+// @Failure      400           {object}  object{error=string}
+// @Failure      500           {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/costs/export [get]
+func (s *Server) handleExportProjectCosts(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	params := r.URL.Query()
 
-	writeJSON(w, http.StatusOK, summary)
+	format := export.FormatCSV
+	if v := params.Get("format"); v != "" {
+		var err error
+		if format, err = export.ParseFormat(v); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	q, err := recordQueryFromQuery(params, projectID)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	var labelKeys []string
+	if format != export.FormatNDJSON {
+		if labelKeys, err = s.store.CostLabelKeys(r.Context(), q); err != nil {
+			s.logger.Error("failed to list label keys", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to export costs"})
+			return
+		}
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "costs.export",
+		TargetType: audit.TargetProject,
+		TargetID:   projectID,
+		ProjectID:  projectID,
+		After:      map[string]string{"format": string(format), "query": r.URL.RawQuery},
+	})
+
+	// Once the first row is sent the status is committed, so later errors
+	// are only logged and the client sees a truncated file.
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="costs-%s.%s"`, projectID, format))
+	clearWriteDeadline(w)
+	ew, err := export.NewWriter(w, format, labelKeys)
+	if err != nil {
+		s.logger.Error("failed to start cost export", "error", err)
+		return
+	}
+	if err := s.store.ExportCostRecords(r.Context(), q, ew.Write); err != nil {
+		s.logger.Error("cost export aborted", "project", projectID, "error", err)
+		return
+	}
+	if err := ew.Close(); err != nil {
+		s.logger.Error("failed to finish cost export", "project", projectID, "error", err)
+	}
+}
+
+// @Summary      List project cost records
+// @Description  Returns one page of the raw cost records of a project, newest first unless sorted otherwise. It takes the same filters as the costs endpoint.
+// @Tags         Costs
+// @Produce      json
+// @Param        projectID     path      string    true   "Project ID"
+// @Param        provider      query     string    false  "Provider"
+// @Param        service       query     string    false  "Service"
+// @Param        category      query     string    false  "Category"
+// @Param        region        query     string    false  "Region"
+// @Param        label         query     []string  false  "Label as key=value; repeat to require several"
+// @Param        labelIn       query     []string  false  "Label as key=value1,value2, matching any of the values"
+// @Param        labelExists   query     []string  false  "Label key the records must carry"
+// @Param        labelMissing  query     []string  false  "Label key the records must not carry"
+// @Param        start         query     string    false  "Range start, RFC 3339 or YYYY-MM-DD"
+// @Param        end           query     string    false  "Range end (exclusive), RFC 3339 or YYYY-MM-DD"
+// @Param        sort          query     string    false  "Sort field: startTime, netCost, listCost, service or provider, prefixed with - for descending (default -startTime)"
+// @Param        cursor        query     string    false  "Cursor from the previous page's next link"
+// @Param        limit         query     int       false  "Maximum records to return (default 100, max 1000)"
+// @Success      200           {object}  object{records=[]models.CostRecord,next=string}
+// @Failure      400           {object}  object{error=string}
+// @Failure      500           {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/costs/records [get]
+func (s *Server) handleListProjectCostRecords(w http.ResponseWriter, r *http.Request) {
+	q, err := recordQueryFromQuery(r.URL.Query(), chi.URLParam(r, "projectID"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	p, err := parsePage(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	records, next, err := s.store.QueryCostRecords(r.Context(), q, p)
+	if err != nil {
+		s.writePageError(w, err, "cost records")
+		return
+	}
+	if records == nil {
+		records = []*models.CostRecord{}
+	}
+	writePage(w, r, "records", records, next)
+}
+
+// recordQueryFromQuery reads the filters, range and label selectors of the
+// endpoints returning raw cost records.
+func recordQueryFromQuery(params url.Values, projectID string) (store.CostQuery, error) {
+	filter, err := costFilterFromQuery(params)
+	if err != nil {
+		return store.CostQuery{}, err
+	}
+	q := store.CostQuery{CostFilter: filter, ProjectID: projectID}
+	if err := costTimesFromQuery(params, &q); err != nil {
+		return q, err
+	}
+	q.LabelSelectors, err = labelSelectorsFromQuery(params)
+	return q, err
+}
+
+// @Summary      List project cost labels
+// @Description  Returns every label key found on the project's cost records, in key order, with the values each has taken. Use them to build label filters and label:<key> groups on the costs endpoint.
+// @Tags         Costs
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Success      200        {object}  object{labels=[]store.CostLabel}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/labels [get]
+func (s *Server) handleListProjectLabels(w http.ResponseWriter, r *http.Request) {
+	labels, err := s.store.ListCostLabels(r.Context(), chi.URLParam(r, "projectID"))
+	if err != nil {
+		s.logger.Error("failed to list cost labels", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list labels"})
+		return
+	}
+	if labels == nil {
+		labels = []*store.CostLabel{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"labels": labels})
+}
+
+// @Summary      Rebuild cost rollups
+// @Description  Recompute the daily cost rollups from the raw cost records, for one project or, without projectId, for all of them. Summaries at day granularity or coarser read the rollups, so run this if they disagree with the records.
+// @Tags         Costs
+// @Produce      json
+// @Param        projectId  query     string  false  "Project ID"
+// @Success      200        {object}  object{status=string}
+// @Failure      403        {object}  object{error=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /rollups/rebuild [post]
+func (s *Server) handleRebuildRollups(w http.ResponseWriter, r *http.Request) {
+	projectID := r.URL.Query().Get("projectId")
+	if projectID != "" {
+		project, err := s.store.GetProject(r.Context(), projectID)
+		if err != nil {
+			s.logger.Error("failed to get project", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get project"})
+			return
+		}
+		if project == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "project not found"})
+			return
+		}
+	}
+
+	if err := s.store.RebuildCostRollups(r.Context(), projectID); err != nil {
+		s.logger.Error("failed to rebuild cost rollups", "project", projectID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to rebuild rollups"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "rollups.rebuild",
+		TargetType: audit.TargetRollups,
+		TargetID:   projectID,
+		ProjectID:  projectID,
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "rebuilt"})
+}
+
+// costRangeFromQuery reads the range, granularity and groupBy parameters of
+// the costs endpoint. A series is asked for by a granularity or a groupBy;
+// then granularity defaults to day, end to now and start to 30 days before
+// end. Without one, only the given bounds narrow the totals.
+func costRangeFromQuery(params url.Values, now time.Time) (store.CostQuery, error) {
+	var q store.CostQuery
+	if err := costTimesFromQuery(params, &q); err != nil {
+		return q, err
+	}
+
+	q.Granularity = store.Granularity(params.Get("granularity"))
+	q.GroupBy = params["groupBy"]
+	for _, dim := range q.GroupBy {
+		if err := store.ValidateCostDimension(dim); err != nil {
+			return q, err
+		}
+	}
+	if q.Granularity == "" && len(q.GroupBy) == 0 {
+		if !q.StartTime.IsZero() && !q.EndTime.IsZero() && !q.StartTime.Before(q.EndTime) {
+			return q, fmt.Errorf("start must be before end")
+		}
+		return q, nil
+	}
+
+	if q.Granularity == "" {
+		q.Granularity = store.GranularityDay
+	}
+	if !q.Granularity.Valid() {
+		return q, fmt.Errorf("invalid granularity %q: must be hour, day, week or month", q.Granularity)
+	}
+	if q.EndTime.IsZero() {
+		q.EndTime = now.UTC()
+	}
+	if q.StartTime.IsZero() {
+		q.StartTime = q.EndTime.Add(-defaultCostRange)
+	}
+	if !q.StartTime.Before(q.EndTime) {
+		return q, fmt.Errorf("start must be before end")
+	}
+	if q.EndTime.Sub(q.StartTime) > maxCostBuckets*minBucketWidth[q.Granularity] {
+		return q, fmt.Errorf("range spans more than %d %s buckets; use a coarser granularity or a shorter range", maxCostBuckets, q.Granularity)
+	}
+	return q, nil
+}
+
+// costFilterFromQuery reads a cost filter from query parameters. Each label
+// parameter is a key=value pair, and a record must carry all of them.
+func costFilterFromQuery(q url.Values) (models.CostFilter, error) {
+	filter := models.CostFilter{
+		Provider: q.Get("provider"),
+		Service:  q.Get("service"),
+		Category: q.Get("category"),
+		Region:   q.Get("region"),
+	}
+	for _, label := range q["label"] {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok {
+			return filter, fmt.Errorf("label %q must be written as key=value", label)
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[key] = value
+	}
+	return filter, validateCostFilter(filter)
+}
+
+// costTimesFromQuery reads the start and end parameters into q, each an RFC
+// 3339 timestamp or a date standing for its UTC midnight.
+func costTimesFromQuery(params url.Values, q *store.CostQuery) error {
+	for name, dst := range map[string]*time.Time{"start": &q.StartTime, "end": &q.EndTime} {
+		if v := params.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				if t, err = time.Parse(time.DateOnly, v); err != nil {
+					return fmt.Errorf("invalid %s: must be an RFC 3339 timestamp or a YYYY-MM-DD date", name)
+				}
+			}
+			*dst = t.UTC()
+		}
+	}
+	return nil
+}
+
+// labelSelectorsFromQuery reads the label predicates of the costs endpoint
+// beyond plain equality: labelIn=key=v1,v2 matches any of the values, and
+// labelExists=key and labelMissing=key match records with and without the
+// label. Each parameter can be repeated, and a record must match them all.
+func labelSelectorsFromQuery(q url.Values) ([]store.LabelSelector, error) {
+	var selectors []store.LabelSelector
+	for _, in := range q["labelIn"] {
+		key, values, ok := strings.Cut(in, "=")
+		if !ok {
+			return nil, fmt.Errorf("labelIn %q must be written as key=value1,value2", in)
+		}
+		selectors = append(selectors, store.LabelSelector{Key: key, Op: store.LabelIn, Values: strings.Split(values, ",")})
+	}
+	for _, key := range q["labelExists"] {
+		selectors = append(selectors, store.LabelSelector{Key: key, Op: store.LabelExists})
+	}
+	for _, key := range q["labelMissing"] {
+		selectors = append(selectors, store.LabelSelector{Key: key, Op: store.LabelNotExists})
+	}
+	for _, sel := range selectors {
+		if err := sel.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return selectors, nil
+}
+
+// validateCostFilter rejects filters that could never match a record.
+func validateCostFilter(filter models.CostFilter) error {
+	for key := range filter.Labels {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("invalid label key %q", key)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,693 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inelson/finguard/internal/auth"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+)
+
+func TestProjectMembers_InviteByEmail(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	ctx := context.Background()
+
+	w := doRequest(srv, http.MethodPost, "/api/v1/projects", `{"name":"payments"}`)
+	var project models.Project
+	json.NewDecoder(w.Body).Decode(&project)
+	members := "/api/v1/projects/" + project.ID + "/members"
+
+	existing := &models.User{Email: "alice@example.com", DisplayName: "Alice", Active: true}
+	if err := st.CreateUser(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+	expiry := time.Now().UTC().Add(48 * time.Hour).Format(time.RFC3339)
+
+	w = doRequest(srv, http.MethodPost, members, `{"email":"alice@example.com","role":"editor","expiresAt":"`+expiry+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("add existing user by email: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var pr models.ProjectRole
+	json.NewDecoder(w.Body).Decode(&pr)
+	if pr.SubjectID != existing.ID || pr.ExpiresAt == nil {
+		t.Errorf("expected a time-bound role for %s, got %+v", existing.ID, pr)
+	}
+
+	w = doRequest(srv, http.MethodPost, members, `{"email":"bob@example.com","role":"viewer"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("invite unknown email: expected 202, got %d: %s", w.Code, w.Body)
+	}
+	var inv models.ProjectInvitation
+	json.NewDecoder(w.Body).Decode(&inv)
+
+	w = doRequest(srv, http.MethodGet, "/api/v1/projects/"+project.ID+"/invitations", "")
+	var body struct {
+		Invitations []models.ProjectInvitation `json:"invitations"`
+	}
+	json.NewDecoder(w.Body).Decode(&body)
+	if len(body.Invitations) != 1 || body.Invitations[0].Email != "bob@example.com" {
+		t.Fatalf("expected one pending invitation for bob, got %+v", body.Invitations)
+	}
+
+	if w = doRequest(srv, http.MethodDelete, "/api/v1/projects/other/invitations/"+inv.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("delete invitation from another project: expected 404, got %d", w.Code)
+	}
+	if w = doRequest(srv, http.MethodDelete, "/api/v1/projects/"+project.ID+"/invitations/"+inv.ID, ""); w.Code != http.StatusOK {
+		t.Errorf("delete invitation: expected 200, got %d", w.Code)
+	}
+}
+
+func TestProjectMembers_Validation(t *testing.T) {
+	srv, _ := newTestServerWithStore(t)
+
+	w := doRequest(srv, http.MethodPost, "/api/v1/projects", `{"name":"payments"}`)
+	var project models.Project
+	json.NewDecoder(w.Body).Decode(&project)
+	members := "/api/v1/projects/" + project.ID + "/members"
+	past := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"subjectType":"user","subjectId":"u-1","role":"viewer","expiresAt":"` + past + `"}`, http.StatusBadRequest},
+		{`{"subjectType":"group","email":"team@example.com","role":"viewer"}`, http.StatusBadRequest},
+		{`{"subjectId":"u-1","email":"a@example.com","role":"viewer"}`, http.StatusBadRequest},
+		{`{"subjectType":"user","role":"viewer"}`, http.StatusBadRequest},
+		{`{"email":"a@example.com","role":"owner"}`, http.StatusBadRequest},
+		{`{"subjectType":"user","subjectId":"u-1","role":"viewer","expiresAt":"tomorrow"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := doRequest(srv, http.MethodPost, members, tt.body); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.body, tt.want, w.Code)
+		}
+	}
+}
+
+func TestProjectCosts_Filter(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, k8s := setupBudgetProject(t, st)
+	now := time.Now().UTC()
+	records := []*models.CostRecord{{ProjectID: project.ID, CostSourceID: k8s.ID, Provider: "kubernetes", Service: "compute", StartTime: now, EndTime: now, NetCost: 7, Labels: map[string]string{"namespace": "payments"}}}
+	if err := st.InsertCostRecords(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+	base := "/api/v1/projects/" + project.ID + "/costs"
+
+	tests := []struct {
+		query string
+		want  float64
+	}{
+		{"", 557},
+		{"?provider=aws", 530},
+		{"?provider=kubernetes&service=compute", 27},
+		{"?label=namespace%3Dpayments", 7},
+		{"?label=namespace%3Dpayments&provider=aws", 0},
+	}
+	for _, tt := range tests {
+		w := doRequest(srv, http.MethodGet, base+tt.query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tt.query, w.Code, w.Body)
+		}
+		var summary struct {
+			TotalNetCost float64 `json:"totalNetCost"`
+		}
+		json.NewDecoder(w.Body).Decode(&summary)
+		if summary.TotalNetCost != tt.want {
+			t.Errorf("%s: expected net cost %v, got %v", tt.query, tt.want, summary.TotalNetCost)
+		}
+	}
+
+	if w := doRequest(srv, http.MethodGet, base+"?label=namespace", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a label without a value, got %d", w.Code)
+	}
+}
+
+func TestProjectCosts_Series(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, aws, k8s := setupBudgetProject(t, st)
+	at := func(day, hour int) time.Time { return time.Date(2025, time.March, day, hour, 0, 0, 0, time.UTC) }
+	records := []*models.CostRecord{
+		{ProjectID: project.ID, CostSourceID: aws.ID, Provider: "aws", Service: "ec2", StartTime: at(3, 10), EndTime: at(3, 11), NetCost: 10, Labels: map[string]string{"team": "a"}},
+		{ProjectID: project.ID, CostSourceID: aws.ID, Provider: "aws", Service: "ec2", StartTime: at(3, 15), EndTime: at(3, 16), NetCost: 5, Labels: map[string]string{"team": "a"}},
+		{ProjectID: project.ID, CostSourceID: aws.ID, Provider: "aws", Service: "s3", StartTime: at(5, 0), EndTime: at(6, 0), NetCost: 4, Labels: map[string]string{"team": "b"}},
+		{ProjectID: project.ID, CostSourceID: k8s.ID, Provider: "kubernetes", Service: "compute", StartTime: at(6, 0), EndTime: at(7, 0), NetCost: 2},
+	}
+	if err := st.InsertCostRecords(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+	base := "/api/v1/projects/" + project.ID + "/costs"
+
+	type series struct {
+		Group        map[string]string `json:"group"`
+		TotalNetCost float64           `json:"totalNetCost"`
+		Points       []struct {
+			Start        time.Time `json:"start"`
+			TotalNetCost float64   `json:"totalNetCost"`
+		} `json:"points"`
+	}
+	get := func(query string) (float64, []series) {
+		t.Helper()
+		w := doRequest(srv, http.MethodGet, base+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, w.Code, w.Body)
+		}
+		var resp struct {
+			TotalNetCost float64  `json:"totalNetCost"`
+			Series       []series `json:"series"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp.TotalNetCost, resp.Series
+	}
+	netCosts := func(s series) []float64 {
+		var costs []float64
+		for _, p := range s.Points {
+			costs = append(costs, p.TotalNetCost)
+		}
+		return costs
+	}
+
+	// Daily by provider and team label: one zero-filled series per pair,
+	// most expensive first.
+	total, got := get("?start=2025-03-01&end=2025-03-08&groupBy=provider&groupBy=label:team")
+	if total != 21 {
+		t.Errorf("expected a total of 21 over the range, got %v", total)
+	}
+	want := []struct {
+		provider, team string
+		points         []float64
+	}{
+		{"aws", "a", []float64{0, 0, 15, 0, 0, 0, 0}},
+		{"aws", "b", []float64{0, 0, 0, 0, 4, 0, 0}},
+		{"kubernetes", "", []float64{0, 0, 0, 0, 0, 2, 0}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d series, got %+v", len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Group["provider"] != w.provider || g.Group["label:team"] != w.team || !slices.Equal(netCosts(g), w.points) {
+			t.Errorf("series %d: expected %s/%s %v, got %v %v", i, w.provider, w.team, w.points, g.Group, netCosts(g))
+		}
+	}
+	if !got[0].Points[0].Start.Equal(at(1, 0)) {
+		t.Errorf("expected the first bucket to start on March 1, got %v", got[0].Points[0].Start)
+	}
+
+	tests := []struct {
+		query string
+		want  []float64
+	}{
+		{"?start=2025-03-03T09:00:00Z&end=2025-03-03T16:00:00Z&granularity=hour", []float64{0, 10, 0, 0, 0, 0, 5}},
+		// March 1, 2025 is a Saturday, so its week starts on February 24.
+		{"?start=2025-03-01&end=2025-03-10&granularity=week", []float64{0, 21}},
+		{"?start=2025-02-15&end=2025-04-01&granularity=month", []float64{0, 21}},
+		{"?start=2025-03-01&end=2025-03-08&granularity=day&provider=kubernetes", []float64{0, 0, 0, 0, 0, 2, 0}},
+	}
+	for _, tt := range tests {
+		_, got := get(tt.query)
+		if len(got) != 1 || !slices.Equal(netCosts(got[0]), tt.want) {
+			t.Errorf("%s: expected one series %v, got %+v", tt.query, tt.want, got)
+		}
+	}
+
+	for _, query := range []string{
+		"?granularity=year",
+		"?groupBy=owner",
+		"?groupBy=label:",
+		"?start=yesterday",
+		"?start=2025-03-08&end=2025-03-01",
+		"?start=2020-01-01&end=2025-01-01&granularity=hour",
+	} {
+		if w := doRequest(srv, http.MethodGet, base+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestProjectCosts_LabelSelectors(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, aws, _ := setupBudgetProject(t, st)
+	now := time.Now().UTC()
+	records := []*models.CostRecord{
+		{ProjectID: project.ID, CostSourceID: aws.ID, Provider: "aws", Service: "ec2", StartTime: now, EndTime: now, NetCost: 1, Labels: map[string]string{"team": "payments", "env": "prod"}},
+		{ProjectID: project.ID, CostSourceID: aws.ID, Provider: "aws", Service: "ec2", StartTime: now, EndTime: now, NetCost: 2, Labels: map[string]string{"team": "search", "env": "prod"}},
+		{ProjectID: project.ID, CostSourceID: aws.ID, Provider: "aws", Service: "ec2", StartTime: now, EndTime: now, NetCost: 4, Labels: map[string]string{"team": "ads"}},
+	}
+	if err := st.InsertCostRecords(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+	base := "/api/v1/projects/" + project.ID
+
+	tests := []struct {
+		query string
+		want  float64
+	}{
+		{"?label=team%3Dpayments", 1},
+		{"?labelIn=team%3Dpayments,ads", 5},
+		{"?labelIn=team%3Dpayments,ads&label=env%3Dprod", 1},
+		{"?labelExists=env", 3},
+		// Records without labels, from setupBudgetProject, lack env too.
+		{"?labelMissing=env", 554},
+		{"?labelExists=team&labelMissing=env", 4},
+		{"?labelExists=owner", 0},
+	}
+	for _, tt := range tests {
+		w := doRequest(srv, http.MethodGet, base+"/costs"+tt.query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tt.query, w.Code, w.Body)
+		}
+		var summary struct {
+			TotalNetCost float64 `json:"totalNetCost"`
+		}
+		json.NewDecoder(w.Body).Decode(&summary)
+		if summary.TotalNetCost != tt.want {
+			t.Errorf("%s: expected net cost %v, got %v", tt.query, tt.want, summary.TotalNetCost)
+		}
+	}
+	for _, query := range []string{"?labelIn=team", "?labelExists=", "?labelMissing=%20"} {
+		if w := doRequest(srv, http.MethodGet, base+"/costs"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+
+	w := doRequest(srv, http.MethodGet, base+"/labels", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("labels: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Labels []struct {
+			Key    string   `json:"key"`
+			Values []string `json:"values"`
+		} `json:"labels"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Labels) != 2 ||
+		resp.Labels[0].Key != "env" || !slices.Equal(resp.Labels[0].Values, []string{"prod"}) ||
+		resp.Labels[1].Key != "team" || !slices.Equal(resp.Labels[1].Values, []string{"ads", "payments", "search"}) {
+		t.Errorf("unexpected labels: %+v", resp.Labels)
+	}
+}
+
+func TestProjectCosts_Rollups(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, aws, _ := setupBudgetProject(t, st)
+	ctx := context.Background()
+	day := func(d int) time.Time { return time.Date(2025, time.June, d, 0, 0, 0, 0, time.UTC) }
+	record := func(id, service string, d int, cost float64) *models.CostRecord {
+		return &models.CostRecord{ID: id, ProjectID: project.ID, CostSourceID: aws.ID, Provider: "aws", Service: service, StartTime: day(d), EndTime: day(d + 1), NetCost: cost}
+	}
+	if err := st.InsertCostRecords(ctx, []*models.CostRecord{record("r1", "ec2", 2, 10), record("r2", "s3", 3, 5)}); err != nil {
+		t.Fatal(err)
+	}
+	base := "/api/v1/projects/" + project.ID + "/costs?start=2025-06-01&end=2025-06-08&groupBy=service"
+
+	type series struct {
+		Group        map[string]string `json:"group"`
+		TotalNetCost float64           `json:"totalNetCost"`
+	}
+	get := func(query string) (float64, map[string]float64) {
+		t.Helper()
+		w := doRequest(srv, http.MethodGet, query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, w.Code, w.Body)
+		}
+		var resp struct {
+			TotalNetCost float64  `json:"totalNetCost"`
+			Series       []series `json:"series"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		byService := make(map[string]float64)
+		for _, s := range resp.Series {
+			byService[s.Group["service"]] = s.TotalNetCost
+		}
+		return resp.TotalNetCost, byService
+	}
+	// A label predicate no record can fail forces the raw records, so both
+	// paths can be compared.
+	check := func(want map[string]float64) {
+		t.Helper()
+		for _, query := range []string{base, base + "&labelMissing=nothing"} {
+			var sum float64
+			for _, v := range want {
+				sum += v
+			}
+			total, got := get(query)
+			if total != sum || !maps.Equal(got, want) {
+				t.Errorf("%s: expected %v (total %v), got %v (total %v)", query, want, sum, got, total)
+			}
+		}
+	}
+	check(map[string]float64{"ec2": 10, "s3": 5})
+
+	// Re-inserting a record replaces it, moving its cost between groups.
+	if err := st.InsertCostRecords(ctx, []*models.CostRecord{record("r2", "ec2", 3, 7)}); err != nil {
+		t.Fatal(err)
+	}
+	check(map[string]float64{"ec2": 17})
+
+	if w := doRequest(srv, http.MethodPost, "/api/v1/rollups/rebuild?projectId="+project.ID, ""); w.Code != http.StatusOK {
+		t.Fatalf("rebuild: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	check(map[string]float64{"ec2": 17})
+	if w := doRequest(srv, http.MethodPost, "/api/v1/rollups/rebuild?projectId=missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("rebuild of an unknown project: expected 404, got %d", w.Code)
+	}
+	if w := doRequest(srv, http.MethodPost, "/api/v1/rollups/rebuild", ""); w.Code != http.StatusOK {
+		t.Errorf("rebuild of all projects: expected 200, got %d", w.Code)
+	}
+	if total, _ := get("/api/v1/projects/" + project.ID + "/costs"); total != 567 {
+		t.Errorf("expected all-time total 567 after rebuilding everything, got %v", total)
+	}
+}
+
+func TestProjectCosts_Ingest(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, aws, _ := setupBudgetProject(t, st)
+	ctx := context.Background()
+	day := time.Date(2025, time.June, 2, 0, 0, 0, 0, time.UTC)
+	records := func(n int, cost float64, err error) iter.Seq2[*models.CostRecord, error] {
+		return func(yield func(*models.CostRecord, error) bool) {
+			for i := range n {
+				r := &models.CostRecord{ID: fmt.Sprintf("r%d", i), ProjectID: project.ID, CostSourceID: aws.ID, Provider: "aws", Service: "ec2",
+					StartTime: day, EndTime: day.Add(time.Hour), NetCost: cost, Labels: map[string]string{"n": strconv.Itoa(i)}}
+				if !yield(r, nil) {
+					return
+				}
+			}
+			if err != nil {
+				yield(nil, err)
+			}
+		}
+	}
+	total := func(query string) float64 {
+		t.Helper()
+		w := doRequest(srv, http.MethodGet, "/api/v1/projects/"+project.ID+"/costs?start=2025-06-01&end=2025-06-08"+query, "")
+		var resp struct {
+			TotalNetCost float64 `json:"totalNetCost"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp.TotalNetCost
+	}
+
+	// More records than fit one chunk, so the last chunk is partial.
+	n := store.IngestChunkSize + 10
+	if count, err := st.IngestCostRecords(ctx, records(n, 1, nil)); err != nil || count != n {
+		t.Fatalf("ingest: got %d, %v; want %d records", count, err, n)
+	}
+	if got := total(""); got != float64(n) {
+		t.Errorf("expected total %d, got %v", n, got)
+	}
+	if got := total("&label=n%3D7"); got != 1 {
+		t.Errorf("expected the labelled record's cost 1, got %v", got)
+	}
+
+	// Re-ingesting replaces the records; a failure part way keeps the chunks
+	// before it.
+	count, err := st.IngestCostRecords(ctx, records(store.IngestChunkSize+3, 2, errors.New("source went away")))
+	if err == nil || count != store.IngestChunkSize {
+		t.Fatalf("failed ingest: got %d, %v; want the first chunk and an error", count, err)
+	}
+	if want := float64(2*store.IngestChunkSize + 10); total("") != want {
+		t.Errorf("expected total %v after the partial re-ingest, got %v", want, total(""))
+	}
+}
+
+func TestProjectCosts_Export(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, aws, _ := setupBudgetProject(t, st)
+	now := time.Now().UTC()
+	records := []*models.CostRecord{{ProjectID: project.ID, CostSourceID: aws.ID, Provider: "aws", Service: "s3", StartTime: now, EndTime: now, NetCost: 3, Labels: map[string]string{"team": "payments"}}}
+	if err := st.InsertCostRecords(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+	base := "/api/v1/projects/" + project.ID + "/costs/export"
+
+	w := doRequest(srv, http.MethodGet, base+"?provider=aws", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("expected 200 text/csv, got %d %s: %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The three aws records, oldest first, with a column for the one label.
+	if len(rows) != 4 || rows[0][len(rows[0])-1] != "label:team" || rows[3][len(rows[3])-1] != "payments" {
+		t.Errorf("unexpected export:\n%v", rows)
+	}
+
+	w = doRequest(srv, http.MethodGet, base+"?format=ndjson&label=team%3Dpayments", "")
+	if lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n"); w.Code != http.StatusOK || len(lines) != 1 {
+		t.Errorf("ndjson: expected one line, got %d: %s", w.Code, w.Body)
+	}
+
+	if w := doRequest(srv, http.MethodGet, base+"?format=xlsx", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: expected 400, got %d", w.Code)
+	}
+
+	entries, _ := st.ListAuditEntries(context.Background(), store.AuditQuery{Action: "costs.export"})
+	if len(entries) != 2 || entries[0].ProjectID != project.ID {
+		t.Errorf("expected 2 audited exports of the project, got %+v", entries)
+	}
+}
+
+func TestProjectCosts_RecordPages(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	base := "/api/v1/projects/" + project.ID + "/costs/records"
+
+	// Follow next links one record at a time. The two records of this
+	// month start together, so the order between them rests on the tie.
+	var costs []float64
+	seen := map[string]bool{}
+	for path := base + "?limit=1"; path != ""; {
+		w := doRequest(srv, http.MethodGet, path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, w.Code, w.Body)
+		}
+		var page struct {
+			Records []*models.CostRecord `json:"records"`
+			Next    string               `json:"next"`
+		}
+		json.NewDecoder(w.Body).Decode(&page)
+		for _, r := range page.Records {
+			if seen[r.ID] {
+				t.Fatalf("record %s returned twice", r.ID)
+			}
+			seen[r.ID] = true
+			costs = append(costs, r.NetCost)
+		}
+		path = page.Next
+	}
+	if len(costs) != 3 || costs[2] != 500 {
+		t.Errorf("expected this month's records then last month's, got %v", costs)
+	}
+
+	w := doRequest(srv, http.MethodGet, base+"?sort=netCost&provider=aws&limit=1", "")
+	var page struct {
+		Records []*models.CostRecord `json:"records"`
+		Next    string               `json:"next"`
+	}
+	json.NewDecoder(w.Body).Decode(&page)
+	if len(page.Records) != 1 || page.Records[0].NetCost != 30 || !strings.Contains(page.Next, "provider=aws") {
+		t.Fatalf("expected the cheapest aws record and a next link keeping the filter, got %+v", page)
+	}
+	w = doRequest(srv, http.MethodGet, page.Next, "")
+	page.Next = ""
+	json.NewDecoder(w.Body).Decode(&page)
+	if len(page.Records) != 1 || page.Records[0].NetCost != 500 || page.Next != "" {
+		t.Errorf("expected the last aws record and no next link, got %+v", page)
+	}
+
+	// A cursor only continues the sort it was issued for.
+	w = doRequest(srv, http.MethodGet, base+"?sort=netCost&limit=1", "")
+	json.NewDecoder(w.Body).Decode(&page)
+	next, err := url.Parse(page.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := next.Query().Get("cursor")
+	for _, q := range []string{"sort=region", "sort=-startTime&cursor=" + cursor, "cursor=garbage", "limit=0"} {
+		if w := doRequest(srv, http.MethodGet, base+"?"+q, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+}
+
+func TestListPages(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	ctx := context.Background()
+	for _, name := range []string{"beta", "alpha", "delta", "gamma"} {
+		if err := st.CreateProject(ctx, &models.Project{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type page struct {
+		Projects []*models.Project `json:"projects"`
+		Next     string            `json:"next"`
+	}
+	var names []string
+	for path := "/api/v1/projects?limit=3&sort=-name"; path != ""; {
+		w := doRequest(srv, http.MethodGet, path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, w.Code, w.Body)
+		}
+		var p page
+		json.NewDecoder(w.Body).Decode(&p)
+		for _, project := range p.Projects {
+			names = append(names, project.Name)
+		}
+		path = p.Next
+	}
+	if want := []string{"gamma", "delta", "beta", "alpha"}; !slices.Equal(names, want) {
+		t.Errorf("expected %v, got %v", want, names)
+	}
+
+	projects, _ := st.ListProjects(ctx)
+	projectID := projects[0].ID
+	expired := time.Now().Add(-time.Hour)
+	for i, pr := range []*models.ProjectRole{
+		{SubjectType: models.SubjectUser, SubjectID: "u-1", Role: models.RoleViewer},
+		{SubjectType: models.SubjectUser, SubjectID: "u-2", Role: models.RoleViewer, ExpiresAt: &expired},
+		{SubjectType: models.SubjectGroup, SubjectID: "g-1", Role: models.RoleEditor},
+	} {
+		pr.ProjectID = projectID
+		if err := st.SetProjectRole(ctx, pr); err != nil {
+			t.Fatalf("role %d: %v", i, err)
+		}
+	}
+	w := doRequest(srv, http.MethodGet, "/api/v1/projects/"+projectID+"/members?limit=1", "")
+	var members struct {
+		Members []*models.ProjectRole `json:"members"`
+		Next    string                `json:"next"`
+	}
+	json.NewDecoder(w.Body).Decode(&members)
+	if len(members.Members) != 1 || members.Members[0].SubjectID != "g-1" || members.Next == "" {
+		t.Fatalf("expected the group first and a next link, got %+v", members)
+	}
+	w = doRequest(srv, http.MethodGet, members.Next, "")
+	members.Next = ""
+	json.NewDecoder(w.Body).Decode(&members)
+	if len(members.Members) != 1 || members.Members[0].SubjectID != "u-1" || members.Next != "" {
+		t.Errorf("expected the unexpired user last, got %+v", members)
+	}
+
+	for _, email := range []string{"b@example.com", "a@example.com"} {
+		if err := st.CreateUser(ctx, &models.User{Email: email, Active: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w = doRequest(srv, http.MethodGet, "/api/v1/users?limit=1", "")
+	var users struct {
+		Users []*models.User `json:"users"`
+		Next  string         `json:"next"`
+	}
+	json.NewDecoder(w.Body).Decode(&users)
+	if w.Code != http.StatusOK || len(users.Users) != 1 || users.Users[0].Email != "a@example.com" || users.Next == "" {
+		t.Errorf("expected the first user by email and a next link, got %d %+v", w.Code, users)
+	}
+}
+
+func TestProjects_AdmissionMode(t *testing.T) {
+	srv, _ := newTestServerWithStore(t)
+
+	w := doRequest(srv, http.MethodPost, "/api/v1/projects", `{"name":"payments"}`)
+	var project models.Project
+	json.NewDecoder(w.Body).Decode(&project)
+	if project.AdmissionMode != models.AdmissionWarn {
+		t.Errorf("expected new projects to default to warn, got %q", project.AdmissionMode)
+	}
+
+	if w := doRequest(srv, http.MethodPost, "/api/v1/projects", `{"name":"x","admissionMode":"block"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("create with unknown mode: expected 400, got %d", w.Code)
+	}
+	path := "/api/v1/projects/" + project.ID
+	if w := doRequest(srv, http.MethodPut, path, `{"admissionMode":"block"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("update with unknown mode: expected 400, got %d", w.Code)
+	}
+	w = doRequest(srv, http.MethodPut, path, `{"admissionMode":"deny"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var updated models.Project
+	json.NewDecoder(doRequest(srv, http.MethodGet, path, "").Body).Decode(&updated)
+	if updated.AdmissionMode != models.AdmissionDeny || updated.Name != "payments" {
+		t.Errorf("expected payments in deny mode, got %+v", updated)
+	}
+}
+
+func TestCostSources_ScopedToProject(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	_, aws, _ := setupBudgetProject(t, st)
+	other := &models.Project{Name: "search"}
+	if err := st.CreateProject(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+	foreign := "/api/v1/projects/" + other.ID + "/sources/" + aws.ID
+
+	if w := doRequest(srv, http.MethodGet, foreign, ""); w.Code != http.StatusNotFound {
+		t.Errorf("get through another project: expected 404, got %d", w.Code)
+	}
+	if w := doRequest(srv, http.MethodDelete, foreign, ""); w.Code != http.StatusNotFound {
+		t.Errorf("delete through another project: expected 404, got %d", w.Code)
+	}
+	if cs, _ := st.GetCostSource(context.Background(), aws.ID); cs == nil {
+		t.Fatal("expected the source to survive a delete through another project")
+	}
+
+	own := "/api/v1/projects/" + aws.ProjectID + "/sources/" + aws.ID
+	if w := doRequest(srv, http.MethodGet, own, ""); w.Code != http.StatusOK {
+		t.Errorf("get: expected 200, got %d", w.Code)
+	}
+	if w := doRequest(srv, http.MethodDelete, own, ""); w.Code != http.StatusOK {
+		t.Errorf("delete: expected 200, got %d", w.Code)
+	}
+	if w := doRequest(srv, http.MethodDelete, own, ""); w.Code != http.StatusNotFound {
+		t.Errorf("delete again: expected 404, got %d", w.Code)
+	}
+}
+
+func TestProjects_CreatorBecomesAdmin(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	user := &models.User{Email: "dev@example.com", OIDCSubject: "dev"}
+	if err := st.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/projects", strings.NewReader(`{"name":"payments"}`))
+	req = req.WithContext(auth.WithUser(req.Context(), &auth.SessionData{UserID: user.ID, Email: user.Email}))
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var project models.Project
+	json.NewDecoder(w.Body).Decode(&project)
+
+	roles, err := st.ListProjectRoles(context.Background(), project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[0].SubjectType != models.SubjectUser || roles[0].SubjectID != user.ID || roles[0].Role != models.RoleAdmin {
+		t.Errorf("expected the creator as the project's admin, got %+v", roles)
+	}
+	entries, _ := st.ListAuditEntries(context.Background(), store.AuditQuery{Action: "member.add", ProjectID: project.ID})
+	if len(entries) != 1 {
+		t.Errorf("expected the creator's role audited, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/report"
+)
+
+// reportRequest is the body accepted when creating or replacing a report.
+type reportRequest struct {
+	Name       string              `json:"name"`
+	Schedule   string              `json:"schedule"`
+	Timezone   string              `json:"timezone"`
+	Recipients []string            `json:"recipients"`
+	Format     models.ReportFormat `json:"format"`
+	Filter     models.CostFilter   `json:"filter"`
+	Enabled    *bool               `json:"enabled"`
+}
+
+// @Summary      Create a scheduled report
+// @Description  Add a cost report emailed to recipients on a cron schedule (e.g. "0 8 * * MON"), evaluated in timezone (default UTC).
+// @Description  Each run covers the seven days before the run day: spend and its week-over-week change, the top 10 services and budget status, as an HTML email or a CSV attachment (format html or csv, default html).
+// @Tags         Reports
+// @Accept       json
+// @Produce      json
+// @Param        projectID  path      string                                                                                                          true  "Project ID"
+// @Param        body       body      object{name=string,schedule=string,timezone=string,recipients=[]string,format=string,filter=object,enabled=bool}  true  "Report fields"
+// @Success      201        {object}  models.Report
+// @Failure      400        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/reports [post]
+func (s *Server) handleCreateReport(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+
+	var req reportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	rep := &models.Report{ProjectID: projectID, Enabled: true}
+	if !applyReportRequest(w, rep, req) {
+		return
+	}
+
+	if err := s.store.CreateReport(r.Context(), rep); err != nil {
+		s.logger.Error("failed to create report", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create report"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "report.create",
+		TargetType: audit.TargetReport,
+		TargetID:   rep.ID,
+		ProjectID:  projectID,
+		After:      rep,
+	})
+
+	writeJSON(w, http.StatusCreated, rep)
+}
+
+// @Summary      List scheduled reports
+// @Description  Returns all scheduled reports of a project
+// @Tags         Reports
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Success      200        {object}  object{reports=[]models.Report}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/reports [get]
+func (s *Server) handleListReports(w http.ResponseWriter, r *http.Request) {
+	reports, err := s.store.ListReports(r.Context(), chi.URLParam(r, "projectID"))
+	if err != nil {
+		s.logger.Error("failed to list reports", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list reports"})
+		return
+	}
+	if reports == nil {
+		reports = []*models.Report{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"reports": reports})
+}
+
+// @Summary      Get a scheduled report
+// @Description  Returns a single scheduled report by ID, with its next run and the outcome of its last one
+// @Tags         Reports
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Param        reportID   path      string  true  "Report ID"
+// @Success      200        {object}  models.Report
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/reports/{reportID} [get]
+func (s *Server) handleGetReport(w http.ResponseWriter, r *http.Request) {
+	rep, ok := s.loadReport(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, rep)
+}
+
+// @Summary      Update a scheduled report
+// @Description  Replace a report's name, schedule, timezone, recipients, format, filter and enabled flag. The next run is recomputed.
+// @Tags         Reports
+// @Accept       json
+// @Produce      json
+// @Param        projectID  path      string                                                                                                          true  "Project ID"
+// @Param        reportID   path      string                                                                                                          true  "Report ID"
+// @Param        body       body      object{name=string,schedule=string,timezone=string,recipients=[]string,format=string,filter=object,enabled=bool}  true  "Report fields"
+// @Success      200        {object}  models.Report
+// @Failure      400        {object}  object{error=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/reports/{reportID} [put]
+func (s *Server) handleUpdateReport(w http.ResponseWriter, r *http.Request) {
+	rep, ok := s.loadReport(w, r)
+	if !ok {
+		return
+	}
+
+	var req reportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	before := *rep
+	if !applyReportRequest(w, rep, req) {
+		return
+	}
+
+	if err := s.store.UpdateReport(r.Context(), rep); err != nil {
+		s.logger.Error("failed to update report", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update report"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "report.update",
+		TargetType: audit.TargetReport,
+		TargetID:   rep.ID,
+		ProjectID:  rep.ProjectID,
+		Before:     before,
+		After:      rep,
+	})
+
+	writeJSON(w, http.StatusOK, rep)
+}
+
+// @Summary      Delete a scheduled report
+// @Description  Remove a scheduled report from a project
+// @Tags         Reports
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Param        reportID   path      string  true  "Report ID"
+// @Success      200        {object}  object{status=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/reports/{reportID} [delete]
+func (s *Server) handleDeleteReport(w http.ResponseWriter, r *http.Request) {
+	rep, ok := s.loadReport(w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteReport(r.Context(), rep.ID); err != nil {
+		s.logger.Error("failed to delete report", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete report"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "report.delete",
+		TargetType: audit.TargetReport,
+		TargetID:   rep.ID,
+		ProjectID:  rep.ProjectID,
+		Before:     rep,
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// @Summary      Preview a scheduled report
+// @Description  Render the report as a run now would, without sending it: the HTML email for html reports, the CSV attachment for csv reports.
+// @Tags         Reports
+// @Produce      html
+// @Produce      text/csv
+// @Param        projectID  path      string  true  "Project ID"
+// @Param        reportID   path      string  true  "Report ID"
+// @Success      200        {string}  string
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Failure      503        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/reports/{reportID}/preview [get]
+func (s *Server) handlePreviewReport(w http.ResponseWriter, r *http.Request) {
+	rep, ok := s.loadReport(w, r)
+	if !ok {
+		return
+	}
+	if s.reporter == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "reports are not available"})
+		return
+	}
+	out, err := s.reporter.Preview(r.Context(), rep)
+	if err != nil {
+		s.logger.Error("failed to render report", "report", rep.ID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to render report"})
+		return
+	}
+
+	if out.Attachment != nil {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `inline; filename="`+out.AttachmentName+`"`)
+		w.Write(out.Attachment)
+		return
+	}
+	w.Header().Set("Content-Type", out.ContentType)
+	w.Write([]byte(out.Body))
+}
+
+// @Summary      Send a scheduled report now
+// @Description  Render the report and email it to its recipients immediately. The schedule is not changed.
+// @Tags         Reports
+// @Produce      json
+// @Param        projectID  path      string  true  "Project ID"
+// @Param        reportID   path      string  true  "Report ID"
+// @Success      200        {object}  object{status=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      502        {object}  object{error=string}
+// @Failure      503        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /projects/{projectID}/reports/{reportID}/send [post]
+func (s *Server) handleSendReport(w http.ResponseWriter, r *http.Request) {
+	rep, ok := s.loadReport(w, r)
+	if !ok {
+		return
+	}
+	if s.reporter == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "reports are not available"})
+		return
+	}
+	if err := s.reporter.Send(r.Context(), rep); err != nil {
+		s.logger.Warn("report send failed", "report", rep.ID, "error", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "delivery failed: " + err.Error()})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "report.send",
+		TargetType: audit.TargetReport,
+		TargetID:   rep.ID,
+		ProjectID:  rep.ProjectID,
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+}
+
+// loadReport fetches the report named by the URL and writes a 404 unless it
+// belongs to the project in the URL.
+func (s *Server) loadReport(w http.ResponseWriter, r *http.Request) (*models.Report, bool) {
+	rep, err := s.store.GetReport(r.Context(), chi.URLParam(r, "reportID"))
+	if err != nil {
+		s.logger.Error("failed to get report", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get report"})
+		return nil, false
+	}
+	if rep == nil || rep.ProjectID != chi.URLParam(r, "projectID") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "report not found"})
+		return nil, false
+	}
+	return rep, true
+}
+
+// applyReportRequest validates req and copies it onto rep, scheduling the
+// next run of enabled reports. It writes a 400 and returns false when the
+// request is invalid.
+func applyReportRequest(w http.ResponseWriter, rep *models.Report, req reportRequest) bool {
+	next := *rep
+	next.Name = req.Name
+	next.Schedule = req.Schedule
+	next.Timezone = req.Timezone
+	if next.Timezone == "" {
+		next.Timezone = "UTC"
+	}
+	next.Recipients = req.Recipients
+	next.Format = req.Format
+	if next.Format == "" {
+		next.Format = models.ReportHTML
+	}
+	next.Filter = req.Filter
+	if req.Enabled != nil {
+		next.Enabled = *req.Enabled
+	}
+	if err := report.Validate(&next); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	if err := validateCostFilter(next.Filter); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+
+	next.NextRunAt = nil
+	if next.Enabled {
+		at, err := report.NextRun(&next, time.Now())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return false
+		}
+		next.NextRunAt = &at
+	}
+	*rep = next
+	return true
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/report"
+)
+
+func TestReports_CRUD(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	base := "/api/v1/projects/" + project.ID + "/reports"
+
+	w := doRequest(srv, http.MethodPost, base, `{"name":"Weekly","schedule":"0 8 * * MON","recipients":["finance@example.com"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var created models.Report
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Timezone != "UTC" || created.Format != models.ReportHTML || !created.Enabled || created.NextRunAt == nil {
+		t.Errorf("expected an enabled, scheduled HTML report in UTC, got %+v", created)
+	}
+
+	w = doRequest(srv, http.MethodPut, base+"/"+created.ID, `{"name":"Weekly","schedule":"0 8 * * MON","recipients":["finance@example.com"],"format":"csv","enabled":false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var updated models.Report
+	json.NewDecoder(doRequest(srv, http.MethodGet, base+"/"+created.ID, "").Body).Decode(&updated)
+	if updated.Enabled || updated.Format != models.ReportCSV || updated.NextRunAt != nil {
+		t.Errorf("expected a disabled, unscheduled CSV report, got %+v", updated)
+	}
+
+	var list struct {
+		Reports []models.Report `json:"reports"`
+	}
+	json.NewDecoder(doRequest(srv, http.MethodGet, base, "").Body).Decode(&list)
+	if len(list.Reports) != 1 {
+		t.Errorf("expected 1 report, got %d", len(list.Reports))
+	}
+
+	if w := doRequest(srv, http.MethodDelete, base+"/"+created.ID, ""); w.Code != http.StatusOK {
+		t.Errorf("delete: expected 200, got %d", w.Code)
+	}
+	if w := doRequest(srv, http.MethodGet, base+"/"+created.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete: expected 404, got %d", w.Code)
+	}
+}
+
+func TestReports_Validation(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	base := "/api/v1/projects/" + project.ID + "/reports"
+
+	for _, body := range []string{
+		`{"schedule":"0 8 * * MON","recipients":["a@example.com"]}`,
+		`{"name":"a","schedule":"mondays","recipients":["a@example.com"]}`,
+		`{"name":"a","schedule":"0 8 * * MON","recipients":[]}`,
+		`{"name":"a","schedule":"0 8 * * MON","recipients":["a@example.com"],"timezone":"Nowhere/Land"}`,
+		`{"name":"a","schedule":"0 8 * * MON","recipients":["a@example.com"],"format":"pdf"}`,
+		`{"name":"a","schedule":"0 8 * * MON","recipients":["a@example.com"],"filter":{"labels":{"":"x"}}}`,
+	} {
+		if w := doRequest(srv, http.MethodPost, base, body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestReports_PreviewAndSend(t *testing.T) {
+	srv, st := newTestServerWithStore(t)
+	project, _, _ := setupBudgetProject(t, st)
+	base := "/api/v1/projects/" + project.ID + "/reports"
+
+	w := doRequest(srv, http.MethodPost, base, `{"name":"Weekly","schedule":"0 8 * * MON","recipients":["finance@example.com"],"format":"csv"}`)
+	var created models.Report
+	json.NewDecoder(w.Body).Decode(&created)
+
+	if w := doRequest(srv, http.MethodGet, base+"/"+created.ID+"/preview", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("without a reporter: expected 503, got %d", w.Code)
+	}
+
+	srv.reporter = report.New(st, report.Config{}, testLogger())
+	w = doRequest(srv, http.MethodGet, base+"/"+created.ID+"/preview", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("preview: expected 200 text/csv, got %d %s: %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	if !strings.HasPrefix(w.Body.String(), "section,name,spend") || !strings.Contains(w.Body.String(), "total,payments,") {
+		t.Errorf("unexpected preview:\n%s", w.Body)
+	}
+
+	// Without an SMTP relay the send fails and says why.
+	w = doRequest(srv, http.MethodPost, base+"/"+created.ID+"/send", "")
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "FINGUARD_SMTP_ADDR") {
+		t.Errorf("send: expected 502 naming the missing relay, got %d: %s", w.Code, w.Body)
+	}
+}
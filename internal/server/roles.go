@@ -0,0 +1,288 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/auth"
+	"github.com/inelson/finguard/internal/models"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// @Summary      List permissions
+// @Description  Returns every permission that can be granted by a role. Source write permissions may also be scoped to a source type, e.g. sources:write:kubernetes.
+// @Tags         Roles
+// @Produce      json
+// @Success      200  {object}  object{permissions=[]string}
+// @Security     SessionAuth
+// @Router       /permissions [get]
+func (s *Server) handleListPermissions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"permissions": models.AllPermissions})
+}
+
+// @Summary      List roles
+// @Description  Returns the built-in roles followed by all custom roles
+// @Tags         Roles
+// @Produce      json
+// @Success      200  {object}  object{roles=[]models.RoleDefinition}
+// @Failure      500  {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /roles [get]
+func (s *Server) handleListRoles(w http.ResponseWriter, r *http.Request) {
+	custom, err := s.store.ListRoles(r.Context())
+	if err != nil {
+		s.logger.Error("failed to list roles", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list roles"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"roles": append(auth.BuiltinRoles(), custom...)})
+}
+
+// @Summary      Get a role
+// @Description  Returns a built-in or custom role by name
+// @Tags         Roles
+// @Produce      json
+// @Param        roleName  path      string  true  "Role name"
+// @Success      200       {object}  models.RoleDefinition
+// @Failure      404       {object}  object{error=string}
+// @Failure      500       {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /roles/{roleName} [get]
+func (s *Server) handleGetRole(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "roleName")
+	for _, role := range auth.BuiltinRoles() {
+		if role.Name == name {
+			writeJSON(w, http.StatusOK, role)
+			return
+		}
+	}
+	role, err := s.store.GetRole(r.Context(), name)
+	if err != nil {
+		s.logger.Error("failed to get role", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get role"})
+		return
+	}
+	if role == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "role not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, role)
+}
+
+// @Summary      Create a custom role
+// @Description  Define a named set of permissions that can be assigned to project members. Requires platform admin.
+// @Tags         Roles
+// @Accept       json
+// @Produce      json
+// @Param        body  body      object{name=string,description=string,permissions=[]string}  true  "Role definition"
+// @Success      201   {object}  models.RoleDefinition
+// @Failure      400   {object}  object{error=string}
+// @Failure      403   {object}  object{error=string}
+// @Failure      409   {object}  object{error=string}
+// @Failure      500   {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /roles [post]
+func (s *Server) handleCreateRole(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name        string              `json:"name"`
+		Description string              `json:"description"`
+		Permissions []models.Permission `json:"permissions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if !roleNamePattern.MatchString(req.Name) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name must be lowercase letters, digits and dashes"})
+		return
+	}
+	if msg := validatePermissions(req.Permissions); msg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+
+	exists, err := s.roleExists(r, models.Role(req.Name))
+	if err != nil {
+		s.logger.Error("failed to get role", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create role"})
+		return
+	}
+	if exists {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "role already exists"})
+		return
+	}
+
+	role := &models.RoleDefinition{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+	}
+	if err := s.store.CreateRole(r.Context(), role); err != nil {
+		s.logger.Error("failed to create role", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create role"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "role.create",
+		TargetType: audit.TargetRole,
+		TargetID:   role.Name,
+		After:      role,
+	})
+
+	writeJSON(w, http.StatusCreated, role)
+}
+
+// @Summary      Update a custom role
+// @Description  Change a custom role's description and/or permissions. Built-in roles cannot be edited. Requires platform admin.
+// @Tags         Roles
+// @Accept       json
+// @Produce      json
+// @Param        roleName  path      string                                        true  "Role name"
+// @Param        body      body      object{description=string,permissions=[]string}  true  "Fields to update"
+// @Success      200       {object}  models.RoleDefinition
+// @Failure      400       {object}  object{error=string}
+// @Failure      403       {object}  object{error=string}
+// @Failure      404       {object}  object{error=string}
+// @Failure      500       {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /roles/{roleName} [put]
+func (s *Server) handleUpdateRole(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "roleName")
+	if auth.IsBuiltinRole(name) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "built-in roles cannot be modified"})
+		return
+	}
+
+	existing, err := s.store.GetRole(r.Context(), name)
+	if err != nil {
+		s.logger.Error("failed to get role", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update role"})
+		return
+	}
+	if existing == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "role not found"})
+		return
+	}
+
+	var req struct {
+		Description *string             `json:"description"`
+		Permissions []models.Permission `json:"permissions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+
+	before := *existing
+	if req.Description != nil {
+		existing.Description = *req.Description
+	}
+	if req.Permissions != nil {
+		if msg := validatePermissions(req.Permissions); msg != "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+			return
+		}
+		existing.Permissions = req.Permissions
+	}
+
+	if err := s.store.UpdateRole(r.Context(), existing); err != nil {
+		s.logger.Error("failed to update role", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update role"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "role.update",
+		TargetType: audit.TargetRole,
+		TargetID:   name,
+		Before:     before,
+		After:      existing,
+	})
+
+	writeJSON(w, http.StatusOK, existing)
+}
+
+// @Summary      Delete a custom role
+// @Description  Delete a custom role that is no longer assigned to any project member. Requires platform admin.
+// @Tags         Roles
+// @Produce      json
+// @Param        roleName  path      string  true  "Role name"
+// @Success      200       {object}  object{status=string}
+// @Failure      400       {object}  object{error=string}
+// @Failure      403       {object}  object{error=string}
+// @Failure      404       {object}  object{error=string}
+// @Failure      409       {object}  object{error=string}
+// @Failure      500       {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /roles/{roleName} [delete]
+func (s *Server) handleDeleteRole(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "roleName")
+	if auth.IsBuiltinRole(name) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "built-in roles cannot be deleted"})
+		return
+	}
+
+	existing, err := s.store.GetRole(r.Context(), name)
+	if err != nil {
+		s.logger.Error("failed to get role", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete role"})
+		return
+	}
+	if existing == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "role not found"})
+		return
+	}
+
+	assigned, err := s.store.CountRoleAssignments(r.Context(), name)
+	if err != nil {
+		s.logger.Error("failed to count role assignments", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete role"})
+		return
+	}
+	if assigned > 0 {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "role is still assigned to project members"})
+		return
+	}
+
+	if err := s.store.DeleteRole(r.Context(), name); err != nil {
+		s.logger.Error("failed to delete role", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete role"})
+		return
+	}
+
+	s.recordAudit(r, audit.Event{
+		Action:     "role.delete",
+		TargetType: audit.TargetRole,
+		TargetID:   name,
+		Before:     existing,
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// roleExists reports whether role names a built-in or custom role.
+func (s *Server) roleExists(r *http.Request, role models.Role) (bool, error) {
+	if auth.IsBuiltinRole(string(role)) {
+		return true, nil
+	}
+	def, err := s.store.GetRole(r.Context(), string(role))
+	return def != nil, err
+}
+
+func validatePermissions(perms []models.Permission) string {
+	if len(perms) == 0 {
+		return "at least one permission is required"
+	}
+	for _, p := range perms {
+		if err := auth.ValidatePermission(p); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
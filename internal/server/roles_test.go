@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+func TestRoles_CRUD(t *testing.T) {
+	srv, _ := newTestServerWithStore(t)
+
+	w := doRequest(srv, http.MethodPost, "/api/v1/roles", `{"name":"finance","permissions":["costs:read","budgets:write"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create role: expected 201, got %d: %s", w.Code, w.Body)
+	}
+
+	w = doRequest(srv, http.MethodGet, "/api/v1/roles", "")
+	var body struct {
+		Roles []models.RoleDefinition `json:"roles"`
+	}
+	json.NewDecoder(w.Body).Decode(&body)
+	if len(body.Roles) != 4 || body.Roles[3].Name != "finance" || body.Roles[3].BuiltIn {
+		t.Fatalf("expected three built-ins followed by finance, got %+v", body.Roles)
+	}
+
+	w = doRequest(srv, http.MethodPut, "/api/v1/roles/finance", `{"permissions":["costs:read"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update role: expected 200, got %d", w.Code)
+	}
+
+	w = doRequest(srv, http.MethodPost, "/api/v1/projects", `{"name":"payments"}`)
+	var project models.Project
+	json.NewDecoder(w.Body).Decode(&project)
+	w = doRequest(srv, http.MethodPost, "/api/v1/projects/"+project.ID+"/members", `{"subjectType":"user","subjectId":"u-1","role":"finance"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("assign custom role: expected 201, got %d", w.Code)
+	}
+
+	if w = doRequest(srv, http.MethodDelete, "/api/v1/roles/finance", ""); w.Code != http.StatusConflict {
+		t.Errorf("delete assigned role: expected 409, got %d", w.Code)
+	}
+	doRequest(srv, http.MethodDelete, "/api/v1/projects/"+project.ID+"/members/u-1", "")
+	if w = doRequest(srv, http.MethodDelete, "/api/v1/roles/finance", ""); w.Code != http.StatusOK {
+		t.Errorf("delete unassigned role: expected 200, got %d", w.Code)
+	}
+}
+
+func TestRoles_Validation(t *testing.T) {
+	srv, _ := newTestServerWithStore(t)
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, "/api/v1/roles", `{"name":"editor","permissions":["costs:read"]}`, http.StatusConflict},
+		{http.MethodPost, "/api/v1/roles", `{"name":"Bad Name","permissions":["costs:read"]}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/roles", `{"name":"x","permissions":["costs:write"]}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/roles", `{"name":"x","permissions":[]}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/roles/admin", `{"permissions":["costs:read"]}`, http.StatusBadRequest},
+		{http.MethodDelete, "/api/v1/roles/viewer", ``, http.StatusBadRequest},
+		{http.MethodDelete, "/api/v1/roles/missing", ``, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := doRequest(srv, tt.method, tt.path, tt.body); w.Code != tt.want {
+			t.Errorf("%s %s %s: expected %d, got %d", tt.method, tt.path, tt.body, tt.want, w.Code)
+		}
+	}
+}
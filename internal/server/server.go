@@ -2,10 +2,17 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/fs"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/coder/websocket"
@@ -13,11 +20,18 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	corev1 "k8s.io/api/core/v1"
 
+	"github.com/inelson/finguard/internal/admission"
+	"github.com/inelson/finguard/internal/audit"
 	"github.com/inelson/finguard/internal/auth"
 	"github.com/inelson/finguard/internal/clustercache"
 	"github.com/inelson/finguard/internal/config"
+	"github.com/inelson/finguard/internal/enforcement"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/notify"
 	"github.com/inelson/finguard/internal/opencostproxy"
 	pluginmgr "github.com/inelson/finguard/internal/plugin"
+	"github.com/inelson/finguard/internal/report"
+	"github.com/inelson/finguard/internal/scim"
 	"github.com/inelson/finguard/internal/store"
 	"github.com/inelson/finguard/internal/stream"
 	"github.com/inelson/finguard/pkg/api"
@@ -34,12 +48,20 @@ type Server struct {
 	pluginMgr  *pluginmgr.Manager
 	store      store.Store
 	auth       *auth.Manager
+	rbac       *auth.RBAC
+	auditor    *audit.Recorder
+	enforcer   *enforcement.Enforcer
+	notifier   *notify.Notifier
+	reporter   *report.Reporter
 	frontendFS fs.FS
 	logger     *slog.Logger
 	http       *http.Server
+	// admission serves the admission webhook on its own TLS listener; it is
+	// nil when the webhook is disabled.
+	admission *http.Server
 }
 
-func New(cfg *config.Config, hub *stream.Hub, proxy *opencostproxy.Proxy, cc *clustercache.Cache, pm *pluginmgr.Manager, st store.Store, am *auth.Manager, frontendFS fs.FS, logger *slog.Logger) *Server {
+func New(cfg *config.Config, hub *stream.Hub, proxy *opencostproxy.Proxy, cc *clustercache.Cache, pm *pluginmgr.Manager, st store.Store, am *auth.Manager, auditor *audit.Recorder, enforcer *enforcement.Enforcer, notifier *notify.Notifier, reporter *report.Reporter, frontendFS fs.FS, logger *slog.Logger) *Server {
 	s := &Server{
 		cfg:        cfg,
 		hub:        hub,
@@ -48,6 +70,11 @@ func New(cfg *config.Config, hub *stream.Hub, proxy *opencostproxy.Proxy, cc *cl
 		pluginMgr:  pm,
 		store:      st,
 		auth:       am,
+		rbac:       auth.NewRBAC(st, am == nil || am.IsDisabled()),
+		auditor:    auditor,
+		enforcer:   enforcer,
+		notifier:   notifier,
+		reporter:   reporter,
 		frontendFS: frontendFS,
 		logger:     logger,
 	}
@@ -59,9 +86,59 @@ func New(cfg *config.Config, hub *stream.Hub, proxy *opencostproxy.Proxy, cc *cl
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	if cfg.AdmissionWebhook && st != nil {
+		s.admission = &http.Server{
+			Addr:         cfg.AdmissionAddr,
+			Handler:      s.admissionRoutes(),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			IdleTimeout:  60 * time.Second,
+			ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+		}
+	}
 	return s
 }
 
+func (s *Server) admissionWebhook() *admission.Webhook {
+	cfg := admission.Config{
+		Pricing:         admission.Pricing{CPUCoreHour: s.cfg.AdmissionCPUHourly, MemoryGiBHour: s.cfg.AdmissionMemoryGiBHourly},
+		FiscalYearStart: s.cfg.FiscalYearStartMonth,
+	}
+	if s.cache == nil {
+		return admission.New(s.store, nil, nil, cfg, s.logger)
+	}
+	return admission.New(s.store, s.cache, s.cache.Clientset(), cfg, s.logger)
+}
+
+// admissionRoutes serves only the admission webhook, which the API server
+// calls and which authenticates with TLS rather than a session.
+func (s *Server) admissionRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	r.Method(http.MethodPost, "/admission/validate", s.admissionWebhook())
+	return r
+}
+
+// admissionTLSConfig requires a client certificate signed by
+// cfg.AdmissionClientCA, if set.
+func admissionTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.AdmissionClientCA == "" {
+		return tlsConfig, nil
+	}
+	data, err := os.ReadFile(cfg.AdmissionClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("read admission client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("admission client CA %s holds no PEM certificates", cfg.AdmissionClientCA)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return tlsConfig, nil
+}
+
 func (s *Server) Router() chi.Router {
 	return s.router
 }
@@ -83,13 +160,40 @@ func (s *Server) routes() chi.Router {
 		r.Get("/logout", s.auth.HandleLogout)
 	}
 
+	// SCIM provisioning authenticates with its own bearer token, not sessions
+	if s.cfg.SCIMToken != "" && s.store != nil {
+		r.Mount("/scim/v2", scim.New(s.store, s.cfg.SCIMToken, s.auditor, s.logger).Routes())
+	}
+
 	r.Route("/api/v1", func(r chi.Router) {
 		if s.auth != nil && !s.auth.IsDisabled() {
 			r.Use(s.auth.Middleware)
 		}
 		r.Get("/me", s.handleMe)
+		r.Get("/me/sessions", s.handleListMySessions)
+		r.Delete("/me/sessions", s.handleRevokeAllMySessions)
+		r.Delete("/me/sessions/{sessionID}", s.handleRevokeMySession)
 		r.Get("/stream", s.handleStream)
 
+		// User and session administration
+		r.With(s.rbac.RequirePlatformAdmin()).Get("/users", s.handleListUsers)
+		r.Route("/users/{userID}/sessions", func(r chi.Router) {
+			r.Use(s.rbac.RequirePlatformAdmin())
+			r.Get("/", s.handleListUserSessions)
+			r.Delete("/", s.handleRevokeUserSessions)
+			r.Delete("/{sessionID}", s.handleRevokeUserSession)
+		})
+
+		// Audit log
+		r.Route("/audit", func(r chi.Router) {
+			r.Use(s.rbac.RequirePlatformAdmin())
+			r.Get("/", s.handleListAudit)
+			r.Get("/export", s.handleExportAudit)
+		})
+
+		// Cost rollup maintenance
+		r.With(s.rbac.RequirePlatformAdmin()).Post("/rollups/rebuild", s.handleRebuildRollups)
+
 		// OpenCost proxy endpoints
 		r.Get("/allocation", s.proxy.ProxyAllocation)
 		r.Get("/assets", s.proxy.ProxyAssets)
@@ -106,17 +210,60 @@ func (s *Server) routes() chi.Router {
 		r.Post("/projects", s.handleCreateProject)
 		r.Get("/projects", s.handleListProjects)
 		r.Route("/projects/{projectID}", func(r chi.Router) {
-			r.Get("/", s.handleGetProject)
-			r.Put("/", s.handleUpdateProject)
-			r.Delete("/", s.handleDeleteProject)
-			r.Post("/sources", s.handleCreateCostSource)
-			r.Get("/sources", s.handleListCostSources)
-			r.Get("/sources/{sourceID}", s.handleGetCostSource)
-			r.Delete("/sources/{sourceID}", s.handleDeleteCostSource)
-			r.Get("/costs", s.handleGetProjectCosts)
-			r.Post("/members", s.handleAddProjectMember)
-			r.Get("/members", s.handleListProjectMembers)
-			r.Delete("/members/{subjectID}", s.handleRemoveProjectMember)
+			perm := s.rbac.RequirePermission
+			r.With(perm(models.PermProjectsRead)).Get("/", s.handleGetProject)
+			r.With(perm(models.PermProjectsWrite)).Put("/", s.handleUpdateProject)
+			r.With(perm(models.PermProjectsDelete)).Delete("/", s.handleDeleteProject)
+			r.With(perm(models.PermSourcesWrite)).Post("/sources", s.handleCreateCostSource)
+			r.With(perm(models.PermSourcesRead)).Get("/sources", s.handleListCostSources)
+			r.With(perm(models.PermSourcesRead)).Get("/sources/{sourceID}", s.handleGetCostSource)
+			r.With(perm(models.PermSourcesWrite)).Delete("/sources/{sourceID}", s.handleDeleteCostSource)
+			r.With(perm(models.PermCostsRead)).Get("/costs", s.handleGetProjectCosts)
+			r.With(perm(models.PermCostsRead)).Get("/costs/records", s.handleListProjectCostRecords)
+			r.With(perm(models.PermCostsExport)).Get("/costs/export", s.handleExportProjectCosts)
+			r.With(perm(models.PermCostsRead)).Get("/labels", s.handleListProjectLabels)
+			r.With(perm(models.PermBudgetsWrite)).Post("/budgets", s.handleCreateBudget)
+			r.With(perm(models.PermBudgetsRead)).Get("/budgets", s.handleListBudgets)
+			r.With(perm(models.PermBudgetsRead)).Get("/budgets/{budgetID}", s.handleGetBudget)
+			r.With(perm(models.PermBudgetsWrite)).Put("/budgets/{budgetID}", s.handleUpdateBudget)
+			r.With(perm(models.PermBudgetsWrite)).Delete("/budgets/{budgetID}", s.handleDeleteBudget)
+			r.With(perm(models.PermBudgetsWrite)).Post("/budgets/{budgetID}/acknowledge", s.handleAcknowledgeBudget)
+			r.With(perm(models.PermBudgetsRead)).Get("/budgets/{budgetID}/enforcements", s.handleListBudgetEnforcements)
+			r.With(perm(models.PermBudgetsEnforce)).Post("/budgets/{budgetID}/enforcements/revert", s.handleRevertBudgetEnforcements)
+			r.With(perm(models.PermNotificationsWrite)).Post("/notification-channels", s.handleCreateChannel)
+			r.With(perm(models.PermNotificationsRead)).Get("/notification-channels", s.handleListChannels)
+			r.With(perm(models.PermNotificationsRead)).Get("/notification-channels/{channelID}", s.handleGetChannel)
+			r.With(perm(models.PermNotificationsWrite)).Put("/notification-channels/{channelID}", s.handleUpdateChannel)
+			r.With(perm(models.PermNotificationsWrite)).Delete("/notification-channels/{channelID}", s.handleDeleteChannel)
+			r.With(perm(models.PermNotificationsWrite)).Post("/notification-channels/{channelID}/test", s.handleTestChannel)
+			r.With(perm(models.PermNotificationsRead)).Get("/notification-channels/{channelID}/deliveries", s.handleListDeliveries)
+			r.With(perm(models.PermNotificationsRead)).Get("/notification-channels/{channelID}/deliveries/{deliveryID}", s.handleGetDelivery)
+			r.With(perm(models.PermNotificationsWrite)).Post("/notification-channels/{channelID}/deliveries/{deliveryID}/redeliver", s.handleRedeliver)
+			r.With(perm(models.PermReportsWrite)).Post("/reports", s.handleCreateReport)
+			r.With(perm(models.PermReportsRead)).Get("/reports", s.handleListReports)
+			r.With(perm(models.PermReportsRead)).Get("/reports/{reportID}", s.handleGetReport)
+			r.With(perm(models.PermReportsWrite)).Put("/reports/{reportID}", s.handleUpdateReport)
+			r.With(perm(models.PermReportsWrite)).Delete("/reports/{reportID}", s.handleDeleteReport)
+			r.With(perm(models.PermReportsRead)).Get("/reports/{reportID}/preview", s.handlePreviewReport)
+			r.With(perm(models.PermReportsWrite)).Post("/reports/{reportID}/send", s.handleSendReport)
+			r.With(perm(models.PermMembersManage)).Post("/members", s.handleAddProjectMember)
+			r.With(perm(models.PermMembersRead)).Get("/members", s.handleListProjectMembers)
+			r.With(perm(models.PermMembersManage)).Delete("/members/{subjectID}", s.handleRemoveProjectMember)
+			r.With(perm(models.PermMembersRead)).Get("/invitations", s.handleListProjectInvitations)
+			r.With(perm(models.PermMembersManage)).Delete("/invitations/{invitationID}", s.handleDeleteProjectInvitation)
+			r.With(perm(models.PermAuditRead)).Get("/audit", s.handleListProjectAudit)
+			r.With(perm(models.PermAuditRead)).Get("/audit/export", s.handleExportProjectAudit)
+		})
+
+		// Custom roles
+		r.Get("/permissions", s.handleListPermissions)
+		r.Get("/roles", s.handleListRoles)
+		r.Get("/roles/{roleName}", s.handleGetRole)
+		r.Group(func(r chi.Router) {
+			r.Use(s.rbac.RequirePlatformAdmin())
+			r.Post("/roles", s.handleCreateRole)
+			r.Put("/roles/{roleName}", s.handleUpdateRole)
+			r.Delete("/roles/{roleName}", s.handleDeleteRole)
 		})
 
 		// Plugin endpoints
@@ -148,8 +295,37 @@ func (s *Server) Start() error {
 	return s.http.ListenAndServe()
 }
 
+// StartAdmission serves the admission webhook over TLS on its own listener
+// until Shutdown. It returns nil at once when the webhook is disabled.
+func (s *Server) StartAdmission() error {
+	if s.admission == nil {
+		return nil
+	}
+	ln, err := net.Listen("tcp", s.cfg.AdmissionAddr)
+	if err != nil {
+		return err
+	}
+	return s.serveAdmission(ln)
+}
+
+func (s *Server) serveAdmission(ln net.Listener) error {
+	tlsConfig, err := admissionTLSConfig(s.cfg)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	s.admission.TLSConfig = tlsConfig
+	s.logger.Info("starting admission webhook", "addr", ln.Addr().String())
+	return s.admission.ServeTLS(ln, s.cfg.AdmissionTLSCert, s.cfg.AdmissionTLSKey)
+}
+
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info("shutting down server")
+	if s.admission != nil {
+		if err := s.admission.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
 	return s.http.Shutdown(ctx)
 }
 
@@ -416,3 +592,51 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 		slog.Error("failed to write json response", "error", err)
 	}
 }
+
+// clearWriteDeadline lifts the server's write timeout for a response that
+// streams for as long as an export takes. A client that goes away still
+// cancels the request.
+func clearWriteDeadline(w http.ResponseWriter) {
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("failed to clear write deadline", "error", err)
+	}
+}
+
+// parsePage reads the sort, cursor and limit query parameters of a list
+// endpoint.
+func parsePage(r *http.Request) (store.PageQuery, error) {
+	params := r.URL.Query()
+	p := store.PageQuery{Sort: params.Get("sort"), Cursor: params.Get("cursor")}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return p, fmt.Errorf("invalid limit: must be a positive integer")
+		}
+		p.Limit = min(n, store.MaxPageLimit)
+	}
+	return p, nil
+}
+
+// writePage writes one page of a list under key, with a link to the next
+// page unless this is the last one. The link repeats the request's filters
+// and sort with the cursor replaced.
+func writePage(w http.ResponseWriter, r *http.Request, key string, items any, next string) {
+	resp := map[string]any{key: items}
+	if next != "" {
+		params := r.URL.Query()
+		params.Set("cursor", next)
+		resp["next"] = r.URL.Path + "?" + params.Encode()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// writePageError answers a failed page query: 400 for a bad sort or cursor,
+// 500 for anything else.
+func (s *Server) writePageError(w http.ResponseWriter, err error, what string) {
+	if errors.Is(err, store.ErrInvalidPage) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	s.logger.Error("failed to list "+what, "error", err)
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list " + what})
+}
@@ -1,15 +1,33 @@
 package server
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"io"
 	"log/slog"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/inelson/finguard/internal/audit"
 	"github.com/inelson/finguard/internal/config"
+	"github.com/inelson/finguard/internal/models"
 	"github.com/inelson/finguard/internal/opencostproxy"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
 	"github.com/inelson/finguard/internal/stream"
 )
 
@@ -25,7 +43,7 @@ func newTestServer() *Server {
 	logger := testLogger()
 	hub := stream.NewHub(logger)
 	proxy := opencostproxy.New(cfg.OpenCostURL, logger)
-	return New(cfg, hub, proxy, nil, nil, nil, nil, nil, logger)
+	return New(cfg, hub, proxy, nil, nil, nil, nil, nil, nil, nil, nil, nil, logger)
 }
 
 func TestHealthz(t *testing.T) {
@@ -134,3 +152,162 @@ func TestPluginsEndpoint_NoManager(t *testing.T) {
 		t.Errorf("expected empty plugins list, got %d", len(plugins))
 	}
 }
+
+// selfSignedCert writes a certificate for 127.0.0.1, which can also sign and
+// act as a client certificate, and its key to dir.
+func selfSignedCert(t *testing.T, dir string) (tls.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "finguard-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair, certFile, keyFile
+}
+
+func TestAdmissionWebhook_TLSListener(t *testing.T) {
+	cert, certFile, keyFile := selfSignedCert(t, t.TempDir())
+	st := storetest.New(t)
+	logger := testLogger()
+	cfg := &config.Config{
+		HTTPAddr:          ":0",
+		OpenCostURL:       "http://localhost:9003",
+		AdmissionWebhook:  true,
+		AdmissionTLSCert:  certFile,
+		AdmissionTLSKey:   keyFile,
+		AdmissionClientCA: certFile,
+	}
+	srv := New(cfg, stream.NewHub(logger), opencostproxy.New(cfg.OpenCostURL, logger), nil, nil, st, nil, audit.NewRecorder(st, logger), nil, nil, nil, nil, logger)
+	review := `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview","request":{"uid":"abc","resource":{"group":"","version":"v1","resource":"pods"},"operation":"CREATE","namespace":"team-a","object":{"spec":{"containers":[{"name":"app"}]}}}}`
+
+	// The main listener does not serve the webhook.
+	if w := doRequest(srv, http.MethodPost, "/admission/validate", review); w.Code == http.StatusOK {
+		t.Error("expected the webhook not to be served on the main listener")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.serveAdmission(ln)
+	t.Cleanup(func() { srv.admission.Close() })
+	url := "https://" + ln.Addr().String() + "/admission/validate"
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Leaf)
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+	}
+
+	if resp, err := client().Post(url, "application/json", strings.NewReader(review)); err == nil {
+		resp.Body.Close()
+		t.Error("expected a client without a certificate to be refused")
+	}
+	if resp, err := http.Post("http://"+ln.Addr().String()+"/admission/validate", "application/json", strings.NewReader(review)); err == nil {
+		if resp.StatusCode == http.StatusOK {
+			t.Error("expected plain HTTP to be refused")
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := client(cert).Post(url, "application/json", strings.NewReader(review))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Response struct {
+			UID     string `json:"uid"`
+			Allowed bool   `json:"allowed"`
+		} `json:"response"`
+	}
+	json.NewDecoder(resp.Body).Decode(&out)
+	if resp.StatusCode != http.StatusOK || out.Response.UID != "abc" || !out.Response.Allowed {
+		t.Errorf("expected an allowed response for uid abc, got %d %+v", resp.StatusCode, out.Response)
+	}
+}
+
+// slowExportStore delays each exported row, so exports outlast a short write
+// timeout.
+type slowExportStore struct {
+	store.Store
+	delay time.Duration
+}
+
+func (s slowExportStore) ExportCostRecords(ctx context.Context, q store.CostQuery, fn func(*models.CostRecord) error) error {
+	return s.Store.ExportCostRecords(ctx, q, func(r *models.CostRecord) error {
+		time.Sleep(s.delay)
+		return fn(r)
+	})
+}
+
+func (s slowExportStore) ExportAuditEntries(ctx context.Context, q store.AuditQuery, fn func(*models.AuditEntry) error) error {
+	return s.Store.ExportAuditEntries(ctx, q, func(e *models.AuditEntry) error {
+		time.Sleep(s.delay)
+		return fn(e)
+	})
+}
+
+func TestExports_OutlastWriteTimeout(t *testing.T) {
+	st := slowExportStore{Store: storetest.New(t), delay: 100 * time.Millisecond}
+	logger := testLogger()
+	cfg := &config.Config{HTTPAddr: ":0", OpenCostURL: "http://localhost:9003"}
+	srv := New(cfg, stream.NewHub(logger), opencostproxy.New(cfg.OpenCostURL, logger), nil, nil, st, nil, audit.NewRecorder(st, logger), nil, nil, nil, nil, logger)
+	project, aws, _ := setupBudgetProject(t, st)
+	for range 2 {
+		if err := st.InsertAuditEntry(context.Background(), &models.AuditEntry{Action: "project.create", TargetType: "project", TargetID: project.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts := httptest.NewUnstartedServer(srv.Router())
+	ts.Config.WriteTimeout = 50 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	for _, path := range []string{"/api/v1/projects/" + project.ID + "/costs/export?provider=aws", "/api/v1/audit/export"} {
+		resp, err := ts.Client().Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected a complete 200 response, got %d (%v)", path, resp.StatusCode, err)
+		}
+		if !strings.Contains(string(body), project.ID) || (path != "/api/v1/audit/export" && !strings.Contains(string(body), aws.ID)) {
+			t.Errorf("%s: expected the exported rows, got %s", path, body)
+		}
+	}
+}
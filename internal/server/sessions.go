@@ -0,0 +1,174 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/inelson/finguard/internal/audit"
+	"github.com/inelson/finguard/internal/auth"
+	"github.com/inelson/finguard/internal/models"
+)
+
+// @Summary      List my sessions
+// @Description  Returns the current user's active sessions across all devices
+// @Tags         Auth
+// @Produce      json
+// @Success      200  {object}  object{sessions=[]models.Session}
+// @Failure      401  {object}  object{error=string}
+// @Failure      500  {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /me/sessions [get]
+func (s *Server) handleListMySessions(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+		return
+	}
+	s.writeUserSessions(w, r, user.UserID)
+}
+
+// @Summary      Revoke one of my sessions
+// @Description  Signs out a single session belonging to the current user
+// @Tags         Auth
+// @Produce      json
+// @Param        sessionID  path      string  true  "Session ID"
+// @Success      200        {object}  object{status=string}
+// @Failure      401        {object}  object{error=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /me/sessions/{sessionID} [delete]
+func (s *Server) handleRevokeMySession(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+		return
+	}
+	s.revokeUserSession(w, r, user.UserID, chi.URLParam(r, "sessionID"))
+}
+
+// @Summary      Log out everywhere
+// @Description  Revokes every session of the current user, including this one
+// @Tags         Auth
+// @Produce      json
+// @Success      200  {object}  object{status=string}
+// @Failure      401  {object}  object{error=string}
+// @Failure      500  {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /me/sessions [delete]
+func (s *Server) handleRevokeAllMySessions(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+		return
+	}
+	if err := s.store.RevokeUserSessions(r.Context(), user.UserID); err != nil {
+		s.logger.Error("failed to revoke sessions", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to revoke sessions"})
+		return
+	}
+	s.recordAudit(r, audit.Event{
+		Action:     "session.revoke_all",
+		TargetType: audit.TargetUser,
+		TargetID:   user.UserID,
+	})
+	auth.ClearSessionCookie(w)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// @Summary      List a user's sessions
+// @Description  Returns the active sessions of any user. Requires platform admin.
+// @Tags         Auth
+// @Produce      json
+// @Param        userID  path      string  true  "User ID"
+// @Success      200     {object}  object{sessions=[]models.Session}
+// @Failure      403     {object}  object{error=string}
+// @Failure      500     {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /users/{userID}/sessions [get]
+func (s *Server) handleListUserSessions(w http.ResponseWriter, r *http.Request) {
+	s.writeUserSessions(w, r, chi.URLParam(r, "userID"))
+}
+
+// @Summary      Revoke all of a user's sessions
+// @Description  Signs a user out of every device, e.g. when deprovisioning. Requires platform admin.
+// @Tags         Auth
+// @Produce      json
+// @Param        userID  path      string  true  "User ID"
+// @Success      200     {object}  object{status=string}
+// @Failure      403     {object}  object{error=string}
+// @Failure      500     {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /users/{userID}/sessions [delete]
+func (s *Server) handleRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if err := s.store.RevokeUserSessions(r.Context(), userID); err != nil {
+		s.logger.Error("failed to revoke user sessions", "userId", userID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to revoke sessions"})
+		return
+	}
+	s.recordAudit(r, audit.Event{
+		Action:     "session.revoke_all",
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+	})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// @Summary      Revoke a user's session
+// @Description  Signs out a single session of any user. Requires platform admin.
+// @Tags         Auth
+// @Produce      json
+// @Param        userID     path      string  true  "User ID"
+// @Param        sessionID  path      string  true  "Session ID"
+// @Success      200        {object}  object{status=string}
+// @Failure      403        {object}  object{error=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /users/{userID}/sessions/{sessionID} [delete]
+func (s *Server) handleRevokeUserSession(w http.ResponseWriter, r *http.Request) {
+	s.revokeUserSession(w, r, chi.URLParam(r, "userID"), chi.URLParam(r, "sessionID"))
+}
+
+func (s *Server) writeUserSessions(w http.ResponseWriter, r *http.Request, userID string) {
+	sessions, err := s.store.ListUserSessions(r.Context(), userID, auth.IdleBefore(time.Now(), s.cfg.SessionIdleTimeout))
+	if err != nil {
+		s.logger.Error("failed to list sessions", "userId", userID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list sessions"})
+		return
+	}
+	if sessions == nil {
+		sessions = []*models.Session{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sessions": sessions})
+}
+
+// revokeUserSession revokes sessionID only if it belongs to userID, so one user
+// cannot probe or end another user's sessions by guessing IDs.
+func (s *Server) revokeUserSession(w http.ResponseWriter, r *http.Request, userID, sessionID string) {
+	sess, err := s.store.GetSession(r.Context(), sessionID)
+	if err != nil {
+		s.logger.Error("failed to get session", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to revoke session"})
+		return
+	}
+	if sess == nil || sess.UserID != userID {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "session not found"})
+		return
+	}
+	if err := s.store.RevokeSession(r.Context(), sessionID); err != nil {
+		s.logger.Error("failed to revoke session", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to revoke session"})
+		return
+	}
+	s.recordAudit(r, audit.Event{
+		Action:     "session.revoke",
+		TargetType: audit.TargetSession,
+		TargetID:   sessionID,
+		Before:     sess,
+	})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
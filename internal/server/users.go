@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+// @Summary      List users
+// @Description  Returns one page of users, by email unless sorted otherwise. Requires platform admin.
+// @Tags         Users
+// @Produce      json
+// @Param        sort    query     string  false  "Sort field: email or createdAt, prefixed with - for descending"
+// @Param        cursor  query     string  false  "Cursor from the previous page's next link"
+// @Param        limit   query     int     false  "Maximum users to return (default 100, max 1000)"
+// @Success      200     {object}  object{users=[]models.User,next=string}
+// @Failure      400     {object}  object{error=string}
+// @Failure      403     {object}  object{error=string}
+// @Failure      500     {object}  object{error=string}
+// @Security     SessionAuth
+// @Router       /users [get]
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	p, err := parsePage(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	users, next, err := s.store.ListUsersPage(r.Context(), p)
+	if err != nil {
+		s.writePageError(w, err, "users")
+		return
+	}
+	if users == nil {
+		users = []*models.User{}
+	}
+	writePage(w, r, "users", users, next)
+}
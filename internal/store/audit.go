@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+const auditColumns = `id, occurred_at, actor_id, actor_email, action, target_type, target_id, project_id, before_json, after_json, request_id, ip_address`
+
+func (s *SQLStore) InsertAuditEntry(ctx context.Context, e *models.AuditEntry) error {
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = now()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO audit_log (`+auditColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.OccurredAt, e.ActorID, e.ActorEmail, e.Action, e.TargetType, e.TargetID, e.ProjectID,
+		rawJSONOrNull(e.Before), rawJSONOrNull(e.After), e.RequestID, e.IPAddress,
+	)
+	return err
+}
+
+// ListAuditEntries returns matching entries, newest first.
+func (s *SQLStore) ListAuditEntries(ctx context.Context, q AuditQuery) ([]*models.AuditEntry, error) {
+	var entries []*models.AuditEntry
+	err := s.ExportAuditEntries(ctx, q, func(e *models.AuditEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// ExportAuditEntries streams matching entries to fn, newest first, without
+// buffering the result set. Iteration stops at the first error returned by fn.
+func (s *SQLStore) ExportAuditEntries(ctx context.Context, q AuditQuery, fn func(*models.AuditEntry) error) error {
+	where, args := buildAuditWhere(q)
+	query := `SELECT ` + auditColumns + ` FROM audit_log` + where + ` ORDER BY occurred_at DESC, id DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+var auditListing = listing[*models.AuditEntry]{
+	keys: map[string]sortKey[*models.AuditEntry]{
+		"occurredAt": {column: "occurred_at", kind: keyTime, value: func(e *models.AuditEntry) any { return e.OccurredAt }},
+		"action":     {column: "action", kind: keyString, value: func(e *models.AuditEntry) any { return e.Action }},
+	},
+	defaultSort: "-occurredAt",
+	tie:         "id",
+	tieValue:    func(e *models.AuditEntry) string { return e.ID },
+}
+
+// ListAuditEntriesPage returns one page of matching entries, newest first
+// unless p sorts by action, and the cursor of the next page. q.Limit is
+// ignored in favour of p.Limit.
+func (s *SQLStore) ListAuditEntriesPage(ctx context.Context, q AuditQuery, p PageQuery) ([]*models.AuditEntry, string, error) {
+	conditions, args := auditConditions(q)
+	return queryPage(ctx, s, auditListing, p, `SELECT `+auditColumns+` FROM audit_log`, conditions, args, scanAuditEntry)
+}
+
+func scanAuditEntry(row rowScanner) (*models.AuditEntry, error) {
+	e := &models.AuditEntry{}
+	var before, after string
+	if err := row.Scan(
+		&e.ID, &e.OccurredAt, &e.ActorID, &e.ActorEmail, &e.Action, &e.TargetType, &e.TargetID, &e.ProjectID,
+		&before, &after, &e.RequestID, &e.IPAddress,
+	); err != nil {
+		return nil, err
+	}
+	e.Before = json.RawMessage(before)
+	e.After = json.RawMessage(after)
+	return e, nil
+}
+
+func buildAuditWhere(q AuditQuery) (string, []any) {
+	conditions, args := auditConditions(q)
+	return joinConditions(conditions), args
+}
+
+func auditConditions(q AuditQuery) ([]string, []any) {
+	var conditions []string
+	var args []any
+
+	if q.ProjectID != "" {
+		conditions = append(conditions, "project_id = ?")
+		args = append(args, q.ProjectID)
+	}
+	if q.ActorID != "" {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, q.ActorID)
+	}
+	if q.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, q.Action)
+	}
+	if q.TargetType != "" {
+		conditions = append(conditions, "target_type = ?")
+		args = append(args, q.TargetType)
+	}
+	if q.TargetID != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, q.TargetID)
+	}
+	if !q.Since.IsZero() {
+		conditions = append(conditions, "occurred_at >= ?")
+		args = append(args, q.Since)
+	}
+	if !q.Until.IsZero() {
+		conditions = append(conditions, "occurred_at < ?")
+		args = append(args, q.Until)
+	}
+	return conditions, args
+}
+
+func rawJSONOrNull(data json.RawMessage) string {
+	if len(data) == 0 {
+		return "null"
+	}
+	return string(data)
+}
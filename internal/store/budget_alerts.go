@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+const budgetAlertColumns = `budget_id, period_start, state, tier, acknowledged_tier, acknowledged_by, last_notified_at, updated_at`
+
+// GetBudgetAlertState returns the alert state of a budget, or nil if it has
+// never been evaluated.
+func (s *SQLStore) GetBudgetAlertState(ctx context.Context, budgetID string) (*models.BudgetAlertState, error) {
+	st := &models.BudgetAlertState{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT `+budgetAlertColumns+` FROM budget_alert_states WHERE budget_id = ?`, budgetID,
+	).Scan(&st.BudgetID, &st.PeriodStart, &st.State, &st.Tier, &st.AcknowledgedTier, &st.AcknowledgedBy, &st.LastNotifiedAt, &st.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return st, err
+}
+
+func (s *SQLStore) SaveBudgetAlertState(ctx context.Context, st *models.BudgetAlertState, deliveries ...*models.NotificationDelivery) error {
+	st.UpdatedAt = now()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO budget_alert_states (`+budgetAlertColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(budget_id) DO UPDATE SET period_start = excluded.period_start, state = excluded.state, tier = excluded.tier,
+			acknowledged_tier = excluded.acknowledged_tier, acknowledged_by = excluded.acknowledged_by,
+			last_notified_at = excluded.last_notified_at, updated_at = excluded.updated_at`,
+		st.BudgetID, st.PeriodStart.UTC(), st.State, st.Tier, st.AcknowledgedTier, st.AcknowledgedBy, utcOrNil(st.LastNotifiedAt), st.UpdatedAt,
+	); err != nil {
+		return err
+	}
+	if err := insertDeliveries(ctx, tx, deliveries); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
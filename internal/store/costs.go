@@ -0,0 +1,344 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Granularity is the width of the time buckets a cost series is split into.
+// Buckets are aligned in UTC, weeks starting on Monday, and a record counts
+// towards the bucket its start time falls in.
+type Granularity string
+
+const (
+	GranularityHour  Granularity = "hour"
+	GranularityDay   Granularity = "day"
+	GranularityWeek  Granularity = "week"
+	GranularityMonth Granularity = "month"
+)
+
+// Valid reports whether g is a known granularity.
+func (g Granularity) Valid() bool {
+	switch g {
+	case GranularityHour, GranularityDay, GranularityWeek, GranularityMonth:
+		return true
+	}
+	return false
+}
+
+// Truncate returns the start of the bucket t falls in.
+func (g Granularity) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch g {
+	case GranularityHour:
+		return t.Truncate(time.Hour)
+	case GranularityWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case GranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// next returns the start of the bucket after the one starting at t.
+func (g Granularity) next(t time.Time) time.Time {
+	switch g {
+	case GranularityHour:
+		return t.Add(time.Hour)
+	case GranularityWeek:
+		return t.AddDate(0, 0, 7)
+	case GranularityMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// Buckets returns the start of every bucket overlapping [start, end).
+func (g Granularity) Buckets(start, end time.Time) []time.Time {
+	var buckets []time.Time
+	for t := g.Truncate(start); t.Before(end); t = g.next(t) {
+		buckets = append(buckets, t)
+	}
+	return buckets
+}
+
+// costGroupColumns maps the dimensions costs can be grouped by to columns.
+// Records can also be grouped by a label, written label:<key>.
+var costGroupColumns = map[string]string{
+	"provider": "provider",
+	"service":  "service",
+	"category": "category",
+	"region":   "region",
+	"account":  "account_id",
+	"source":   "cost_source_id",
+}
+
+// ValidateCostDimension checks that costs can be grouped by dim.
+func ValidateCostDimension(dim string) error {
+	if key, ok := strings.CutPrefix(dim, "label:"); ok {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("invalid group %q: label needs a key", dim)
+		}
+		return nil
+	}
+	if _, ok := costGroupColumns[dim]; !ok {
+		return fmt.Errorf("cannot group costs by %q", dim)
+	}
+	return nil
+}
+
+// costDimensions returns the select expression of each dimension and the
+// arguments they bind, in order. Records missing a value group under "".
+func (s *SQLStore) costDimensions(dims []string) ([]string, []any, error) {
+	exprs := make([]string, 0, len(dims))
+	var args []any
+	for _, dim := range dims {
+		if err := ValidateCostDimension(dim); err != nil {
+			return nil, nil, err
+		}
+		if key, ok := strings.CutPrefix(dim, "label:"); ok {
+			if s.driver == "pgx" {
+				exprs = append(exprs, "COALESCE(labels_json::jsonb ->> ?, '')")
+				args = append(args, key)
+			} else {
+				exprs = append(exprs, "COALESCE(json_extract(labels_json, ?), '')")
+				args = append(args, labelPath(key))
+			}
+			continue
+		}
+		exprs = append(exprs, "COALESCE("+costGroupColumns[dim]+", '')")
+	}
+	return exprs, args, nil
+}
+
+// costBucket returns the expression truncating a record's start to g: a
+// timestamp on PostgreSQL and 'YYYY-MM-DD HH:MM:SS' text on SQLite. Rollups
+// start on their day column. The SQLite driver stores times as Go formats
+// them, so on raw records the expression first cuts the UTC datetime the
+// text starts with.
+func (s *SQLStore) costBucket(g Granularity, rollup bool) string {
+	if s.driver == "pgx" {
+		if rollup {
+			return "date_trunc('" + string(g) + "', CAST(day AS timestamp))"
+		}
+		return "date_trunc('" + string(g) + "', start_time)"
+	}
+	ts := "substr(start_time, 1, 19)"
+	if rollup {
+		ts = "day"
+	}
+	switch g {
+	case GranularityHour:
+		return "strftime('%Y-%m-%d %H:00:00', " + ts + ")"
+	case GranularityWeek:
+		return "strftime('%Y-%m-%d 00:00:00', " + ts + ", '-' || ((CAST(strftime('%w', " + ts + ") AS INTEGER) + 6) % 7) || ' days')"
+	case GranularityMonth:
+		return "strftime('%Y-%m-01 00:00:00', " + ts + ")"
+	default:
+		return "strftime('%Y-%m-%d 00:00:00', " + ts + ")"
+	}
+}
+
+// scanBucket converts a bucket as the driver returns it to a UTC time.
+func scanBucket(v any) (time.Time, error) {
+	switch b := v.(type) {
+	case time.Time:
+		return b.UTC(), nil
+	case string:
+		return time.ParseInLocation(time.DateTime, b, time.UTC)
+	case []byte:
+		return time.ParseInLocation(time.DateTime, string(b), time.UTC)
+	}
+	return time.Time{}, fmt.Errorf("unexpected cost bucket %v (%T)", v, v)
+}
+
+const (
+	costSums   = `COALESCE(SUM(list_cost),0), COALESCE(SUM(net_cost),0), COALESCE(SUM(amortized_cost),0), COALESCE(SUM(amortized_net_cost),0), COUNT(*)`
+	rollupSums = `COALESCE(SUM(list_cost),0), COALESCE(SUM(net_cost),0), COALESCE(SUM(amortized_cost),0), COALESCE(SUM(amortized_net_cost),0), COALESCE(SUM(record_count),0)`
+)
+
+// planCostQuery picks the table a summary of q reads, the daily rollups
+// when useRollups allows it and the raw records otherwise, and returns it
+// with the matching sum expressions and WHERE clause.
+func (s *SQLStore) planCostQuery(q CostQuery) (from, sums, where string, args []any) {
+	if useRollups(q) {
+		where, args = s.buildRollupWhere(q)
+		return "cost_daily_rollups", rollupSums, where, args
+	}
+	where, args = s.buildCostWhere(q)
+	return "cost_records", costSums, where, args
+}
+
+// GroupCosts summarises the records matching q per combination of the
+// q.GroupBy dimensions, most expensive by net cost first. q.Limit, when set,
+// keeps only the top groups.
+func (s *SQLStore) GroupCosts(ctx context.Context, q CostQuery) ([]*CostGroup, error) {
+	if len(q.GroupBy) == 0 {
+		return nil, errors.New("no dimension to group costs by")
+	}
+	exprs, args, err := s.costDimensions(q.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	from, sums, where, whereArgs := s.planCostQuery(q)
+	args = append(args, whereArgs...)
+	positions := ordinals(1, len(exprs))
+	query := `SELECT ` + strings.Join(exprs, ", ") + `, ` + sums + ` FROM ` + from + where +
+		` GROUP BY ` + positions + ` ORDER BY SUM(net_cost) DESC, ` + positions
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*CostGroup
+	for rows.Next() {
+		values := make([]string, len(exprs))
+		g := &CostGroup{}
+		dest := make([]any, 0, len(values)+5)
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		dest = append(dest, &g.TotalListCost, &g.TotalNetCost, &g.TotalAmortized, &g.TotalAmortizedNet, &g.RecordCount)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		g.Group = groupKey(q.GroupBy, values)
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// CostTimeSeries splits the records matching q into q.Granularity buckets,
+// one series per combination of the q.GroupBy dimensions, or a single series
+// when there are none. Every series has a point for every bucket between
+// q.StartTime and q.EndTime, zero where nothing was spent, and the series are
+// ordered by net cost, most expensive first.
+func (s *SQLStore) CostTimeSeries(ctx context.Context, q CostQuery) ([]*CostSeries, error) {
+	if !q.Granularity.Valid() {
+		return nil, fmt.Errorf("unknown granularity %q", q.Granularity)
+	}
+	if q.StartTime.IsZero() || q.EndTime.IsZero() {
+		return nil, errors.New("a cost series needs a start and an end")
+	}
+	exprs, args, err := s.costDimensions(q.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	from, sums, where, whereArgs := s.planCostQuery(q)
+	args = append(args, whereArgs...)
+	positions := ordinals(1, len(exprs)+1)
+	bucket := s.costBucket(q.Granularity, from == "cost_daily_rollups")
+	query := `SELECT ` + strings.Join(append([]string{bucket}, exprs...), ", ") + `, ` + sums +
+		` FROM ` + from + where + ` GROUP BY ` + positions + ` ORDER BY ` + positions
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := q.Granularity.Buckets(q.StartTime, q.EndTime)
+	index := make(map[time.Time]int, len(buckets))
+	for i, b := range buckets {
+		index[b] = i
+	}
+	newSeries := func(group map[string]string) *CostSeries {
+		series := &CostSeries{Group: group, Points: make([]*CostPoint, len(buckets))}
+		for i, b := range buckets {
+			series.Points[i] = &CostPoint{Start: b}
+		}
+		return series
+	}
+
+	bySeries := make(map[string]*CostSeries)
+	keys := make(map[*CostSeries]string)
+	var all []*CostSeries
+	for rows.Next() {
+		var bucket any
+		values := make([]string, len(exprs))
+		var sum CostSummary
+		dest := make([]any, 0, len(values)+6)
+		dest = append(dest, &bucket)
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		dest = append(dest, &sum.TotalListCost, &sum.TotalNetCost, &sum.TotalAmortized, &sum.TotalAmortizedNet, &sum.RecordCount)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		start, err := scanBucket(bucket)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := index[start]
+		if !ok {
+			continue
+		}
+
+		key := strings.Join(values, "\x00")
+		series := bySeries[key]
+		if series == nil {
+			series = newSeries(groupKey(q.GroupBy, values))
+			bySeries[key] = series
+			keys[series] = key
+			all = append(all, series)
+		}
+		series.Points[i].CostSummary = sum
+		series.add(sum)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(all) == 0 && len(q.GroupBy) == 0 {
+		all = append(all, newSeries(map[string]string{}))
+	}
+	slices.SortFunc(all, func(a, b *CostSeries) int {
+		if a.TotalNetCost != b.TotalNetCost {
+			if a.TotalNetCost > b.TotalNetCost {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(keys[a], keys[b])
+	})
+	return all, nil
+}
+
+func (c *CostSummary) add(o CostSummary) {
+	c.TotalListCost += o.TotalListCost
+	c.TotalNetCost += o.TotalNetCost
+	c.TotalAmortized += o.TotalAmortized
+	c.TotalAmortizedNet += o.TotalAmortizedNet
+	c.RecordCount += o.RecordCount
+}
+
+// groupKey pairs each dimension with the value a row has for it.
+func groupKey(dims, values []string) map[string]string {
+	group := make(map[string]string, len(dims))
+	for i, dim := range dims {
+		group[dim] = values[i]
+	}
+	return group
+}
+
+// ordinals returns "from, from+1, ..." for n select list positions.
+func ordinals(from, n int) string {
+	positions := make([]string, n)
+	for i := range positions {
+		positions[i] = fmt.Sprint(from + i)
+	}
+	return strings.Join(positions, ", ")
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+const enforcementColumns = `id, budget_id, project_id, action_json, status, undo_json, error, applied_at, reverted_at, reverted_by`
+
+func (s *SQLStore) CreateBudgetEnforcement(ctx context.Context, e *models.BudgetEnforcement) error {
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	e.AppliedAt = now()
+	action, err := json.Marshal(e.Action)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO budget_enforcements (`+enforcementColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.BudgetID, e.ProjectID, string(action), e.Status, string(e.Undo), e.Error, e.AppliedAt, utcOrNil(e.RevertedAt), e.RevertedBy,
+	)
+	return err
+}
+
+func (s *SQLStore) GetBudgetEnforcement(ctx context.Context, id string) (*models.BudgetEnforcement, error) {
+	e, err := scanEnforcement(s.db.QueryRowContext(ctx, `SELECT `+enforcementColumns+` FROM budget_enforcements WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return e, err
+}
+
+// ListBudgetEnforcements returns a budget's enforcement history, oldest first.
+func (s *SQLStore) ListBudgetEnforcements(ctx context.Context, budgetID string) ([]*models.BudgetEnforcement, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+enforcementColumns+` FROM budget_enforcements WHERE budget_id = ? ORDER BY applied_at, id`, budgetID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var enforcements []*models.BudgetEnforcement
+	for rows.Next() {
+		e, err := scanEnforcement(rows)
+		if err != nil {
+			return nil, err
+		}
+		enforcements = append(enforcements, e)
+	}
+	return enforcements, rows.Err()
+}
+
+// UpdateBudgetEnforcement saves the outcome of running or reverting an
+// enforcement action.
+func (s *SQLStore) UpdateBudgetEnforcement(ctx context.Context, e *models.BudgetEnforcement) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE budget_enforcements SET status = ?, undo_json = ?, error = ?, reverted_at = ?, reverted_by = ? WHERE id = ?`,
+		e.Status, string(e.Undo), e.Error, utcOrNil(e.RevertedAt), e.RevertedBy, e.ID,
+	)
+	return err
+}
+
+func scanEnforcement(row rowScanner) (*models.BudgetEnforcement, error) {
+	e := &models.BudgetEnforcement{}
+	var action, undo string
+	if err := row.Scan(&e.ID, &e.BudgetID, &e.ProjectID, &action, &e.Status, &undo, &e.Error, &e.AppliedAt, &e.RevertedAt, &e.RevertedBy); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(action), &e.Action); err != nil {
+		return nil, fmt.Errorf("enforcement %s action: %w", e.ID, err)
+	}
+	if undo != "" {
+		e.Undo = json.RawMessage(undo)
+	}
+	return e, nil
+}
@@ -0,0 +1,345 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+const (
+	// IngestChunkSize is how many records IngestCostRecords commits at a
+	// time.
+	IngestChunkSize = 5000
+
+	// insertBatchSize is how many rows one multi-row INSERT writes. With 21
+	// columns a batch binds 10500 parameters, within the limits of both
+	// SQLite (32766) and Postgres (65535).
+	insertBatchSize = 500
+)
+
+// costRecordFields are the columns of costRecordColumns, in order, for COPY.
+var costRecordFields = strings.Split(costRecordColumns, ", ")
+
+// InsertCostRecords writes records in one transaction and keeps the label
+// index and the daily rollups in step. A record whose ID is already stored
+// replaces it, so collectors that derive IDs from the source data can
+// re-collect a window without counting it twice; of records repeating an ID
+// the last wins. Records of a day or month that retention has merged their
+// like into are dropped, as the merged record already counts them. Rows are
+// written with COPY on Postgres and multi-row INSERTs on SQLite.
+//
+// On Postgres the primary key is (id, start_time), so it cannot stop two
+// writers that both replace a record from inserting it twice; writes for the
+// same cost source take a transaction-scoped advisory lock on it and run one
+// after the other, across processes. SQLite allows one writer at a time.
+func (s *SQLStore) InsertCostRecords(ctx context.Context, records []*models.CostRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := s.ensureCostPartitions(ctx, records); err != nil {
+		return err
+	}
+	records, ids := latestCostRecords(records)
+
+	// COPY needs the pgx connection under the transaction, so the
+	// transaction is begun on a connection of its own.
+	conn, err := s.rawDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	sqlTx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	tx := &rebindTx{tx: sqlTx, driver: s.driver}
+	defer tx.Rollback()
+
+	if s.driver == "pgx" {
+		if err := lockCostSources(ctx, tx, records); err != nil {
+			return err
+		}
+	}
+	records, dropped, err := dropCompacted(ctx, tx, records)
+	if err != nil {
+		return err
+	}
+	ids = slices.DeleteFunc(ids, func(id string) bool { return dropped[id] })
+	deltas := make(rollupDeltas)
+	if err := replaceCostRecords(ctx, tx, ids, deltas); err != nil {
+		return err
+	}
+	if s.driver == "pgx" {
+		err = copyCostRecords(ctx, conn, records)
+	} else {
+		err = insertCostRecords(ctx, tx, records)
+	}
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		deltas.add(r, 1)
+	}
+
+	if err := applyRollups(ctx, tx, deltas); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IngestCostRecords writes the records records yields, committing every
+// IngestChunkSize of them with InsertCostRecords so that neither memory nor
+// the write lock grows with the size of a collection. It returns how many
+// records were committed; after an error, from records or from a write, the
+// chunks before it stay committed.
+func (s *SQLStore) IngestCostRecords(ctx context.Context, records iter.Seq2[*models.CostRecord, error]) (int, error) {
+	written := 0
+	chunk := make([]*models.CostRecord, 0, IngestChunkSize)
+	for r, err := range records {
+		if err != nil {
+			return written, err
+		}
+		chunk = append(chunk, r)
+		if len(chunk) < IngestChunkSize {
+			continue
+		}
+		if err := s.InsertCostRecords(ctx, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		clear(chunk)
+		chunk = chunk[:0]
+	}
+	if err := s.InsertCostRecords(ctx, chunk); err != nil {
+		return written, err
+	}
+	return written + len(chunk), nil
+}
+
+// lockCostSources takes the advisory lock of every cost source of records
+// until tx ends, in sorted order so that writers never wait on each other in
+// a cycle.
+func lockCostSources(ctx context.Context, tx *rebindTx, records []*models.CostRecord) error {
+	var sources []string
+	for _, r := range records {
+		sources = append(sources, r.CostSourceID)
+	}
+	slices.Sort(sources)
+	for _, id := range slices.Compact(sources) {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('cost_records:' || ?))`, id); err != nil {
+			return fmt.Errorf("lock cost source %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// latestCostRecords gives records without an ID a new one and drops those
+// whose ID a later record repeats. It returns the records kept and the IDs
+// they came with, which may already be stored.
+func latestCostRecords(records []*models.CostRecord) ([]*models.CostRecord, []string) {
+	last := make(map[string]int)
+	for i, r := range records {
+		if r.ID != "" {
+			last[r.ID] = i
+		}
+	}
+	kept := make([]*models.CostRecord, 0, len(records))
+	var ids []string
+	for i, r := range records {
+		if r.ID == "" {
+			r.ID = newID()
+		} else if last[r.ID] != i {
+			continue
+		} else {
+			ids = append(ids, r.ID)
+		}
+		kept = append(kept, r)
+	}
+	return kept, ids
+}
+
+// dropCompacted drops the records whose day or month holds the record a
+// compaction merged records like them into, and returns the IDs dropped.
+func dropCompacted(ctx context.Context, tx *rebindTx, records []*models.CostRecord) ([]*models.CostRecord, map[string]bool, error) {
+	merged := make(map[string][]*models.CostRecord)
+	for _, r := range records {
+		key := mergeKeyOf(r)
+		for _, unit := range []Granularity{GranularityDay, GranularityMonth} {
+			start := unit.Truncate(r.StartTime)
+			end := unit.next(start)
+			if r.EndTime.After(end) {
+				continue
+			}
+			id := key.recordID(start, end)
+			merged[id] = append(merged[id], r)
+		}
+	}
+
+	dropped := make(map[string]bool)
+	for batch := range slices.Chunk(slices.Collect(maps.Keys(merged)), insertBatchSize) {
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+		rows, err := tx.QueryContext(ctx, `SELECT id FROM cost_records WHERE id IN (?`+strings.Repeat(", ?", len(batch)-1)+`)`, args...)
+		if err != nil {
+			return nil, nil, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, nil, err
+			}
+			for _, r := range merged[id] {
+				dropped[r.ID] = true
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(dropped) == 0 {
+		return records, dropped, nil
+	}
+	kept := slices.DeleteFunc(records, func(r *models.CostRecord) bool { return dropped[r.ID] })
+	return kept, dropped, nil
+}
+
+// replaceCostRecords deletes the stored records with the given IDs, taking
+// them out of the rollups and the label index. Deleting rather than
+// upserting lets a replacement move to another month's partition, as the
+// primary key of a partitioned cost_records includes start_time.
+func replaceCostRecords(ctx context.Context, tx *rebindTx, ids []string, deltas rollupDeltas) error {
+	for batch := range slices.Chunk(ids, insertBatchSize) {
+		in := " IN (?" + strings.Repeat(", ?", len(batch)-1) + ")"
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		rows, err := tx.QueryContext(ctx,
+			`SELECT project_id, cost_source_id, provider, service, category, region, account_id, start_time, end_time, list_cost, net_cost, amortized_cost, amortized_net_cost FROM cost_records WHERE id`+in, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			old := &models.CostRecord{}
+			if err := rows.Scan(&old.ProjectID, &old.CostSourceID, &old.Provider, &old.Service, &old.Category, &old.Region, &old.AccountID,
+				&old.StartTime, &old.EndTime, &old.ListCost, &old.NetCost, &old.AmortizedCost, &old.AmortizedNetCost); err != nil {
+				rows.Close()
+				return err
+			}
+			deltas.add(old, -1)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM cost_record_labels WHERE record_id`+in, args...); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM cost_records WHERE id`+in, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertCostRecords writes records and their labels with multi-row INSERTs.
+// It leaves the rollups to the caller.
+func insertCostRecords(ctx context.Context, tx *rebindTx, records []*models.CostRecord) error {
+	for batch := range slices.Chunk(records, insertBatchSize) {
+		args := make([]any, 0, len(batch)*len(costRecordFields))
+		for _, r := range batch {
+			args = append(args, costRecordValues(r)...)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO cost_records (`+costRecordColumns+`) VALUES `+valueRows(len(batch), len(costRecordFields)), args...,
+		); err != nil {
+			return err
+		}
+	}
+
+	labels := costRecordLabelValues(records)
+	for batch := range slices.Chunk(labels, insertBatchSize) {
+		args := make([]any, 0, len(batch)*4)
+		for _, l := range batch {
+			args = append(args, l...)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO cost_record_labels (record_id, project_id, key, value) VALUES `+valueRows(len(batch), 4), args...,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyCostRecords writes records and their labels with COPY, within the
+// transaction open on conn. It leaves the rollups to the caller.
+func copyCostRecords(ctx context.Context, conn *sql.Conn, records []*models.CostRecord) error {
+	return conn.Raw(func(driverConn any) error {
+		pc, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("copy cost records: unexpected driver connection %T", driverConn)
+		}
+		if _, err := pc.Conn().CopyFrom(ctx, pgx.Identifier{"cost_records"}, costRecordFields,
+			pgx.CopyFromSlice(len(records), func(i int) ([]any, error) {
+				return costRecordValues(records[i]), nil
+			}),
+		); err != nil {
+			return err
+		}
+		_, err := pc.Conn().CopyFrom(ctx, pgx.Identifier{"cost_record_labels"}, []string{"record_id", "project_id", "key", "value"},
+			pgx.CopyFromRows(costRecordLabelValues(records)))
+		return err
+	})
+}
+
+// costRecordValues returns the values of r's costRecordColumns.
+func costRecordValues(r *models.CostRecord) []any {
+	return []any{
+		r.ID, r.ProjectID, r.CostSourceID, r.Provider, r.ProviderID, r.AccountID, r.AccountName, r.InvoiceEntityID,
+		r.Service, r.Category, r.Region, r.AvailabilityZone, r.StartTime.UTC(), r.EndTime.UTC(),
+		r.ListCost, r.NetCost, r.AmortizedCost, r.AmortizedNetCost, r.Currency, labelsJSON(r), r.KubernetesPercent,
+	}
+}
+
+// labelsJSON returns the labels_json column of r.
+func labelsJSON(r *models.CostRecord) string {
+	if r.Labels == nil {
+		return "{}"
+	}
+	data, _ := json.Marshal(r.Labels)
+	return string(data)
+}
+
+// costRecordLabelValues returns a cost_record_labels row per label of records.
+func costRecordLabelValues(records []*models.CostRecord) [][]any {
+	var rows [][]any
+	for _, r := range records {
+		for key, value := range r.Labels {
+			rows = append(rows, []any{r.ID, r.ProjectID, key, value})
+		}
+	}
+	return rows
+}
+
+// valueRows returns the VALUES list of n rows of cols placeholders each.
+func valueRows(n, cols int) string {
+	row := "(?" + strings.Repeat(", ?", cols-1) + ")"
+	return row + strings.Repeat(", "+row, n-1)
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+const invitationColumns = `id, project_id, email, role, role_expires_at, invited_by, created_at`
+
+// CreateProjectInvitation invites an email address to a project. Inviting the
+// same address again replaces the pending role rather than adding a second row.
+func (s *SQLStore) CreateProjectInvitation(ctx context.Context, inv *models.ProjectInvitation) error {
+	inv.ID = newID()
+	inv.Email = strings.ToLower(strings.TrimSpace(inv.Email))
+	inv.CreatedAt = now()
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO project_invitations (`+invitationColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(project_id, email) DO UPDATE SET role = excluded.role, role_expires_at = excluded.role_expires_at,
+			invited_by = excluded.invited_by, created_at = excluded.created_at
+		RETURNING id`,
+		inv.ID, inv.ProjectID, inv.Email, inv.Role, utcOrNil(inv.RoleExpiresAt), inv.InvitedBy, inv.CreatedAt,
+	).Scan(&inv.ID)
+}
+
+func (s *SQLStore) GetProjectInvitation(ctx context.Context, id string) (*models.ProjectInvitation, error) {
+	inv, err := scanInvitation(s.db.QueryRowContext(ctx, `SELECT `+invitationColumns+` FROM project_invitations WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return inv, err
+}
+
+func (s *SQLStore) ListProjectInvitations(ctx context.Context, projectID string) ([]*models.ProjectInvitation, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+invitationColumns+` FROM project_invitations WHERE project_id = ? ORDER BY email`, projectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []*models.ProjectInvitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+func (s *SQLStore) DeleteProjectInvitation(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM project_invitations WHERE id = ?`, id)
+	return err
+}
+
+// AcceptProjectInvitations converts every invitation for email into a role
+// assignment for userID and deletes the invitations. Invitations whose role
+// expiry has already passed are dropped without granting anything.
+func (s *SQLStore) AcceptProjectInvitations(ctx context.Context, email, userID string) ([]*models.ProjectRole, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	rows, err := tx.QueryContext(ctx, `SELECT `+invitationColumns+` FROM project_invitations WHERE email = ?`, email)
+	if err != nil {
+		return nil, err
+	}
+	var invitations []*models.ProjectInvitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(invitations) == 0 {
+		return nil, nil
+	}
+
+	t := now()
+	var granted []*models.ProjectRole
+	for _, inv := range invitations {
+		pr := &models.ProjectRole{
+			ProjectID:   inv.ProjectID,
+			SubjectType: models.SubjectUser,
+			SubjectID:   userID,
+			Role:        inv.Role,
+			ExpiresAt:   inv.RoleExpiresAt,
+		}
+		if pr.Expired(t) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO project_roles (`+projectRoleColumns+`) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(project_id, subject_type, subject_id) DO UPDATE SET role = excluded.role, expires_at = excluded.expires_at`,
+			pr.ProjectID, pr.SubjectType, pr.SubjectID, pr.Role, utcOrNil(pr.ExpiresAt),
+		); err != nil {
+			return nil, err
+		}
+		granted = append(granted, pr)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM project_invitations WHERE email = ?`, email); err != nil {
+		return nil, err
+	}
+	return granted, tx.Commit()
+}
+
+func scanInvitation(row rowScanner) (*models.ProjectInvitation, error) {
+	inv := &models.ProjectInvitation{}
+	if err := row.Scan(&inv.ID, &inv.ProjectID, &inv.Email, &inv.Role, &inv.RoleExpiresAt, &inv.InvitedBy, &inv.CreatedAt); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
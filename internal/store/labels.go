@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// LabelOp is how a LabelSelector matches a record's label.
+type LabelOp string
+
+const (
+	// LabelEquals matches records whose label has the single value.
+	LabelEquals LabelOp = "="
+	// LabelIn matches records whose label has any of the values.
+	LabelIn LabelOp = "in"
+	// LabelExists matches records carrying the label, whatever its value.
+	LabelExists LabelOp = "exists"
+	// LabelNotExists matches records without the label.
+	LabelNotExists LabelOp = "!exists"
+)
+
+// LabelSelector is a predicate on one label key of a cost record.
+type LabelSelector struct {
+	Key    string
+	Op     LabelOp
+	Values []string
+}
+
+// Validate checks that the selector names a key and has the values its
+// operator needs.
+func (sel LabelSelector) Validate() error {
+	if strings.TrimSpace(sel.Key) == "" {
+		return fmt.Errorf("invalid label key %q", sel.Key)
+	}
+	switch sel.Op {
+	case LabelEquals:
+		if len(sel.Values) != 1 {
+			return fmt.Errorf("label %s: = needs exactly one value", sel.Key)
+		}
+	case LabelIn:
+		if len(sel.Values) == 0 {
+			return fmt.Errorf("label %s: in needs at least one value", sel.Key)
+		}
+	case LabelExists, LabelNotExists:
+		if len(sel.Values) != 0 {
+			return fmt.Errorf("label %s: %s takes no values", sel.Key, sel.Op)
+		}
+	default:
+		return fmt.Errorf("label %s: unknown operator %q", sel.Key, sel.Op)
+	}
+	return nil
+}
+
+// condition returns the WHERE condition matching cost_records rows against
+// the selector through the label index, and its arguments.
+func (sel LabelSelector) condition() (string, []any) {
+	cond := "EXISTS (SELECT 1 FROM cost_record_labels l WHERE l.record_id = cost_records.id AND l.key = ?"
+	args := []any{sel.Key}
+	switch sel.Op {
+	case LabelEquals, LabelIn:
+		cond += " AND l.value IN (?" + strings.Repeat(", ?", len(sel.Values)-1) + ")"
+		for _, v := range sel.Values {
+			args = append(args, v)
+		}
+	case LabelNotExists:
+		cond = "NOT " + cond
+	}
+	return cond + ")", args
+}
+
+// labelSelectors returns the selectors a query filters by: one equality per
+// label of the embedded filter, in key order, then q.LabelSelectors.
+func labelSelectors(q CostQuery) []LabelSelector {
+	var selectors []LabelSelector
+	for _, key := range slices.Sorted(maps.Keys(q.Labels)) {
+		selectors = append(selectors, LabelSelector{Key: key, Op: LabelEquals, Values: []string{q.Labels[key]}})
+	}
+	return append(selectors, q.LabelSelectors...)
+}
+
+// CostLabel is a label key seen on a project's cost records and the values
+// it has taken, in order.
+type CostLabel struct {
+	Key    string   `json:"key"`
+	Values []string `json:"values"`
+}
+
+// ListCostLabels returns the label keys of a project's cost records, in key
+// order, with their values.
+func (s *SQLStore) ListCostLabels(ctx context.Context, projectID string) ([]*CostLabel, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT DISTINCT key, value FROM cost_record_labels WHERE project_id = ? ORDER BY key, value`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var labels []*CostLabel
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		if len(labels) == 0 || labels[len(labels)-1].Key != key {
+			labels = append(labels, &CostLabel{Key: key})
+		}
+		last := labels[len(labels)-1]
+		last.Values = append(last.Values, value)
+	}
+	return labels, rows.Err()
+}
+
+// CostLabelKeys returns the label keys carried by any record matching q, in
+// order.
+func (s *SQLStore) CostLabelKeys(ctx context.Context, q CostQuery) ([]string, error) {
+	where, args := s.buildCostWhere(q)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT DISTINCT key FROM cost_record_labels WHERE record_id IN (SELECT id FROM cost_records`+where+`) ORDER BY key`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
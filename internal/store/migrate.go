@@ -2,77 +2,333 @@ package store
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"regexp"
 	"sort"
-	"strings"
+	"strconv"
 )
 
-func runMigrations(db *rebindDB, migrationsFS fs.FS) error {
-	ctx := context.Background()
+// Migration files are named NNNNNN_name.up.sql and NNNNNN_name.down.sql. A
+// migration whose SQL differs between databases can instead, or as well,
+// come as NNNNNN_name.sqlite.up.sql and NNNNNN_name.postgres.up.sql; a
+// database uses its own variant over the plain file. A version with
+// variants for other databases only is recorded without running anything,
+// so versions mean the same on every database.
+var migrationFile = regexp.MustCompile(`^(\d{6})_(\w+?)(?:\.(sqlite|postgres))?\.(up|down)\.sql$`)
+
+// ErrDirty is wrapped by the errors of migrating a database whose last
+// migration failed part way.
+var ErrDirty = errors.New("database is dirty")
+
+// migration is one version of the schema, with the files that apply and
+// revert it on the store's database. A file is empty if there is none.
+type migration struct {
+	version  int
+	name     string
+	up, down string
+	// other is set when the only variants are for other databases.
+	other bool
+}
+
+// MigrationInfo describes a migration for MigrationStatus.
+type MigrationInfo struct {
+	Version    int    `json:"version"`
+	Name       string `json:"name"`
+	Applied    bool   `json:"applied"`
+	Reversible bool   `json:"reversible"`
+}
+
+// MigrationStatus is the schema version of a database, whether a migration
+// failed part way at that version, and the migrations there are.
+type MigrationStatus struct {
+	Version    int             `json:"version"`
+	Dirty      bool            `json:"dirty"`
+	Latest     int             `json:"latest"`
+	Migrations []MigrationInfo `json:"migrations"`
+}
+
+// dialect is the store's database as migration file names spell it.
+func (s *SQLStore) dialect() string {
+	if s.driver == "pgx" {
+		return "postgres"
+	}
+	return "sqlite"
+}
+
+// loadMigrations returns the migrations in migrationsFS for the store's
+// database, by version.
+func (s *SQLStore) loadMigrations(migrationsFS fs.FS) ([]*migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations dir: %w", err)
+	}
+
+	type files struct{ up, down, dialectUp, dialectDown string }
+	byVersion := make(map[int]*migration)
+	found := make(map[int]*files)
+	for _, e := range entries {
+		m := migrationFile.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(m[1])
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &migration{version: version, name: m[2]}
+			byVersion[version] = mig
+			found[version] = &files{}
+		} else if mig.name != m[2] {
+			return nil, fmt.Errorf("migration %06d is named both %s and %s", version, mig.name, m[2])
+		}
+
+		f := found[version]
+		var slot *string
+		switch {
+		case m[3] == "" && m[4] == "up":
+			slot = &f.up
+		case m[3] == "":
+			slot = &f.down
+		case m[3] != s.dialect():
+			continue
+		case m[4] == "up":
+			slot = &f.dialectUp
+		default:
+			slot = &f.dialectDown
+		}
+		*slot = e.Name()
+	}
 
-	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+	migrations := make([]*migration, 0, len(byVersion))
+	for version, mig := range byVersion {
+		f := found[version]
+		mig.up, mig.down = f.up, f.down
+		if f.dialectUp != "" {
+			mig.up = f.dialectUp
+		}
+		if f.dialectDown != "" {
+			mig.down = f.dialectDown
+		}
+		mig.other = mig.up == "" && mig.down == ""
+		migrations = append(migrations, mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// ensureMigrationsTable creates schema_migrations, which holds a row per
+// applied version; the highest is the schema's version. A row is dirty
+// while its migration runs, and stays so if the migration fails.
+func (s *SQLStore) ensureMigrationsTable(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
 		version INTEGER PRIMARY KEY,
 		dirty BOOLEAN NOT NULL DEFAULT FALSE
 	)`); err != nil {
 		return fmt.Errorf("create migrations table: %w", err)
 	}
+	return nil
+}
 
-	var currentVersion int
-	err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&currentVersion)
+// schemaVersion returns the schema's version and whether it is dirty.
+func (s *SQLStore) schemaVersion(ctx context.Context) (version int, dirty bool, err error) {
+	err = s.db.QueryRowContext(ctx,
+		`SELECT version, dirty FROM schema_migrations ORDER BY version DESC LIMIT 1`,
+	).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
 	if err != nil {
-		return fmt.Errorf("get current version: %w", err)
+		return 0, false, fmt.Errorf("get current version: %w", err)
 	}
+	return version, dirty, nil
+}
 
-	entries, err := fs.ReadDir(migrationsFS, ".")
+// MigrationStatus reports the schema version of the database against the
+// migrations in migrationsFS.
+func (s *SQLStore) MigrationStatus(migrationsFS fs.FS) (*MigrationStatus, error) {
+	ctx := context.Background()
+	if err := s.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+	migrations, err := s.loadMigrations(migrationsFS)
 	if err != nil {
-		return fmt.Errorf("read migrations dir: %w", err)
+		return nil, err
+	}
+	version, dirty, err := s.schemaVersion(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	var upFiles []string
-	for _, e := range entries {
-		if strings.HasSuffix(e.Name(), ".up.sql") {
-			upFiles = append(upFiles, e.Name())
-		}
+	status := &MigrationStatus{Version: version, Dirty: dirty}
+	for _, m := range migrations {
+		status.Latest = m.version
+		status.Migrations = append(status.Migrations, MigrationInfo{
+			Version:    m.version,
+			Name:       m.name,
+			Applied:    m.version <= version,
+			Reversible: m.down != "" || m.other,
+		})
+	}
+	return status, nil
+}
+
+// MigrateUp applies the migrations after the schema's version up to target,
+// or all of them if target is zero, each in its own transaction. It refuses
+// to run on a dirty database.
+func (s *SQLStore) MigrateUp(migrationsFS fs.FS, target int) error {
+	ctx := context.Background()
+	migrations, current, err := s.prepareMigration(ctx, migrationsFS)
+	if err != nil {
+		return err
+	}
+	if target > 0 && target < current {
+		return fmt.Errorf("cannot migrate up to version %d: the database is at version %d", target, current)
 	}
-	sort.Strings(upFiles)
 
-	for _, filename := range upFiles {
-		var version int
-		if _, err := fmt.Sscanf(filename, "%06d_", &version); err != nil {
+	for _, m := range migrations {
+		if m.version <= current || (target > 0 && m.version > target) {
 			continue
 		}
-		if version <= currentVersion {
-			continue
+		if err := s.applyMigration(ctx, migrationsFS, m, m.up, true); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		content, err := fs.ReadFile(migrationsFS, filename)
-		if err != nil {
-			return fmt.Errorf("read migration %s: %w", filename, err)
-		}
+// MigrateDown reverts the migrations after target, newest first, each in its
+// own transaction. Target zero reverts them all. It refuses to run on a
+// dirty database or past a migration without a down file.
+func (s *SQLStore) MigrateDown(migrationsFS fs.FS, target int) error {
+	ctx := context.Background()
+	migrations, current, err := s.prepareMigration(ctx, migrationsFS)
+	if err != nil {
+		return err
+	}
+	if target < 0 || target > current {
+		return fmt.Errorf("cannot migrate down to version %d: the database is at version %d", target, current)
+	}
 
-		tx, err := db.BeginTx(ctx, nil)
-		if err != nil {
-			return fmt.Errorf("begin tx for %s: %w", filename, err)
+	var revert []*migration
+	for _, m := range migrations {
+		if m.version > target && m.version <= current {
+			if m.down == "" && !m.other {
+				return fmt.Errorf("cannot migrate down to version %d: migration %06d_%s has no down file", target, m.version, m.name)
+			}
+			revert = append(revert, m)
 		}
-
-		if _, err := tx.ExecContext(ctx, string(content)); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("execute migration %s: %w", filename, err)
+	}
+	for i := len(revert) - 1; i >= 0; i-- {
+		if err := s.applyMigration(ctx, migrationsFS, revert[i], revert[i].down, false); err != nil {
+			return err
 		}
+	}
+	return nil
+}
+
+// ForceMigrationVersion records the schema as clean at version, without
+// running any migration, after a failed one has been repaired by hand.
+// Version zero records an empty schema.
+func (s *SQLStore) ForceMigrationVersion(version int) error {
+	ctx := context.Background()
+	if version < 0 {
+		return fmt.Errorf("invalid version %d", version)
+	}
+	if err := s.ensureMigrationsTable(ctx); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version >= ?`, version); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE schema_migrations SET dirty = FALSE`); err != nil {
+		return err
+	}
+	if version > 0 {
 		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES (?, FALSE)`, version); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("record migration %s: %w", filename, err)
+			return err
 		}
+	}
+	return tx.Commit()
+}
+
+// prepareMigration loads the migrations and the schema's version, failing
+// if the database is dirty.
+func (s *SQLStore) prepareMigration(ctx context.Context, migrationsFS fs.FS) ([]*migration, int, error) {
+	if err := s.ensureMigrationsTable(ctx); err != nil {
+		return nil, 0, err
+	}
+	migrations, err := s.loadMigrations(migrationsFS)
+	if err != nil {
+		return nil, 0, err
+	}
+	current, dirty, err := s.schemaVersion(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if dirty {
+		return nil, 0, fmt.Errorf("%w at version %d: a migration failed part way; repair the schema by hand, then run finguard migrate force <version>", ErrDirty, current)
+	}
+	return migrations, current, nil
+}
 
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("commit migration %s: %w", filename, err)
+// applyMigration runs filename, m's up or down file, or nothing if it is
+// empty. The version is marked dirty first, in a transaction of its own, so
+// that a migration that fails part way leaves the database marked; on
+// success the mark is cleared, or for a down migration the version removed,
+// in the migration's transaction.
+func (s *SQLStore) applyMigration(ctx context.Context, migrationsFS fs.FS, m *migration, filename string, up bool) error {
+	var content []byte
+	if filename != "" {
+		var err error
+		if content, err = fs.ReadFile(migrationsFS, filename); err != nil {
+			return fmt.Errorf("read migration %s: %w", filename, err)
 		}
+	}
+	label := fmt.Sprintf("%06d_%s", m.version, m.name)
+
+	mark := `UPDATE schema_migrations SET dirty = TRUE WHERE version = ?`
+	if up {
+		mark = `INSERT INTO schema_migrations (version, dirty) VALUES (?, TRUE)`
+	}
+	if _, err := s.db.ExecContext(ctx, mark, m.version); err != nil {
+		return fmt.Errorf("mark migration %s dirty: %w", label, err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx for %s: %w", label, err)
+	}
+	defer tx.Rollback()
 
-		slog.Info("applied migration", "version", version, "file", filename)
+	if len(content) > 0 {
+		if _, err := tx.ExecContext(ctx, string(content)); err != nil {
+			return fmt.Errorf("execute migration %s: %w", filename, err)
+		}
+	}
+	done := `DELETE FROM schema_migrations WHERE version = ?`
+	if up {
+		done = `UPDATE schema_migrations SET dirty = FALSE WHERE version = ?`
+	}
+	if _, err := tx.ExecContext(ctx, done, m.version); err != nil {
+		return fmt.Errorf("record migration %s: %w", label, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration %s: %w", label, err)
 	}
 
+	direction := "applied"
+	if !up {
+		direction = "reverted"
+	}
+	slog.Info(direction+" migration", "version", m.version, "file", filename)
 	return nil
 }
@@ -0,0 +1,268 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+const channelColumns = `id, project_id, type, name, config_json, topics_json, template, enabled, created_at, updated_at`
+
+func (s *SQLStore) CreateNotificationChannel(ctx context.Context, c *models.NotificationChannel) error {
+	if c.ID == "" {
+		c.ID = newID()
+	}
+	config, topics, err := marshalChannelJSON(c)
+	if err != nil {
+		return err
+	}
+	c.CreatedAt = now()
+	c.UpdatedAt = c.CreatedAt
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO notification_channels (`+channelColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.ProjectID, c.Type, c.Name, config, topics, c.Template, c.Enabled, c.CreatedAt, c.UpdatedAt,
+	)
+	return err
+}
+
+func (s *SQLStore) GetNotificationChannel(ctx context.Context, id string) (*models.NotificationChannel, error) {
+	c, err := scanChannel(s.db.QueryRowContext(ctx, `SELECT `+channelColumns+` FROM notification_channels WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
+
+func (s *SQLStore) ListNotificationChannels(ctx context.Context, projectID string) ([]*models.NotificationChannel, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+channelColumns+` FROM notification_channels WHERE project_id = ? ORDER BY name, id`, projectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []*models.NotificationChannel
+	for rows.Next() {
+		c, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, c)
+	}
+	return channels, rows.Err()
+}
+
+func (s *SQLStore) UpdateNotificationChannel(ctx context.Context, c *models.NotificationChannel) error {
+	config, topics, err := marshalChannelJSON(c)
+	if err != nil {
+		return err
+	}
+	c.UpdatedAt = now()
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE notification_channels SET name = ?, config_json = ?, topics_json = ?, template = ?, enabled = ?, updated_at = ? WHERE id = ?`,
+		c.Name, config, topics, c.Template, c.Enabled, c.UpdatedAt, c.ID,
+	)
+	return err
+}
+
+func (s *SQLStore) DeleteNotificationChannel(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM notification_channels WHERE id = ?`, id)
+	return err
+}
+
+func scanChannel(row rowScanner) (*models.NotificationChannel, error) {
+	c := &models.NotificationChannel{}
+	var config, topics string
+	if err := row.Scan(&c.ID, &c.ProjectID, &c.Type, &c.Name, &config, &topics, &c.Template, &c.Enabled, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	c.Config = json.RawMessage(config)
+	if err := json.Unmarshal([]byte(topics), &c.Topics); err != nil {
+		return nil, fmt.Errorf("notification channel %s topics: %w", c.ID, err)
+	}
+	return c, nil
+}
+
+func marshalChannelJSON(c *models.NotificationChannel) (config, topics string, err error) {
+	config = string(c.Config)
+	if config == "" {
+		config = "{}"
+	}
+	if c.Topics == nil {
+		c.Topics = []string{}
+	}
+	topicsJSON, err := json.Marshal(c.Topics)
+	if err != nil {
+		return "", "", err
+	}
+	return config, string(topicsJSON), nil
+}
+
+const deliveryColumns = `id, channel_id, project_id, topic, event_json, status, attempts, next_attempt_at, last_error, created_at, delivered_at`
+
+// CreateNotificationDeliveries adds deliveries to the outbox in a single
+// transaction, so an event is queued for all of its channels or none.
+func (s *SQLStore) CreateNotificationDeliveries(ctx context.Context, deliveries []*models.NotificationDelivery) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertDeliveries(ctx, tx, deliveries); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertDeliveries adds deliveries to the outbox within tx.
+func insertDeliveries(ctx context.Context, tx *rebindTx, deliveries []*models.NotificationDelivery) error {
+	for _, d := range deliveries {
+		if d.ID == "" {
+			d.ID = newID()
+		}
+		if d.Status == "" {
+			d.Status = models.DeliveryPending
+		}
+		d.CreatedAt = now()
+		if d.NextAttemptAt.IsZero() {
+			d.NextAttemptAt = d.CreatedAt
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO notification_deliveries (`+deliveryColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			d.ID, d.ChannelID, d.ProjectID, d.Topic, string(d.Event), d.Status, d.Attempts, d.NextAttemptAt.UTC(), d.LastError, d.CreatedAt, utcOrNil(d.DeliveredAt),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) GetNotificationDelivery(ctx context.Context, id string) (*models.NotificationDelivery, error) {
+	d, err := scanDelivery(s.db.QueryRowContext(ctx, `SELECT `+deliveryColumns+` FROM notification_deliveries WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// ListNotificationDeliveries returns a channel's most recent deliveries, newest
+// first.
+func (s *SQLStore) ListNotificationDeliveries(ctx context.Context, channelID string, limit int) ([]*models.NotificationDelivery, error) {
+	return s.queryDeliveries(ctx,
+		`SELECT `+deliveryColumns+` FROM notification_deliveries WHERE channel_id = ? ORDER BY created_at DESC, id DESC LIMIT ?`, channelID, limit,
+	)
+}
+
+// ClaimNotificationDeliveries returns up to limit pending deliveries that are
+// due at now, oldest first, and pushes each one's next attempt back by lease
+// so that no other worker picks it up while it is being sent. A delivery is
+// only returned if this call was the one to move it.
+func (s *SQLStore) ClaimNotificationDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.NotificationDelivery, error) {
+	due, err := s.queryDeliveries(ctx,
+		`SELECT `+deliveryColumns+` FROM notification_deliveries WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`,
+		models.DeliveryPending, now.UTC(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []*models.NotificationDelivery
+	until := now.Add(lease).UTC()
+	for _, d := range due {
+		res, err := s.db.ExecContext(ctx,
+			`UPDATE notification_deliveries SET next_attempt_at = ? WHERE id = ? AND status = ? AND next_attempt_at = ?`,
+			until, d.ID, models.DeliveryPending, d.NextAttemptAt.UTC(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil || n != 1 {
+			continue
+		}
+		d.NextAttemptAt = until
+		claimed = append(claimed, d)
+	}
+	return claimed, nil
+}
+
+// UpdateNotificationDelivery saves the outcome of a delivery attempt or a
+// redelivery request.
+func (s *SQLStore) UpdateNotificationDelivery(ctx context.Context, d *models.NotificationDelivery) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE notification_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?, delivered_at = ? WHERE id = ?`,
+		d.Status, d.Attempts, d.NextAttemptAt.UTC(), d.LastError, utcOrNil(d.DeliveredAt), d.ID,
+	)
+	return err
+}
+
+func (s *SQLStore) queryDeliveries(ctx context.Context, query string, args ...any) ([]*models.NotificationDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.NotificationDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanDelivery(row rowScanner) (*models.NotificationDelivery, error) {
+	d := &models.NotificationDelivery{}
+	var event string
+	if err := row.Scan(&d.ID, &d.ChannelID, &d.ProjectID, &d.Topic, &event, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+		return nil, err
+	}
+	d.Event = json.RawMessage(event)
+	return d, nil
+}
+
+const attemptColumns = `id, delivery_id, attempt, status_code, latency_ms, response, error, attempted_at`
+
+func (s *SQLStore) CreateDeliveryAttempt(ctx context.Context, a *models.DeliveryAttempt) error {
+	if a.ID == "" {
+		a.ID = newID()
+	}
+	if a.AttemptedAt.IsZero() {
+		a.AttemptedAt = now()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO notification_delivery_attempts (`+attemptColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.DeliveryID, a.Attempt, a.StatusCode, a.LatencyMs, a.Response, a.Error, a.AttemptedAt.UTC(),
+	)
+	return err
+}
+
+// ListDeliveryAttempts returns a delivery's attempts, oldest first.
+func (s *SQLStore) ListDeliveryAttempts(ctx context.Context, deliveryID string) ([]*models.DeliveryAttempt, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+attemptColumns+` FROM notification_delivery_attempts WHERE delivery_id = ? ORDER BY attempted_at, id`, deliveryID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []*models.DeliveryAttempt
+	for rows.Next() {
+		a := &models.DeliveryAttempt{}
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.Attempt, &a.StatusCode, &a.LatencyMs, &a.Response, &a.Error, &a.AttemptedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
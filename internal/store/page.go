@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPageLimit is the page size of a PageQuery without a limit.
+	DefaultPageLimit = 100
+	// MaxPageLimit caps the page size a PageQuery may ask for.
+	MaxPageLimit = 1000
+)
+
+// PageQuery asks for one page of a list. Sort names one of the list's sort
+// fields, prefixed with "-" for descending order, and defaults to the list's
+// own order. Cursor is the next cursor of the previous page, empty for the
+// first.
+type PageQuery struct {
+	Sort   string
+	Cursor string
+	Limit  int
+}
+
+// ErrInvalidPage is wrapped by the errors returned for a page query with an
+// unknown sort field or a cursor issued for another list or sort.
+var ErrInvalidPage = errors.New("invalid page query")
+
+// keyKind is how a sort key's value is carried in a cursor.
+type keyKind int
+
+const (
+	keyString keyKind = iota
+	keyTime
+	keyFloat
+)
+
+// sortKey is a field a list can be sorted by: its column, the kind of its
+// values and how to read the value from an item.
+type sortKey[T any] struct {
+	column string
+	kind   keyKind
+	value  func(T) any
+}
+
+// listing describes how a list pages. Items are ordered by the sort key and
+// then by tie, an expression unique within the list, so that pages neither
+// skip nor repeat items whose sort values are equal.
+type listing[T any] struct {
+	keys        map[string]sortKey[T]
+	defaultSort string
+	tie         string
+	tieValue    func(T) string
+}
+
+// cursor is the decoded form of a page cursor: the sort it was issued for
+// and the sort value and tie of the last item of its page.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	Tie   string `json:"t"`
+}
+
+// normalize fills in the defaults of p.
+func (l listing[T]) normalize(p PageQuery) PageQuery {
+	if p.Sort == "" {
+		p.Sort = l.defaultSort
+	}
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageLimit
+	}
+	p.Limit = min(p.Limit, MaxPageLimit)
+	return p
+}
+
+// plan returns the keyset condition for page p and its arguments, and the
+// ORDER BY and LIMIT clauses. It asks for one item more than the limit so
+// that page can tell whether another page follows.
+func (l listing[T]) plan(p PageQuery) (cond string, args []any, order string, err error) {
+	field, desc := strings.CutPrefix(p.Sort, "-")
+	key, ok := l.keys[field]
+	if !ok {
+		fields := slices.Sorted(maps.Keys(l.keys))
+		return "", nil, "", fmt.Errorf("%w: cannot sort by %q: must be one of %s, optionally prefixed with -",
+			ErrInvalidPage, field, strings.Join(fields, ", "))
+	}
+	dir, cmp := "ASC", ">"
+	if desc {
+		dir, cmp = "DESC", "<"
+	}
+	order = fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT %d", key.column, dir, l.tie, dir, p.Limit+1)
+	if p.Cursor == "" {
+		return "", nil, order, nil
+	}
+
+	c, err := decodeCursor(p.Cursor)
+	if err != nil || c.Sort != p.Sort {
+		return "", nil, "", fmt.Errorf("%w: cursor was not issued for sort %q", ErrInvalidPage, p.Sort)
+	}
+	value, err := key.parse(c.Value)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("%w: malformed cursor", ErrInvalidPage)
+	}
+	cond = fmt.Sprintf("(%s %s ? OR (%s = ? AND %s %s ?))", key.column, cmp, key.column, l.tie, cmp)
+	return cond, []any{value, value, c.Tie}, order, nil
+}
+
+// page drops the extra item plan asked for and returns the cursor of the
+// following page, or "" if items ends the list.
+func (l listing[T]) page(items []T, p PageQuery) ([]T, string) {
+	if len(items) <= p.Limit {
+		return items, ""
+	}
+	items = items[:p.Limit]
+	last := items[len(items)-1]
+	key := l.keys[strings.TrimPrefix(p.Sort, "-")]
+	return items, encodeCursor(cursor{Sort: p.Sort, Value: key.format(key.value(last)), Tie: l.tieValue(last)})
+}
+
+// queryPage runs query, a SELECT without WHERE, filtered by conditions and
+// paged by p, and scans the page.
+func queryPage[T any](ctx context.Context, s *SQLStore, l listing[T], p PageQuery, query string, conditions []string, args []any, scan func(rowScanner) (T, error)) ([]T, string, error) {
+	p = l.normalize(p)
+	cond, pageArgs, order, err := l.plan(p)
+	if err != nil {
+		return nil, "", err
+	}
+	if cond != "" {
+		conditions = append(conditions, cond)
+		args = append(args, pageArgs...)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query+joinConditions(conditions)+order, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	items, next := l.page(items, p)
+	return items, next, nil
+}
+
+func (k sortKey[T]) format(v any) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (k sortKey[T]) parse(s string) (any, error) {
+	switch k.kind {
+	case keyTime:
+		t, err := time.Parse(time.RFC3339Nano, s)
+		return t.UTC(), err
+	case keyFloat:
+		return strconv.ParseFloat(s, 64)
+	default:
+		return s, nil
+	}
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+// On Postgres cost_records is range-partitioned by month on start_time, one
+// partition per UTC month named after it: cost_records_p202610 holds the
+// records starting in October 2026. Migration 000018 converts the flat table
+// of earlier versions. There is no default partition, so a partition must
+// exist before records of its month are inserted; InsertCostRecords creates
+// missing ones and ManageCostPartitions creates them ahead of time. SQLite
+// keeps a single flat table.
+const costPartitionPrefix = "cost_records_p"
+
+func costPartitionName(month time.Time) string {
+	return costPartitionPrefix + month.Format("200601")
+}
+
+// createCostPartition returns the statement creating the partition of month.
+func createCostPartition(month time.Time) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF cost_records FOR VALUES FROM ('%s') TO ('%s')`,
+		costPartitionName(month), month.Format(time.DateTime), GranularityMonth.next(month).Format(time.DateTime))
+}
+
+// ensureCostPartitions creates the missing partitions of the months records
+// start in. Partitions already seen by this store are not looked up again.
+func (s *SQLStore) ensureCostPartitions(ctx context.Context, records []*models.CostRecord) error {
+	if s.driver != "pgx" {
+		return nil
+	}
+	for _, r := range records {
+		month := GranularityMonth.Truncate(r.StartTime)
+		if _, ok := s.partitions.Load(month); ok {
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, createCostPartition(month)); err != nil {
+			return fmt.Errorf("create partition %s: %w", costPartitionName(month), err)
+		}
+		s.partitions.Store(month, struct{}{})
+	}
+	return nil
+}
+
+// CostPartitionPolicy says which monthly partitions of cost_records
+// ManageCostPartitions keeps.
+type CostPartitionPolicy struct {
+	// Ahead is how many months after the current one get a partition before
+	// their first record arrives.
+	Ahead int
+	// Before, if set, expires the partitions of the months ending by then.
+	Before time.Time
+	// Detach detaches expired partitions, leaving them as plain tables for
+	// archival, instead of dropping them.
+	Detach bool
+}
+
+// PartitionResult names the partitions ManageCostPartitions created,
+// detached and dropped.
+type PartitionResult struct {
+	Created  []string `json:"created,omitempty"`
+	Detached []string `json:"detached,omitempty"`
+	Dropped  []string `json:"dropped,omitempty"`
+}
+
+// ManageCostPartitions creates the partitions of the current month and the
+// p.Ahead months after it, and detaches or drops those p.Before expires. An
+// expired partition goes in one transaction with the label index entries of
+// its records and the daily rollups of its month, which no longer count
+// them. It does nothing on SQLite.
+func (s *SQLStore) ManageCostPartitions(ctx context.Context, now time.Time, p CostPartitionPolicy) (PartitionResult, error) {
+	var res PartitionResult
+	if s.driver != "pgx" {
+		return res, nil
+	}
+	existing, err := s.costPartitions(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	month := GranularityMonth.Truncate(now)
+	for range p.Ahead + 1 {
+		if _, ok := existing[month]; !ok {
+			if _, err := s.db.ExecContext(ctx, createCostPartition(month)); err != nil {
+				return res, fmt.Errorf("create partition %s: %w", costPartitionName(month), err)
+			}
+			res.Created = append(res.Created, costPartitionName(month))
+		}
+		s.partitions.Store(month, struct{}{})
+		month = GranularityMonth.next(month)
+	}
+
+	if p.Before.IsZero() {
+		return res, nil
+	}
+	for month, name := range existing {
+		if GranularityMonth.next(month).After(p.Before) {
+			continue
+		}
+		if err := s.expireCostPartition(ctx, month, name, p.Detach); err != nil {
+			return res, fmt.Errorf("expire partition %s: %w", name, err)
+		}
+		if p.Detach {
+			res.Detached = append(res.Detached, name)
+		} else {
+			res.Dropped = append(res.Dropped, name)
+		}
+	}
+	return res, nil
+}
+
+// costPartitions returns the partitions of cost_records by month.
+func (s *SQLStore) costPartitions(ctx context.Context) (map[time.Time]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid WHERE i.inhparent = 'cost_records'::regclass`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partitions := make(map[time.Time]string)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		suffix, ok := strings.CutPrefix(name, costPartitionPrefix)
+		if !ok {
+			continue
+		}
+		month, err := time.Parse("200601", suffix)
+		if err != nil {
+			continue
+		}
+		partitions[month] = name
+	}
+	return partitions, rows.Err()
+}
+
+func (s *SQLStore) expireCostPartition(ctx context.Context, month time.Time, name string, detach bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM cost_record_labels WHERE record_id IN (SELECT id FROM `+name+`)`); err != nil {
+		return err
+	}
+	stmt := `DROP TABLE ` + name
+	if detach {
+		stmt = `ALTER TABLE cost_records DETACH PARTITION ` + name
+	}
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	if err := rebuildRollups(ctx, tx, "", month, GranularityMonth.next(month)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.partitions.Delete(month)
+	return nil
+}
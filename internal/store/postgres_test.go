@@ -0,0 +1,304 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/internal/store/storetest"
+	"github.com/inelson/finguard/migrations"
+)
+
+// These tests run against the Postgres database at
+// $FINGUARD_TEST_POSTGRES_DSN, each in a schema of its own, and are skipped
+// without it.
+
+func newPostgresStore(t *testing.T) (*store.SQLStore, *sql.DB) {
+	t.Helper()
+	dsn := storetest.PostgresDSN(t)
+	st, err := store.New(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return st, db
+}
+
+func seedSource(t *testing.T, st store.Store) *models.CostSource {
+	t.Helper()
+	ctx := context.Background()
+	project := &models.Project{Name: "payments"}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	source := &models.CostSource{ProjectID: project.ID, Type: models.CostSourceAWS, Name: "aws", Enabled: true}
+	if err := st.CreateCostSource(ctx, source); err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func costRecord(source *models.CostSource, id, service, team string, start time.Time, net float64) *models.CostRecord {
+	return &models.CostRecord{
+		ID: id, ProjectID: source.ProjectID, CostSourceID: source.ID, Provider: "aws", Service: service,
+		StartTime: start, EndTime: start.Add(time.Hour), NetCost: net, Currency: "USD",
+		Labels: map[string]string{"team": team},
+	}
+}
+
+func records(rs ...*models.CostRecord) iter.Seq2[*models.CostRecord, error] {
+	return func(yield func(*models.CostRecord, error) bool) {
+		for _, r := range rs {
+			if !yield(r, nil) {
+				return
+			}
+		}
+	}
+}
+
+func day(month time.Month, d int) time.Time {
+	return time.Date(2026, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+// partitions returns the names of the partitions of cost_records.
+func partitions(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = to_regclass('cost_records') ORDER BY c.relname`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func count(t *testing.T, db *sql.DB, query string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// totals returns q's net cost and record count from the daily rollups and
+// from the records themselves, which the label filter forces.
+func totals(t *testing.T, st store.Store, q store.CostQuery) (rolled, raw store.CostSummary) {
+	t.Helper()
+	ctx := context.Background()
+	r, err := st.AggregateCosts(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Labels = map[string]string{"team": "a"}
+	a, err := st.AggregateCosts(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *r, *a
+}
+
+func TestPostgres_MigrationPartitionsExistingCostRecords(t *testing.T) {
+	st, db := newPostgresStore(t)
+	if err := st.MigrateUp(migrations.FS, 17); err != nil {
+		t.Fatal(err)
+	}
+	source := seedSource(t, st)
+	for i, start := range []time.Time{day(time.August, 15), day(time.August, 31), day(time.September, 3)} {
+		if _, err := db.Exec(`INSERT INTO cost_records (id, project_id, cost_source_id, provider, service, start_time, end_time, net_cost, labels_json)
+			VALUES ($1, $2, $3, 'aws', 's3', $4, $5, 10, '{"team":"a"}')`,
+			fmt.Sprintf("r%d", i), source.ProjectID, source.ID, start, start.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := st.Migrate(migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+	if got := partitions(t, db); !slices.Equal(got, []string{"cost_records_p202608", "cost_records_p202609"}) {
+		t.Errorf("expected a partition per month with records, got %v", got)
+	}
+	rolled, raw := totals(t, st, store.CostQuery{ProjectID: source.ProjectID})
+	if rolled.TotalNetCost != 30 || raw.TotalNetCost != 30 || raw.RecordCount != 3 {
+		t.Errorf("expected the three records copied, labelled and rolled up, got %+v and %+v", rolled, raw)
+	}
+	// New months get their partition on insert.
+	if err := st.InsertCostRecords(context.Background(), []*models.CostRecord{costRecord(source, "r3", "s3", "a", day(time.October, 1), 5)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.MigrateDown(migrations.FS, 17); err != nil {
+		t.Fatal(err)
+	}
+	if got := partitions(t, db); len(got) != 0 {
+		t.Errorf("expected a flat table after migrating down, got partitions %v", got)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM cost_records`); n != 4 {
+		t.Errorf("expected the four records kept, got %d", n)
+	}
+	if _, err := db.Exec(`INSERT INTO cost_records (id, project_id, cost_source_id, provider, service, start_time, end_time)
+		VALUES ('r0', $1, $2, 'aws', 's3', $3, $3)`, source.ProjectID, source.ID, day(time.January, 1)); err == nil {
+		t.Error("expected the flat table's primary key to reject a repeated id")
+	}
+	if err := st.MigrateUp(migrations.FS, 0); err != nil {
+		t.Fatalf("migrating up again: %v", err)
+	}
+}
+
+func TestPostgres_IngestReplacesRecordsByID(t *testing.T) {
+	st, db := newPostgresStore(t)
+	if err := st.Migrate(migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+	source := seedSource(t, st)
+	ctx := context.Background()
+	batch := func(net float64, moved time.Time) []*models.CostRecord {
+		return []*models.CostRecord{
+			costRecord(source, "a", "s3", "a", day(time.March, 2), net),
+			costRecord(source, "b", "s3", "a", day(time.March, 20), net),
+			costRecord(source, "c", "ec2", "a", moved, net),
+		}
+	}
+	q := store.CostQuery{ProjectID: source.ProjectID, StartTime: day(time.January, 1), EndTime: day(time.June, 1)}
+
+	n, err := st.IngestCostRecords(ctx, records(batch(10, day(time.March, 31))...))
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 records ingested, got %d (%v)", n, err)
+	}
+	// Re-collecting the window replaces the records, including one that
+	// moves to the next month's partition.
+	if _, err := st.IngestCostRecords(ctx, records(batch(20, day(time.April, 1))...)); err != nil {
+		t.Fatal(err)
+	}
+	rolled, raw := totals(t, st, q)
+	if rolled.TotalNetCost != 60 || rolled.RecordCount != 3 || raw.TotalNetCost != 60 || raw.RecordCount != 3 {
+		t.Fatalf("expected the three records replaced, got %+v and %+v", rolled, raw)
+	}
+
+	// Concurrent ingests of the same records take turns instead of both
+	// inserting them.
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for range 4 {
+		wg.Go(func() {
+			errs <- st.InsertCostRecords(ctx, batch(20, day(time.April, 1)))
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM cost_records`); n != 3 {
+		t.Errorf("expected 3 records after concurrent ingests, got %d", n)
+	}
+	if rolled, raw := totals(t, st, q); rolled.TotalNetCost != 60 || raw.TotalNetCost != 60 {
+		t.Errorf("expected costs counted once after concurrent ingests, got %+v and %+v", rolled, raw)
+	}
+}
+
+func TestPostgres_ExpiredPartitionsLeaveRollups(t *testing.T) {
+	for _, detach := range []bool{false, true} {
+		t.Run(fmt.Sprintf("detach=%t", detach), func(t *testing.T) {
+			st, db := newPostgresStore(t)
+			if err := st.Migrate(migrations.FS); err != nil {
+				t.Fatal(err)
+			}
+			source := seedSource(t, st)
+			ctx := context.Background()
+			if err := st.InsertCostRecords(ctx, []*models.CostRecord{
+				costRecord(source, "jan", "s3", "a", day(time.January, 10), 7),
+				costRecord(source, "mar", "s3", "a", day(time.March, 10), 5),
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := st.ManageCostPartitions(ctx, day(time.March, 15), store.CostPartitionPolicy{Ahead: 1, Before: day(time.February, 1), Detach: detach})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expired := res.Dropped
+			if detach {
+				expired = res.Detached
+			}
+			if !slices.Equal(res.Created, []string{"cost_records_p202604"}) || !slices.Equal(expired, []string{"cost_records_p202601"}) {
+				t.Errorf("unexpected partition changes %+v", res)
+			}
+			if got := partitions(t, db); !slices.Equal(got, []string{"cost_records_p202603", "cost_records_p202604"}) {
+				t.Errorf("unexpected partitions %v", got)
+			}
+			kept := count(t, db, `SELECT COUNT(*) FROM pg_class WHERE relname = 'cost_records_p202601' AND relnamespace = current_schema()::regnamespace`)
+			if detach != (kept == 1) {
+				t.Errorf("detach=%t: expected the expired table kept only when detached, found %d", detach, kept)
+			}
+			if n := count(t, db, `SELECT COUNT(*) FROM cost_record_labels`); n != 1 {
+				t.Errorf("expected only the March record's label left, got %d", n)
+			}
+			rolled, raw := totals(t, st, store.CostQuery{ProjectID: source.ProjectID})
+			if rolled.TotalNetCost != 5 || raw.TotalNetCost != 5 {
+				t.Errorf("expected only March in the rollups and records, got %+v and %+v", rolled, raw)
+			}
+		})
+	}
+}
+
+func TestPostgres_GroupedSeries(t *testing.T) {
+	st, _ := newPostgresStore(t)
+	if err := st.Migrate(migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+	source := seedSource(t, st)
+	ctx := context.Background()
+	if err := st.InsertCostRecords(ctx, []*models.CostRecord{
+		costRecord(source, "1", "s3", "a", day(time.January, 5), 1),
+		costRecord(source, "2", "s3", "a", day(time.February, 5), 2),
+		costRecord(source, "3", "ec2", "b", day(time.February, 6), 10),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, groupBy := range [][]string{{"service"}, {"service", "label:team"}} {
+		series, err := st.CostTimeSeries(ctx, store.CostQuery{
+			ProjectID: source.ProjectID, StartTime: day(time.January, 1), EndTime: day(time.March, 1),
+			Granularity: store.GranularityMonth, GroupBy: groupBy,
+		})
+		if err != nil {
+			t.Fatalf("%v: %v", groupBy, err)
+		}
+		if len(series) != 2 || series[0].Group["service"] != "ec2" || series[1].Group["service"] != "s3" {
+			t.Fatalf("%v: expected ec2 then s3, got %+v", groupBy, series)
+		}
+		if len(groupBy) == 2 && (series[0].Group["label:team"] != "b" || series[1].Group["label:team"] != "a") {
+			t.Errorf("%v: expected the team label in each group, got %v and %v", groupBy, series[0].Group, series[1].Group)
+		}
+		s3 := series[1]
+		if len(s3.Points) != 2 || !s3.Points[0].Start.Equal(day(time.January, 1)) || s3.Points[0].TotalNetCost != 1 || s3.Points[1].TotalNetCost != 2 {
+			t.Errorf("%v: expected monthly s3 points of 1 and 2, got %+v", groupBy, s3.Points)
+		}
+		if ec2 := series[0]; ec2.TotalNetCost != 10 || ec2.Points[0].TotalNetCost != 0 {
+			t.Errorf("%v: expected ec2 to total 10 in February only, got %+v", groupBy, ec2)
+		}
+	}
+}
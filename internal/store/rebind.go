@@ -71,6 +71,14 @@ func (t *rebindTx) ExecContext(ctx context.Context, query string, args ...any) (
 	return t.tx.ExecContext(ctx, t.rebind(query), args...)
 }
 
+func (t *rebindTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return t.tx.QueryContext(ctx, t.rebind(query), args...)
+}
+
+func (t *rebindTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.tx.QueryRowContext(ctx, t.rebind(query), args...)
+}
+
 func (t *rebindTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
 	return t.tx.PrepareContext(ctx, t.rebind(query))
 }
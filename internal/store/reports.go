@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+const reportColumns = `id, project_id, name, schedule, timezone, recipients_json, format, filter_json, enabled, next_run_at, last_run_at, last_error, created_at, updated_at`
+
+func (s *SQLStore) CreateReport(ctx context.Context, r *models.Report) error {
+	if r.ID == "" {
+		r.ID = newID()
+	}
+	recipients, filter, err := marshalReportJSON(r)
+	if err != nil {
+		return err
+	}
+	r.CreatedAt = now()
+	r.UpdatedAt = r.CreatedAt
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO reports (`+reportColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.ProjectID, r.Name, r.Schedule, r.Timezone, recipients, r.Format, filter, r.Enabled,
+		utcOrNil(r.NextRunAt), utcOrNil(r.LastRunAt), r.LastError, r.CreatedAt, r.UpdatedAt,
+	)
+	return err
+}
+
+func (s *SQLStore) GetReport(ctx context.Context, id string) (*models.Report, error) {
+	r, err := scanReport(s.db.QueryRowContext(ctx, `SELECT `+reportColumns+` FROM reports WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+func (s *SQLStore) ListReports(ctx context.Context, projectID string) ([]*models.Report, error) {
+	return s.queryReports(ctx, `SELECT `+reportColumns+` FROM reports WHERE project_id = ? ORDER BY name, id`, projectID)
+}
+
+// ListDueReports returns the enabled reports whose next run is at or before
+// now.
+func (s *SQLStore) ListDueReports(ctx context.Context, now time.Time) ([]*models.Report, error) {
+	return s.queryReports(ctx,
+		`SELECT `+reportColumns+` FROM reports WHERE enabled = ? AND next_run_at <= ? ORDER BY next_run_at, id`, true, now.UTC(),
+	)
+}
+
+// UpdateReport saves a report's definition and next run. The outcome of the
+// last run is only changed by RecordReportRun.
+func (s *SQLStore) UpdateReport(ctx context.Context, r *models.Report) error {
+	recipients, filter, err := marshalReportJSON(r)
+	if err != nil {
+		return err
+	}
+	r.UpdatedAt = now()
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE reports SET name = ?, schedule = ?, timezone = ?, recipients_json = ?, format = ?, filter_json = ?, enabled = ?, next_run_at = ?, updated_at = ? WHERE id = ?`,
+		r.Name, r.Schedule, r.Timezone, recipients, r.Format, filter, r.Enabled, utcOrNil(r.NextRunAt), r.UpdatedAt, r.ID,
+	)
+	return err
+}
+
+// AdvanceReport moves a report's next run from from to to, and reports
+// whether it did. It fails when another instance has already advanced the
+// report, so each scheduled run is sent once.
+func (s *SQLStore) AdvanceReport(ctx context.Context, id string, from, to time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE reports SET next_run_at = ? WHERE id = ? AND next_run_at = ?`, to.UTC(), id, from.UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// RecordReportRun stores when a report was last sent and the error, if any.
+func (s *SQLStore) RecordReportRun(ctx context.Context, id string, at time.Time, lastError string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE reports SET last_run_at = ?, last_error = ? WHERE id = ?`, at.UTC(), lastError, id,
+	)
+	return err
+}
+
+func (s *SQLStore) DeleteReport(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM reports WHERE id = ?`, id)
+	return err
+}
+
+func (s *SQLStore) queryReports(ctx context.Context, query string, args ...any) ([]*models.Report, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []*models.Report
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+func scanReport(row rowScanner) (*models.Report, error) {
+	r := &models.Report{}
+	var recipients, filter string
+	if err := row.Scan(&r.ID, &r.ProjectID, &r.Name, &r.Schedule, &r.Timezone, &recipients, &r.Format, &filter, &r.Enabled,
+		&r.NextRunAt, &r.LastRunAt, &r.LastError, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(recipients), &r.Recipients); err != nil {
+		return nil, fmt.Errorf("report %s recipients: %w", r.ID, err)
+	}
+	if err := json.Unmarshal([]byte(filter), &r.Filter); err != nil {
+		return nil, fmt.Errorf("report %s filter: %w", r.ID, err)
+	}
+	return r, nil
+}
+
+func marshalReportJSON(r *models.Report) (recipients, filter string, err error) {
+	if r.Recipients == nil {
+		r.Recipients = []string{}
+	}
+	recipientsJSON, err := json.Marshal(r.Recipients)
+	if err != nil {
+		return "", "", err
+	}
+	filterJSON, err := json.Marshal(r.Filter)
+	if err != nil {
+		return "", "", err
+	}
+	return string(recipientsJSON), string(filterJSON), nil
+}
@@ -0,0 +1,289 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+// CostCompaction selects the cost records of a project that
+// CompactCostRecords merges into coarser records or removes.
+type CostCompaction struct {
+	ProjectID string
+	// Providers limits the compaction to records of these providers and
+	// ExcludeProviders leaves those of these providers alone. Both empty
+	// means every provider.
+	Providers        []string
+	ExcludeProviders []string
+	// Into is the granularity records are merged into, day or month.
+	// Empty removes the records instead of merging them.
+	Into Granularity
+	// Before bounds the records touched to those ending by then. Merging
+	// also leaves alone the buckets of Into ending after Before.
+	Before time.Time
+	// Archive, if set, is given each bucket's records before they are
+	// removed. An error leaves the bucket as it was and stops the compaction.
+	Archive func(bucket time.Time, records []*models.CostRecord) error
+}
+
+// CompactionResult counts the records a compaction removed and the merged
+// records it wrote in their place.
+type CompactionResult struct {
+	Removed int `json:"removed"`
+	Written int `json:"written"`
+}
+
+// CompactCostRecords merges the records c selects into one record per
+// bucket of c.Into and combination of every other column, or removes them
+// when c.Into is empty. Records crossing a bucket boundary are left as they
+// are. A merged record spans its whole bucket and carries the sums of the
+// records it replaces, so totals over whole buckets do not change; ranges
+// that split a bucket no longer see its costs. A merged record's ID derives
+// from its bucket and columns, so InsertCostRecords can drop re-collected
+// records the merged record already counts.
+//
+// Each bucket is compacted in its own transaction together with the daily
+// rollups of its days, so a failure loses no data and a later run carries
+// on where it stopped.
+func (s *SQLStore) CompactCostRecords(ctx context.Context, c CostCompaction) (CompactionResult, error) {
+	var res CompactionResult
+	unit := c.Into
+	switch unit {
+	case GranularityDay, GranularityMonth:
+	case "":
+		// Removal goes a month at a time to bound each transaction.
+		unit = GranularityMonth
+	default:
+		return res, fmt.Errorf("cannot compact cost records into %q: must be day or month", c.Into)
+	}
+	if c.Before.IsZero() {
+		return res, fmt.Errorf("compaction needs a before time")
+	}
+
+	conditions, args := compactionConditions(c)
+	var cursor time.Time
+	for {
+		var start time.Time
+		err := s.db.QueryRowContext(ctx,
+			`SELECT start_time FROM cost_records`+joinConditions(append(slices.Clip(conditions), "start_time >= ?"))+` ORDER BY start_time LIMIT 1`,
+			append(slices.Clip(args), cursor.UTC())...,
+		).Scan(&start)
+		if err == sql.ErrNoRows {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+
+		bucket := unit.Truncate(start)
+		end := unit.next(bucket)
+		if c.Into != "" && end.After(c.Before) {
+			return res, nil
+		}
+		removed, written, err := s.compactBucket(ctx, c, conditions, args, bucket, end)
+		if err != nil {
+			return res, fmt.Errorf("compact %s: %w", bucket.Format(time.DateOnly), err)
+		}
+		res.Removed += removed
+		res.Written += written
+		cursor = end
+	}
+}
+
+// compactionConditions returns the conditions on cost_records of c, apart
+// from the bucket.
+func compactionConditions(c CostCompaction) ([]string, []any) {
+	conditions := []string{"project_id = ?", "end_time <= ?"}
+	args := []any{c.ProjectID, c.Before.UTC()}
+	if len(c.Providers) > 0 {
+		conditions = append(conditions, "provider IN (?"+strings.Repeat(", ?", len(c.Providers)-1)+")")
+		for _, p := range c.Providers {
+			args = append(args, p)
+		}
+	}
+	if len(c.ExcludeProviders) > 0 {
+		conditions = append(conditions, "provider NOT IN (?"+strings.Repeat(", ?", len(c.ExcludeProviders)-1)+")")
+		for _, p := range c.ExcludeProviders {
+			args = append(args, p)
+		}
+	}
+	return conditions, args
+}
+
+// compactBucket compacts the records of [start, end) that c selects.
+func (s *SQLStore) compactBucket(ctx context.Context, c CostCompaction, conditions []string, args []any, start, end time.Time) (removed, written int, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	// Merging leaves records crossing the end of the bucket alone, and those
+	// spanning exactly the bucket, which an earlier run merged.
+	conditions = append(slices.Clip(conditions), "start_time >= ?", "start_time < ?")
+	args = append(slices.Clip(args), start.UTC(), end.UTC())
+	if c.Into != "" {
+		conditions = append(conditions, "end_time <= ?", "NOT (start_time = ? AND end_time = ?)")
+		args = append(args, end.UTC(), start.UTC(), end.UTC())
+	}
+	where := joinConditions(conditions)
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+costRecordColumns+` FROM cost_records`+where+` ORDER BY start_time, id`, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	var records []*models.CostRecord
+	for rows.Next() {
+		r, err := scanCostRecord(rows)
+		if err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		records = append(records, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if len(records) == 0 {
+		return 0, 0, nil
+	}
+
+	if c.Archive != nil {
+		if err := c.Archive(start, records); err != nil {
+			return 0, 0, fmt.Errorf("archive: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM cost_record_labels WHERE record_id IN (SELECT id FROM cost_records`+where+`)`, args...); err != nil {
+		return 0, 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM cost_records`+where, args...); err != nil {
+		return 0, 0, err
+	}
+
+	var merged []*models.CostRecord
+	if c.Into != "" {
+		merged = mergeCostRecords(records, start, end)
+		// A merged record's ID is derived from its bucket, so one merged by
+		// an earlier run is replaced rather than counted twice.
+		ids := make([]string, len(merged))
+		for i, m := range merged {
+			ids[i] = m.ID
+		}
+		if err := replaceCostRecords(ctx, tx, ids, make(rollupDeltas)); err != nil {
+			return 0, 0, err
+		}
+		if err := insertCostRecords(ctx, tx, merged); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if err := rebuildRollups(ctx, tx, c.ProjectID, start, end); err != nil {
+		return 0, 0, err
+	}
+	return len(records), len(merged), tx.Commit()
+}
+
+// mergeKey is what a merged record keeps of the records it replaces: every
+// column but the ID, the times and the costs.
+type mergeKey struct {
+	ProjectID        string
+	CostSourceID     string
+	Provider         string
+	ProviderID       string
+	AccountID        string
+	AccountName      string
+	InvoiceEntityID  string
+	Service          string
+	Category         string
+	Region           string
+	AvailabilityZone string
+	Currency         string
+	LabelsJSON       string
+}
+
+func mergeKeyOf(r *models.CostRecord) mergeKey {
+	return mergeKey{
+		r.ProjectID, r.CostSourceID, r.Provider, r.ProviderID, r.AccountID, r.AccountName, r.InvoiceEntityID,
+		r.Service, r.Category, r.Region, r.AvailabilityZone, r.Currency, labelsJSON(r),
+	}
+}
+
+// mergedNamespace is the UUID namespace of merged record IDs.
+var mergedNamespace = uuid.MustParse("0b7c6f2e-4f53-4d7e-9a55-3b1f0c2e8d41")
+
+// recordID is the ID of the record merging the records of k in [start, end).
+// It only depends on k and the bucket, so merging the same bucket again
+// yields the same ID.
+func (k mergeKey) recordID(start, end time.Time) string {
+	data, _ := json.Marshal(struct {
+		Key        mergeKey
+		Start, End time.Time
+	}{k, start.UTC(), end.UTC()})
+	return uuid.NewSHA1(mergedNamespace, data).String()
+}
+
+// mergeCostRecords merges records into one record spanning [start, end) per
+// mergeKey, in order of first appearance. Costs are summed; the Kubernetes
+// share is the mean of the merged records' weighted by list cost, or the
+// plain mean when they have no list cost.
+func mergeCostRecords(records []*models.CostRecord, start, end time.Time) []*models.CostRecord {
+	type share struct {
+		weighted, sum float64
+		n             int
+	}
+	var merged []*models.CostRecord
+	byKey := make(map[mergeKey]*models.CostRecord)
+	shares := make(map[*models.CostRecord]*share)
+	for _, r := range records {
+		key := mergeKeyOf(r)
+		m := byKey[key]
+		if m == nil {
+			m = &models.CostRecord{
+				ID:               key.recordID(start, end),
+				ProjectID:        r.ProjectID,
+				CostSourceID:     r.CostSourceID,
+				Provider:         r.Provider,
+				ProviderID:       r.ProviderID,
+				AccountID:        r.AccountID,
+				AccountName:      r.AccountName,
+				InvoiceEntityID:  r.InvoiceEntityID,
+				Service:          r.Service,
+				Category:         r.Category,
+				Region:           r.Region,
+				AvailabilityZone: r.AvailabilityZone,
+				StartTime:        start,
+				EndTime:          end,
+				Currency:         r.Currency,
+				Labels:           r.Labels,
+			}
+			byKey[key] = m
+			shares[m] = &share{}
+			merged = append(merged, m)
+		}
+		m.ListCost += r.ListCost
+		m.NetCost += r.NetCost
+		m.AmortizedCost += r.AmortizedCost
+		m.AmortizedNetCost += r.AmortizedNetCost
+		sh := shares[m]
+		sh.weighted += r.KubernetesPercent * r.ListCost
+		sh.sum += r.KubernetesPercent
+		sh.n++
+	}
+	for _, m := range merged {
+		if sh := shares[m]; m.ListCost != 0 {
+			m.KubernetesPercent = sh.weighted / m.ListCost
+		} else {
+			m.KubernetesPercent = sh.sum / float64(sh.n)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+const roleColumns = `name, description, permissions_json, created_at, updated_at`
+
+func (s *SQLStore) CreateRole(ctx context.Context, role *models.RoleDefinition) error {
+	role.CreatedAt = now()
+	role.UpdatedAt = role.CreatedAt
+	perms, err := json.Marshal(permissionsOrEmpty(role.Permissions))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO roles (`+roleColumns+`) VALUES (?, ?, ?, ?, ?)`,
+		role.Name, role.Description, string(perms), role.CreatedAt, role.UpdatedAt,
+	)
+	return err
+}
+
+func (s *SQLStore) GetRole(ctx context.Context, name string) (*models.RoleDefinition, error) {
+	role, err := scanRole(s.db.QueryRowContext(ctx, `SELECT `+roleColumns+` FROM roles WHERE name = ?`, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return role, err
+}
+
+func (s *SQLStore) ListRoles(ctx context.Context) ([]*models.RoleDefinition, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+roleColumns+` FROM roles ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*models.RoleDefinition
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (s *SQLStore) UpdateRole(ctx context.Context, role *models.RoleDefinition) error {
+	role.UpdatedAt = now()
+	perms, err := json.Marshal(permissionsOrEmpty(role.Permissions))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE roles SET description = ?, permissions_json = ?, updated_at = ? WHERE name = ?`,
+		role.Description, string(perms), role.UpdatedAt, role.Name,
+	)
+	return err
+}
+
+func (s *SQLStore) DeleteRole(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM roles WHERE name = ?`, name)
+	return err
+}
+
+// CountRoleAssignments reports how many project role assignments and pending
+// invitations reference the role.
+func (s *SQLStore) CountRoleAssignments(ctx context.Context, name string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM project_roles WHERE role = ?) + (SELECT COUNT(*) FROM project_invitations WHERE role = ?)`,
+		name, name,
+	).Scan(&n)
+	return n, err
+}
+
+func scanRole(row rowScanner) (*models.RoleDefinition, error) {
+	role := &models.RoleDefinition{}
+	var perms string
+	if err := row.Scan(&role.Name, &role.Description, &perms, &role.CreatedAt, &role.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(perms), &role.Permissions); err != nil {
+		return nil, fmt.Errorf("unmarshal permissions for role %s: %w", role.Name, err)
+	}
+	return role, nil
+}
+
+func permissionsOrEmpty(perms []models.Permission) []models.Permission {
+	if perms == nil {
+		return []models.Permission{}
+	}
+	return perms
+}
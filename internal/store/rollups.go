@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+// rollupKey identifies a row of cost_daily_rollups.
+type rollupKey struct {
+	ProjectID    string
+	CostSourceID string
+	Provider     string
+	Service      string
+	Category     string
+	Region       string
+	AccountID    string
+	Day          string
+	LastDay      string
+}
+
+// rollupKeyOf returns the rollup row a record counts towards. LastDay is the
+// day of the record's last instant, so a record ending at midnight does not
+// reach into the next day.
+func rollupKeyOf(r *models.CostRecord) rollupKey {
+	last := r.EndTime.UTC().Add(-time.Nanosecond)
+	if last.Before(r.StartTime.UTC()) {
+		last = r.StartTime.UTC()
+	}
+	return rollupKey{
+		ProjectID:    r.ProjectID,
+		CostSourceID: r.CostSourceID,
+		Provider:     r.Provider,
+		Service:      r.Service,
+		Category:     r.Category,
+		Region:       r.Region,
+		AccountID:    r.AccountID,
+		Day:          r.StartTime.UTC().Format(time.DateOnly),
+		LastDay:      last.Format(time.DateOnly),
+	}
+}
+
+// rollupDeltas accumulates the changes a batch of writes makes to each
+// rollup row, so each row is written once per batch.
+type rollupDeltas map[rollupKey]*CostSummary
+
+func (d rollupDeltas) add(r *models.CostRecord, sign int) {
+	key := rollupKeyOf(r)
+	delta := d[key]
+	if delta == nil {
+		delta = &CostSummary{}
+		d[key] = delta
+	}
+	f := float64(sign)
+	delta.add(CostSummary{
+		TotalListCost:     f * r.ListCost,
+		TotalNetCost:      f * r.NetCost,
+		TotalAmortized:    f * r.AmortizedCost,
+		TotalAmortizedNet: f * r.AmortizedNetCost,
+		RecordCount:       sign,
+	})
+}
+
+// applyRollups adds the deltas to cost_daily_rollups and drops the rows no
+// record counts towards any more.
+func applyRollups(ctx context.Context, tx *rebindTx, deltas rollupDeltas) error {
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO cost_daily_rollups (project_id, cost_source_id, provider, service, category, region, account_id, day, last_day, list_cost, net_cost, amortized_cost, amortized_net_cost, record_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(project_id, cost_source_id, provider, service, category, region, account_id, day, last_day) DO UPDATE SET
+			list_cost = cost_daily_rollups.list_cost + excluded.list_cost,
+			net_cost = cost_daily_rollups.net_cost + excluded.net_cost,
+			amortized_cost = cost_daily_rollups.amortized_cost + excluded.amortized_cost,
+			amortized_net_cost = cost_daily_rollups.amortized_net_cost + excluded.amortized_net_cost,
+			record_count = cost_daily_rollups.record_count + excluded.record_count`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	var emptied []rollupKey
+	for k, d := range deltas {
+		if _, err := stmt.ExecContext(ctx,
+			k.ProjectID, k.CostSourceID, k.Provider, k.Service, k.Category, k.Region, k.AccountID, k.Day, k.LastDay,
+			d.TotalListCost, d.TotalNetCost, d.TotalAmortized, d.TotalAmortizedNet, d.RecordCount,
+		); err != nil {
+			return err
+		}
+		if d.RecordCount < 0 {
+			emptied = append(emptied, k)
+		}
+	}
+	for _, k := range emptied {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM cost_daily_rollups WHERE project_id = ? AND cost_source_id = ? AND provider = ? AND service = ? AND category = ?
+			AND region = ? AND account_id = ? AND day = ? AND last_day = ? AND record_count <= 0`,
+			k.ProjectID, k.CostSourceID, k.Provider, k.Service, k.Category, k.Region, k.AccountID, k.Day, k.LastDay,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildCostRollups recomputes the daily rollups of a project, or of every
+// project when projectID is empty, from its raw cost records. Use it when the
+// rollups have drifted from the records, e.g. after records were edited by
+// hand.
+func (s *SQLStore) RebuildCostRollups(ctx context.Context, projectID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := rebuildRollups(ctx, tx, projectID, time.Time{}, time.Time{}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rebuildRollups recomputes, within tx, the rollups of the records starting
+// in [from, to), which are the rollup rows of the days in that range. Zero
+// bounds leave the range open and an empty projectID spans every project.
+func rebuildRollups(ctx context.Context, tx *rebindTx, projectID string, from, to time.Time) error {
+	var rollupConds, recordConds []string
+	var rollupArgs, recordArgs []any
+	if projectID != "" {
+		rollupConds, rollupArgs = append(rollupConds, "project_id = ?"), append(rollupArgs, projectID)
+		recordConds, recordArgs = append(recordConds, "project_id = ?"), append(recordArgs, projectID)
+	}
+	if !from.IsZero() {
+		rollupConds, rollupArgs = append(rollupConds, "day >= ?"), append(rollupArgs, from.UTC().Format(time.DateOnly))
+		recordConds, recordArgs = append(recordConds, "start_time >= ?"), append(recordArgs, from.UTC())
+	}
+	if !to.IsZero() {
+		rollupConds, rollupArgs = append(rollupConds, "day < ?"), append(rollupArgs, to.UTC().Format(time.DateOnly))
+		recordConds, recordArgs = append(recordConds, "start_time < ?"), append(recordArgs, to.UTC())
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM cost_daily_rollups`+joinConditions(rollupConds), rollupArgs...); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT project_id, cost_source_id, provider, service, category, region, account_id, start_time, end_time, list_cost, net_cost, amortized_cost, amortized_net_cost FROM cost_records`+joinConditions(recordConds), recordArgs...)
+	if err != nil {
+		return err
+	}
+	deltas := make(rollupDeltas)
+	for rows.Next() {
+		r := &models.CostRecord{}
+		if err := rows.Scan(&r.ProjectID, &r.CostSourceID, &r.Provider, &r.Service, &r.Category, &r.Region, &r.AccountID,
+			&r.StartTime, &r.EndTime, &r.ListCost, &r.NetCost, &r.AmortizedCost, &r.AmortizedNetCost); err != nil {
+			rows.Close()
+			return err
+		}
+		deltas.add(r, 1)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return applyRollups(ctx, tx, deltas)
+}
+
+// useRollups reports whether q can be answered from the daily rollups: it
+// filters and groups only by columns the rollups keep, its range starts and
+// ends on UTC midnights, and it asks for no buckets finer than a day.
+func useRollups(q CostQuery) bool {
+	if len(labelSelectors(q)) > 0 || q.Granularity == GranularityHour {
+		return false
+	}
+	for _, dim := range q.GroupBy {
+		if strings.HasPrefix(dim, "label:") {
+			return false
+		}
+	}
+	for _, t := range []time.Time{q.StartTime, q.EndTime} {
+		if !t.IsZero() && !t.UTC().Equal(GranularityDay.Truncate(t)) {
+			return false
+		}
+	}
+	return true
+}
+
+// buildRollupWhere is buildCostWhere for cost_daily_rollups. With the range
+// on midnights, start_time >= start holds exactly when the record's day is
+// on or after start's, and end_time <= end when its last day is before end's.
+func (s *SQLStore) buildRollupWhere(q CostQuery) (string, []any) {
+	conditions, args := costColumnConditions(q)
+	if !q.StartTime.IsZero() {
+		conditions = append(conditions, "day >= ?")
+		args = append(args, q.StartTime.UTC().Format(time.DateOnly))
+	}
+	if !q.EndTime.IsZero() {
+		conditions = append(conditions, "last_day < ?")
+		args = append(args, q.EndTime.UTC().Format(time.DateOnly))
+	}
+	return joinConditions(conditions), args
+}
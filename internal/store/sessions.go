@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+)
+
+const sessionColumns = `id, user_id, user_agent, ip_address, groups_json, refresh_token, token_expires_at, created_at, last_seen_at, expires_at, revoked_at`
+
+func (s *SQLStore) CreateSession(ctx context.Context, sess *models.Session) error {
+	if sess.ID == "" {
+		sess.ID = newID()
+	}
+	sess.CreatedAt = now()
+	sess.LastSeenAt = sess.CreatedAt
+	groupsJSON, err := marshalStrings(sess.Groups)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sess.ID, sess.UserID, sess.UserAgent, sess.IPAddress, groupsJSON, sess.RefreshToken, sess.TokenExpiresAt,
+		sess.CreatedAt, sess.LastSeenAt, sess.ExpiresAt, sess.RevokedAt,
+	)
+	return err
+}
+
+func (s *SQLStore) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	sess, err := scanSession(s.db.QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sess, err
+}
+
+// ListUserSessions returns the user's sessions that can still be used, most
+// recently used first: not revoked, not idle since before idleBefore, and not
+// expired unless a refresh token can renew them. A zero idleBefore means
+// sessions never go idle.
+func (s *SQLStore) ListUserSessions(ctx context.Context, userID string, idleBefore time.Time) ([]*models.Session, error) {
+	conds := []string{`user_id = ?`, `revoked_at IS NULL`, `(expires_at >= ? OR refresh_token <> '')`}
+	args := []any{userID, now()}
+	if !idleBefore.IsZero() {
+		conds = append(conds, `last_seen_at >= ?`)
+		args = append(args, idleBefore.UTC())
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE `+strings.Join(conds, " AND ")+` ORDER BY last_seen_at DESC`, args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *SQLStore) TouchSession(ctx context.Context, id string, t time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE sessions SET last_seen_at = ? WHERE id = ?`, t, id)
+	return err
+}
+
+// UpdateSessionToken persists a renewed refresh token along with the extended session expiry.
+func (s *SQLStore) UpdateSessionToken(ctx context.Context, sess *models.Session) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE sessions SET refresh_token = ?, token_expires_at = ?, expires_at = ? WHERE id = ?`,
+		sess.RefreshToken, sess.TokenExpiresAt, sess.ExpiresAt, sess.ID,
+	)
+	return err
+}
+
+func (s *SQLStore) RevokeSession(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = ?, refresh_token = '' WHERE id = ? AND revoked_at IS NULL`, now(), id,
+	)
+	return err
+}
+
+func (s *SQLStore) RevokeUserSessions(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = ?, refresh_token = '' WHERE user_id = ? AND revoked_at IS NULL`, now(), userID,
+	)
+	return err
+}
+
+// DeleteStaleSessions purges sessions that can no longer be used: revoked ones,
+// ones idle since before idleBefore, and expired ones with no refresh token to renew them.
+// A zero idleBefore means sessions never go idle.
+func (s *SQLStore) DeleteStaleSessions(ctx context.Context, idleBefore time.Time) error {
+	conds := []string{`revoked_at IS NOT NULL`, `(expires_at < ? AND refresh_token = '')`}
+	args := []any{now()}
+	if !idleBefore.IsZero() {
+		conds = append(conds, `last_seen_at < ?`)
+		args = append(args, idleBefore.UTC())
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE `+strings.Join(conds, " OR "), args...)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row rowScanner) (*models.Session, error) {
+	sess := &models.Session{}
+	var groupsJSON string
+	if err := row.Scan(
+		&sess.ID, &sess.UserID, &sess.UserAgent, &sess.IPAddress, &groupsJSON, &sess.RefreshToken, &sess.TokenExpiresAt,
+		&sess.CreatedAt, &sess.LastSeenAt, &sess.ExpiresAt, &sess.RevokedAt,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(groupsJSON), &sess.Groups); err != nil {
+		return nil, fmt.Errorf("unmarshal groups for session %s: %w", sess.ID, err)
+	}
+	return sess, nil
+}
+
+func marshalStrings(values []string) (string, error) {
+	if values == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/fs"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,6 +19,9 @@ type SQLStore struct {
 	db     *rebindDB
 	rawDB  *sql.DB
 	driver string
+	// partitions holds the months whose cost_records partition is known to
+	// exist, on Postgres.
+	partitions sync.Map
 }
 
 func New(dsn string) (*SQLStore, error) {
@@ -62,7 +66,7 @@ func (s *SQLStore) Close() error {
 }
 
 func (s *SQLStore) Migrate(migrationsFS fs.FS) error {
-	return runMigrations(s.db, migrationsFS)
+	return s.MigrateUp(migrationsFS, 0)
 }
 
 func newID() string {
@@ -75,24 +79,44 @@ func now() time.Time {
 
 // --- Projects ---
 
-func (s *SQLStore) CreateProject(ctx context.Context, p *models.Project) error {
+func (s *SQLStore) CreateProject(ctx context.Context, p *models.Project, roles ...*models.ProjectRole) error {
 	if p.ID == "" {
 		p.ID = newID()
 	}
+	if p.AdmissionMode == "" {
+		p.AdmissionMode = models.AdmissionWarn
+	}
 	p.CreatedAt = now()
 	p.UpdatedAt = p.CreatedAt
-	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO projects (id, name, description, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
-		p.ID, p.Name, p.Description, p.CreatedAt, p.UpdatedAt,
-	)
-	return err
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO projects (id, name, description, admission_mode, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		p.ID, p.Name, p.Description, p.AdmissionMode, p.CreatedAt, p.UpdatedAt,
+	); err != nil {
+		return err
+	}
+	for _, pr := range roles {
+		pr.ProjectID = p.ID
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO project_roles (`+projectRoleColumns+`) VALUES (?, ?, ?, ?, ?)`,
+			pr.ProjectID, pr.SubjectType, pr.SubjectID, pr.Role, utcOrNil(pr.ExpiresAt),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
+const projectColumns = `id, name, description, admission_mode, created_at, updated_at`
+
 func (s *SQLStore) GetProject(ctx context.Context, id string) (*models.Project, error) {
-	p := &models.Project{}
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, name, description, created_at, updated_at FROM projects WHERE id = ?`, id,
-	).Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.UpdatedAt)
+	p, err := scanProject(s.db.QueryRowContext(ctx, `SELECT `+projectColumns+` FROM projects WHERE id = ?`, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -100,7 +124,7 @@ func (s *SQLStore) GetProject(ctx context.Context, id string) (*models.Project,
 }
 
 func (s *SQLStore) ListProjects(ctx context.Context) ([]*models.Project, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT id, name, description, created_at, updated_at FROM projects ORDER BY name`)
+	rows, err := s.db.QueryContext(ctx, `SELECT `+projectColumns+` FROM projects ORDER BY name`)
 	if err != nil {
 		return nil, err
 	}
@@ -108,8 +132,8 @@ func (s *SQLStore) ListProjects(ctx context.Context) ([]*models.Project, error)
 
 	var projects []*models.Project
 	for rows.Next() {
-		p := &models.Project{}
-		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		p, err := scanProject(rows)
+		if err != nil {
 			return nil, err
 		}
 		projects = append(projects, p)
@@ -117,18 +141,57 @@ func (s *SQLStore) ListProjects(ctx context.Context) ([]*models.Project, error)
 	return projects, rows.Err()
 }
 
+var projectListing = listing[*models.Project]{
+	keys: map[string]sortKey[*models.Project]{
+		"name":      {column: "name", kind: keyString, value: func(p *models.Project) any { return p.Name }},
+		"createdAt": {column: "created_at", kind: keyTime, value: func(p *models.Project) any { return p.CreatedAt }},
+		"updatedAt": {column: "updated_at", kind: keyTime, value: func(p *models.Project) any { return p.UpdatedAt }},
+	},
+	defaultSort: "name",
+	tie:         "id",
+	tieValue:    func(p *models.Project) string { return p.ID },
+}
+
+// ListProjectsPage returns one page of projects, by name unless p sorts by
+// createdAt or updatedAt, and the cursor of the next page.
+func (s *SQLStore) ListProjectsPage(ctx context.Context, p PageQuery) ([]*models.Project, string, error) {
+	return queryPage(ctx, s, projectListing, p, `SELECT `+projectColumns+` FROM projects`, nil, nil, scanProject)
+}
+
+func scanProject(row rowScanner) (*models.Project, error) {
+	p := &models.Project{}
+	if err := row.Scan(&p.ID, &p.Name, &p.Description, &p.AdmissionMode, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 func (s *SQLStore) UpdateProject(ctx context.Context, p *models.Project) error {
 	p.UpdatedAt = now()
 	_, err := s.db.ExecContext(ctx,
-		`UPDATE projects SET name = ?, description = ?, updated_at = ? WHERE id = ?`,
-		p.Name, p.Description, p.UpdatedAt, p.ID,
+		`UPDATE projects SET name = ?, description = ?, admission_mode = ?, updated_at = ? WHERE id = ?`,
+		p.Name, p.Description, p.AdmissionMode, p.UpdatedAt, p.ID,
 	)
 	return err
 }
 
+// DeleteProject deletes a project and everything in it. The label index is
+// cleared first: on Postgres it has no foreign key to the partitioned cost
+// records to cascade along.
 func (s *SQLStore) DeleteProject(ctx context.Context, id string) error {
-	_, err := s.db.ExecContext(ctx, `DELETE FROM projects WHERE id = ?`, id)
-	return err
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM cost_record_labels WHERE project_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM projects WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // --- Cost Sources ---
@@ -150,22 +213,19 @@ func (s *SQLStore) CreateCostSource(ctx context.Context, cs *models.CostSource)
 	return err
 }
 
+const costSourceColumns = `id, project_id, type, name, config_json, enabled, last_collected_at, created_at, updated_at`
+
 func (s *SQLStore) GetCostSource(ctx context.Context, id string) (*models.CostSource, error) {
-	cs := &models.CostSource{}
-	var configJSON string
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, project_id, type, name, config_json, enabled, last_collected_at, created_at, updated_at FROM cost_sources WHERE id = ?`, id,
-	).Scan(&cs.ID, &cs.ProjectID, &cs.Type, &cs.Name, &configJSON, &cs.Enabled, &cs.LastCollectedAt, &cs.CreatedAt, &cs.UpdatedAt)
+	cs, err := scanCostSource(s.db.QueryRowContext(ctx, `SELECT `+costSourceColumns+` FROM cost_sources WHERE id = ?`, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	cs.Config = json.RawMessage(configJSON)
 	return cs, err
 }
 
 func (s *SQLStore) ListCostSources(ctx context.Context, projectID string) ([]*models.CostSource, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, project_id, type, name, config_json, enabled, last_collected_at, created_at, updated_at FROM cost_sources WHERE project_id = ? ORDER BY name`, projectID,
+		`SELECT `+costSourceColumns+` FROM cost_sources WHERE project_id = ? ORDER BY name`, projectID,
 	)
 	if err != nil {
 		return nil, err
@@ -174,17 +234,43 @@ func (s *SQLStore) ListCostSources(ctx context.Context, projectID string) ([]*mo
 
 	var sources []*models.CostSource
 	for rows.Next() {
-		cs := &models.CostSource{}
-		var configJSON string
-		if err := rows.Scan(&cs.ID, &cs.ProjectID, &cs.Type, &cs.Name, &configJSON, &cs.Enabled, &cs.LastCollectedAt, &cs.CreatedAt, &cs.UpdatedAt); err != nil {
+		cs, err := scanCostSource(rows)
+		if err != nil {
 			return nil, err
 		}
-		cs.Config = json.RawMessage(configJSON)
 		sources = append(sources, cs)
 	}
 	return sources, rows.Err()
 }
 
+var costSourceListing = listing[*models.CostSource]{
+	keys: map[string]sortKey[*models.CostSource]{
+		"name":      {column: "name", kind: keyString, value: func(cs *models.CostSource) any { return cs.Name }},
+		"type":      {column: "type", kind: keyString, value: func(cs *models.CostSource) any { return string(cs.Type) }},
+		"createdAt": {column: "created_at", kind: keyTime, value: func(cs *models.CostSource) any { return cs.CreatedAt }},
+	},
+	defaultSort: "name",
+	tie:         "id",
+	tieValue:    func(cs *models.CostSource) string { return cs.ID },
+}
+
+// ListCostSourcesPage returns one page of a project's cost sources, by name
+// unless p sorts by type or createdAt, and the cursor of the next page.
+func (s *SQLStore) ListCostSourcesPage(ctx context.Context, projectID string, p PageQuery) ([]*models.CostSource, string, error) {
+	return queryPage(ctx, s, costSourceListing, p, `SELECT `+costSourceColumns+` FROM cost_sources`,
+		[]string{"project_id = ?"}, []any{projectID}, scanCostSource)
+}
+
+func scanCostSource(row rowScanner) (*models.CostSource, error) {
+	cs := &models.CostSource{}
+	var configJSON string
+	if err := row.Scan(&cs.ID, &cs.ProjectID, &cs.Type, &cs.Name, &configJSON, &cs.Enabled, &cs.LastCollectedAt, &cs.CreatedAt, &cs.UpdatedAt); err != nil {
+		return nil, err
+	}
+	cs.Config = json.RawMessage(configJSON)
+	return cs, nil
+}
+
 func (s *SQLStore) UpdateCostSource(ctx context.Context, cs *models.CostSource) error {
 	cs.UpdatedAt = now()
 	configJSON := string(cs.Config)
@@ -198,9 +284,24 @@ func (s *SQLStore) UpdateCostSource(ctx context.Context, cs *models.CostSource)
 	return err
 }
 
+// DeleteCostSource deletes a cost source and its records, clearing their
+// labels first like DeleteProject.
 func (s *SQLStore) DeleteCostSource(ctx context.Context, id string) error {
-	_, err := s.db.ExecContext(ctx, `DELETE FROM cost_sources WHERE id = ?`, id)
-	return err
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM cost_record_labels WHERE record_id IN (SELECT id FROM cost_records WHERE cost_source_id = ?)`, id,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM cost_sources WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (s *SQLStore) UpdateCostSourceCollectedAt(ctx context.Context, id string, t time.Time) error {
@@ -213,135 +314,186 @@ func (s *SQLStore) UpdateCostSourceCollectedAt(ctx context.Context, id string, t
 
 // --- Users ---
 
+const userColumns = `id, email, display_name, oidc_subject, external_id, active, created_at`
+
 func (s *SQLStore) CreateUser(ctx context.Context, u *models.User) error {
 	if u.ID == "" {
 		u.ID = newID()
 	}
 	u.CreatedAt = now()
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO users (id, email, display_name, oidc_subject, created_at) VALUES (?, ?, ?, ?, ?)`,
-		u.ID, u.Email, u.DisplayName, nullString(u.OIDCSubject), u.CreatedAt,
+		`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		u.ID, u.Email, u.DisplayName, nullString(u.OIDCSubject), u.ExternalID, u.Active, u.CreatedAt,
 	)
 	return err
 }
 
 func (s *SQLStore) GetUser(ctx context.Context, id string) (*models.User, error) {
-	u := &models.User{}
-	var oidcSubject sql.NullString
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, email, display_name, oidc_subject, created_at FROM users WHERE id = ?`, id,
-	).Scan(&u.ID, &u.Email, &u.DisplayName, &oidcSubject, &u.CreatedAt)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	u.OIDCSubject = oidcSubject.String
-	return u, err
+	return s.getUser(ctx, `id = ?`, id)
 }
 
 func (s *SQLStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	u := &models.User{}
-	var oidcSubject sql.NullString
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, email, display_name, oidc_subject, created_at FROM users WHERE email = ?`, email,
-	).Scan(&u.ID, &u.Email, &u.DisplayName, &oidcSubject, &u.CreatedAt)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	u.OIDCSubject = oidcSubject.String
-	return u, err
+	return s.getUser(ctx, `email = ?`, email)
 }
 
 func (s *SQLStore) GetUserByOIDCSubject(ctx context.Context, subject string) (*models.User, error) {
-	u := &models.User{}
-	var oidcSubject sql.NullString
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, email, display_name, oidc_subject, created_at FROM users WHERE oidc_subject = ?`, subject,
-	).Scan(&u.ID, &u.Email, &u.DisplayName, &oidcSubject, &u.CreatedAt)
+	return s.getUser(ctx, `oidc_subject = ?`, subject)
+}
+
+func (s *SQLStore) getUser(ctx context.Context, where string, arg any) (*models.User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE `+where, arg))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	u.OIDCSubject = oidcSubject.String
 	return u, err
 }
 
 func (s *SQLStore) ListUsers(ctx context.Context) ([]*models.User, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT id, email, display_name, oidc_subject, created_at FROM users ORDER BY email`)
+	users, _, err := s.SearchUsers(ctx, DirectoryQuery{})
+	return users, err
+}
+
+var userListing = listing[*models.User]{
+	keys: map[string]sortKey[*models.User]{
+		"email":     {column: "email", kind: keyString, value: func(u *models.User) any { return u.Email }},
+		"createdAt": {column: "created_at", kind: keyTime, value: func(u *models.User) any { return u.CreatedAt }},
+	},
+	defaultSort: "email",
+	tie:         "id",
+	tieValue:    func(u *models.User) string { return u.ID },
+}
+
+// ListUsersPage returns one page of users, by email unless p sorts by
+// createdAt, and the cursor of the next page.
+func (s *SQLStore) ListUsersPage(ctx context.Context, p PageQuery) ([]*models.User, string, error) {
+	return queryPage(ctx, s, userListing, p, `SELECT `+userColumns+` FROM users`, nil, nil, scanUser)
+}
+
+// SearchUsers returns one page of users ordered by email, along with the total
+// number of users matching the query.
+func (s *SQLStore) SearchUsers(ctx context.Context, q DirectoryQuery) ([]*models.User, int, error) {
+	where, args := buildDirectoryWhere(q, "email")
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users`+where+` ORDER BY email`+pageClause(q), args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	var users []*models.User
 	for rows.Next() {
-		u := &models.User{}
-		var oidcSubject sql.NullString
-		if err := rows.Scan(&u.ID, &u.Email, &u.DisplayName, &oidcSubject, &u.CreatedAt); err != nil {
-			return nil, err
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
 		}
-		u.OIDCSubject = oidcSubject.String
 		users = append(users, u)
 	}
-	return users, rows.Err()
+	return users, total, rows.Err()
+}
+
+func (s *SQLStore) UpdateUser(ctx context.Context, u *models.User) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE users SET email = ?, display_name = ?, oidc_subject = ?, external_id = ?, active = ? WHERE id = ?`,
+		u.Email, u.DisplayName, nullString(u.OIDCSubject), u.ExternalID, u.Active, u.ID,
+	)
+	return err
+}
+
+// DeleteUser removes the user along with their direct project role assignments.
+// Sessions and group memberships are removed by foreign key cascade.
+func (s *SQLStore) DeleteUser(ctx context.Context, id string) error {
+	return s.deleteSubject(ctx, "users", models.SubjectUser, id)
+}
+
+func scanUser(row rowScanner) (*models.User, error) {
+	u := &models.User{}
+	var oidcSubject sql.NullString
+	if err := row.Scan(&u.ID, &u.Email, &u.DisplayName, &oidcSubject, &u.ExternalID, &u.Active, &u.CreatedAt); err != nil {
+		return nil, err
+	}
+	u.OIDCSubject = oidcSubject.String
+	return u, nil
 }
 
 // --- Groups ---
 
+const groupColumns = `id, name, oidc_claim, external_id, created_at`
+
 func (s *SQLStore) CreateGroup(ctx context.Context, g *models.Group) error {
 	if g.ID == "" {
 		g.ID = newID()
 	}
 	g.CreatedAt = now()
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO groups (id, name, oidc_claim, created_at) VALUES (?, ?, ?, ?)`,
-		g.ID, g.Name, nullString(g.OIDCClaim), g.CreatedAt,
+		`INSERT INTO groups (`+groupColumns+`) VALUES (?, ?, ?, ?, ?)`,
+		g.ID, g.Name, nullString(g.OIDCClaim), g.ExternalID, g.CreatedAt,
 	)
 	return err
 }
 
 func (s *SQLStore) GetGroup(ctx context.Context, id string) (*models.Group, error) {
-	g := &models.Group{}
-	var oidcClaim sql.NullString
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, name, oidc_claim, created_at FROM groups WHERE id = ?`, id,
-	).Scan(&g.ID, &g.Name, &oidcClaim, &g.CreatedAt)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	g.OIDCClaim = oidcClaim.String
-	return g, err
+	return s.getGroup(ctx, `id = ?`, id)
 }
 
 func (s *SQLStore) GetGroupByOIDCClaim(ctx context.Context, claim string) (*models.Group, error) {
-	g := &models.Group{}
-	var oidcClaim sql.NullString
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, name, oidc_claim, created_at FROM groups WHERE oidc_claim = ?`, claim,
-	).Scan(&g.ID, &g.Name, &oidcClaim, &g.CreatedAt)
+	return s.getGroup(ctx, `oidc_claim = ?`, claim)
+}
+
+func (s *SQLStore) getGroup(ctx context.Context, where string, arg any) (*models.Group, error) {
+	g, err := scanGroup(s.db.QueryRowContext(ctx, `SELECT `+groupColumns+` FROM groups WHERE `+where, arg))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	g.OIDCClaim = oidcClaim.String
 	return g, err
 }
 
 func (s *SQLStore) ListGroups(ctx context.Context) ([]*models.Group, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT id, name, oidc_claim, created_at FROM groups ORDER BY name`)
+	groups, _, err := s.SearchGroups(ctx, DirectoryQuery{})
+	return groups, err
+}
+
+// SearchGroups returns one page of groups ordered by name, along with the total
+// number of groups matching the query. DirectoryQuery.Name matches the group name.
+func (s *SQLStore) SearchGroups(ctx context.Context, q DirectoryQuery) ([]*models.Group, int, error) {
+	where, args := buildDirectoryWhere(q, "name")
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM groups`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+groupColumns+` FROM groups`+where+` ORDER BY name`+pageClause(q), args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	var groups []*models.Group
 	for rows.Next() {
-		g := &models.Group{}
-		var oidcClaim sql.NullString
-		if err := rows.Scan(&g.ID, &g.Name, &oidcClaim, &g.CreatedAt); err != nil {
-			return nil, err
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, 0, err
 		}
-		g.OIDCClaim = oidcClaim.String
 		groups = append(groups, g)
 	}
-	return groups, rows.Err()
+	return groups, total, rows.Err()
+}
+
+func (s *SQLStore) UpdateGroup(ctx context.Context, g *models.Group) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE groups SET name = ?, external_id = ? WHERE id = ?`,
+		g.Name, g.ExternalID, g.ID,
+	)
+	return err
+}
+
+// DeleteGroup removes the group along with its project role assignments.
+// Memberships are removed by foreign key cascade.
+func (s *SQLStore) DeleteGroup(ctx context.Context, id string) error {
+	return s.deleteSubject(ctx, "groups", models.SubjectGroup, id)
 }
 
 func (s *SQLStore) AddGroupMember(ctx context.Context, groupID, userID string) error {
@@ -362,9 +514,28 @@ func (s *SQLStore) RemoveGroupMember(ctx context.Context, groupID, userID string
 	return err
 }
 
+// SetGroupMembers replaces the group's membership with exactly userIDs.
+func (s *SQLStore) SetGroupMembers(ctx context.Context, groupID string, userIDs []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM group_members WHERE group_id = ?`, groupID); err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO group_members (group_id, user_id) VALUES (?, ?)`, groupID, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 func (s *SQLStore) ListGroupMembers(ctx context.Context, groupID string) ([]*models.User, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT u.id, u.email, u.display_name, u.oidc_subject, u.created_at FROM users u JOIN group_members gm ON u.id = gm.user_id WHERE gm.group_id = ? ORDER BY u.email`,
+		`SELECT u.id, u.email, u.display_name, u.oidc_subject, u.external_id, u.active, u.created_at FROM users u JOIN group_members gm ON u.id = gm.user_id WHERE gm.group_id = ? ORDER BY u.email`,
 		groupID,
 	)
 	if err != nil {
@@ -374,24 +545,99 @@ func (s *SQLStore) ListGroupMembers(ctx context.Context, groupID string) ([]*mod
 
 	var users []*models.User
 	for rows.Next() {
-		u := &models.User{}
-		var oidcSubject sql.NullString
-		if err := rows.Scan(&u.ID, &u.Email, &u.DisplayName, &oidcSubject, &u.CreatedAt); err != nil {
+		u, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
-		u.OIDCSubject = oidcSubject.String
 		users = append(users, u)
 	}
 	return users, rows.Err()
 }
 
+func (s *SQLStore) ListUserGroups(ctx context.Context, userID string) ([]*models.Group, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT g.id, g.name, g.oidc_claim, g.external_id, g.created_at FROM groups g JOIN group_members gm ON g.id = gm.group_id WHERE gm.user_id = ? ORDER BY g.name`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*models.Group
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+func scanGroup(row rowScanner) (*models.Group, error) {
+	g := &models.Group{}
+	var oidcClaim sql.NullString
+	if err := row.Scan(&g.ID, &g.Name, &oidcClaim, &g.ExternalID, &g.CreatedAt); err != nil {
+		return nil, err
+	}
+	g.OIDCClaim = oidcClaim.String
+	return g, nil
+}
+
+// deleteSubject deletes a user or group row together with the project roles
+// granted to it, which have no foreign key to cascade from.
+func (s *SQLStore) deleteSubject(ctx context.Context, table string, subjectType models.SubjectType, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM project_roles WHERE subject_type = ? AND subject_id = ?`, subjectType, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func buildDirectoryWhere(q DirectoryQuery, nameColumn string) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if q.Name != "" {
+		conditions = append(conditions, "LOWER("+nameColumn+") = LOWER(?)")
+		args = append(args, q.Name)
+	}
+	if q.ExternalID != "" {
+		conditions = append(conditions, "external_id = ?")
+		args = append(args, q.ExternalID)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func pageClause(q DirectoryQuery) string {
+	if q.Limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d OFFSET %d", q.Limit, q.Offset)
+}
+
 // --- Project Roles ---
 
+const projectRoleColumns = `project_id, subject_type, subject_id, role, expires_at`
+
 func (s *SQLStore) SetProjectRole(ctx context.Context, pr *models.ProjectRole) error {
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO project_roles (project_id, subject_type, subject_id, role) VALUES (?, ?, ?, ?)
-		ON CONFLICT(project_id, subject_type, subject_id) DO UPDATE SET role = excluded.role`,
-		pr.ProjectID, pr.SubjectType, pr.SubjectID, pr.Role,
+		`INSERT INTO project_roles (`+projectRoleColumns+`) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(project_id, subject_type, subject_id) DO UPDATE SET role = excluded.role, expires_at = excluded.expires_at`,
+		pr.ProjectID, pr.SubjectType, pr.SubjectID, pr.Role, utcOrNil(pr.ExpiresAt),
 	)
 	return err
 }
@@ -404,10 +650,80 @@ func (s *SQLStore) RemoveProjectRole(ctx context.Context, projectID string, subj
 	return err
 }
 
+// ListProjectRoles returns every assignment on the project, including expired
+// ones that the sweeper has not removed yet; callers check ProjectRole.Expired.
 func (s *SQLStore) ListProjectRoles(ctx context.Context, projectID string) ([]*models.ProjectRole, error) {
-	rows, err := s.db.QueryContext(ctx,
-		`SELECT project_id, subject_type, subject_id, role FROM project_roles WHERE project_id = ?`, projectID,
+	return s.queryProjectRoles(ctx, `SELECT `+projectRoleColumns+` FROM project_roles WHERE project_id = ?`, projectID)
+}
+
+// memberSubject is the subject of an assignment as one string, unique within
+// a project, which members pages break ties on.
+const memberSubject = `subject_type || ':' || subject_id`
+
+var memberListing = listing[*models.ProjectRole]{
+	keys: map[string]sortKey[*models.ProjectRole]{
+		"subject": {column: memberSubject, kind: keyString, value: func(pr *models.ProjectRole) any { return string(pr.SubjectType) + ":" + pr.SubjectID }},
+		"role":    {column: "role", kind: keyString, value: func(pr *models.ProjectRole) any { return string(pr.Role) }},
+	},
+	defaultSort: "subject",
+	tie:         memberSubject,
+	tieValue:    func(pr *models.ProjectRole) string { return string(pr.SubjectType) + ":" + pr.SubjectID },
+}
+
+// ListProjectMembersPage returns one page of the assignments on a project
+// that have not expired at t, by subject unless p sorts by role, and the
+// cursor of the next page.
+func (s *SQLStore) ListProjectMembersPage(ctx context.Context, projectID string, t time.Time, p PageQuery) ([]*models.ProjectRole, string, error) {
+	return queryPage(ctx, s, memberListing, p, `SELECT `+projectRoleColumns+` FROM project_roles`,
+		[]string{"project_id = ?", "(expires_at IS NULL OR expires_at > ?)"}, []any{projectID, t.UTC()}, scanProjectRole)
+}
+
+func (s *SQLStore) GetUserProjectRole(ctx context.Context, projectID, userID string) (*models.ProjectRole, error) {
+	pr, err := scanProjectRole(s.db.QueryRowContext(ctx,
+		`SELECT `+projectRoleColumns+` FROM project_roles WHERE project_id = ? AND subject_type = 'user' AND subject_id = ?`,
+		projectID, userID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return pr, err
+}
+
+// DeleteExpiredProjectRoles removes assignments that expired before t and
+// returns them so the caller can report what was revoked.
+func (s *SQLStore) DeleteExpiredProjectRoles(ctx context.Context, t time.Time) ([]*models.ProjectRole, error) {
+	expired, err := s.queryProjectRoles(ctx,
+		`SELECT `+projectRoleColumns+` FROM project_roles WHERE expires_at IS NOT NULL AND expires_at <= ?`, t.UTC(),
 	)
+	if err != nil || len(expired) == 0 {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Re-check the expiry so an assignment extended since the SELECT is kept.
+	var removed []*models.ProjectRole
+	for _, pr := range expired {
+		res, err := tx.ExecContext(ctx,
+			`DELETE FROM project_roles WHERE project_id = ? AND subject_type = ? AND subject_id = ? AND expires_at IS NOT NULL AND expires_at <= ?`,
+			pr.ProjectID, pr.SubjectType, pr.SubjectID, t.UTC(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			removed = append(removed, pr)
+		}
+	}
+	return removed, tx.Commit()
+}
+
+func (s *SQLStore) queryProjectRoles(ctx context.Context, query string, args ...any) ([]*models.ProjectRole, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -415,8 +731,8 @@ func (s *SQLStore) ListProjectRoles(ctx context.Context, projectID string) ([]*m
 
 	var roles []*models.ProjectRole
 	for rows.Next() {
-		pr := &models.ProjectRole{}
-		if err := rows.Scan(&pr.ProjectID, &pr.SubjectType, &pr.SubjectID, &pr.Role); err != nil {
+		pr, err := scanProjectRole(rows)
+		if err != nil {
 			return nil, err
 		}
 		roles = append(roles, pr)
@@ -424,26 +740,30 @@ func (s *SQLStore) ListProjectRoles(ctx context.Context, projectID string) ([]*m
 	return roles, rows.Err()
 }
 
-func (s *SQLStore) GetUserProjectRole(ctx context.Context, projectID, userID string) (*models.ProjectRole, error) {
+func scanProjectRole(row rowScanner) (*models.ProjectRole, error) {
 	pr := &models.ProjectRole{}
-	err := s.db.QueryRowContext(ctx,
-		`SELECT project_id, subject_type, subject_id, role FROM project_roles WHERE project_id = ? AND subject_type = 'user' AND subject_id = ?`,
-		projectID, userID,
-	).Scan(&pr.ProjectID, &pr.SubjectType, &pr.SubjectID, &pr.Role)
-	if err == sql.ErrNoRows {
-		return nil, nil
+	if err := row.Scan(&pr.ProjectID, &pr.SubjectType, &pr.SubjectID, &pr.Role, &pr.ExpiresAt); err != nil {
+		return nil, err
 	}
-	return pr, err
+	return pr, nil
+}
+
+func utcOrNil(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
 }
 
 func (s *SQLStore) ListUserProjects(ctx context.Context, userID string) ([]*models.Project, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT DISTINCT p.id, p.name, p.description, p.created_at, p.updated_at
+		`SELECT DISTINCT p.id, p.name, p.description, p.admission_mode, p.created_at, p.updated_at
 		FROM projects p
 		LEFT JOIN project_roles pr ON p.id = pr.project_id
-		WHERE (pr.subject_type = 'user' AND pr.subject_id = ?)
-		   OR pr.subject_id IN (SELECT group_id FROM group_members WHERE user_id = ?)
-		ORDER BY p.name`, userID, userID,
+		WHERE ((pr.subject_type = 'user' AND pr.subject_id = ?)
+		   OR pr.subject_id IN (SELECT group_id FROM group_members WHERE user_id = ?))
+		  AND (pr.expires_at IS NULL OR pr.expires_at > ?)
+		ORDER BY p.name`, userID, userID, now(),
 	)
 	if err != nil {
 		return nil, err
@@ -453,7 +773,7 @@ func (s *SQLStore) ListUserProjects(ctx context.Context, userID string) ([]*mode
 	var projects []*models.Project
 	for rows.Next() {
 		p := &models.Project{}
-		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.AdmissionMode, &p.CreatedAt, &p.UpdatedAt); err != nil {
 			return nil, err
 		}
 		projects = append(projects, p)
@@ -463,24 +783,30 @@ func (s *SQLStore) ListUserProjects(ctx context.Context, userID string) ([]*mode
 
 // --- Budgets ---
 
+const budgetColumns = `id, project_id, cost_source_id, filter_json, period, amount, plan_json, rollover, thresholds_json, enforcement_json, created_at, updated_at`
+
 func (s *SQLStore) CreateBudget(ctx context.Context, b *models.Budget) error {
 	if b.ID == "" {
 		b.ID = newID()
 	}
+	if b.Period == "" {
+		b.Period = models.BudgetMonthly
+	}
+	filter, plan, thresholds, enforcement, err := marshalBudgetJSON(b)
+	if err != nil {
+		return err
+	}
 	b.CreatedAt = now()
 	b.UpdatedAt = b.CreatedAt
-	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO budgets (id, project_id, cost_source_id, monthly_limit, warn_threshold, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		b.ID, b.ProjectID, b.CostSourceID, b.MonthlyLimit, b.WarnThreshold, b.CreatedAt, b.UpdatedAt,
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO budgets (`+budgetColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.ID, b.ProjectID, b.CostSourceID, filter, b.Period, b.Amount, plan, b.Rollover, thresholds, enforcement, b.CreatedAt, b.UpdatedAt,
 	)
 	return err
 }
 
 func (s *SQLStore) GetBudget(ctx context.Context, id string) (*models.Budget, error) {
-	b := &models.Budget{}
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, project_id, cost_source_id, monthly_limit, warn_threshold, created_at, updated_at FROM budgets WHERE id = ?`, id,
-	).Scan(&b.ID, &b.ProjectID, &b.CostSourceID, &b.MonthlyLimit, &b.WarnThreshold, &b.CreatedAt, &b.UpdatedAt)
+	b, err := scanBudget(s.db.QueryRowContext(ctx, `SELECT `+budgetColumns+` FROM budgets WHERE id = ?`, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -489,7 +815,7 @@ func (s *SQLStore) GetBudget(ctx context.Context, id string) (*models.Budget, er
 
 func (s *SQLStore) ListBudgets(ctx context.Context, projectID string) ([]*models.Budget, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, project_id, cost_source_id, monthly_limit, warn_threshold, created_at, updated_at FROM budgets WHERE project_id = ?`, projectID,
+		`SELECT `+budgetColumns+` FROM budgets WHERE project_id = ? ORDER BY created_at`, projectID,
 	)
 	if err != nil {
 		return nil, err
@@ -498,8 +824,8 @@ func (s *SQLStore) ListBudgets(ctx context.Context, projectID string) ([]*models
 
 	var budgets []*models.Budget
 	for rows.Next() {
-		b := &models.Budget{}
-		if err := rows.Scan(&b.ID, &b.ProjectID, &b.CostSourceID, &b.MonthlyLimit, &b.WarnThreshold, &b.CreatedAt, &b.UpdatedAt); err != nil {
+		b, err := scanBudget(rows)
+		if err != nil {
 			return nil, err
 		}
 		budgets = append(budgets, b)
@@ -508,10 +834,14 @@ func (s *SQLStore) ListBudgets(ctx context.Context, projectID string) ([]*models
 }
 
 func (s *SQLStore) UpdateBudget(ctx context.Context, b *models.Budget) error {
+	filter, plan, thresholds, enforcement, err := marshalBudgetJSON(b)
+	if err != nil {
+		return err
+	}
 	b.UpdatedAt = now()
-	_, err := s.db.ExecContext(ctx,
-		`UPDATE budgets SET monthly_limit = ?, warn_threshold = ?, updated_at = ? WHERE id = ?`,
-		b.MonthlyLimit, b.WarnThreshold, b.UpdatedAt, b.ID,
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE budgets SET cost_source_id = ?, filter_json = ?, period = ?, amount = ?, plan_json = ?, rollover = ?, thresholds_json = ?, enforcement_json = ?, updated_at = ? WHERE id = ?`,
+		b.CostSourceID, filter, b.Period, b.Amount, plan, b.Rollover, thresholds, enforcement, b.UpdatedAt, b.ID,
 	)
 	return err
 }
@@ -521,87 +851,125 @@ func (s *SQLStore) DeleteBudget(ctx context.Context, id string) error {
 	return err
 }
 
-// --- Cost Records ---
+func scanBudget(row rowScanner) (*models.Budget, error) {
+	b := &models.Budget{}
+	var filter, plan, thresholds, enforcement string
+	if err := row.Scan(&b.ID, &b.ProjectID, &b.CostSourceID, &filter, &b.Period, &b.Amount, &plan, &b.Rollover, &thresholds, &enforcement, &b.CreatedAt, &b.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(filter), &b.Filter); err != nil {
+		return nil, fmt.Errorf("budget %s filter: %w", b.ID, err)
+	}
+	if err := json.Unmarshal([]byte(plan), &b.Plan); err != nil {
+		return nil, fmt.Errorf("budget %s plan: %w", b.ID, err)
+	}
+	if err := json.Unmarshal([]byte(thresholds), &b.Thresholds); err != nil {
+		return nil, fmt.Errorf("budget %s thresholds: %w", b.ID, err)
+	}
+	if err := json.Unmarshal([]byte(enforcement), &b.Enforcement); err != nil {
+		return nil, fmt.Errorf("budget %s enforcement: %w", b.ID, err)
+	}
+	return b, nil
+}
 
-func (s *SQLStore) InsertCostRecords(ctx context.Context, records []*models.CostRecord) error {
-	tx, err := s.db.BeginTx(ctx, nil)
+// marshalBudgetJSON encodes a budget's filter, plan, thresholds and
+// enforcement actions, filling in the default thresholds when none are set.
+func marshalBudgetJSON(b *models.Budget) (filter, plan, thresholds, enforcement string, err error) {
+	if len(b.Thresholds) == 0 {
+		b.Thresholds = models.DefaultBudgetThresholds
+	}
+	filterJSON, err := json.Marshal(b.Filter)
 	if err != nil {
-		return err
+		return "", "", "", "", err
 	}
-	defer tx.Rollback()
-
-	stmt, err := tx.PrepareContext(ctx,
-		`INSERT INTO cost_records (id, project_id, cost_source_id, provider, provider_id, account_id, account_name, invoice_entity_id, service, category, region, availability_zone, start_time, end_time, list_cost, net_cost, amortized_cost, amortized_net_cost, currency, labels_json, kubernetes_percent)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	planJSON, err := json.Marshal(b.Plan)
 	if err != nil {
-		return err
+		return "", "", "", "", err
 	}
-	defer stmt.Close()
-
-	for _, r := range records {
-		if r.ID == "" {
-			r.ID = newID()
-		}
-		var labelsJSON []byte
-		if r.Labels == nil {
-			labelsJSON = []byte("{}")
-		} else {
-			labelsJSON, _ = json.Marshal(r.Labels)
-		}
-		// Prepared statements already have placeholders rebound, so use raw ExecContext
-		_, err := stmt.ExecContext(ctx,
-			r.ID, r.ProjectID, r.CostSourceID, r.Provider, r.ProviderID, r.AccountID, r.AccountName, r.InvoiceEntityID,
-			r.Service, r.Category, r.Region, r.AvailabilityZone, r.StartTime, r.EndTime,
-			r.ListCost, r.NetCost, r.AmortizedCost, r.AmortizedNetCost, r.Currency, string(labelsJSON), r.KubernetesPercent,
-		)
-		if err != nil {
-			return err
-		}
+	if b.Plan == nil {
+		planJSON = []byte("[]")
 	}
-
-	return tx.Commit()
+	thresholdsJSON, err := json.Marshal(b.Thresholds)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	enforcementJSON, err := json.Marshal(b.Enforcement)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	if b.Enforcement == nil {
+		enforcementJSON = []byte("[]")
+	}
+	return string(filterJSON), string(planJSON), string(thresholdsJSON), string(enforcementJSON), nil
 }
 
-func (s *SQLStore) QueryCostRecords(ctx context.Context, q CostQuery) ([]*models.CostRecord, error) {
-	where, args := buildCostWhere(q)
-	query := `SELECT id, project_id, cost_source_id, provider, provider_id, account_id, account_name, invoice_entity_id, service, category, region, availability_zone, start_time, end_time, list_cost, net_cost, amortized_cost, amortized_net_cost, currency, labels_json, kubernetes_percent FROM cost_records` + where + ` ORDER BY start_time DESC`
+// --- Cost Records ---
 
-	if q.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", q.Limit)
-	}
-	if q.Offset > 0 {
-		query += fmt.Sprintf(" OFFSET %d", q.Offset)
-	}
+const costRecordColumns = `id, project_id, cost_source_id, provider, provider_id, account_id, account_name, invoice_entity_id, service, category, region, availability_zone, start_time, end_time, list_cost, net_cost, amortized_cost, amortized_net_cost, currency, labels_json, kubernetes_percent`
+
+var costRecordListing = listing[*models.CostRecord]{
+	keys: map[string]sortKey[*models.CostRecord]{
+		"startTime": {column: "start_time", kind: keyTime, value: func(r *models.CostRecord) any { return r.StartTime }},
+		"netCost":   {column: "net_cost", kind: keyFloat, value: func(r *models.CostRecord) any { return r.NetCost }},
+		"listCost":  {column: "list_cost", kind: keyFloat, value: func(r *models.CostRecord) any { return r.ListCost }},
+		"service":   {column: "service", kind: keyString, value: func(r *models.CostRecord) any { return r.Service }},
+		"provider":  {column: "provider", kind: keyString, value: func(r *models.CostRecord) any { return r.Provider }},
+	},
+	defaultSort: "-startTime",
+	tie:         "id",
+	tieValue:    func(r *models.CostRecord) string { return r.ID },
+}
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+// QueryCostRecords returns one page of the records matching q, newest first
+// unless p sorts otherwise, and the cursor of the next page.
+func (s *SQLStore) QueryCostRecords(ctx context.Context, q CostQuery, p PageQuery) ([]*models.CostRecord, string, error) {
+	conditions, args := s.costConditions(q)
+	return queryPage(ctx, s, costRecordListing, p, `SELECT `+costRecordColumns+` FROM cost_records`, conditions, args, scanCostRecord)
+}
+
+// ExportCostRecords calls fn with each record matching q, oldest first, as
+// it is read from the database, so exports do not hold every record in
+// memory. It stops at the first error fn returns.
+func (s *SQLStore) ExportCostRecords(ctx context.Context, q CostQuery, fn func(*models.CostRecord) error) error {
+	where, args := s.buildCostWhere(q)
+	rows, err := s.db.QueryContext(ctx, `SELECT `+costRecordColumns+` FROM cost_records`+where+` ORDER BY start_time, id`, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var records []*models.CostRecord
 	for rows.Next() {
-		r := &models.CostRecord{}
-		if err := rows.Scan(
-			&r.ID, &r.ProjectID, &r.CostSourceID, &r.Provider, &r.ProviderID, &r.AccountID, &r.AccountName, &r.InvoiceEntityID,
-			&r.Service, &r.Category, &r.Region, &r.AvailabilityZone, &r.StartTime, &r.EndTime,
-			&r.ListCost, &r.NetCost, &r.AmortizedCost, &r.AmortizedNetCost, &r.Currency, &r.LabelsJSON, &r.KubernetesPercent,
-		); err != nil {
-			return nil, err
+		r, err := scanCostRecord(rows)
+		if err != nil {
+			return err
 		}
-		if r.LabelsJSON != "" && r.LabelsJSON != "{}" {
-			if err := json.Unmarshal([]byte(r.LabelsJSON), &r.Labels); err != nil {
-				return nil, fmt.Errorf("unmarshal labels for record %s: %w", r.ID, err)
-			}
+		if err := fn(r); err != nil {
+			return err
 		}
-		records = append(records, r)
 	}
-	return records, rows.Err()
+	return rows.Err()
+}
+
+func scanCostRecord(row rowScanner) (*models.CostRecord, error) {
+	r := &models.CostRecord{}
+	if err := row.Scan(
+		&r.ID, &r.ProjectID, &r.CostSourceID, &r.Provider, &r.ProviderID, &r.AccountID, &r.AccountName, &r.InvoiceEntityID,
+		&r.Service, &r.Category, &r.Region, &r.AvailabilityZone, &r.StartTime, &r.EndTime,
+		&r.ListCost, &r.NetCost, &r.AmortizedCost, &r.AmortizedNetCost, &r.Currency, &r.LabelsJSON, &r.KubernetesPercent,
+	); err != nil {
+		return nil, err
+	}
+	if r.LabelsJSON != "" && r.LabelsJSON != "{}" {
+		if err := json.Unmarshal([]byte(r.LabelsJSON), &r.Labels); err != nil {
+			return nil, fmt.Errorf("unmarshal labels for record %s: %w", r.ID, err)
+		}
+	}
+	return r, nil
 }
 
 func (s *SQLStore) AggregateCosts(ctx context.Context, q CostQuery) (*CostSummary, error) {
-	where, args := buildCostWhere(q)
-	query := `SELECT COALESCE(SUM(list_cost),0), COALESCE(SUM(net_cost),0), COALESCE(SUM(amortized_cost),0), COALESCE(SUM(amortized_net_cost),0), COUNT(*) FROM cost_records` + where
+	from, sums, where, args := s.planCostQuery(q)
+	query := `SELECT ` + sums + ` FROM ` + from + where
 
 	summary := &CostSummary{}
 	err := s.db.QueryRowContext(ctx, query, args...).Scan(
@@ -610,7 +978,44 @@ func (s *SQLStore) AggregateCosts(ctx context.Context, q CostQuery) (*CostSummar
 	return summary, err
 }
 
-func buildCostWhere(q CostQuery) (string, []any) {
+func (s *SQLStore) buildCostWhere(q CostQuery) (string, []any) {
+	conditions, args := s.costConditions(q)
+	return joinConditions(conditions), args
+}
+
+// costConditions returns the conditions buildCostWhere joins.
+func (s *SQLStore) costConditions(q CostQuery) ([]string, []any) {
+	conditions, args := costColumnConditions(q)
+	for _, sel := range labelSelectors(q) {
+		cond, condArgs := sel.condition()
+		conditions = append(conditions, cond)
+		args = append(args, condArgs...)
+	}
+	// start_time is bounded from below even without a range start, so that
+	// every query carries a predicate Postgres can prune partitions with.
+	start := q.StartTime
+	if start.IsZero() {
+		start = earliestCostStart
+	}
+	conditions = append(conditions, "start_time >= ?")
+	args = append(args, start.UTC())
+	if !q.EndTime.IsZero() {
+		// A record starts no later than it ends, so bounding start_time too
+		// selects the same records and lets Postgres prune the monthly
+		// partitions after the range.
+		conditions = append(conditions, "end_time <= ?", "start_time <= ?")
+		args = append(args, q.EndTime.UTC(), q.EndTime.UTC())
+	}
+	return conditions, args
+}
+
+// earliestCostStart bounds start_time in queries without a range start. It
+// is before any record.
+var earliestCostStart = time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// costColumnConditions returns the conditions of q on the columns cost
+// records and their daily rollups share.
+func costColumnConditions(q CostQuery) ([]string, []any) {
 	var conditions []string
 	var args []any
 
@@ -630,19 +1035,28 @@ func buildCostWhere(q CostQuery) (string, []any) {
 		conditions = append(conditions, "service = ?")
 		args = append(args, q.Service)
 	}
-	if !q.StartTime.IsZero() {
-		conditions = append(conditions, "start_time >= ?")
-		args = append(args, q.StartTime)
+	if q.Category != "" {
+		conditions = append(conditions, "category = ?")
+		args = append(args, q.Category)
 	}
-	if !q.EndTime.IsZero() {
-		conditions = append(conditions, "end_time <= ?")
-		args = append(args, q.EndTime)
+	if q.Region != "" {
+		conditions = append(conditions, "region = ?")
+		args = append(args, q.Region)
 	}
+	return conditions, args
+}
 
+func joinConditions(conditions []string) string {
 	if len(conditions) == 0 {
-		return "", nil
+		return ""
 	}
-	return " WHERE " + strings.Join(conditions, " AND "), args
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// labelPath returns the SQLite JSON path of a label key, quoted so that keys
+// containing dots or slashes, like app.kubernetes.io/name, address one member.
+func labelPath(key string) string {
+	return `$."` + strings.ReplaceAll(key, `"`, `\"`) + `"`
 }
 
 func nullString(s string) sql.NullString {
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"io/fs"
+	"iter"
 	"time"
 
 	"github.com/inelson/finguard/internal/models"
@@ -13,9 +14,12 @@ type Store interface {
 	Migrate(migrationsFS fs.FS) error
 
 	// Projects
-	CreateProject(ctx context.Context, p *models.Project) error
+	// CreateProject stores p and, in the same transaction, the roles given on
+	// it, such as its creator's.
+	CreateProject(ctx context.Context, p *models.Project, roles ...*models.ProjectRole) error
 	GetProject(ctx context.Context, id string) (*models.Project, error)
 	ListProjects(ctx context.Context) ([]*models.Project, error)
+	ListProjectsPage(ctx context.Context, p PageQuery) ([]*models.Project, string, error)
 	UpdateProject(ctx context.Context, p *models.Project) error
 	DeleteProject(ctx context.Context, id string) error
 
@@ -23,6 +27,7 @@ type Store interface {
 	CreateCostSource(ctx context.Context, cs *models.CostSource) error
 	GetCostSource(ctx context.Context, id string) (*models.CostSource, error)
 	ListCostSources(ctx context.Context, projectID string) ([]*models.CostSource, error)
+	ListCostSourcesPage(ctx context.Context, projectID string, p PageQuery) ([]*models.CostSource, string, error)
 	UpdateCostSource(ctx context.Context, cs *models.CostSource) error
 	DeleteCostSource(ctx context.Context, id string) error
 	UpdateCostSourceCollectedAt(ctx context.Context, id string, t time.Time) error
@@ -33,22 +38,58 @@ type Store interface {
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	GetUserByOIDCSubject(ctx context.Context, subject string) (*models.User, error)
 	ListUsers(ctx context.Context) ([]*models.User, error)
+	ListUsersPage(ctx context.Context, p PageQuery) ([]*models.User, string, error)
+	SearchUsers(ctx context.Context, q DirectoryQuery) ([]*models.User, int, error)
+	UpdateUser(ctx context.Context, u *models.User) error
+	DeleteUser(ctx context.Context, id string) error
 
 	// Groups
 	CreateGroup(ctx context.Context, g *models.Group) error
 	GetGroup(ctx context.Context, id string) (*models.Group, error)
 	GetGroupByOIDCClaim(ctx context.Context, claim string) (*models.Group, error)
 	ListGroups(ctx context.Context) ([]*models.Group, error)
+	SearchGroups(ctx context.Context, q DirectoryQuery) ([]*models.Group, int, error)
+	UpdateGroup(ctx context.Context, g *models.Group) error
+	DeleteGroup(ctx context.Context, id string) error
 	AddGroupMember(ctx context.Context, groupID, userID string) error
 	RemoveGroupMember(ctx context.Context, groupID, userID string) error
+	SetGroupMembers(ctx context.Context, groupID string, userIDs []string) error
 	ListGroupMembers(ctx context.Context, groupID string) ([]*models.User, error)
+	ListUserGroups(ctx context.Context, userID string) ([]*models.Group, error)
+
+	// Sessions
+	CreateSession(ctx context.Context, sess *models.Session) error
+	GetSession(ctx context.Context, id string) (*models.Session, error)
+	ListUserSessions(ctx context.Context, userID string, idleBefore time.Time) ([]*models.Session, error)
+	TouchSession(ctx context.Context, id string, t time.Time) error
+	UpdateSessionToken(ctx context.Context, sess *models.Session) error
+	RevokeSession(ctx context.Context, id string) error
+	RevokeUserSessions(ctx context.Context, userID string) error
+	DeleteStaleSessions(ctx context.Context, idleBefore time.Time) error
 
 	// Project Roles
 	SetProjectRole(ctx context.Context, pr *models.ProjectRole) error
 	RemoveProjectRole(ctx context.Context, projectID string, subjectType models.SubjectType, subjectID string) error
 	ListProjectRoles(ctx context.Context, projectID string) ([]*models.ProjectRole, error)
+	ListProjectMembersPage(ctx context.Context, projectID string, t time.Time, p PageQuery) ([]*models.ProjectRole, string, error)
 	GetUserProjectRole(ctx context.Context, projectID, userID string) (*models.ProjectRole, error)
 	ListUserProjects(ctx context.Context, userID string) ([]*models.Project, error)
+	DeleteExpiredProjectRoles(ctx context.Context, t time.Time) ([]*models.ProjectRole, error)
+
+	// Project Invitations
+	CreateProjectInvitation(ctx context.Context, inv *models.ProjectInvitation) error
+	GetProjectInvitation(ctx context.Context, id string) (*models.ProjectInvitation, error)
+	ListProjectInvitations(ctx context.Context, projectID string) ([]*models.ProjectInvitation, error)
+	DeleteProjectInvitation(ctx context.Context, id string) error
+	AcceptProjectInvitations(ctx context.Context, email, userID string) ([]*models.ProjectRole, error)
+
+	// Custom Roles
+	CreateRole(ctx context.Context, role *models.RoleDefinition) error
+	GetRole(ctx context.Context, name string) (*models.RoleDefinition, error)
+	ListRoles(ctx context.Context) ([]*models.RoleDefinition, error)
+	UpdateRole(ctx context.Context, role *models.RoleDefinition) error
+	DeleteRole(ctx context.Context, name string) error
+	CountRoleAssignments(ctx context.Context, name string) (int, error)
 
 	// Budgets
 	CreateBudget(ctx context.Context, b *models.Budget) error
@@ -56,23 +97,76 @@ type Store interface {
 	ListBudgets(ctx context.Context, projectID string) ([]*models.Budget, error)
 	UpdateBudget(ctx context.Context, b *models.Budget) error
 	DeleteBudget(ctx context.Context, id string) error
+	GetBudgetAlertState(ctx context.Context, budgetID string) (*models.BudgetAlertState, error)
+	// SaveBudgetAlertState stores st and, in the same transaction, the outbox
+	// deliveries of the alert it raised.
+	SaveBudgetAlertState(ctx context.Context, st *models.BudgetAlertState, deliveries ...*models.NotificationDelivery) error
+	CreateBudgetEnforcement(ctx context.Context, e *models.BudgetEnforcement) error
+	GetBudgetEnforcement(ctx context.Context, id string) (*models.BudgetEnforcement, error)
+	ListBudgetEnforcements(ctx context.Context, budgetID string) ([]*models.BudgetEnforcement, error)
+	UpdateBudgetEnforcement(ctx context.Context, e *models.BudgetEnforcement) error
+
+	// Notification Channels
+	CreateNotificationChannel(ctx context.Context, c *models.NotificationChannel) error
+	GetNotificationChannel(ctx context.Context, id string) (*models.NotificationChannel, error)
+	ListNotificationChannels(ctx context.Context, projectID string) ([]*models.NotificationChannel, error)
+	UpdateNotificationChannel(ctx context.Context, c *models.NotificationChannel) error
+	DeleteNotificationChannel(ctx context.Context, id string) error
+	CreateNotificationDeliveries(ctx context.Context, deliveries []*models.NotificationDelivery) error
+	GetNotificationDelivery(ctx context.Context, id string) (*models.NotificationDelivery, error)
+	ListNotificationDeliveries(ctx context.Context, channelID string, limit int) ([]*models.NotificationDelivery, error)
+	ClaimNotificationDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.NotificationDelivery, error)
+	UpdateNotificationDelivery(ctx context.Context, d *models.NotificationDelivery) error
+	CreateDeliveryAttempt(ctx context.Context, a *models.DeliveryAttempt) error
+	ListDeliveryAttempts(ctx context.Context, deliveryID string) ([]*models.DeliveryAttempt, error)
+
+	// Reports
+	CreateReport(ctx context.Context, r *models.Report) error
+	GetReport(ctx context.Context, id string) (*models.Report, error)
+	ListReports(ctx context.Context, projectID string) ([]*models.Report, error)
+	ListDueReports(ctx context.Context, now time.Time) ([]*models.Report, error)
+	UpdateReport(ctx context.Context, r *models.Report) error
+	AdvanceReport(ctx context.Context, id string, from, to time.Time) (bool, error)
+	RecordReportRun(ctx context.Context, id string, at time.Time, lastError string) error
+	DeleteReport(ctx context.Context, id string) error
+
+	// Audit Log
+	InsertAuditEntry(ctx context.Context, e *models.AuditEntry) error
+	ListAuditEntries(ctx context.Context, q AuditQuery) ([]*models.AuditEntry, error)
+	ListAuditEntriesPage(ctx context.Context, q AuditQuery, p PageQuery) ([]*models.AuditEntry, string, error)
+	ExportAuditEntries(ctx context.Context, q AuditQuery, fn func(*models.AuditEntry) error) error
 
 	// Cost Records
 	InsertCostRecords(ctx context.Context, records []*models.CostRecord) error
-	QueryCostRecords(ctx context.Context, q CostQuery) ([]*models.CostRecord, error)
+	IngestCostRecords(ctx context.Context, records iter.Seq2[*models.CostRecord, error]) (int, error)
+	QueryCostRecords(ctx context.Context, q CostQuery, p PageQuery) ([]*models.CostRecord, string, error)
+	ExportCostRecords(ctx context.Context, q CostQuery, fn func(*models.CostRecord) error) error
 	AggregateCosts(ctx context.Context, q CostQuery) (*CostSummary, error)
+	GroupCosts(ctx context.Context, q CostQuery) ([]*CostGroup, error)
+	CostTimeSeries(ctx context.Context, q CostQuery) ([]*CostSeries, error)
+	ListCostLabels(ctx context.Context, projectID string) ([]*CostLabel, error)
+	CostLabelKeys(ctx context.Context, q CostQuery) ([]string, error)
+	RebuildCostRollups(ctx context.Context, projectID string) error
+	CompactCostRecords(ctx context.Context, c CostCompaction) (CompactionResult, error)
+	ManageCostPartitions(ctx context.Context, now time.Time, p CostPartitionPolicy) (PartitionResult, error)
 }
 
+// CostQuery selects cost records. The embedded filter narrows them by provider,
+// service, category, region and labels, the same way a budget's filter does;
+// LabelSelectors add label predicates a budget cannot express.
 type CostQuery struct {
-	ProjectID    string
-	CostSourceID string
-	Provider     string
-	Service      string
-	StartTime    time.Time
-	EndTime      time.Time
-	GroupBy      string
-	Limit        int
-	Offset       int
+	models.CostFilter
+	LabelSelectors []LabelSelector
+	ProjectID      string
+	CostSourceID   string
+	StartTime      time.Time
+	EndTime        time.Time
+	// GroupBy lists the dimensions GroupCosts and CostTimeSeries split
+	// records by: provider, service, category, region, account, source or
+	// label:<key>.
+	GroupBy     []string
+	Granularity Granularity
+	Limit       int
 }
 
 type CostSummary struct {
@@ -82,3 +176,45 @@ type CostSummary struct {
 	TotalAmortizedNet float64 `json:"totalAmortizedNet"`
 	RecordCount       int     `json:"recordCount"`
 }
+
+// CostGroup is the summary of the records sharing one value of each of the
+// query's GroupBy dimensions. Group maps each dimension to that value.
+type CostGroup struct {
+	Group map[string]string `json:"group"`
+	CostSummary
+}
+
+// CostPoint is the summary of the records starting in one time bucket.
+type CostPoint struct {
+	Start time.Time `json:"start"`
+	CostSummary
+}
+
+// CostSeries is a time series of one group's costs, with its total over the
+// whole range.
+type CostSeries struct {
+	Group map[string]string `json:"group"`
+	CostSummary
+	Points []*CostPoint `json:"points"`
+}
+
+// DirectoryQuery filters users or groups for directory sync. Name matches a
+// user's email or a group's name case-insensitively; zero values are ignored.
+type DirectoryQuery struct {
+	Name       string
+	ExternalID string
+	Offset     int
+	Limit      int
+}
+
+// AuditQuery filters audit entries. Zero values are ignored.
+type AuditQuery struct {
+	ProjectID  string
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+}
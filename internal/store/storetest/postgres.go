@@ -0,0 +1,50 @@
+package storetest
+
+import (
+	"database/sql"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// PostgresEnv names the variable with the DSN of a Postgres database the
+// Postgres tests may create schemas in. They are skipped when it is unset.
+const PostgresEnv = "FINGUARD_TEST_POSTGRES_DSN"
+
+// PostgresDSN returns the DSN of an empty schema of its own in the database
+// at $FINGUARD_TEST_POSTGRES_DSN, dropped when the test ends, or skips the
+// test when the variable is unset.
+func PostgresDSN(t testing.TB) string {
+	t.Helper()
+	dsn := os.Getenv(PostgresEnv)
+	if dsn == "" {
+		t.Skip(PostgresEnv + " is not set")
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("invalid %s: %v", PostgresEnv, err)
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "finguard_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := db.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+		db.Close()
+	})
+
+	params := u.Query()
+	params.Set("search_path", schema)
+	u.RawQuery = params.Encode()
+	return u.String()
+}
@@ -0,0 +1,26 @@
+// Package storetest provides the database fixture shared by the tests of
+// packages built on the store.
+package storetest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/migrations"
+)
+
+// New returns a store on a fresh SQLite database in a temporary directory,
+// migrated to the latest schema and closed when the test ends.
+func New(t testing.TB) *store.SQLStore {
+	t.Helper()
+	st, err := store.New("sqlite://" + filepath.Join(t.TempDir(), "finguard.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	if err := st.Migrate(migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
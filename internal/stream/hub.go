@@ -14,9 +14,15 @@ import (
 type Hub struct {
 	mu      sync.RWMutex
 	clients map[*Client]struct{}
+	sinks   []Sink
 	logger  *slog.Logger
 }
 
+// Sink receives every event published on the hub, whatever its topic. Sinks
+// are called from Publish with the hub locked, so they must not block; a sink
+// that does slow work should queue the event and return.
+type Sink func(*event.Event)
+
 type Client struct {
 	conn   *websocket.Conn
 	topics map[string]struct{} // empty map means all topics
@@ -63,6 +69,13 @@ func (h *Hub) Unregister(c *Client) {
 	h.logger.Info("client disconnected", "total", h.Len())
 }
 
+// AddSink registers s to receive every published event.
+func (h *Hub) AddSink(s Sink) {
+	h.mu.Lock()
+	h.sinks = append(h.sinks, s)
+	h.mu.Unlock()
+}
+
 func (h *Hub) Len() int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -79,6 +92,9 @@ func (h *Hub) Publish(e *event.Event) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
+	for _, sink := range h.sinks {
+		sink(e)
+	}
 	for c := range h.clients {
 		if !c.subscribedTo(e.Topic) {
 			continue
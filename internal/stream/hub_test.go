@@ -151,3 +151,17 @@ func TestHub_DoubleUnregisterNoPanic(t *testing.T) {
 		t.Errorf("expected 0 clients, got %d", hub.Len())
 	}
 }
+
+func TestHub_PublishReachesSinks(t *testing.T) {
+	hub := NewHub(testLogger())
+	var got []string
+	hub.AddSink(func(e *event.Event) { got = append(got, e.Topic) })
+
+	for _, topic := range []string{event.TopicBudgetExceeded, event.TopicCostIdle} {
+		e, _ := event.New("test", topic, "test", nil)
+		hub.Publish(e)
+	}
+	if len(got) != 2 || got[0] != event.TopicBudgetExceeded || got[1] != event.TopicCostIdle {
+		t.Errorf("expected the sink to receive both events, got %v", got)
+	}
+}
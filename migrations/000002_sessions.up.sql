@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id               TEXT PRIMARY KEY,
+    user_id          TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent       TEXT NOT NULL DEFAULT '',
+    ip_address       TEXT NOT NULL DEFAULT '',
+    groups_json      TEXT NOT NULL DEFAULT '[]',
+    refresh_token    TEXT NOT NULL DEFAULT '',
+    token_expires_at TIMESTAMP,
+    created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at       TIMESTAMP NOT NULL,
+    revoked_at       TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_last_seen ON sessions(last_seen_at);
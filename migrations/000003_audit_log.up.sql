@@ -0,0 +1,21 @@
+-- Audit entries intentionally carry no foreign keys: the trail must survive
+-- deletion of the projects, sources and users it describes.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          TEXT PRIMARY KEY,
+    occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    actor_id    TEXT NOT NULL DEFAULT '',
+    actor_email TEXT NOT NULL DEFAULT '',
+    action      TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id   TEXT NOT NULL DEFAULT '',
+    project_id  TEXT NOT NULL DEFAULT '',
+    before_json TEXT NOT NULL DEFAULT 'null',
+    after_json  TEXT NOT NULL DEFAULT 'null',
+    request_id  TEXT NOT NULL DEFAULT '',
+    ip_address  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_occurred ON audit_log(occurred_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_project ON audit_log(project_id, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
@@ -0,0 +1,9 @@
+-- Custom roles are named permission sets. The built-in roles (admin, editor,
+-- viewer) are defined in code and never stored here.
+CREATE TABLE IF NOT EXISTS roles (
+    name             TEXT PRIMARY KEY,
+    description      TEXT NOT NULL DEFAULT '',
+    permissions_json TEXT NOT NULL DEFAULT '[]',
+    created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
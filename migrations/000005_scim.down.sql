@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_groups_external_id;
+DROP INDEX IF EXISTS idx_users_external_id;
+ALTER TABLE groups DROP COLUMN external_id;
+ALTER TABLE users DROP COLUMN active;
+ALTER TABLE users DROP COLUMN external_id;
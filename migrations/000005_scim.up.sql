@@ -0,0 +1,8 @@
+-- SCIM provisioning: identities owned by an external directory carry its ID,
+-- and deactivated users are kept (with their role assignments) but cannot sign in.
+ALTER TABLE users ADD COLUMN external_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE groups ADD COLUMN external_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_users_external_id ON users(external_id);
+CREATE INDEX IF NOT EXISTS idx_groups_external_id ON groups(external_id);
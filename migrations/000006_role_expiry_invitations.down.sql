@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS project_invitations;
+DROP INDEX IF EXISTS idx_project_roles_expires;
+ALTER TABLE project_roles DROP COLUMN expires_at;
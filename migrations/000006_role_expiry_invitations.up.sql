@@ -0,0 +1,18 @@
+ALTER TABLE project_roles ADD COLUMN expires_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_project_roles_expires ON project_roles(expires_at);
+
+-- Invitations grant a role to an email address that has no user yet. They are
+-- converted into project_roles rows when a user with that email is provisioned.
+CREATE TABLE IF NOT EXISTS project_invitations (
+    id              TEXT PRIMARY KEY,
+    project_id      TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    email           TEXT NOT NULL,
+    role            TEXT NOT NULL,
+    role_expires_at TIMESTAMP,
+    invited_by      TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (project_id, email)
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_invitations_email ON project_invitations(email);
@@ -0,0 +1,2 @@
+ALTER TABLE budgets DROP COLUMN period;
+ALTER TABLE budgets RENAME COLUMN amount TO monthly_limit;
@@ -0,0 +1,3 @@
+-- Budgets are no longer necessarily monthly: the limit applies to the budget's period.
+ALTER TABLE budgets RENAME COLUMN monthly_limit TO amount;
+ALTER TABLE budgets ADD COLUMN period TEXT NOT NULL DEFAULT 'monthly';
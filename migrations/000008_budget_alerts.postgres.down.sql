@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS budget_alert_states;
+-- A budget's warning threshold is its first tier below the exceeded tier;
+-- one with no such tier warns only once exceeded.
+ALTER TABLE budgets ADD COLUMN warn_threshold REAL NOT NULL DEFAULT 0.8;
+UPDATE budgets SET warn_threshold = COALESCE(
+    (SELECT t.value::real FROM jsonb_array_elements_text(budgets.thresholds_json::jsonb) WITH ORDINALITY AS t(value, i)
+     WHERE t.value::real < 1 ORDER BY t.i LIMIT 1), 1);
+ALTER TABLE budgets DROP COLUMN thresholds_json;
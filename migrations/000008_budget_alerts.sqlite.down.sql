@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS budget_alert_states;
+-- A budget's warning threshold is its first tier below the exceeded tier;
+-- one with no such tier warns only once exceeded.
+ALTER TABLE budgets ADD COLUMN warn_threshold REAL NOT NULL DEFAULT 0.8;
+UPDATE budgets SET warn_threshold = COALESCE(
+    (SELECT value FROM json_each(budgets.thresholds_json) WHERE value < 1 ORDER BY key LIMIT 1), 1);
+ALTER TABLE budgets DROP COLUMN thresholds_json;
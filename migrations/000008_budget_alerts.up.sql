@@ -0,0 +1,19 @@
+-- Budgets alert at each threshold tier they cross, as fractions of the amount.
+-- Existing budgets keep their single warning threshold plus the exceeded tier.
+ALTER TABLE budgets ADD COLUMN thresholds_json TEXT NOT NULL DEFAULT '[0.5,0.8,1,1.2]';
+UPDATE budgets SET thresholds_json = '[' || CAST(warn_threshold AS TEXT) || ',1]' WHERE warn_threshold > 0 AND warn_threshold < 1;
+UPDATE budgets SET thresholds_json = '[1]' WHERE warn_threshold <= 0 OR warn_threshold >= 1;
+ALTER TABLE budgets DROP COLUMN warn_threshold;
+
+-- One row per budget recording the highest tier already alerted on in the
+-- current period, so evaluations only emit events when the tier changes.
+CREATE TABLE IF NOT EXISTS budget_alert_states (
+    budget_id          TEXT PRIMARY KEY REFERENCES budgets(id) ON DELETE CASCADE,
+    period_start       TIMESTAMP NOT NULL,
+    state              TEXT NOT NULL DEFAULT 'ok',
+    tier               REAL NOT NULL DEFAULT 0,
+    acknowledged_tier  REAL NOT NULL DEFAULT 0,
+    acknowledged_by    TEXT NOT NULL DEFAULT '',
+    last_notified_at   TIMESTAMP,
+    updated_at         TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
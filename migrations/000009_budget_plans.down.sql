@@ -0,0 +1,2 @@
+ALTER TABLE budgets DROP COLUMN rollover;
+ALTER TABLE budgets DROP COLUMN plan_json;
@@ -0,0 +1,4 @@
+-- plan_json holds an explicit amount per period of the fiscal year; an empty
+-- plan means the flat amount applies to every period.
+ALTER TABLE budgets ADD COLUMN plan_json TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE budgets ADD COLUMN rollover BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_cost_records_service;
+
+ALTER TABLE budgets DROP COLUMN filter_json;
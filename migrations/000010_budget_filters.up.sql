@@ -0,0 +1,5 @@
+-- filter_json narrows a budget to cost records matching a models.CostFilter;
+-- the empty object matches everything.
+ALTER TABLE budgets ADD COLUMN filter_json TEXT NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_cost_records_service ON cost_records(service);
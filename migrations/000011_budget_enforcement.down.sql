@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS budget_enforcements;
+
+ALTER TABLE budgets DROP COLUMN enforcement_json;
@@ -0,0 +1,19 @@
+-- Opt-in Kubernetes actions taken when a budget is exceeded.
+ALTER TABLE budgets ADD COLUMN enforcement_json TEXT NOT NULL DEFAULT '[]';
+
+-- One row per enforcement action run. undo_json records the state the action
+-- replaced so it can be reverted; rows are kept after reverting as an audit trail.
+CREATE TABLE IF NOT EXISTS budget_enforcements (
+    id          TEXT PRIMARY KEY,
+    budget_id   TEXT NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+    project_id  TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    action_json TEXT NOT NULL,
+    status      TEXT NOT NULL,
+    undo_json   TEXT NOT NULL DEFAULT '',
+    error       TEXT NOT NULL DEFAULT '',
+    applied_at  TIMESTAMP NOT NULL,
+    reverted_at TIMESTAMP,
+    reverted_by TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_budget_enforcements_budget ON budget_enforcements(budget_id, applied_at);
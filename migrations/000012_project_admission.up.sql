@@ -0,0 +1,3 @@
+-- admission_mode controls whether the admission webhook warns about, denies
+-- or ignores workloads that would breach the project's budgets.
+ALTER TABLE projects ADD COLUMN admission_mode TEXT NOT NULL DEFAULT 'warn';
@@ -0,0 +1,15 @@
+-- Outbound notification channels, subscribed per project to event topics.
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id          TEXT PRIMARY KEY,
+    project_id  TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    type        TEXT NOT NULL,
+    name        TEXT NOT NULL,
+    config_json TEXT NOT NULL DEFAULT '{}',
+    topics_json TEXT NOT NULL DEFAULT '[]',
+    template    TEXT NOT NULL DEFAULT '',
+    enabled     BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_channels_project ON notification_channels(project_id);
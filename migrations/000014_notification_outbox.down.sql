@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS notification_delivery_attempts;
+DROP TABLE IF EXISTS notification_deliveries;
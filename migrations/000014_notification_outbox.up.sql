@@ -0,0 +1,32 @@
+-- Outbox of notification deliveries: one row per event and subscribed channel,
+-- written when the event is published and retried until delivered or dead.
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id              TEXT PRIMARY KEY,
+    channel_id      TEXT NOT NULL REFERENCES notification_channels(id) ON DELETE CASCADE,
+    project_id      TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    topic           TEXT NOT NULL,
+    event_json      TEXT NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error      TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMP NOT NULL,
+    delivered_at    TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_due ON notification_deliveries(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_channel ON notification_deliveries(channel_id, created_at);
+
+-- One row per delivery attempt, with the receiver's response.
+CREATE TABLE IF NOT EXISTS notification_delivery_attempts (
+    id           TEXT PRIMARY KEY,
+    delivery_id  TEXT NOT NULL REFERENCES notification_deliveries(id) ON DELETE CASCADE,
+    attempt      INTEGER NOT NULL,
+    status_code  INTEGER NOT NULL DEFAULT 0,
+    latency_ms   BIGINT NOT NULL DEFAULT 0,
+    response     TEXT NOT NULL DEFAULT '',
+    error        TEXT NOT NULL DEFAULT '',
+    attempted_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_delivery_attempts_delivery ON notification_delivery_attempts(delivery_id, attempted_at);
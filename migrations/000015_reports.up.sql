@@ -0,0 +1,20 @@
+-- Scheduled cost reports emailed per project.
+CREATE TABLE IF NOT EXISTS reports (
+    id              TEXT PRIMARY KEY,
+    project_id      TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name            TEXT NOT NULL,
+    schedule        TEXT NOT NULL,
+    timezone        TEXT NOT NULL DEFAULT 'UTC',
+    recipients_json TEXT NOT NULL DEFAULT '[]',
+    format          TEXT NOT NULL DEFAULT 'html',
+    filter_json     TEXT NOT NULL DEFAULT '{}',
+    enabled         BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at     TIMESTAMP,
+    last_run_at     TIMESTAMP,
+    last_error      TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMP NOT NULL,
+    updated_at      TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_reports_project ON reports(project_id);
+CREATE INDEX IF NOT EXISTS idx_reports_due ON reports(enabled, next_run_at);
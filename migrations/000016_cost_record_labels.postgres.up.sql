@@ -0,0 +1,16 @@
+-- One row per label of a cost record, so label filters use an index instead
+-- of parsing labels_json. labels_json stays the record's source of truth;
+-- records inserted before this table existed are backfilled from it below.
+CREATE TABLE IF NOT EXISTS cost_record_labels (
+    record_id  TEXT NOT NULL REFERENCES cost_records(id) ON DELETE CASCADE,
+    project_id TEXT NOT NULL,
+    key        TEXT NOT NULL,
+    value      TEXT NOT NULL,
+    PRIMARY KEY (record_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_cost_record_labels_key ON cost_record_labels(key, value, record_id);
+CREATE INDEX IF NOT EXISTS idx_cost_record_labels_project ON cost_record_labels(project_id, key, value);
+
+INSERT INTO cost_record_labels (record_id, project_id, key, value)
+SELECT c.id, c.project_id, j.key, j.value FROM cost_records c, jsonb_each_text(c.labels_json::jsonb) j WHERE c.labels_json <> '{}';
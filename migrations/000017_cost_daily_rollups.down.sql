@@ -0,0 +1 @@
+DROP TABLE IF EXISTS cost_daily_rollups;
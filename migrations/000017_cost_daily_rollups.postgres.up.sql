@@ -0,0 +1,34 @@
+-- Daily totals of cost records, kept up to date by InsertCostRecords so that
+-- summaries at day granularity or coarser skip the raw rows. A record counts
+-- towards the UTC day its start time falls in; last_day is the UTC day its
+-- end time reaches, so range filters on rollups select exactly the records a
+-- filter on start_time and end_time would. Existing records are rolled up
+-- below.
+CREATE TABLE IF NOT EXISTS cost_daily_rollups (
+    project_id         TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    cost_source_id     TEXT NOT NULL REFERENCES cost_sources(id) ON DELETE CASCADE,
+    provider           TEXT NOT NULL,
+    service            TEXT NOT NULL,
+    category           TEXT NOT NULL,
+    region             TEXT NOT NULL,
+    account_id         TEXT NOT NULL,
+    day                TEXT NOT NULL,
+    last_day           TEXT NOT NULL,
+    list_cost          DOUBLE PRECISION NOT NULL DEFAULT 0,
+    net_cost           DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amortized_cost     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amortized_net_cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+    record_count       INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (project_id, cost_source_id, provider, service, category, region, account_id, day, last_day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_cost_daily_rollups_day ON cost_daily_rollups(project_id, day);
+
+INSERT INTO cost_daily_rollups (project_id, cost_source_id, provider, service, category, region, account_id, day, last_day,
+    list_cost, net_cost, amortized_cost, amortized_net_cost, record_count)
+SELECT project_id, cost_source_id, provider, service, category, region, account_id,
+       to_char(start_time, 'YYYY-MM-DD'),
+       to_char(GREATEST(end_time - INTERVAL '1 microsecond', start_time), 'YYYY-MM-DD'),
+       SUM(list_cost), SUM(net_cost), SUM(amortized_cost), SUM(amortized_net_cost), COUNT(*)
+FROM cost_records
+GROUP BY 1, 2, 3, 4, 5, 6, 7, 8, 9;
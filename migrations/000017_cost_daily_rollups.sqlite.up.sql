@@ -0,0 +1,39 @@
+-- Daily totals of cost records, kept up to date by InsertCostRecords so that
+-- summaries at day granularity or coarser skip the raw rows. A record counts
+-- towards the UTC day its start time falls in; last_day is the UTC day its
+-- end time reaches, so range filters on rollups select exactly the records a
+-- filter on start_time and end_time would. Existing records are rolled up
+-- below.
+CREATE TABLE IF NOT EXISTS cost_daily_rollups (
+    project_id         TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    cost_source_id     TEXT NOT NULL REFERENCES cost_sources(id) ON DELETE CASCADE,
+    provider           TEXT NOT NULL,
+    service            TEXT NOT NULL,
+    category           TEXT NOT NULL,
+    region             TEXT NOT NULL,
+    account_id         TEXT NOT NULL,
+    day                TEXT NOT NULL,
+    last_day           TEXT NOT NULL,
+    list_cost          DOUBLE PRECISION NOT NULL DEFAULT 0,
+    net_cost           DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amortized_cost     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amortized_net_cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+    record_count       INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (project_id, cost_source_id, provider, service, category, region, account_id, day, last_day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_cost_daily_rollups_day ON cost_daily_rollups(project_id, day);
+
+-- Timestamps are stored as text in UTC that starts with the date, such as
+-- '2026-03-04 00:00:00 +0000 UTC'. A record ending exactly at midnight, whose
+-- time of day is all zeros, last reaches the day before.
+INSERT INTO cost_daily_rollups (project_id, cost_source_id, provider, service, category, region, account_id, day, last_day,
+    list_cost, net_cost, amortized_cost, amortized_net_cost, record_count)
+SELECT project_id, cost_source_id, provider, service, category, region, account_id,
+       substr(start_time, 1, 10),
+       max(substr(start_time, 1, 10),
+           CASE WHEN rtrim(substr(end_time, 12), '0:.+ UTCZ') = '' THEN date(substr(end_time, 1, 10), '-1 day')
+                ELSE substr(end_time, 1, 10) END),
+       SUM(list_cost), SUM(net_cost), SUM(amortized_cost), SUM(amortized_net_cost), COUNT(*)
+FROM cost_records
+GROUP BY 1, 2, 3, 4, 5, 6, 7, 8, 9;
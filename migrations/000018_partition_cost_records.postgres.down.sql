@@ -0,0 +1,26 @@
+-- Turn the partitioned cost_records back into a flat table. Partitions that
+-- were detached for archival are not part of it and stay as they are.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = to_regclass('cost_records')) THEN
+        RETURN;
+    END IF;
+
+    CREATE TABLE cost_records_flat (LIKE cost_records INCLUDING DEFAULTS INCLUDING CONSTRAINTS);
+    INSERT INTO cost_records_flat SELECT * FROM cost_records;
+    DROP TABLE cost_records;
+    ALTER TABLE cost_records_flat RENAME TO cost_records;
+    ALTER TABLE cost_records
+        ADD PRIMARY KEY (id),
+        ADD FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+        ADD FOREIGN KEY (cost_source_id) REFERENCES cost_sources(id) ON DELETE CASCADE;
+
+    CREATE INDEX idx_cost_records_project ON cost_records(project_id);
+    CREATE INDEX idx_cost_records_source ON cost_records(cost_source_id);
+    CREATE INDEX idx_cost_records_time ON cost_records(start_time, end_time);
+    CREATE INDEX idx_cost_records_provider ON cost_records(provider);
+    CREATE INDEX idx_cost_records_service ON cost_records(service);
+
+    DELETE FROM cost_record_labels WHERE record_id NOT IN (SELECT id FROM cost_records);
+    ALTER TABLE cost_record_labels ADD FOREIGN KEY (record_id) REFERENCES cost_records(id) ON DELETE CASCADE;
+END $$;
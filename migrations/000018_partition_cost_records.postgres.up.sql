@@ -0,0 +1,48 @@
+-- Range-partition cost_records by month on start_time, one partition per UTC
+-- month named cost_records_pYYYYMM, copying existing rows into the partitions
+-- of their months. Partitions for new months are created by the store.
+--
+-- A partitioned table's primary key must include the partition key, so the
+-- key becomes (id, start_time), and cost_record_labels loses its foreign key
+-- to cost_records; the store deletes labels together with their records.
+-- A table that is already partitioned is left alone.
+DO $$
+DECLARE
+    part_month TIMESTAMP;
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = to_regclass('cost_records')) THEN
+        RETURN;
+    END IF;
+
+    ALTER TABLE cost_record_labels DROP CONSTRAINT IF EXISTS cost_record_labels_record_id_fkey;
+    ALTER TABLE cost_records RENAME TO cost_records_unpartitioned;
+    ALTER TABLE cost_records_unpartitioned RENAME CONSTRAINT cost_records_pkey TO cost_records_unpartitioned_pkey;
+    DROP INDEX IF EXISTS idx_cost_records_project, idx_cost_records_source, idx_cost_records_time, idx_cost_records_provider, idx_cost_records_service;
+
+    CREATE TABLE cost_records (
+        LIKE cost_records_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS,
+        PRIMARY KEY (id, start_time),
+        FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+        FOREIGN KEY (cost_source_id) REFERENCES cost_sources(id) ON DELETE CASCADE
+    ) PARTITION BY RANGE (start_time);
+
+    CREATE INDEX idx_cost_records_project ON cost_records(project_id);
+    CREATE INDEX idx_cost_records_source ON cost_records(cost_source_id);
+    CREATE INDEX idx_cost_records_time ON cost_records(start_time, end_time);
+    CREATE INDEX idx_cost_records_provider ON cost_records(provider);
+    CREATE INDEX idx_cost_records_service ON cost_records(service);
+
+    FOR part_month IN
+        SELECT generate_series(r.lo, r.hi, INTERVAL '1 month')
+        FROM (
+            SELECT date_trunc('month', MIN(start_time)) AS lo, date_trunc('month', MAX(start_time)) AS hi
+            FROM cost_records_unpartitioned
+        ) r
+    LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF cost_records FOR VALUES FROM (%L) TO (%L)',
+            'cost_records_p' || to_char(part_month, 'YYYYMM'), part_month, part_month + INTERVAL '1 month');
+    END LOOP;
+
+    INSERT INTO cost_records SELECT * FROM cost_records_unpartitioned;
+    DROP TABLE cost_records_unpartitioned;
+END $$;
@@ -0,0 +1,292 @@
+package migrations_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/store"
+	"github.com/inelson/finguard/migrations"
+)
+
+func newStore(t *testing.T) *store.SQLStore {
+	t.Helper()
+	s, err := store.New("sqlite://" + filepath.Join(t.TempDir(), "finguard.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// withFiles returns the embedded migrations plus files.
+func withFiles(t *testing.T, files map[string]string) fs.FS {
+	t.Helper()
+	fsys := fstest.MapFS{}
+	entries, err := fs.ReadDir(migrations.FS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		data, err := fs.ReadFile(migrations.FS, e.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsys[e.Name()] = &fstest.MapFile{Data: data}
+	}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	return fsys
+}
+
+func version(t *testing.T, s *store.SQLStore, fsys fs.FS) *store.MigrationStatus {
+	t.Helper()
+	status, err := s.MigrationStatus(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestMigrations_UpAndDown(t *testing.T) {
+	s := newStore(t)
+	if err := s.Migrate(migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+	status := version(t, s, migrations.FS)
+	if status.Version != status.Latest || status.Dirty {
+		t.Fatalf("after migrating: %+v, want clean at the latest version", status)
+	}
+	for _, m := range status.Migrations {
+		if !m.Applied || !m.Reversible {
+			t.Errorf("migration %d: %+v, want applied and reversible", m.Version, m)
+		}
+	}
+
+	// Every down file reverts its up file, so the whole chain can be walked
+	// down and up again.
+	if err := s.MigrateDown(migrations.FS, 15); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(t, s, migrations.FS).Version; v != 15 {
+		t.Errorf("after migrating down to 15: version %d", v)
+	}
+	if err := s.MigrateDown(migrations.FS, 0); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(t, s, migrations.FS).Version; v != 0 {
+		t.Errorf("after migrating down to 0: version %d", v)
+	}
+	if err := s.MigrateUp(migrations.FS, 3); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(t, s, migrations.FS).Version; v != 3 {
+		t.Errorf("after migrating up to 3: version %d", v)
+	}
+	if err := s.Migrate(migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MigrateDown(migrations.FS, status.Latest+1); err == nil {
+		t.Error("migrating down to a version above the current one: expected an error")
+	}
+}
+
+func TestMigrations_BudgetAlertsDownKeepsWarnThreshold(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "finguard.db")
+	s, err := store.New("sqlite://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Migrate(migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	p := &models.Project{Name: "payments"}
+	if err := s.CreateProject(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	tiered := &models.Budget{ProjectID: p.ID, Amount: 100, Thresholds: []float64{0.6, 0.9, 1, 1.2}}
+	exceededOnly := &models.Budget{ProjectID: p.ID, Amount: 100, Thresholds: []float64{1}}
+	for _, b := range []*models.Budget{tiered, exceededOnly} {
+		if err := s.CreateBudget(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.MigrateDown(migrations.FS, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for id, want := range map[string]float64{tiered.ID: 0.6, exceededOnly.ID: 1} {
+		var got float64
+		if err := db.QueryRow(`SELECT warn_threshold FROM budgets WHERE id = ?`, id).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("budget %s: warn_threshold %v after migrating down, want %v", id, got, want)
+		}
+	}
+}
+
+func TestMigrations_Dirty(t *testing.T) {
+	s := newStore(t)
+	latest := version(t, s, migrations.FS).Latest
+	broken := withFiles(t, map[string]string{
+		"000099_broken.up.sql": "CREATE TABLE broken (id TEXT PRIMARY KEY); CREATE TABLE (",
+	})
+	if err := s.Migrate(broken); err == nil {
+		t.Fatal("expected the broken migration to fail")
+	}
+	if status := version(t, s, broken); status.Version != 99 || !status.Dirty {
+		t.Fatalf("after the failure: %+v, want dirty at 99", status)
+	}
+	// The failed migration's transaction rolled back, but nothing runs until
+	// the database is forced clean.
+	if err := s.Migrate(migrations.FS); !errors.Is(err, store.ErrDirty) {
+		t.Fatalf("migrating a dirty database: got %v, want ErrDirty", err)
+	}
+	if err := s.MigrateDown(migrations.FS, 0); !errors.Is(err, store.ErrDirty) {
+		t.Fatalf("migrating a dirty database down: got %v, want ErrDirty", err)
+	}
+	if err := s.ForceMigrationVersion(latest); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Migrate(migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+	if status := version(t, s, migrations.FS); status.Version != latest || status.Dirty {
+		t.Errorf("after forcing: %+v, want clean at %d", status, latest)
+	}
+}
+
+func TestMigrations_DialectVariants(t *testing.T) {
+	s := newStore(t)
+	fsys := withFiles(t, map[string]string{
+		"000090_variant.sqlite.up.sql":     "CREATE TABLE variant_sqlite (id TEXT);",
+		"000090_variant.sqlite.down.sql":   "DROP TABLE variant_sqlite;",
+		"000090_variant.postgres.up.sql":   "CREATE TABLE variant_postgres (id TEXT) WITH (fillfactor = 90);",
+		"000090_variant.postgres.down.sql": "DROP TABLE variant_postgres;",
+		// Only Postgres has anything to do: SQLite records the version.
+		"000091_postgres_only.postgres.up.sql": "CREATE EXTENSION IF NOT EXISTS pg_trgm;",
+	})
+	if err := s.Migrate(fsys); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(t, s, fsys).Version; v != 91 {
+		t.Errorf("version %d, want 91", v)
+	}
+	if err := s.MigrateDown(fsys, 89); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MigrateUp(fsys, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMigrations_Backfill checks that the label index and rollup migrations
+// build the same rows from existing records as ingest does.
+func TestMigrations_Backfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "finguard.db")
+	s, err := store.New("sqlite://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Migrate(migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	p := &models.Project{Name: "payments"}
+	if err := s.CreateProject(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	cs := &models.CostSource{ProjectID: p.ID, Type: models.CostSourceKubernetes, Name: "k8s", Enabled: true}
+	if err := s.CreateCostSource(ctx, cs); err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2026, time.March, 3, 0, 0, 0, 0, time.UTC)
+	record := func(start, end time.Time, labels map[string]string) *models.CostRecord {
+		return &models.CostRecord{
+			ProjectID: p.ID, CostSourceID: cs.ID, Provider: "kubernetes", Service: "compute",
+			Labels: labels, StartTime: start, EndTime: end, ListCost: 2, NetCost: 1.5,
+		}
+	}
+	records := []*models.CostRecord{
+		record(day, day.Add(time.Hour), map[string]string{"namespace": "team-a", "app": "api"}),
+		record(day.Add(time.Hour), day.Add(2*time.Hour), map[string]string{"namespace": "team-a"}),
+		// Ends at midnight, so it does not reach the next day.
+		record(day.Add(22*time.Hour+500*time.Millisecond), day.AddDate(0, 0, 1), nil),
+		// Reaches into the next day by a fraction of a second.
+		record(day.Add(23*time.Hour), day.AddDate(0, 0, 1).Add(time.Millisecond), nil),
+		record(day.Add(5*time.Hour), day.Add(5*time.Hour), map[string]string{"namespace": "team-b"}),
+		record(day.AddDate(0, 0, 1), day.AddDate(0, 0, 3), nil),
+	}
+	if err := s.InsertCostRecords(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	dump := func(query string) []string {
+		t.Helper()
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		cols, _ := rows.Columns()
+		var out []string
+		for rows.Next() {
+			values := make([]any, len(cols))
+			ptrs := make([]any, len(cols))
+			for i := range values {
+				ptrs[i] = &values[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, fmt.Sprintf("%v", values))
+		}
+		return out
+	}
+	const (
+		labelsQuery  = `SELECT record_id, project_id, key, value FROM cost_record_labels ORDER BY record_id, key`
+		rollupsQuery = `SELECT cost_source_id, day, last_day, list_cost, net_cost, record_count FROM cost_daily_rollups ORDER BY day, last_day`
+	)
+	labels, rollups := dump(labelsQuery), dump(rollupsQuery)
+	if len(labels) != 4 || len(rollups) != 3 {
+		t.Fatalf("expected 4 labels and 3 rollups from ingest, got %v and %v", labels, rollups)
+	}
+
+	if err := s.MigrateDown(migrations.FS, 15); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Migrate(migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+	if got := dump(labelsQuery); !slices.Equal(got, labels) {
+		t.Errorf("backfilled labels:\n%v\nwant\n%v", got, labels)
+	}
+	if got := dump(rollupsQuery); !slices.Equal(got, rollups) {
+		t.Errorf("backfilled rollups:\n%v\nwant\n%v", got, rollups)
+	}
+}
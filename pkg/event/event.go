@@ -28,11 +28,15 @@ func New(eventType, topic, source string, payload any) (*Event, error) {
 }
 
 const (
-	TopicCostAllocation = "cost.allocation"
-	TopicCostIdle       = "cost.idle.detected"
-	TopicBudgetWarning  = "budget.warning"
-	TopicBudgetExceeded = "budget.exceeded"
-	TopicClusterChange  = "cluster.change"
-	TopicPluginStatus   = "plugin.status"
-	TopicSystem         = "system"
+	TopicCostAllocation     = "cost.allocation"
+	TopicCostIdle           = "cost.idle.detected"
+	TopicBudgetWarning      = "budget.warning"
+	TopicBudgetExceeded     = "budget.exceeded"
+	TopicBudgetResolved     = "budget.resolved"
+	TopicCollectionComplete = "collection.complete"
+	TopicCollectionFailed   = "collection.failed"
+	TopicClusterChange      = "cluster.change"
+	TopicPluginStatus       = "plugin.status"
+	TopicMembership         = "project.membership"
+	TopicSystem             = "system"
 )
@@ -18,10 +18,14 @@ type Plugin struct {
 	httpClient  *http.Client
 	events      chan *pluginpkg.Event
 	logger      *slog.Logger
+	owners      NamespaceOwners
 	mu          sync.RWMutex
 	recommendations []Recommendation
 }
 
+// NamespaceOwners returns the IDs of the projects owning each namespace.
+type NamespaceOwners func(ctx context.Context) (map[string][]string, error)
+
 type Recommendation struct {
 	Namespace    string  `json:"namespace"`
 	Pod          string  `json:"pod"`
@@ -33,11 +37,15 @@ type Recommendation struct {
 	Severity     string  `json:"severity"`
 }
 
-func New(logger *slog.Logger) *Plugin {
+// New returns the plugin. owners, if not nil, attributes each namespace's
+// recommendations to the projects owning it, so that cost.idle.detected
+// events carry the projectId notification channels are matched on.
+func New(logger *slog.Logger, owners NamespaceOwners) *Plugin {
 	return &Plugin{
 		httpClient: &http.Client{Timeout: 15 * time.Second},
 		events:     make(chan *pluginpkg.Event, 100),
 		logger:     logger,
+		owners:     owners,
 	}
 }
 
@@ -161,10 +169,40 @@ func (p *Plugin) detectIdle(ctx context.Context) {
 	p.mu.Unlock()
 
 	if len(recs) > 0 {
-		payload, _ := json.Marshal(map[string]any{
+		p.publishIdle(ctx, recs)
+	}
+}
+
+// publishIdle publishes the recommendations in one cost.idle.detected event
+// per project owning their namespaces, and those of namespaces no project
+// owns in one event without a projectId.
+func (p *Plugin) publishIdle(ctx context.Context, recs []Recommendation) {
+	var owners map[string][]string
+	if p.owners != nil {
+		var err error
+		if owners, err = p.owners(ctx); err != nil {
+			p.logger.Warn("costbreakdown: failed to look up namespace owners", "error", err)
+		}
+	}
+	byProject := make(map[string][]Recommendation)
+	for _, rec := range recs {
+		projects := owners[rec.Namespace]
+		if len(projects) == 0 {
+			projects = []string{""}
+		}
+		for _, id := range projects {
+			byProject[id] = append(byProject[id], rec)
+		}
+	}
+	for projectID, recs := range byProject {
+		fields := map[string]any{
 			"count":           len(recs),
 			"recommendations": recs,
-		})
+		}
+		if projectID != "" {
+			fields["projectId"] = projectID
+		}
+		payload, _ := json.Marshal(fields)
 		select {
 		case p.events <- &pluginpkg.Event{
 			Type:      "idle_detected",
@@ -0,0 +1,93 @@
+package costbreakdown
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	collectork8s "github.com/inelson/finguard/internal/collector/kubernetes"
+	"github.com/inelson/finguard/internal/models"
+	"github.com/inelson/finguard/internal/notify"
+	pluginmgr "github.com/inelson/finguard/internal/plugin"
+	"github.com/inelson/finguard/internal/store/storetest"
+	"github.com/inelson/finguard/internal/stream"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+// TestIdleDetected_DeliveredToOwningProject runs the plugin against a fake
+// OpenCost and checks that its event reaches the channel of the project
+// whose Kubernetes source lists the idle namespace.
+func TestIdleDetected_DeliveredToOwningProject(t *testing.T) {
+	st := storetest.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	logger := testLogger()
+
+	project := &models.Project{Name: "payments"}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	source := &models.CostSource{ProjectID: project.ID, Type: models.CostSourceKubernetes, Name: "k8s", Enabled: true,
+		Config: json.RawMessage(`{"clusterName":"dev","opencostUrl":"http://opencost","namespaces":["team-a"]}`)}
+	if err := st.CreateCostSource(ctx, source); err != nil {
+		t.Fatal(err)
+	}
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hook.Close()
+	channel := &models.NotificationChannel{ProjectID: project.ID, Type: models.ChannelWebhook, Name: "hook", Enabled: true,
+		Config: json.RawMessage(`{"url":"` + hook.URL + `","secret":"s"}`), Topics: []string{"cost.idle.detected"}}
+	if err := st.CreateNotificationChannel(ctx, channel); err != nil {
+		t.Fatal(err)
+	}
+
+	opencost := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":200,"data":[{
+			"team-a":{"name":"team-a","cpuCoreRequestAverage":4,"cpuCoreUsageAverage":0.1,"totalCost":100},
+			"team-z":{"name":"team-z","cpuCoreRequestAverage":4,"cpuCoreUsageAverage":0.1,"totalCost":100}
+		}]}`))
+	}))
+	defer opencost.Close()
+
+	hub := stream.NewHub(logger)
+	notifier := notify.New(st, notify.Config{MaxAttempts: 1, RetryBackoff: time.Second}, logger)
+	hub.AddSink(notifier.Enqueue)
+	go notifier.Start(ctx)
+	mgr := pluginmgr.NewManager(hub, logger)
+	p := New(logger, func(ctx context.Context) (map[string][]string, error) {
+		return collectork8s.NamespaceOwners(ctx, st)
+	})
+	if err := mgr.Register(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.InitializeAll(ctx, opencost.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	var deliveries []*models.NotificationDelivery
+	for ctx.Err() == nil {
+		var err error
+		if deliveries, err = st.ListNotificationDeliveries(ctx, channel.ID, 10); err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("expected one delivery for the project, got %d", len(deliveries))
+	}
+	event := string(deliveries[0].Event)
+	if !strings.Contains(event, "team-a") || strings.Contains(event, "team-z") {
+		t.Errorf("expected only the project's namespace in the delivered event, got %s", event)
+	}
+}